@@ -57,7 +57,10 @@ type AnalyzeArgs struct {
 	TargetPodPath string
 
 	// synthetic probe
-	ProbePath string
+	ProbePath         string
+	SimulatedReplicas int
+	PodCIDRs          []string
+	ServiceCIDRs      []string
 }
 
 func SetupAnalyzeCommand() *cobra.Command {
@@ -75,7 +78,7 @@ func SetupAnalyzeCommand() *cobra.Command {
 	command.Flags().BoolVar(&args.UseExamplePolicies, "use-example-policies", false, "if true, reads example policies")
 	command.Flags().BoolVarP(&args.AllNamespaces, "all-namespaces", "A", false, "reads kube resources from all namespaces; same as kubectl's '--all-namespaces'/'-A' flag")
 	command.Flags().StringSliceVarP(&args.Namespaces, "namespace", "n", []string{}, "namespaces to read kube resources from; similar to kubectl's '--namespace'/'-n' flag, except that multiple namespaces may be passed in and is empty if not set explicitly (instead of 'default' as in kubectl)")
-	command.Flags().StringVar(&args.PolicyPath, "policy-path", "", "may be a file or a directory; if set, will attempt to read policies from the path")
+	command.Flags().StringVar(&args.PolicyPath, "policy-path", "", "may be a file, a directory, or '-' for stdin; if set, will attempt to read policies -- plus pods and namespaces -- from the manifests at the path")
 	command.Flags().StringVar(&args.Context, "context", "", "selects kube context to read policies from; only reads from kube if one or more namespaces or all namespaces are specified")
 	command.Flags().BoolVar(&args.SimplifyPolicies, "simplify-policies", true, "if true, reduce policies to simpler form while preserving semantics")
 
@@ -84,6 +87,9 @@ func SetupAnalyzeCommand() *cobra.Command {
 	command.Flags().StringVar(&args.TargetPodPath, "target-pod-path", "", "path to json target pod file -- json array of dicts")
 	command.Flags().StringVar(&args.TrafficPath, "traffic-path", "", "path to json traffic file, containing of a list of traffic objects")
 	command.Flags().StringVar(&args.ProbePath, "probe-path", "", "path to json model file for synthetic probe")
+	command.Flags().StringSliceVar(&args.PodCIDRs, "pod-cidr", probe.DefaultPodCIDRs, "cidrs from which to assign simulated pod ips, for pods without ips; pass one v4 and one v6 cidr for dual-stack")
+	command.Flags().StringSliceVar(&args.ServiceCIDRs, "service-cidr", probe.DefaultServiceCIDRs, "cidrs from which to assign simulated service ips, for pods without service ips; pass one v4 and one v6 cidr for dual-stack")
+	command.Flags().IntVar(&args.SimulatedReplicas, "replicas", 1, "number of simulated pods to create for each workload (Deployment, StatefulSet, DaemonSet, Job) read from --policy-path; if 0, use the workload's replicas or parallelism")
 
 	return command
 }
@@ -113,11 +119,13 @@ func RunAnalyzeCommand(args *AnalyzeArgs) {
 			logrus.Errorf("unable to read pods from kube, ns '%s': %+v", namespaces, err)
 		}
 	}
-	// 2. read policies from file
+	// 2. read policies -- and pods and namespaces, as inventory -- from file
 	if args.PolicyPath != "" {
-		policiesFromPath, err := kube.ReadNetworkPoliciesFromPath(args.PolicyPath)
+		manifests, err := kube.ReadManifestsFromPath(args.PolicyPath)
 		utils.DoOrDie(err)
-		kubePolicies = append(kubePolicies, policiesFromPath...)
+		kubePolicies = append(kubePolicies, manifests.Policies...)
+		kubePods = append(kubePods, manifests.ExpandPods(args.SimulatedReplicas)...)
+		kubeNamespaces = append(kubeNamespaces, manifests.ExpandNamespaces()...)
 	}
 	// 3. read example policies
 	if args.UseExamplePolicies {
@@ -125,7 +133,8 @@ func RunAnalyzeCommand(args *AnalyzeArgs) {
 	}
 
 	logrus.Debugf("parsed policies:\n%s", json.MustMarshalToString(kubePolicies))
-	policies := matcher.BuildNetworkPolicies(args.SimplifyPolicies, kubePolicies)
+	policies, err := matcher.BuildNetworkPolicies(args.SimplifyPolicies, kubePolicies)
+	utils.DoOrDie(err)
 
 	for _, mode := range args.Modes {
 		switch mode {
@@ -153,7 +162,9 @@ func RunAnalyzeCommand(args *AnalyzeArgs) {
 			QueryTraffic(policies, args.TrafficPath)
 		case ProbeMode:
 			fmt.Println("probe:")
-			ProbeSyntheticConnectivity(policies, args.ProbePath, kubePods, kubeNamespaces)
+			ipam, err := probe.NewIPAM(args.PodCIDRs, args.ServiceCIDRs)
+			utils.DoOrDie(err)
+			ProbeSyntheticConnectivity(policies, args.ProbePath, kubePods, kubeNamespaces, ipam)
 		default:
 			panic(errors.Errorf("unrecognized mode %s", mode))
 		}
@@ -169,7 +180,8 @@ func ExplainPolicies(explainedPolicies *matcher.Policy) {
 }
 
 func Lint(kubePolicies []*networkingv1.NetworkPolicy) {
-	warnings := linter.Lint(kubePolicies, set.FromSlice[linter.Check](nil))
+	warnings, err := linter.Lint(kubePolicies, set.FromSlice[linter.Check](nil))
+	utils.DoOrDie(err)
 	fmt.Println(linter.WarningsTable(warnings))
 }
 
@@ -191,18 +203,25 @@ func QueryTargets(explainedPolicies *matcher.Policy, podPath string, pods []*Que
 	for _, pod := range pods {
 		fmt.Printf("pod in ns %s with labels %+v:\n\n", pod.Namespace, pod.Labels)
 
-		targets, combinedRules := QueryTargetHelper(explainedPolicies, pod)
+		targets, combinedRules, err := QueryTargetHelper(explainedPolicies, pod)
+		utils.DoOrDie(err)
 
 		fmt.Printf("Matching targets:\n%s\n", targets.ExplainTable())
 		fmt.Printf("Combined rules:\n%s\n\n\n", combinedRules.ExplainTable())
 	}
 }
 
-func QueryTargetHelper(policies *matcher.Policy, pod *QueryTargetPod) (*matcher.Policy, *matcher.Policy) {
-	ingressTargets := policies.TargetsApplyingToPod(true, pod.Namespace, pod.Labels)
+func QueryTargetHelper(policies *matcher.Policy, pod *QueryTargetPod) (*matcher.Policy, *matcher.Policy, error) {
+	ingressTargets, err := policies.TargetsApplyingToPod(true, pod.Namespace, pod.Labels)
+	if err != nil {
+		return nil, nil, err
+	}
 	combinedIngressTarget := matcher.CombineTargetsIgnoringPrimaryKey(pod.Namespace, metav1.LabelSelector{MatchLabels: pod.Labels}, ingressTargets)
 
-	egressTargets := policies.TargetsApplyingToPod(false, pod.Namespace, pod.Labels)
+	egressTargets, err := policies.TargetsApplyingToPod(false, pod.Namespace, pod.Labels)
+	if err != nil {
+		return nil, nil, err
+	}
 	combinedEgressTarget := matcher.CombineTargetsIgnoringPrimaryKey(pod.Namespace, metav1.LabelSelector{MatchLabels: pod.Labels}, egressTargets)
 
 	var combinedIngresses []*matcher.Target
@@ -214,7 +233,7 @@ func QueryTargetHelper(policies *matcher.Policy, pod *QueryTargetPod) (*matcher.
 		combinedEgresses = []*matcher.Target{combinedEgressTarget}
 	}
 
-	return matcher.NewPolicyWithTargets(ingressTargets, egressTargets), matcher.NewPolicyWithTargets(combinedIngresses, combinedEgresses)
+	return matcher.NewPolicyWithTargets(ingressTargets, egressTargets), matcher.NewPolicyWithTargets(combinedIngresses, combinedEgresses), nil
 }
 
 func QueryTraffic(explainedPolicies *matcher.Policy, trafficPath string) {
@@ -227,7 +246,11 @@ func QueryTraffic(explainedPolicies *matcher.Policy, trafficPath string) {
 	for _, traffic := range *allTraffics {
 		fmt.Printf("Traffic:\n%s\n", traffic.Table())
 
-		result := explainedPolicies.IsTrafficAllowed(traffic)
+		result, err := explainedPolicies.IsTrafficAllowed(traffic)
+		if err != nil {
+			fmt.Printf("Unable to determine whether traffic is allowed: %+v\n\n\n", err)
+			continue
+		}
 		fmt.Printf("Is traffic allowed?\n%s\n\n\n", result.Table())
 	}
 }
@@ -237,17 +260,19 @@ type SyntheticProbeConnectivityConfig struct {
 	Probes    []*generator.PortProtocol
 }
 
-func ProbeSyntheticConnectivity(explainedPolicies *matcher.Policy, modelPath string, kubePods []v1.Pod, kubeNamespaces []v1.Namespace) {
+func ProbeSyntheticConnectivity(explainedPolicies *matcher.Policy, modelPath string, kubePods []v1.Pod, kubeNamespaces []v1.Namespace, ipam *probe.IPAM) {
 	if modelPath != "" {
 		config, err := json.ParseFile[SyntheticProbeConnectivityConfig](modelPath)
 		utils.DoOrDie(err)
 
 		jobBuilder := &probe.JobBuilder{TimeoutSeconds: 10}
+		modelResources, err := config.Resources.AssignIPs(ipam)
+		utils.DoOrDie(err)
 
 		// run probes
 		for _, probeConfig := range config.Probes {
 			probeResult := probe.NewSimulatedRunner(explainedPolicies, jobBuilder).
-				RunProbeForConfig(generator.NewProbeConfig(probeConfig.Port, probeConfig.Protocol, generator.ProbeModeServiceName), config.Resources)
+				RunProbeForConfig(generator.NewProbeConfig(probeConfig.Port, probeConfig.Protocol, generator.ProbeModeServiceName), modelResources)
 
 			logrus.Infof("probe on port %s, protocol %s", probeConfig.Port.String(), probeConfig.Protocol)
 
@@ -259,44 +284,8 @@ func ProbeSyntheticConnectivity(explainedPolicies *matcher.Policy, modelPath str
 		}
 	}
 
-	resources := &probe.Resources{
-		Namespaces: map[string]map[string]string{},
-		Pods:       []*probe.Pod{},
-	}
-
-	nsMap := map[string]v1.Namespace{}
-	for _, ns := range kubeNamespaces {
-		nsMap[ns.Name] = ns
-		resources.Namespaces[ns.Name] = ns.Labels
-	}
-
-	for _, pod := range kubePods {
-		var containers []*probe.Container
-		for _, cont := range pod.Spec.Containers {
-			if len(cont.Ports) == 0 {
-				logrus.Warnf("skipping container %s/%s/%s, no ports available", pod.Namespace, pod.Name, cont.Name)
-				continue
-			}
-			port := cont.Ports[0]
-			containers = append(containers, &probe.Container{
-				Name:     cont.Name,
-				Port:     int(port.ContainerPort),
-				Protocol: port.Protocol,
-				PortName: port.Name,
-			})
-		}
-		if len(containers) == 0 {
-			logrus.Warnf("skipping pod %s/%s, no containers available", pod.Namespace, pod.Name)
-			continue
-		}
-		resources.Pods = append(resources.Pods, &probe.Pod{
-			Namespace:  pod.Namespace,
-			Name:       pod.Name,
-			Labels:     pod.Labels,
-			IP:         pod.Status.PodIP,
-			Containers: containers,
-		})
-	}
+	resources, err := probe.NewResourcesFromKubePods(kubePods, kubeNamespaces).AssignIPs(ipam)
+	utils.DoOrDie(err)
 
 	simRunner := probe.NewSimulatedRunner(explainedPolicies, &probe.JobBuilder{TimeoutSeconds: 10})
 	simulatedProbe := simRunner.RunProbeForConfig(generator.ProbeAllAvailable, resources)
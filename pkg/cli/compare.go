@@ -1,14 +1,39 @@
 package cli
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/mattfenwick/collections/pkg/json"
+	"github.com/mattfenwick/collections/pkg/set"
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	networkingv1 "k8s.io/api/networking/v1"
 )
 
 type CompareArgs struct {
+	AllowDNS                  bool
 	Noisy                     bool
-	NetpolCreationWaitSeconds int
+	IgnoreLoopback            bool
+	PerturbationWaitSeconds   int
+	PodCreationTimeoutSeconds int
+	Retries                   int
 	Contexts                  []string
+	ServerPorts               []int
+	ServerProtocols           []string
+	ServerNamespaces          []string
+	ServerPods                []string
+	Include                   []string
+	Exclude                   []string
+	Mock                      bool
+	JobTimeoutSeconds         int
+	ImageRegistry             string
 }
 
 func SetupCompareCommand() *cobra.Command {
@@ -16,113 +41,106 @@ func SetupCompareCommand() *cobra.Command {
 
 	command := &cobra.Command{
 		Use:   "compare",
-		Short: "compare network policy",
-		Long:  "Compare network policies between multiple clusters",
+		Short: "compare network policy implementations",
+		Long:  "run the same generated test cases on multiple clusters in parallel, and compare each cluster's results to the expected results",
 		Args:  cobra.ExactArgs(0),
 		Run: func(cmd *cobra.Command, as []string) {
 			RunCompareCommand(args)
 		},
 	}
 
-	command.Flags().BoolVar(&args.Noisy, "noisy", false, "if true, print all results")
-	command.Flags().IntVar(&args.NetpolCreationWaitSeconds, "netpol-creation-wait-seconds", 5, "number of seconds to wait after creating a network policy before running probes, to give the CNI time to update the cluster state")
-	command.Flags().StringSliceVar(&args.Contexts, "context", []string{}, "kubernetes context to use; if empty, uses default context")
+	command.Flags().StringSliceVar(&args.Contexts, "context", []string{}, "kubernetes contexts to compare; at least two are required")
+	utils.DoOrDie(command.MarkFlagRequired("context"))
+
+	command.Flags().StringSliceVar(&args.ServerProtocols, "server-protocol", []string{"TCP", "UDP", "SCTP"}, "protocols to run server on")
+	command.Flags().IntSliceVar(&args.ServerPorts, "server-port", []int{80, 81}, "ports to run server on")
+	command.Flags().StringSliceVar(&args.ServerNamespaces, "namespace", []string{"x", "y", "z"}, "namespaces to create/use pods in")
+	command.Flags().StringSliceVar(&args.ServerPods, "pod", []string{"a", "b", "c"}, "pods to create in namespaces")
+
+	command.Flags().IntVar(&args.Retries, "retries", 1, "number of kube probe retries to allow, if probe fails; only the probes whose results differ from the expected results are re-run")
+	command.Flags().BoolVar(&args.AllowDNS, "allow-dns", true, "if using egress, allow tcp and udp over port 53 for DNS resolution")
+	command.Flags().BoolVar(&args.Noisy, "noisy", false, "if true, print all cells, not just those which differ from the expected results on some cluster")
+	command.Flags().BoolVar(&args.IgnoreLoopback, "ignore-loopback", false, "if true, ignore loopback for truthtable correctness verification")
+	command.Flags().IntVar(&args.PerturbationWaitSeconds, "perturbation-wait-seconds", 5, "number of seconds to wait after perturbing the cluster (i.e. create a network policy, modify a ns/pod label) before running probes, to give the CNI time to update the cluster state")
+	command.Flags().IntVar(&args.PodCreationTimeoutSeconds, "pod-creation-timeout-seconds", 60, "number of seconds to wait for pods to create, be running and have IP addresses")
+	command.Flags().IntVar(&args.JobTimeoutSeconds, "job-timeout-seconds", 10, "number of seconds each probe waits for a connection: passed to 'agnhost connect --timeout=%ds'")
+
+	command.Flags().StringSliceVar(&args.Include, "include", []string{}, "include tests with any of these tags; if empty, all tests will be included.  Valid tags:\n"+strings.Join(generator.TagSlice, "\n"))
+	command.Flags().StringSliceVar(&args.Exclude, "exclude", DefaultExcludeTags, "exclude tests with any of these tags.  See 'include' field for valid tags")
+
+	command.Flags().BoolVar(&args.Mock, "mock", false, "if true, use a mock kube runner for each context (i.e. don't actually run tests against kubernetes; instead, product fake results")
+	command.Flags().StringVar(&args.ImageRegistry, "image-registry", "registry.k8s.io", "Image registry for agnhost")
 
 	return command
 }
 
 func RunCompareCommand(args *CompareArgs) {
-	panic("TODO")
-	/*
-		namespaces := []string{"x", "y", "z"}
-		pods := []string{"a", "b", "c"}
+	fmt.Printf("args: \n%s\n", json.MustMarshalToString(args))
 
-		protocol := v1.ProtocolTCP
-		probePort := intstr.FromInt(80)
+	RunVersionCommand()
 
-		serverPort := 80
+	utils.DoOrDie(generator.ValidateTags(append(args.Include, args.Exclude...)))
 
-		kubeClients := map[string]*kube.Kubernetes{}
-		if len(args.Contexts) == 0 {
-			kubernetes, err := kube.NewKubernetesForContext("")
-			utils.DoOrDie(err)
-			kubeClients["default-context"] = kubernetes
-		} else {
-			for _, context := range args.Contexts {
-				kubernetes, err := kube.NewKubernetesForContext(context)
-				utils.DoOrDie(err)
-				kubeClients[context] = kubernetes
-			}
-		}
+	contexts := slice.Sort(set.FromSlice(args.Contexts).ToSlice())
+	if len(contexts) < 2 {
+		utils.DoOrDie(errors.Errorf("at least two distinct contexts are required, found %d", len(contexts)))
+	}
 
-		kubeResources := map[string]*connectivitykube.Resources{}
-		var syntheticResources *synthetic.Resources
-		var zcIP string
-		for context, kubeClient := range kubeClients {
-			kubernetesResources, synth, err := connectivity.SetupClusterTODODelete(kubeClient, namespaces, pods, serverPort, protocol)
+	serverProtocols := parseProtocols(args.ServerProtocols)
+	interpreterConfig := &connectivity.InterpreterConfig{
+		ResetClusterBeforeTestCase:       true,
+		KubeProbeRetries:                 args.Retries,
+		PerturbationWaitSeconds:          args.PerturbationWaitSeconds,
+		VerifyClusterStateBeforeTestCase: true,
+		IgnoreLoopback:                   args.IgnoreLoopback,
+		JobTimeoutSeconds:                args.JobTimeoutSeconds,
+	}
+
+	targets := map[string]*connectivity.ContextTarget{}
+	for _, context := range contexts {
+		var kubernetes kube.IKubernetes
+		if args.Mock {
+			kubernetes = kube.NewMockKubernetes(1.0)
+		} else {
+			kubeClient, err := kube.NewKubernetesForContext(context)
 			utils.DoOrDie(err)
-			// TODO this is a huge hack -- ips are going to be different from cluster to cluster, which means
-			//   that policies involving ips need to be different from cluster to cluster.  But here we're just
-			//   taking the first one and using it everywhere.
-			if syntheticResources == nil {
-				syntheticResources = synth
-
-				zcPod, err := kubeClient.GetPod("z", "c")
-				utils.DoOrDie(err)
-				if zcPod.Status.PodIP == "" {
-					panic(errors.Errorf("no ip found for pod z/c"))
-				}
-				zcIP = zcPod.Status.PodIP
-			}
-
-			kubeResources[context] = kubernetesResources
+			info, err := kubeClient.ClientSet.ServerVersion()
+			utils.DoOrDie(err)
+			fmt.Printf("Kubernetes server version for context %s: \n%s\n", context, json.MustMarshalToString(info))
+			kubernetes = kubeClient
 		}
 
-		fragGenerator := generator.NewDefaultFragmentGenerator(true, namespaces, zcIP)
-		kubePolicySlices := packIntoSlices(fragGenerator.FragmentPolicies())
+		resources, err := probe.NewDefaultResources(kubernetes, args.ServerNamespaces, args.ServerPods, args.ServerPorts, serverProtocols, nil, args.PodCreationTimeoutSeconds, false, false, args.ImageRegistry)
+		utils.DoOrDie(errors.WithMessagef(err, "unable to set up resources for context %s", context))
 
-		fmt.Printf("testing %d policies\n\n", len(kubePolicySlices))
+		zcPod, err := resources.GetPod("z", "c")
+		utils.DoOrDie(err)
 
-		contexts := args.Contexts
-		sort.Slice(contexts, func(i, j int) bool {
-			return contexts[i] < contexts[j]
-		})
-		tester := connectivity.NewMultipleContextTester()
-		printer := &connectivity.MultipleContextTestCasePrinter{
-			Noisy:    args.Noisy,
-			Contexts: contexts,
+		targets[context] = &connectivity.ContextTarget{
+			Interpreter: connectivity.NewInterpreter(kubernetes, resources, interpreterConfig),
+			PodIP:       zcPod.IP,
+			PodIPv6:     zcPod.IPv6(),
 		}
+	}
 
-		for i, kubePolicy := range kubePolicySlices {
-			logrus.Infof("starting policy #%d", i)
-			testCase := &connectivity.MultipleContextTestCase{
-				KubePolicies:              kubePolicy,
-				NetpolCreationWaitSeconds: args.NetpolCreationWaitSeconds,
-				Port:                      probePort,
-				Protocol:                  protocol,
-				KubeClients:               kubeClients,
-				KubeResources:             kubeResources,
-				SyntheticResources:        syntheticResources,
-				NamespacesToClean:         namespaces,
-				Policy:                    matcher.BuildNetworkPolicies(kubePolicy),
-			}
-			result := tester.TestNetworkPolicy(testCase)
-			if len(result.Errors) > 0 {
-				panic(result.Errors[0])
-			}
-
-			printer.PrintTestCaseResult(result)
-			logrus.Infof("finished policy #%d", i)
-		}
+	// test cases' ipblocks are built around the first context's z/c pod, and rewritten for the other contexts
+	reference := targets[contexts[0]]
+	tester := connectivity.NewMultipleContextTester(targets, reference.PodIP, reference.PodIPv6)
+	printer := &connectivity.MultipleContextPrinter{
+		Noisy:          args.Noisy,
+		IgnoreLoopback: args.IgnoreLoopback,
+		Contexts:       tester.Contexts(),
+	}
 
-		printer.PrintFinish()
-	*/
-}
+	testCaseGenerator := generator.NewTestCaseGenerator(args.AllowDNS, reference.PodIP, reference.PodIPv6, args.ServerNamespaces, args.Include, args.Exclude)
+	testCases := testCaseGenerator.GenerateTestCases()
+	fmt.Printf("testing %d cases on contexts %s\n\n", len(testCases), strings.Join(contexts, ", "))
 
-func packIntoSlices(netpols []*networkingv1.NetworkPolicy) [][]*networkingv1.NetworkPolicy {
-	var sos [][]*networkingv1.NetworkPolicy
-	for _, np := range netpols {
-		sos = append(sos, []*networkingv1.NetworkPolicy{np})
+	for i, testCase := range testCases {
+		logrus.Infof("starting test case #%d", i+1)
+		printer.PrintTestCaseResult(tester.ExecuteTestCase(testCase))
+		logrus.Infof("finished test case #%d", i+1)
 	}
-	return sos
+
+	printer.PrintSummary()
 }
@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/mattfenwick/collections/pkg/json"
 	"github.com/mattfenwick/cyclonus/pkg/connectivity"
@@ -10,6 +11,8 @@ import (
 	"github.com/mattfenwick/cyclonus/pkg/generator"
 	"github.com/mattfenwick/cyclonus/pkg/kube"
 	"github.com/mattfenwick/cyclonus/pkg/utils"
+	"github.com/mattfenwick/cyclonus/pkg/worker"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -20,7 +23,8 @@ var (
 		generator.TagUpstreamE2E,
 		generator.TagExample,
 		generator.TagEndPort,
-		generator.TagNamespacesByDefaultLabel}
+		generator.TagNamespacesByDefaultLabel,
+		generator.TagLongLivedConnection}
 )
 
 type GenerateArgs struct {
@@ -28,6 +32,8 @@ type GenerateArgs struct {
 	Noisy                     bool
 	IgnoreLoopback            bool
 	PerturbationWaitSeconds   int
+	ConvergenceTimeoutSeconds int
+	DetectTransients          bool
 	PodCreationTimeoutSeconds int
 	Retries                   int
 	Context                   string
@@ -44,8 +50,26 @@ type GenerateArgs struct {
 	DryRun                    bool
 	JobTimeoutSeconds         int
 	JunitResultsFile          string
+	ResultsFile               string
+	HTMLReportFile            string
 	ImageRegistry             string
-	//BatchJobs                 bool
+	ExternalIPs               []string
+	ExternalServer            bool
+	EchoServers               bool
+	LongLivedHoldSeconds      int
+	ProbeSamples              int
+	ProbeConsistency          float64
+	MaxFlakyPercent           float64
+	BatchJobs                 bool
+	AgentAccess               string
+	TestCasePaths             []string
+	ExportDir                 string
+	Random                    int
+	Seed                      int64
+	ShrinkDir                 string
+	ShrinkMaxRuns             int
+	Coverage                  int
+	CoverageMaxCases          int
 }
 
 func SetupGenerateCommand() *cobra.Command {
@@ -66,28 +90,49 @@ func SetupGenerateCommand() *cobra.Command {
 	command.Flags().StringSliceVar(&args.ServerNamespaces, "namespace", []string{"x", "y", "z"}, "namespaces to create/use pods in")
 	command.Flags().StringSliceVar(&args.ServerPods, "pod", []string{"a", "b", "c"}, "pods to create in namespaces")
 
-	//command.Flags().BoolVar(&args.BatchJobs, "batch-jobs", false, "if true, run jobs in batches to avoid saturating the Kube APIServer with too many exec requests")
-	command.Flags().IntVar(&args.Retries, "retries", 1, "number of kube probe retries to allow, if probe fails")
+	command.Flags().BoolVar(&args.BatchJobs, "batch-jobs", false, "if true, run jobs in batches to avoid saturating the Kube APIServer with too many exec requests")
+	command.Flags().StringVar(&args.AgentAccess, "agent-access", string(worker.AgentAccessPortForward), "with batch-jobs, how to reach the agent running in each probe pod; one of "+strings.Join(agentAccessChoices(), ", ")+"; '"+agentAccessExec+"' execs the worker for each batch instead of using the agent")
+	command.Flags().IntVar(&args.ProbeSamples, "probe-samples", 1, "number of times to run each kube probe; if greater than 1, probes are classified as consistently allowed, consistently blocked, or flaky")
+	command.Flags().Float64Var(&args.ProbeConsistency, "probe-consistency-threshold", 0.8, "with probe-samples, the share of samples -- greater than 0.5, and at most 1 -- which must agree for a probe to be consistently allowed or blocked")
+	command.Flags().Float64Var(&args.MaxFlakyPercent, "max-flaky-percent", 0, "with probe-samples, the percentage of a step's compared cells which may be flaky without failing the step")
+	command.Flags().IntVar(&args.Retries, "retries", 1, "number of kube probe retries to allow, if probe fails; only the probes whose results differ from the expected results are re-run")
 	command.Flags().BoolVar(&args.AllowDNS, "allow-dns", true, "if using egress, allow tcp and udp over port 53 for DNS resolution")
 	command.Flags().BoolVar(&args.Noisy, "noisy", false, "if true, print all results")
 	command.Flags().BoolVar(&args.IgnoreLoopback, "ignore-loopback", false, "if true, ignore loopback for truthtable correctness verification")
 	command.Flags().IntVar(&args.PerturbationWaitSeconds, "perturbation-wait-seconds", 5, "number of seconds to wait after perturbing the cluster (i.e. create a network policy, modify a ns/pod label) before running probes, to give the CNI time to update the cluster state")
+	command.Flags().IntVar(&args.ConvergenceTimeoutSeconds, "convergence-timeout-seconds", 0, "if positive, instead of waiting a fixed perturbation-wait-seconds, re-probe the connections whose expected results changed until they match or this many seconds pass, and report the convergence latency")
+	command.Flags().BoolVar(&args.DetectTransients, "detect-transients", false, "if true, keep probing the connections whose expected results each step's policy actions don't change, while the actions take effect, and report any observations inconsistent with both the before and after states")
+	command.Flags().BoolVar(&args.EchoServers, "echo-servers", false, "if true, serve with the cyclonus worker's echo server, which holds connections open, instead of agnhost; required by long-lived-connection test cases")
+	command.Flags().IntVar(&args.LongLivedHoldSeconds, "long-lived-hold-seconds", 30, "number of seconds to hold long-lived connections open; must cover a step's actions and the time for them to take effect")
 	command.Flags().IntVar(&args.PodCreationTimeoutSeconds, "pod-creation-timeout-seconds", 60, "number of seconds to wait for pods to create, be running and have IP addresses")
 	command.Flags().StringVar(&args.Context, "context", "", "kubernetes context to use; if empty, uses default context")
 	command.Flags().BoolVar(&args.CleanupNamespaces, "cleanup-namespaces", false, "if true, clean up namespaces after completion")
 	command.Flags().BoolVar(&args.FailFast, "fail-fast", false, "if true, stop running tests after the first failure")
 	command.Flags().StringVar(&args.DestinationType, "destination-type", "", "override to set what to direct requests at; if not specified, the tests will be left as-is; one of "+strings.Join(generator.AllProbeModes, ", "))
-	command.Flags().IntVar(&args.JobTimeoutSeconds, "job-timeout-seconds", 10, "number of seconds to pass on to 'agnhost connect --timeout=%ds' flag")
+	command.Flags().IntVar(&args.JobTimeoutSeconds, "job-timeout-seconds", 10, "number of seconds each probe waits for a connection: passed to 'agnhost connect --timeout=%ds', or with batch-jobs, to the worker's native dialer")
 
 	command.Flags().StringSliceVar(&args.Include, "include", []string{}, "include tests with any of these tags; if empty, all tests will be included.  Valid tags:\n"+strings.Join(generator.TagSlice, "\n"))
 	command.Flags().StringSliceVar(&args.Exclude, "exclude", DefaultExcludeTags, "exclude tests with any of these tags.  See 'include' field for valid tags")
+	command.Flags().StringSliceVar(&args.TestCasePaths, "test-case-path", []string{}, "yaml or json files -- or directories of them -- of test cases to run along with the built-in test cases; they're tagged '"+generator.TagUserDefined+"', so '--include "+generator.TagUserDefined+"' runs just them")
 
 	command.Flags().BoolVar(&args.Mock, "mock", false, "if true, use a mock kube runner (i.e. don't actually run tests against kubernetes; instead, product fake results")
 	command.Flags().BoolVar(&args.DryRun, "dry-run", false, "if true, don't actually do anything: just print out what would be done")
+	command.Flags().IntVar(&args.Random, "random", 0, "number of random test cases -- composed of random targets, rules, peers and ports, weighted towards the least-covered policy features -- to add to the selected test cases; they're tagged '"+generator.TagRandom+"', and must match the include and exclude tags")
+	command.Flags().Int64Var(&args.Seed, "seed", 0, "seed for random test cases; the same seed produces the same test cases.  If 0, a seed is picked and printed")
+	command.Flags().IntVar(&args.Coverage, "coverage", 0, "if between 2 and 4, report the coverage of combinations of this many features -- from the general, ingress, egress and action categories -- and add test cases, from a covering array, which exercise combinations the selected test cases miss; they're tagged '"+generator.TagCoverage+"', and must match the include and exclude tags.  2 covers pairs, 3 triples")
+	command.Flags().IntVar(&args.CoverageMaxCases, "coverage-max-cases", 200, "with coverage, the maximum number of test cases to add")
+	command.Flags().StringVar(&args.ShrinkDir, "shrink-dir", "", "shrink each failing test case -- by repeatedly simplifying it and re-running it, keeping simplifications which get the same cells wrong the same way -- and write the minimal reproducers to the specified directory, as yaml which can be loaded with --test-case-path")
+	command.Flags().IntVar(&args.ShrinkMaxRuns, "shrink-max-runs", 100, "with shrink-dir, the maximum number of times to run simplified versions of each failing test case")
+	command.Flags().StringVar(&args.ExportDir, "export", "", "write the selected test cases -- with their policies as yaml, and the expected truth tables simulated over the pods -- to the specified directory; its testcases subdirectory can be loaded back with --test-case-path")
 
 	command.Flags().StringVar(&args.JunitResultsFile, "junit-results-file", "", "output junit results to the specified file")
+	command.Flags().StringVar(&args.HTMLReportFile, "html-report-file", "", "output a self-contained html report to the specified file")
+	command.Flags().StringVar(&args.ResultsFile, "results-file", "", "output results -- including test cases, truth tables, timings and cluster version -- to the specified json file, which 'cyclonus report' can re-render")
 	command.Flags().StringVar(&args.ImageRegistry, "image-registry", "registry.k8s.io", "Image registry for agnhost")
 
+	command.Flags().StringSliceVar(&args.ExternalIPs, "external-ip", []string{}, "out-of-cluster ips to probe, in addition to pods; they're assumed to serve the same ports and protocols as the pods")
+	command.Flags().BoolVar(&args.ExternalServer, "external-server", false, "if true, run a host-network server in namespace "+probe.ExternalServerNamespace+" and probe it as an external ip, so that egress to out-of-cluster destinations can be tested without internet access")
+
 	return command
 }
 
@@ -98,11 +143,34 @@ func RunGenerateCommand(args *GenerateArgs) {
 
 	utils.DoOrDie(generator.ValidateTags(append(args.Include, args.Exclude...)))
 
-	externalIPs := []string{} // "http://www.google.com"} // TODO make these be IPs?  or not?
+	// validate flags before anything is created in the cluster
+	if args.ProbeSamples < 1 {
+		utils.DoOrDie(errors.Errorf("invalid probe samples %d: must be at least 1", args.ProbeSamples))
+	}
+	if args.ProbeConsistency <= 0.5 || args.ProbeConsistency > 1 {
+		utils.DoOrDie(errors.Errorf("invalid probe consistency threshold %f: must be greater than 0.5, and at most 1", args.ProbeConsistency))
+	}
+	if args.MaxFlakyPercent < 0 || args.MaxFlakyPercent > 100 {
+		utils.DoOrDie(errors.Errorf("invalid max flaky percent %f: must be between 0 and 100", args.MaxFlakyPercent))
+	}
+	if args.Coverage != 0 && (args.Coverage < 2 || args.Coverage > len(generator.FeatureCategories)) {
+		utils.DoOrDie(errors.Errorf("invalid coverage %d: must be 0, to skip coverage, or between 2 and %d", args.Coverage, len(generator.FeatureCategories)))
+	}
+	agentAccess, err := parseAgentAccess(args.AgentAccess)
+	utils.DoOrDie(err)
+
+	var userTestCases []*generator.TestCase
+	for _, path := range args.TestCasePaths {
+		loaded, err := generator.LoadTestCases(path)
+		utils.DoOrDie(err)
+		userTestCases = append(userTestCases, loaded...)
+	}
 
 	var kubernetes kube.IKubernetes
+	var metadata *connectivity.RunMetadata
 	if args.Mock {
 		kubernetes = kube.NewMockKubernetes(1.0)
+		metadata = newRunMetadata("generate", args, nil)
 	} else {
 		kubeClient, err := kube.NewKubernetesForContext(args.Context)
 		utils.DoOrDie(err)
@@ -110,37 +178,76 @@ func RunGenerateCommand(args *GenerateArgs) {
 		utils.DoOrDie(err)
 		fmt.Printf("Kubernetes server version: \n%s\n", json.MustMarshalToString(info))
 		kubernetes = kubeClient
+		metadata = newRunMetadata("generate", args, kubeClient)
 	}
 
 	serverProtocols := parseProtocols(args.ServerProtocols)
 
-	batchJobs := false // args.BatchJobs
-	resources, err := probe.NewDefaultResources(kubernetes, args.ServerNamespaces, args.ServerPods, args.ServerPorts, serverProtocols, externalIPs, args.PodCreationTimeoutSeconds, batchJobs, args.ImageRegistry)
+	externalIPs := setupExternalIPs(kubernetes, args.ExternalIPs, args.ExternalServer, args.ServerPorts, serverProtocols, args.ImageRegistry, args.PodCreationTimeoutSeconds)
+
+	resources, err := probe.NewDefaultResources(kubernetes, args.ServerNamespaces, args.ServerPods, args.ServerPorts, serverProtocols, externalIPs, args.PodCreationTimeoutSeconds, args.BatchJobs, args.EchoServers, args.ImageRegistry)
 	utils.DoOrDie(err)
 
 	interpreterConfig := &connectivity.InterpreterConfig{
 		ResetClusterBeforeTestCase:       true,
 		KubeProbeRetries:                 args.Retries,
 		PerturbationWaitSeconds:          args.PerturbationWaitSeconds,
+		ConvergenceTimeoutSeconds:        args.ConvergenceTimeoutSeconds,
+		DetectTransients:                 args.DetectTransients,
+		LongLivedHoldSeconds:             args.LongLivedHoldSeconds,
 		VerifyClusterStateBeforeTestCase: true,
-		BatchJobs:                        batchJobs,
+		BatchJobs:                        args.BatchJobs,
+		AgentAccess:                      agentAccess,
+		ProbeSamples:                     args.ProbeSamples,
+		ProbeConsistencyThreshold:        args.ProbeConsistency,
+		MaxFlakyPercent:                  args.MaxFlakyPercent,
 		IgnoreLoopback:                   args.IgnoreLoopback,
 		JobTimeoutSeconds:                args.JobTimeoutSeconds,
 		FailFast:                         args.FailFast,
 	}
 	interpreter := connectivity.NewInterpreter(kubernetes, resources, interpreterConfig)
+	defer interpreter.Close()
 	printer := &connectivity.Printer{
 		Noisy:            args.Noisy,
 		IgnoreLoopback:   args.IgnoreLoopback,
 		JunitResultsFile: args.JunitResultsFile,
+		ResultsFile:      args.ResultsFile,
+		HTMLReportFile:   args.HTMLReportFile,
+		Metadata:         metadata,
+		CoverageStrength: args.Coverage,
 	}
 
+	shrinker := &connectivity.Shrinker{Interpreter: interpreter, MaxRuns: args.ShrinkMaxRuns}
+
 	zcPod, err := resources.GetPod("z", "c")
 	utils.DoOrDie(err)
 
-	testCaseGenerator := generator.NewTestCaseGenerator(args.AllowDNS, zcPod.IP, args.ServerNamespaces, args.Include, args.Exclude)
+	testCaseGenerator := generator.NewTestCaseGenerator(args.AllowDNS, zcPod.IP, zcPod.IPv6(), args.ServerNamespaces, args.Include, args.Exclude)
 
-	testCases := testCaseGenerator.GenerateTestCases()
+	testCases := append(testCaseGenerator.GenerateTestCases(), generator.FilterTestCases(userTestCases, args.Include, args.Exclude)...)
+	if args.Random > 0 {
+		seed := args.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		fmt.Printf("random test case seed: %d\n", seed)
+		randomTestCases := testCaseGenerator.RandomTestCases(args.Random, seed, testCases)
+		if len(randomTestCases) < args.Random {
+			logrus.Warnf("only found %d of %d random test cases matching the tags", len(randomTestCases), args.Random)
+		}
+		testCases = append(testCases, randomTestCases...)
+	}
+	if args.Coverage > 0 {
+		coverage, err := generator.NewFeatureCoverage(args.Coverage)
+		utils.DoOrDie(err)
+		for _, testCase := range testCases {
+			coverage.Add(testCase)
+		}
+		fmt.Printf("feature combination coverage of selected test cases:\n%s\n", connectivity.FeatureCoverageTable(coverage))
+		coverageTestCases := testCaseGenerator.CoverageTestCases(coverage, args.CoverageMaxCases)
+		fmt.Printf("added %d coverage test cases; feature combination coverage:\n%s\n", len(coverageTestCases), connectivity.FeatureCoverageTable(coverage))
+		testCases = append(testCases, coverageTestCases...)
+	}
 	fmt.Printf("test cases to run by tag:\n")
 	for tag, count := range generator.CountTestCasesByTag(testCases) {
 		fmt.Printf("- %s: %d\n", tag, count)
@@ -150,10 +257,6 @@ func RunGenerateCommand(args *GenerateArgs) {
 		fmt.Printf("test #%d: %s\n - tags: %+v\n", i+1, testCase.Description, strings.Join(testCase.Tags.Keys(), ", "))
 	}
 
-	if args.DryRun {
-		return
-	}
-
 	if args.DestinationType != "" {
 		mode, err := generator.ParseProbeMode(args.DestinationType)
 		utils.DoOrDie(err)
@@ -164,6 +267,15 @@ func RunGenerateCommand(args *GenerateArgs) {
 		}
 	}
 
+	if args.ExportDir != "" {
+		utils.DoOrDie(connectivity.ExportTestCases(args.ExportDir, resources, testCases))
+		fmt.Printf("exported %d test cases to %s\n", len(testCases), args.ExportDir)
+	}
+
+	if args.DryRun {
+		return
+	}
+
 	for i, testCase := range testCases {
 		fmt.Printf("starting test case #%d\n", i+1)
 
@@ -173,6 +285,10 @@ func RunGenerateCommand(args *GenerateArgs) {
 		printer.PrintTestCaseResult(result)
 		fmt.Printf("finished policy #%d\n", i+1)
 
+		if args.ShrinkDir != "" && !result.Passed(interpreter.Config.IgnoreLoopback) {
+			shrinkTestCase(shrinker, result, args.ShrinkDir, i+1)
+		}
+
 		if args.FailFast && !result.Passed(interpreter.Config.IgnoreLoopback) {
 			logrus.Warn("failing fast due to failure")
 			break
@@ -182,7 +298,11 @@ func RunGenerateCommand(args *GenerateArgs) {
 	printer.PrintSummary()
 
 	if args.CleanupNamespaces {
-		for _, ns := range args.ServerNamespaces {
+		namespaces := append([]string{}, args.ServerNamespaces...)
+		if args.ExternalServer {
+			namespaces = append(namespaces, probe.ExternalServerNamespace)
+		}
+		for _, ns := range namespaces {
 			logrus.Infof("cleaning up namespace %s", ns)
 			err = kubernetes.DeleteNamespace(ns)
 			if err != nil {
@@ -191,3 +311,38 @@ func RunGenerateCommand(args *GenerateArgs) {
 		}
 	}
 }
+
+func shrinkTestCase(shrinker *connectivity.Shrinker, result *connectivity.Result, dir string, index int) {
+	fmt.Printf("shrinking test case #%d\n", index)
+	shrunk, err := shrinker.Shrink(result)
+	if err != nil {
+		logrus.Warnf("unable to shrink test case #%d: %+v", index, err)
+		return
+	}
+	path, err := shrunk.WriteYaml(dir, index)
+	utils.DoOrDie(err)
+	fmt.Printf("wrote reproducer of test case #%d, after %d runs and %d simplifications, to %s\n", index, shrunk.Runs, len(shrunk.Simplifications), path)
+}
+
+const agentAccessExec = "exec"
+
+func agentAccessChoices() []string {
+	choices := []string{agentAccessExec}
+	for _, access := range worker.AllAgentAccesses {
+		choices = append(choices, string(access))
+	}
+	return choices
+}
+
+// parseAgentAccess maps 'exec' to the empty access, which issues batches by exec'ing the worker
+func parseAgentAccess(access string) (worker.AgentAccess, error) {
+	if access == agentAccessExec {
+		return "", nil
+	}
+	for _, a := range worker.AllAgentAccesses {
+		if string(a) == access {
+			return a, nil
+		}
+	}
+	return "", errors.Errorf("invalid agent access %s; expected one of %s", access, strings.Join(agentAccessChoices(), ", "))
+}
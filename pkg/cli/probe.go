@@ -11,7 +11,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	v1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -20,10 +19,13 @@ type ProbeArgs struct {
 	IgnoreLoopback            bool
 	KubeContext               string
 	PerturbationWaitSeconds   int
+	ConvergenceTimeoutSeconds int
+	DetectTransients          bool
 	PodCreationTimeoutSeconds int
 	PolicyPath                string
 	ProbeMode                 string
 	JobTimeoutSeconds         int
+	ResultsFile               string
 
 	// what to probe on
 	ProbeAllAvailable bool
@@ -36,6 +38,10 @@ type ProbeArgs struct {
 	ServerNamespaces []string
 	ServerPods       []string
 	ImageRegistry    string
+
+	// external destinations
+	ExternalIPs    []string
+	ExternalServer bool
 }
 
 func SetupProbeCommand() *cobra.Command {
@@ -59,39 +65,49 @@ func SetupProbeCommand() *cobra.Command {
 	command.Flags().StringSliceVar(&args.Ports, "port", []string{"80"}, "ports to run probes on; may be named port or numbered port")
 	command.Flags().StringSliceVar(&args.Protocols, "protocol", []string{"tcp"}, "protocols to run probes on")
 
+	command.Flags().StringSliceVar(&args.ExternalIPs, "external-ip", []string{}, "out-of-cluster ips to probe, in addition to pods; they're assumed to serve the same ports and protocols as the pods")
+	command.Flags().BoolVar(&args.ExternalServer, "external-server", false, "if true, run a host-network server in namespace "+probe.ExternalServerNamespace+" and probe it as an external ip, so that egress to out-of-cluster destinations can be tested without internet access")
+
 	command.Flags().StringVar(&args.ProbeMode, "probe-mode", generator.ProbeModeServiceName, "probe mode to use, must be one of "+strings.Join(generator.AllProbeModes, ", "))
-	command.Flags().IntVar(&args.JobTimeoutSeconds, "job-timeout-seconds", 10, "number of seconds to pass on to 'agnhost connect --timeout=%ds' flag")
+	command.Flags().IntVar(&args.JobTimeoutSeconds, "job-timeout-seconds", 10, "number of seconds each probe waits for a connection: passed to 'agnhost connect --timeout=%ds'")
 
 	command.Flags().BoolVar(&args.Noisy, "noisy", false, "if true, print all results")
+	command.Flags().StringVar(&args.ResultsFile, "results-file", "", "output results -- including test cases, truth tables, timings and cluster version -- to the specified json file, which 'cyclonus report' can re-render")
 	command.Flags().BoolVar(&args.IgnoreLoopback, "ignore-loopback", false, "if true, ignore loopback for truthtable correctness verification")
 	command.Flags().StringVar(&args.KubeContext, "context", "", "kubernetes context to use; if empty, uses default context")
 	command.Flags().IntVar(&args.PerturbationWaitSeconds, "perturbation-wait-seconds", 5, "number of seconds to wait after perturbing the cluster (i.e. create a network policy, modify a ns/pod label) before running probes, to give the CNI time to update the cluster state")
+	command.Flags().IntVar(&args.ConvergenceTimeoutSeconds, "convergence-timeout-seconds", 0, "if positive, instead of waiting a fixed perturbation-wait-seconds, re-probe the connections whose expected results changed until they match or this many seconds pass, and report the convergence latency")
+	command.Flags().BoolVar(&args.DetectTransients, "detect-transients", false, "if true, keep probing the connections whose expected results each step's policy actions don't change, while the actions take effect, and report any observations inconsistent with both the before and after states")
 	command.Flags().IntVar(&args.PodCreationTimeoutSeconds, "pod-creation-timeout-seconds", 60, "number of seconds to wait for pods to create, be running and have IP addresses")
-	command.Flags().StringVar(&args.PolicyPath, "policy-path", "", "path to yaml network policy to create in kube; if empty, will not create any policies")
+	command.Flags().StringVar(&args.PolicyPath, "policy-path", "", "path to yaml network policies to create in kube -- may be a file, a directory, or '-' for stdin; if empty, will not create any policies")
 	command.Flags().StringVar(&args.ImageRegistry, "image-registry", "registry.k8s.io", "Image registry for agnhost")
 
 	return command
 }
 
 func RunProbeCommand(args *ProbeArgs) {
-	externalIPs := []string{"http://www.google.com"} // TODO make these be IPs?  or not?
 	if len(args.ServerNamespaces) == 0 || len(args.ServerPods) == 0 {
 		panic(errors.Errorf("found 0 namespaces or pods, must have at least 1 of each"))
 	}
 
 	kubernetes, err := kube.NewKubernetesForContext(args.KubeContext)
 	utils.DoOrDie(err)
+	metadata := newRunMetadata("probe", args, kubernetes)
 
 	protocols := parseProtocols(args.Protocols)
 	serverProtocols := parseProtocols(args.ServerProtocols)
 
-	resources, err := probe.NewDefaultResources(kubernetes, args.ServerNamespaces, args.ServerPods, args.ServerPorts, serverProtocols, externalIPs, args.PodCreationTimeoutSeconds, false, args.ImageRegistry)
+	externalIPs := setupExternalIPs(kubernetes, args.ExternalIPs, args.ExternalServer, args.ServerPorts, serverProtocols, args.ImageRegistry, args.PodCreationTimeoutSeconds)
+
+	resources, err := probe.NewDefaultResources(kubernetes, args.ServerNamespaces, args.ServerPods, args.ServerPorts, serverProtocols, externalIPs, args.PodCreationTimeoutSeconds, false, false, args.ImageRegistry)
 	utils.DoOrDie(err)
 
 	interpreterConfig := &connectivity.InterpreterConfig{
 		ResetClusterBeforeTestCase:       false,
 		KubeProbeRetries:                 0,
 		PerturbationWaitSeconds:          args.PerturbationWaitSeconds,
+		ConvergenceTimeoutSeconds:        args.ConvergenceTimeoutSeconds,
+		DetectTransients:                 args.DetectTransients,
 		VerifyClusterStateBeforeTestCase: false,
 		BatchJobs:                        false,
 		IgnoreLoopback:                   args.IgnoreLoopback,
@@ -102,14 +118,18 @@ func RunProbeCommand(args *ProbeArgs) {
 	actions := []*generator.Action{generator.ReadNetworkPolicies(args.ServerNamespaces)}
 
 	if args.PolicyPath != "" {
-		kubePolicy, err := utils.ParseYamlFromFile[networkingv1.NetworkPolicy](args.PolicyPath)
+		kubePolicies, err := kube.ReadNetworkPoliciesFromPath(args.PolicyPath)
 		utils.DoOrDie(err)
-		actions = append(actions, generator.CreatePolicy(kubePolicy))
+		for _, kubePolicy := range kubePolicies {
+			actions = append(actions, generator.CreatePolicy(kubePolicy))
+		}
 	}
 
 	printer := connectivity.Printer{
 		Noisy:          args.Noisy,
 		IgnoreLoopback: args.IgnoreLoopback,
+		ResultsFile:    args.ResultsFile,
+		Metadata:       metadata,
 	}
 
 	mode, err := generator.ParseProbeMode(args.ProbeMode)
@@ -128,6 +148,23 @@ func RunProbeCommand(args *ProbeArgs) {
 			}
 		}
 	}
+
+	printer.WriteResultsFile()
+}
+
+// setupExternalIPs validates the external ips, and starts the cyclonus-managed external server if requested
+func setupExternalIPs(kubernetes kube.IKubernetes, ips []string, createServer bool, ports []int, protocols []v1.Protocol, imageRegistry string, timeoutSeconds int) []string {
+	for _, ip := range ips {
+		if _, err := kube.IsIPV4Address(ip); err != nil {
+			utils.DoOrDie(errors.WithMessagef(err, "invalid external ip"))
+		}
+	}
+	if createServer {
+		ip, err := probe.CreateExternalServer(kubernetes, probe.NewExternalServer(ports, protocols, imageRegistry), timeoutSeconds)
+		utils.DoOrDie(err)
+		ips = append(ips, ip)
+	}
+	return ips
 }
 
 func parseProtocols(strs []string) []v1.Protocol {
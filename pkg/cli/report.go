@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattfenwick/collections/pkg/json"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type ReportArgs struct {
+	ResultsFile      string
+	JunitResultsFile string
+	HTMLReportFile   string
+	Noisy            bool
+	SummaryOnly      bool
+}
+
+func SetupReportCommand() *cobra.Command {
+	args := &ReportArgs{}
+
+	command := &cobra.Command{
+		Use:   "report",
+		Short: "re-render the reports of a generate or probe run from its results file, without a cluster",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, as []string) {
+			RunReportCommand(args)
+		},
+	}
+
+	command.Flags().StringVar(&args.ResultsFile, "results-file", "", "path to a results file written by 'generate' or 'probe'")
+	utils.DoOrDie(command.MarkFlagRequired("results-file"))
+
+	command.Flags().StringVar(&args.JunitResultsFile, "junit-results-file", "", "output junit results to the specified file")
+	command.Flags().StringVar(&args.HTMLReportFile, "html-report-file", "", "output a self-contained html report to the specified file")
+	command.Flags().BoolVar(&args.Noisy, "noisy", false, "if true, print all results")
+	command.Flags().BoolVar(&args.SummaryOnly, "summary-only", false, "if true, only print the summary, and not each test case's results")
+
+	command.AddCommand(SetupReportDiffCommand())
+
+	return command
+}
+
+func RunReportCommand(args *ReportArgs) {
+	file, err := connectivity.ReadResultsFile(args.ResultsFile)
+	utils.DoOrDie(err)
+	results, err := file.GetResults()
+	utils.DoOrDie(err)
+
+	if file.Metadata != nil {
+		fmt.Printf("run metadata: \n%s\n", json.MustMarshalToString(file.Metadata))
+	}
+
+	printer := &connectivity.Printer{
+		Noisy:            args.Noisy,
+		IgnoreLoopback:   file.IgnoreLoopback,
+		JunitResultsFile: args.JunitResultsFile,
+		HTMLReportFile:   args.HTMLReportFile,
+		Metadata:         file.Metadata,
+	}
+	for i, result := range results {
+		if args.SummaryOnly {
+			printer.Results = append(printer.Results, result)
+			continue
+		}
+		fmt.Printf("test case #%d\n", i+1)
+		printer.PrintTestCaseResult(result)
+	}
+	printer.PrintSummary()
+}
+
+type ReportDiffArgs struct {
+	IgnoreLoopback bool
+	ShowUnchanged  bool
+}
+
+func SetupReportDiffCommand() *cobra.Command {
+	args := &ReportDiffArgs{}
+
+	command := &cobra.Command{
+		Use:   "diff BEFORE AFTER",
+		Short: "compare two results files: which test cases newly fail or pass, and how tag and feature pass rates changed",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, as []string) {
+			RunReportDiffCommand(args, as[0], as[1])
+		},
+	}
+
+	command.Flags().BoolVar(&args.IgnoreLoopback, "ignore-loopback", false, "if true, ignore loopback for truthtable correctness verification; it's also ignored if either run ignored it")
+	command.Flags().BoolVar(&args.ShowUnchanged, "show-unchanged", false, "if true, also print the tags and features whose pass rates didn't change")
+
+	return command
+}
+
+func RunReportDiffCommand(args *ReportDiffArgs, beforePath string, afterPath string) {
+	var results [][]*connectivity.Result
+	ignoreLoopback := args.IgnoreLoopback
+	for _, path := range []string{beforePath, afterPath} {
+		file, err := connectivity.ReadResultsFile(path)
+		utils.DoOrDie(err)
+		fileResults, err := file.GetResults()
+		utils.DoOrDie(err)
+		results = append(results, fileResults)
+		ignoreLoopback = ignoreLoopback || file.IgnoreLoopback
+		if file.Metadata != nil {
+			fmt.Printf("%s: kubernetes %s, CNI [%s], cyclonus %s, started %s\n", path, file.Metadata.KubernetesVersion,
+				strings.Join(file.Metadata.CNI, ", "), file.Metadata.CyclonusVersion, file.Metadata.StartTime.Format(time.RFC3339))
+		}
+	}
+
+	diff := connectivity.DiffResults(ignoreLoopback, results[0], results[1])
+	changed := diff.ChangedTestCases()
+	counts := map[connectivity.TestCaseChange]int{}
+	for _, testCase := range changed {
+		counts[testCase.Change]++
+	}
+	fmt.Printf("\n%d of %d test cases changed: %d newly failing, %d newly passing, %d with changed failing cells, %d added, %d removed\n",
+		len(changed), len(diff.TestCases), counts[connectivity.TestCaseNewlyFailing], counts[connectivity.TestCaseNewlyPassing],
+		counts[connectivity.TestCaseCellsChanged], counts[connectivity.TestCaseAdded], counts[connectivity.TestCaseRemoved])
+	if len(changed) > 0 {
+		fmt.Println(diff.RenderTestCases())
+	}
+
+	fmt.Println(connectivity.RenderPassRateDeltas("Feature", diff.FeatureDeltas, !args.ShowUnchanged))
+	fmt.Println(connectivity.RenderPassRateDeltas("Tag", diff.TagDeltas, !args.ShowUnchanged))
+}
+
+// newRunMetadata records what a run is against; kubeClient is nil for mock runs
+func newRunMetadata(command string, args interface{}, kubeClient *kube.Kubernetes) *connectivity.RunMetadata {
+	metadata := &connectivity.RunMetadata{
+		Command:           command,
+		Args:              args,
+		CyclonusVersion:   version,
+		CyclonusGitSHA:    gitSHA,
+		CyclonusBuildTime: buildTime,
+		StartTime:         time.Now(),
+	}
+	if kubeClient == nil {
+		return metadata
+	}
+	info, err := kubeClient.ClientSet.ServerVersion()
+	if err != nil {
+		logrus.Warnf("unable to get kubernetes server version: %+v", err)
+	} else {
+		metadata.KubernetesVersion = info.GitVersion
+		metadata.KubernetesPlatform = info.Platform
+	}
+	metadata.CNI, err = kube.DetectCNIImages(kubeClient)
+	if err != nil {
+		logrus.Warnf("unable to detect CNI: %+v", err)
+	} else {
+		logrus.Infof("detected CNI images: %s", strings.Join(metadata.CNI, ", "))
+	}
+	return metadata
+}
@@ -1,8 +1,10 @@
 package connectivity
 
 import (
+	"github.com/mattfenwick/collections/pkg/slice"
 	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
 	"github.com/pkg/errors"
+	"golang.org/x/exp/maps"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -11,10 +13,19 @@ type Item struct {
 	Simulated *probe.Item
 }
 
-func (i *Item) ResultsByProtocol() map[bool]map[v1.Protocol]int {
-	counts := map[bool]map[v1.Protocol]int{true: {}, false: {}}
+// ComparisonsByProtocol compares each kube result to its simulated result: flaky kube results are neither
+// the same nor different
+func (i *Item) ComparisonsByProtocol() map[Comparison]map[v1.Protocol]int {
+	counts := map[Comparison]map[v1.Protocol]int{SameComparison: {}, DifferentComparison: {}, FlakyComparison: {}}
 	for key, kr := range i.Kube.JobResults {
-		counts[kr.Combined == i.Simulated.JobResults[key].Combined][kr.Job.Protocol]++
+		switch {
+		case kr.Combined == probe.ConnectivityFlaky:
+			counts[FlakyComparison][kr.Job.Protocol]++
+		case kr.Combined == i.Simulated.JobResults[key].Combined:
+			counts[SameComparison][kr.Job.Protocol]++
+		default:
+			counts[DifferentComparison][kr.Job.Protocol]++
+		}
 	}
 	return counts
 }
@@ -23,6 +34,44 @@ func (i *Item) IsSuccess() bool {
 	return equalsDict(i.Kube.JobResults, i.Simulated.JobResults)
 }
 
+// IsFlaky is true if the kube results differ from the simulated results only in flaky results
+func (i *Item) IsFlaky() bool {
+	if len(i.Kube.JobResults) != len(i.Simulated.JobResults) {
+		return false
+	}
+	flaky := false
+	for key, kr := range i.Kube.JobResults {
+		if kr.Combined == probe.ConnectivityFlaky {
+			flaky = true
+		} else if sr, ok := i.Simulated.JobResults[key]; !ok || sr.Combined != kr.Combined {
+			return false
+		}
+	}
+	return flaky
+}
+
+// Comparison is SameComparison if all the results match, FlakyComparison if the only mismatches are flaky,
+// and DifferentComparison otherwise
+func (i *Item) Comparison() Comparison {
+	if i.IsSuccess() {
+		return SameComparison
+	} else if i.IsFlaky() {
+		return FlakyComparison
+	}
+	return DifferentComparison
+}
+
+// NonPolicyBlocked returns the kube results which were blocked for some reason other than a network policy
+func (i *Item) NonPolicyBlocked() []*probe.JobResult {
+	var results []*probe.JobResult
+	for _, key := range slice.Sort(maps.Keys(i.Kube.JobResults)) {
+		if kr := i.Kube.JobResults[key]; kr.IsBlockedByNonPolicyCause() {
+			results = append(results, kr)
+		}
+	}
+	return results
+}
+
 func equalsDict(l map[string]*probe.JobResult, r map[string]*probe.JobResult) bool {
 	if len(l) != len(r) {
 		return false
@@ -39,8 +88,8 @@ type ComparisonTable struct {
 	Wrapped *probe.TruthTable
 }
 
-func NewComparisonTable(items []string) *ComparisonTable {
-	return &ComparisonTable{Wrapped: probe.NewTruthTableFromItems(items, nil)}
+func NewComparisonTable(froms []string, tos []string) *ComparisonTable {
+	return &ComparisonTable{Wrapped: probe.NewTruthTable(froms, tos, nil)}
 }
 
 func NewComparisonTableFrom(kubeProbe *probe.Table, simulatedProbe *probe.Table) *ComparisonTable {
@@ -58,7 +107,7 @@ func NewComparisonTableFrom(kubeProbe *probe.Table, simulatedProbe *probe.Table)
 		}
 	}
 
-	table := NewComparisonTable(kubeProbe.Wrapped.Froms)
+	table := NewComparisonTable(kubeProbe.Wrapped.Froms, kubeProbe.Wrapped.Tos)
 	for _, key := range kubeProbe.Wrapped.Keys() {
 		table.Set(key.From, key.To, &Item{Kube: kubeProbe.Get(key.From, key.To), Simulated: simulatedProbe.Get(key.From, key.To)})
 	}
@@ -66,18 +115,6 @@ func NewComparisonTableFrom(kubeProbe *probe.Table, simulatedProbe *probe.Table)
 	return table
 }
 
-func (c *ComparisonTable) ResultsByProtocol() map[bool]map[v1.Protocol]int {
-	counts := map[bool]map[v1.Protocol]int{true: {}, false: {}}
-	for _, key := range c.Wrapped.Keys() {
-		for isSuccess, protocolCounts := range c.Get(key.From, key.To).ResultsByProtocol() {
-			for protocol, count := range protocolCounts {
-				counts[isSuccess][protocol] += count
-			}
-		}
-	}
-	return counts
-}
-
 func (c *ComparisonTable) Set(from string, to string, value *Item) {
 	c.Wrapped.Set(from, to, value)
 }
@@ -89,17 +126,12 @@ func (c *ComparisonTable) Get(from string, to string) *Item {
 func (c *ComparisonTable) ValueCountsByProtocol(ignoreLoopback bool) map[v1.Protocol]map[Comparison]int {
 	counts := map[v1.Protocol]map[Comparison]int{v1.ProtocolTCP: {}, v1.ProtocolSCTP: {}, v1.ProtocolUDP: {}}
 	for _, key := range c.Wrapped.Keys() {
-		for isSuccess, protocolCounts := range c.Get(key.From, key.To).ResultsByProtocol() {
-			var c Comparison
+		for comparison, protocolCounts := range c.Get(key.From, key.To).ComparisonsByProtocol() {
 			if ignoreLoopback && key.From == key.To {
-				c = IgnoredComparison
-			} else if isSuccess {
-				c = SameComparison
-			} else {
-				c = DifferentComparison
+				comparison = IgnoredComparison
 			}
 			for protocol, count := range protocolCounts {
-				counts[protocol][c] += count
+				counts[protocol][comparison] += count
 			}
 		}
 	}
@@ -112,24 +144,30 @@ func (c *ComparisonTable) ValueCounts(ignoreLoopback bool) map[Comparison]int {
 		if ignoreLoopback && key.From == key.To {
 			counts[IgnoredComparison] += 1
 		} else {
-			if c.Get(key.From, key.To).IsSuccess() {
-				counts[SameComparison] += 1
-			} else {
-				counts[DifferentComparison] += 1
-			}
+			counts[c.Get(key.From, key.To).Comparison()] += 1
 		}
 	}
 	return counts
 }
 
+// NonPolicyBlocked returns the kube results, across all cells, which were blocked for some reason other than a network policy
+func (c *ComparisonTable) NonPolicyBlocked() []*probe.JobResult {
+	var results []*probe.JobResult
+	for _, key := range c.Wrapped.Keys() {
+		results = append(results, c.Get(key.From, key.To).NonPolicyBlocked()...)
+	}
+	return results
+}
+
+// RenderSuccessTable marks cells with a '*' if any of their kube results were blocked for a non-policy cause
 func (c *ComparisonTable) RenderSuccessTable() string {
 	return c.Wrapped.Table("", false, func(fr, to string, i interface{}) string {
 		item := c.Get(fr, to)
-		if item.IsSuccess() {
-			return "."
-		} else {
-			return "X"
+		symbol := item.Comparison().ShortString()
+		if len(item.NonPolicyBlocked()) > 0 {
+			symbol += "*"
 		}
+		return symbol
 	})
 }
 
@@ -139,6 +177,8 @@ const (
 	SameComparison      Comparison = "same"
 	DifferentComparison Comparison = "different"
 	IgnoredComparison   Comparison = "ignored"
+	// FlakyComparison is for sampled kube probes which were neither consistently allowed nor blocked
+	FlakyComparison Comparison = "flaky"
 )
 
 func (c Comparison) ShortString() string {
@@ -149,6 +189,8 @@ func (c Comparison) ShortString() string {
 		return "X"
 	case IgnoredComparison:
 		return "?"
+	case FlakyComparison:
+		return "~"
 	default:
 		panic(errors.Errorf("invalid Comparison value %+v", c))
 	}
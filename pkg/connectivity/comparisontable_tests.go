@@ -0,0 +1,91 @@
+package connectivity
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+func RunComparisonTableTests() {
+	Describe("ComparisonTable", func() {
+		It("Should flag cells blocked for non-policy causes", func() {
+			pods := []string{"x/a", "x/b"}
+			kube, simulated := probe.NewTable(pods, pods), probe.NewTable(pods, pods)
+			for _, fr := range pods {
+				for _, to := range pods {
+					job := &probe.Job{FromKey: fr, ToKey: to, Protocol: v1.ProtocolTCP, ResolvedPort: 80}
+					kubeResult := &probe.JobResult{Job: job, Combined: probe.ConnectivityAllowed}
+					if fr == "x/a" && to == "x/b" {
+						kubeResult = &probe.JobResult{Job: job, Combined: probe.ConnectivityBlocked, ProbeError: probe.ProbeErrorDNS, Output: "DNS"}
+					}
+					Expect(kube.Get(fr, to).AddJobResult(kubeResult)).To(Succeed())
+					Expect(simulated.Get(fr, to).AddJobResult(&probe.JobResult{Job: job, Combined: probe.ConnectivityAllowed})).To(Succeed())
+				}
+			}
+
+			comparison := NewComparisonTableFrom(kube, simulated)
+			nonPolicyBlocked := comparison.NonPolicyBlocked()
+			Expect(nonPolicyBlocked).To(HaveLen(1))
+			Expect(nonPolicyBlocked[0].Job.ToKey).To(Equal("x/b"))
+			Expect(comparison.RenderSuccessTable()).To(ContainSubstring("X*"))
+		})
+
+		It("Should count cells whose only mismatches are flaky as flaky", func() {
+			pods := []string{"x/a", "x/b"}
+			kube, simulated := probe.NewTable(pods, pods), probe.NewTable(pods, pods)
+			for _, fr := range pods {
+				for _, to := range pods {
+					for _, port := range []int{80, 81} {
+						job := &probe.Job{FromKey: fr, ToKey: to, Protocol: v1.ProtocolTCP, ResolvedPort: port}
+						combined := probe.ConnectivityAllowed
+						switch {
+						case fr == "x/a" && to == "x/b" && port == 80:
+							combined = probe.ConnectivityFlaky
+						case fr == "x/b" && to == "x/a":
+							// a flaky result, and a wrong result
+							combined = map[int]probe.Connectivity{80: probe.ConnectivityFlaky, 81: probe.ConnectivityBlocked}[port]
+						}
+						Expect(kube.Get(fr, to).AddJobResult(&probe.JobResult{Job: job, Combined: combined, Samples: 5, AllowedSamples: 3})).To(Succeed())
+						Expect(simulated.Get(fr, to).AddJobResult(&probe.JobResult{Job: job, Combined: probe.ConnectivityAllowed})).To(Succeed())
+					}
+				}
+			}
+
+			comparison := NewComparisonTableFrom(kube, simulated)
+			Expect(comparison.ValueCounts(false)).To(Equal(map[Comparison]int{SameComparison: 2, FlakyComparison: 1, DifferentComparison: 1}))
+			Expect(comparison.ValueCountsByProtocol(false)[v1.ProtocolTCP]).To(Equal(map[Comparison]int{SameComparison: 5, FlakyComparison: 2, DifferentComparison: 1}))
+			Expect(comparison.RenderSuccessTable()).To(ContainSubstring("~"))
+			Expect(kube.RenderTable()).To(ContainSubstring("~60%"))
+
+			stepResult := &StepResult{SimulatedProbe: simulated}
+			stepResult.AddKubeProbe(kube)
+			Expect(stepResult.Passed(false)).To(BeFalse())
+			Expect(stepResult.Passed(true)).To(BeFalse())
+		})
+
+		It("Should pass steps whose flaky cells are within the threshold", func() {
+			pods := []string{"x/a", "x/b"}
+			kube, simulated := probe.NewTable(pods, pods), probe.NewTable(pods, pods)
+			for _, fr := range pods {
+				for _, to := range pods {
+					job := &probe.Job{FromKey: fr, ToKey: to, Protocol: v1.ProtocolTCP, ResolvedPort: 80}
+					combined := probe.ConnectivityAllowed
+					if fr == "x/a" && to == "x/b" {
+						combined = probe.ConnectivityFlaky
+					}
+					Expect(kube.Get(fr, to).AddJobResult(&probe.JobResult{Job: job, Combined: combined})).To(Succeed())
+					Expect(simulated.Get(fr, to).AddJobResult(&probe.JobResult{Job: job, Combined: probe.ConnectivityAllowed})).To(Succeed())
+				}
+			}
+
+			stepResult := &StepResult{SimulatedProbe: simulated}
+			stepResult.AddKubeProbe(kube)
+			Expect(stepResult.Passed(false)).To(BeFalse())
+			stepResult.MaxFlakyPercent = 25
+			Expect(stepResult.Passed(false)).To(BeTrue())
+			stepResult.MaxFlakyPercent = 20
+			Expect(stepResult.Passed(false)).To(BeFalse())
+		})
+	})
+}
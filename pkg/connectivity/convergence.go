@@ -0,0 +1,71 @@
+package connectivity
+
+import (
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultConvergencePollInterval = 250 * time.Millisecond
+
+// Convergence records how long the cluster took to start enforcing a step's actions: the probes whose
+// expected result was changed by the actions are re-run until they all match, or until a deadline passes.
+type Convergence struct {
+	ActionFeatures []string
+	ChangedProbes  int
+	Converged      bool
+	// Latency is measured from the end of the step's actions until the start of the poll in which the
+	// last changed probe matched; it's only meaningful if Converged is true
+	Latency time.Duration
+	Polls   int
+}
+
+// ChangedJobResults returns the results from `after` whose value differs from `before` -- including results
+// which aren't in `before` at all, i.e. for newly-created pods.
+func ChangedJobResults(before *probe.Table, after *probe.Table) []*probe.JobResult {
+	beforeValues := jobResultValues(before)
+	var changed []*probe.JobResult
+	for _, result := range after.JobResults() {
+		if value, ok := beforeValues[result.Job.Key()]; !ok || value != result.Combined {
+			changed = append(changed, result)
+		}
+	}
+	return changed
+}
+
+// AwaitConvergence repeatedly runs the jobs of the expected results which haven't yet matched, until all of
+// them match or the timeout passes.
+func AwaitConvergence(runner probe.JobRunner, expected []*probe.JobResult, timeout time.Duration, pollInterval time.Duration) *Convergence {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	convergence := &Convergence{ChangedProbes: len(expected)}
+
+	pending := map[string]*probe.JobResult{}
+	for _, result := range expected {
+		pending[result.Job.Key()] = result
+	}
+	for len(pending) > 0 {
+		if convergence.Polls > 0 && time.Now().After(deadline) {
+			logrus.Warnf("%d of %d changed probes did not converge within %s", len(pending), len(expected), timeout)
+			return convergence
+		}
+		pollStart := time.Now()
+		convergence.Polls++
+		var jobs []*probe.Job
+		for _, result := range pending {
+			jobs = append(jobs, result.Job)
+		}
+		for _, result := range runner.RunJobs(jobs) {
+			if result.Combined == pending[result.Job.Key()].Combined {
+				delete(pending, result.Job.Key())
+			}
+		}
+		convergence.Latency = pollStart.Sub(start)
+		if len(pending) > 0 {
+			time.Sleep(pollInterval)
+		}
+	}
+	convergence.Converged = true
+	return convergence
+}
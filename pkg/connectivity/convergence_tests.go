@@ -0,0 +1,82 @@
+package connectivity
+
+import (
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+// laggingJobRunner reports every job as blocked until it's been polled `lag` times, and as allowed afterwards
+type laggingJobRunner struct {
+	lag   int
+	polls int
+}
+
+func (l *laggingJobRunner) RunJobs(jobs []*probe.Job) []*probe.JobResult {
+	l.polls++
+	var results []*probe.JobResult
+	for _, job := range jobs {
+		combined := probe.ConnectivityBlocked
+		if l.polls > l.lag {
+			combined = probe.ConnectivityAllowed
+		}
+		results = append(results, &probe.JobResult{Job: job, Combined: combined})
+	}
+	return results
+}
+
+func RunConvergenceTests() {
+	Describe("Convergence", func() {
+		pods := []string{"x/a", "x/b"}
+		table := func(allowedTo string) *probe.Table {
+			t := probe.NewTable(pods, pods)
+			for _, fr := range pods {
+				for _, to := range pods {
+					combined := probe.ConnectivityBlocked
+					if to == allowedTo {
+						combined = probe.ConnectivityAllowed
+					}
+					job := &probe.Job{FromKey: fr, ToKey: to, Protocol: v1.ProtocolTCP, ResolvedPort: 80}
+					Expect(t.Get(fr, to).AddJobResult(&probe.JobResult{Job: job, Combined: combined})).To(Succeed())
+				}
+			}
+			return t
+		}
+
+		It("Should find the changed job results", func() {
+			changed := ChangedJobResults(table("x/a"), table("x/b"))
+			Expect(changed).To(HaveLen(4))
+			Expect(ChangedJobResults(table("x/a"), table("x/a"))).To(BeEmpty())
+			// results for new cells count as changed
+			Expect(ChangedJobResults(probe.NewTable(nil, nil), table("x/a"))).To(HaveLen(4))
+		})
+
+		It("Should poll until the changed results match", func() {
+			expected := jobResultsWithValue(table("x/a").JobResults(), probe.ConnectivityAllowed)
+			convergence := AwaitConvergence(&laggingJobRunner{lag: 2}, expected, time.Minute, time.Millisecond)
+			Expect(convergence.Converged).To(BeTrue())
+			Expect(convergence.ChangedProbes).To(Equal(2))
+			Expect(convergence.Polls).To(Equal(3))
+		})
+
+		It("Should give up after the timeout", func() {
+			expected := jobResultsWithValue(table("x/a").JobResults(), probe.ConnectivityAllowed)
+			convergence := AwaitConvergence(&laggingJobRunner{lag: 1000000}, expected, 10*time.Millisecond, time.Millisecond)
+			Expect(convergence.Converged).To(BeFalse())
+			Expect(convergence.Polls).To(BeNumerically(">", 1))
+		})
+	})
+}
+
+func jobResultsWithValue(results []*probe.JobResult, combined probe.Connectivity) []*probe.JobResult {
+	var picked []*probe.JobResult
+	for _, result := range results {
+		if result.Combined == combined {
+			picked = append(picked, result)
+		}
+	}
+	return picked
+}
@@ -0,0 +1,189 @@
+package connectivity
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/pkg/errors"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ExportTestCasesDir = "testcases"
+	ExportExpectedDir  = "expected"
+	ExportPoliciesDir  = "policies"
+	ExportIndexFile    = "index.json"
+	ExportTopologyFile = "topology.json"
+)
+
+// SimulatedStep is what a step is expected to produce: the policies in effect after its actions, and the
+// truth table of its probe
+type SimulatedStep struct {
+	Policies []*networkingv1.NetworkPolicy
+	Expected *probe.Table
+}
+
+// SimulateTestCase runs a test case's actions against a mock cluster holding resources, and simulates each
+// step's probe -- without touching a real cluster
+func SimulateTestCase(resources *probe.Resources, testCase *generator.TestCase) ([]*SimulatedStep, error) {
+	mock := kube.NewMockKubernetes(1.0)
+	if err := resources.CreateResourcesInKube(mock); err != nil {
+		return nil, errors.WithMessagef(err, "unable to create resources in mock cluster")
+	}
+	testCaseState := &TestCaseState{
+		Kubernetes: mock,
+		Resources:  resources,
+		Policies:   []*networkingv1.NetworkPolicy{},
+	}
+
+	jobBuilder := &probe.JobBuilder{}
+	var steps []*SimulatedStep
+	for stepIndex, step := range testCase.Steps {
+		for actionIndex, action := range step.Actions {
+			if err := testCaseState.ApplyAction(action); err != nil {
+				return nil, errors.WithMessagef(err, "step %d, action %d", stepIndex+1, actionIndex+1)
+			}
+		}
+		parsedPolicy, err := matcher.BuildNetworkPolicies(true, testCaseState.Policies)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "step %d: unable to build network policies", stepIndex+1)
+		}
+		steps = append(steps, &SimulatedStep{
+			Policies: append([]*networkingv1.NetworkPolicy{}, testCaseState.Policies...),
+			Expected: probe.NewSimulatedRunner(parsedPolicy, jobBuilder).RunProbeForConfig(step.Probe, testCaseState.Resources),
+		})
+	}
+	return steps, nil
+}
+
+// ExportIndexEntry points to a test case's files, relative to the export directory
+type ExportIndexEntry struct {
+	Description  string   `json:"description"`
+	Tags         []string `json:"tags"`
+	TestCaseFile string   `json:"testCaseFile"`
+	ExpectedFile string   `json:"expectedFile"`
+	PolicyFiles  []string `json:"policyFiles"`
+}
+
+type ExportedExpectation struct {
+	Description string                     `json:"description"`
+	Steps       []*ExportedStepExpectation `json:"steps"`
+}
+
+type ExportedStepExpectation struct {
+	Probe    *generator.ProbeConfig `json:"probe"`
+	Expected *probe.Table           `json:"expected"`
+}
+
+// ExportTestCases writes a portable copy of the test cases to dir:
+//   - testcases/: each test case, in the format read by generator.LoadTestCases
+//   - expected/: each step's expected truth table, as json and as text
+//   - policies/: the policies in effect after each step, as yaml
+//   - topology.json: the namespaces and pods which the expected results were simulated over
+//   - index.json: each test case's description, tags and files
+func ExportTestCases(dir string, resources *probe.Resources, testCases []*generator.TestCase) error {
+	for _, subdir := range []string{ExportTestCasesDir, ExportExpectedDir, ExportPoliciesDir} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+			return errors.Wrapf(err, "unable to create export directory %s", subdir)
+		}
+	}
+	if err := writeJSONFile(filepath.Join(dir, ExportTopologyFile), resources); err != nil {
+		return err
+	}
+
+	var index []*ExportIndexEntry
+	for i, testCase := range testCases {
+		entry, err := exportTestCase(dir, fmt.Sprintf("%03d-%s", i+1, slugify(testCase.Description)), resources, testCase)
+		if err != nil {
+			return errors.WithMessagef(err, "unable to export test case #%d (%s)", i+1, testCase.Description)
+		}
+		index = append(index, entry)
+	}
+	return writeJSONFile(filepath.Join(dir, ExportIndexFile), index)
+}
+
+func exportTestCase(dir string, name string, resources *probe.Resources, testCase *generator.TestCase) (*ExportIndexEntry, error) {
+	steps, err := SimulateTestCase(resources, testCase)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &ExportIndexEntry{
+		Description:  testCase.Description,
+		Tags:         testCase.Tags.Keys(),
+		TestCaseFile: filepath.Join(ExportTestCasesDir, name+".yaml"),
+		ExpectedFile: filepath.Join(ExportExpectedDir, name+".json"),
+	}
+
+	testCaseBytes, err := yaml.Marshal(testCase)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to marshal test case")
+	}
+	if err := writeFile(filepath.Join(dir, entry.TestCaseFile), testCaseBytes); err != nil {
+		return nil, err
+	}
+
+	expectation := &ExportedExpectation{Description: testCase.Description}
+	text := &strings.Builder{}
+	for i, step := range steps {
+		expectation.Steps = append(expectation.Steps, &ExportedStepExpectation{Probe: testCase.Steps[i].Probe, Expected: step.Expected})
+		text.WriteString(fmt.Sprintf("step %d:\n%s\n", i+1, step.Expected.RenderTable()))
+
+		policyFile := filepath.Join(ExportPoliciesDir, name, fmt.Sprintf("step-%d.yaml", i+1))
+		if err := writeFile(filepath.Join(dir, policyFile), []byte(policiesToYaml(step.Policies))); err != nil {
+			return nil, err
+		}
+		entry.PolicyFiles = append(entry.PolicyFiles, policyFile)
+	}
+	if err := writeJSONFile(filepath.Join(dir, entry.ExpectedFile), expectation); err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(dir, ExportExpectedDir, name+".txt"), []byte(text.String())); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// policiesToYaml writes the policies as a multi-document yaml file, which can be passed to 'kubectl apply'
+func policiesToYaml(policies []*networkingv1.NetworkPolicy) string {
+	var docs []string
+	for _, policy := range policies {
+		docs = append(docs, PrintNetworkPolicy(policy.DeepCopy()))
+	}
+	return strings.Join(docs, "---\n")
+}
+
+var nonSlugCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify makes a description usable as a file name
+func slugify(description string) string {
+	slug := strings.Trim(nonSlugCharacters.ReplaceAllString(strings.ToLower(description), "-"), "-")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-")
+	}
+	return slug
+}
+
+func writeJSONFile(path string, obj interface{}) error {
+	bs, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal json for %s", path)
+	}
+	return writeFile(path, bs)
+}
+
+func writeFile(path string, bs []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "unable to create directory for %s", path)
+	}
+	return errors.Wrapf(os.WriteFile(path, bs, 0644), "unable to write %s", path)
+}
@@ -0,0 +1,52 @@
+package connectivity
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+func RunExportTests() {
+	Describe("Export", func() {
+		It("Should export test cases which load back, with their expected truth tables", func() {
+			resources, err := probe.NewDefaultResources(kube.NewMockKubernetes(1.0), []string{"x", "y", "z"}, []string{"a", "b", "c"}, []int{80}, []v1.Protocol{v1.ProtocolTCP}, nil, 1, false, false, "registry.k8s.io")
+			Expect(err).To(Succeed())
+			testCases := generator.NewTestCaseGenerator(true, "192.168.1.9", "", []string{"x", "y", "z"}, []string{generator.TagSetPodLabels}, []string{}).GenerateTestCases()
+			Expect(testCases).To(HaveLen(1))
+
+			dir := GinkgoT().TempDir()
+			Expect(ExportTestCases(dir, resources, testCases)).To(Succeed())
+
+			var index []*ExportIndexEntry
+			indexBytes, err := os.ReadFile(filepath.Join(dir, ExportIndexFile))
+			Expect(err).To(Succeed())
+			Expect(json.Unmarshal(indexBytes, &index)).To(Succeed())
+			Expect(index).To(HaveLen(1))
+			Expect(index[0].PolicyFiles).To(HaveLen(len(testCases[0].Steps)))
+
+			loaded, err := generator.LoadTestCases(filepath.Join(dir, ExportTestCasesDir))
+			Expect(err).To(Succeed())
+			Expect(loaded).To(HaveLen(1))
+			Expect(loaded[0].Steps).To(Equal(testCases[0].Steps))
+
+			var expectation ExportedExpectation
+			expectedBytes, err := os.ReadFile(filepath.Join(dir, index[0].ExpectedFile))
+			Expect(err).To(Succeed())
+			Expect(json.Unmarshal(expectedBytes, &expectation)).To(Succeed())
+
+			simulated, err := SimulateTestCase(resources, loaded[0])
+			Expect(err).To(Succeed())
+			Expect(expectation.Steps).To(HaveLen(len(simulated)))
+			for i, step := range simulated {
+				Expect(expectation.Steps[i].Expected.RenderTable()).To(Equal(step.Expected.RenderTable()))
+			}
+		})
+	})
+}
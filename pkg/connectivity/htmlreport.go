@@ -0,0 +1,212 @@
+package connectivity
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/maps"
+)
+
+//go:embed htmlreport.html.tmpl
+var htmlReportTemplateText string
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"formatDuration": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+	"formatTime":     func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(htmlReportTemplateText))
+
+// htmlReport is a test run, prepared for rendering as a self-contained html page
+type htmlReport struct {
+	Metadata      *RunMetadata
+	Passed        int
+	Failed        int
+	Tests         []*htmlTest
+	FeatureCharts []*htmlChart
+	TagCharts     []*htmlChart
+}
+
+// htmlChart is a primary tag or feature, with a bar for it and for each of its subs
+type htmlChart struct {
+	Name string
+	Bars []*htmlBar
+}
+
+type htmlBar struct {
+	Name    string
+	Passed  int
+	Total   int
+	Percent float64
+}
+
+type htmlTest struct {
+	Number      int
+	Description string
+	Passed      bool
+	Err         string
+	Tags        []string
+	Duration    time.Duration
+	Wrong       int
+	Flaky       int
+	Steps       []*htmlStep
+}
+
+type htmlStep struct {
+	Number      int
+	Probe       string
+	Duration    time.Duration
+	Explanation string
+	Policies    []string
+	Wrong       int
+	Flaky       int
+	Ignored     int
+	Correct     int
+	Simulated   *htmlTruthTable
+	Tries       []*htmlTruthTable
+}
+
+type htmlTruthTable struct {
+	Caption string
+	Tos     []string
+	Rows    []*htmlTruthTableRow
+}
+
+type htmlTruthTableRow struct {
+	From  string
+	Cells []*htmlTruthTableCell
+}
+
+// htmlTruthTableCell has a line for each of the cell's results; Class is used to highlight mismatches
+type htmlTruthTableCell struct {
+	Value string
+	Title string
+	Class string
+}
+
+func WriteHTMLReport(path string, metadata *RunMetadata, ignoreLoopback bool, results []*Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create html report file %s", path)
+	}
+	defer f.Close()
+	return errors.Wrapf(htmlReportTemplate.Execute(f, newHTMLReport(metadata, ignoreLoopback, results)), "unable to render html report")
+}
+
+func newHTMLReport(metadata *RunMetadata, ignoreLoopback bool, results []*Result) *htmlReport {
+	summary := NewSummaryTableFromResults(ignoreLoopback, results)
+	report := &htmlReport{
+		Metadata:      metadata,
+		FeatureCharts: newHTMLCharts(summary.FeaturePrimaryCounts, summary.FeatureCounts),
+		TagCharts:     newHTMLCharts(summary.TagPrimaryCounts, summary.TagCounts),
+	}
+	for i, result := range results {
+		test := newHTMLTest(i+1, result, ignoreLoopback)
+		if test.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Tests = append(report.Tests, test)
+	}
+	return report
+}
+
+func newHTMLCharts(primaryCounts map[string]map[bool]int, counts map[string]map[string]map[bool]int) []*htmlChart {
+	newBar := func(name string, passFail map[bool]int) *htmlBar {
+		total := passFail[true] + passFail[false]
+		return &htmlBar{Name: name, Passed: passFail[true], Total: total, Percent: percentage(passFail[true], total)}
+	}
+	var charts []*htmlChart
+	for _, primary := range slice.Sort(maps.Keys(counts)) {
+		chart := &htmlChart{Name: primary, Bars: []*htmlBar{newBar("all", primaryCounts[primary])}}
+		for _, sub := range slice.Sort(maps.Keys(counts[primary])) {
+			chart.Bars = append(chart.Bars, newBar(sub, counts[primary][sub]))
+		}
+		charts = append(charts, chart)
+	}
+	return charts
+}
+
+func newHTMLTest(number int, result *Result, ignoreLoopback bool) *htmlTest {
+	test := &htmlTest{
+		Number:      number,
+		Description: result.TestCase.Description,
+		Passed:      resultPassed(result, ignoreLoopback),
+		Tags:        result.TestCase.Tags.Keys(),
+		Duration:    result.Duration,
+	}
+	if result.Err != nil {
+		test.Err = result.Err.Error()
+	}
+	for i, stepResult := range result.Steps {
+		step := newHTMLStep(i+1, result, stepResult, ignoreLoopback)
+		test.Wrong += step.Wrong
+		test.Flaky += step.Flaky
+		test.Steps = append(test.Steps, step)
+	}
+	return test
+}
+
+func newHTMLStep(number int, result *Result, stepResult *StepResult, ignoreLoopback bool) *htmlStep {
+	step := &htmlStep{
+		Number:   number,
+		Probe:    "all available ports/protocols",
+		Duration: stepResult.Duration,
+	}
+	if number <= len(result.TestCase.Steps) {
+		if pp := result.TestCase.Steps[number-1].Probe.PortProtocol; pp != nil {
+			step.Probe = fmt.Sprintf("port %s, protocol %s", pp.Port.String(), pp.Protocol)
+		}
+	}
+	if stepResult.Policy != nil {
+		step.Explanation = stepResult.Policy.ExplainTable()
+	}
+	for _, policy := range stepResult.KubePolicies {
+		step.Policies = append(step.Policies, PrintNetworkPolicy(policy))
+	}
+
+	counts := stepResult.LastComparison().ValueCounts(ignoreLoopback)
+	step.Wrong, step.Flaky, step.Ignored, step.Correct = counts[DifferentComparison], counts[FlakyComparison], counts[IgnoredComparison], counts[SameComparison]
+
+	step.Simulated = newHTMLTruthTable("Simulated", stepResult.SimulatedProbe, nil, ignoreLoopback)
+	for i, kubeProbe := range stepResult.KubeProbes {
+		step.Tries = append(step.Tries, newHTMLTruthTable(fmt.Sprintf("Kube, try %d", i+1), kubeProbe, stepResult.Comparison(i), ignoreLoopback))
+	}
+	return step
+}
+
+// newHTMLTruthTable renders a table's cells; if comparison isn't nil, it's used to highlight the cells
+func newHTMLTruthTable(caption string, table *probe.Table, comparison *ComparisonTable, ignoreLoopback bool) *htmlTruthTable {
+	htmlTable := &htmlTruthTable{Caption: caption, Tos: table.Wrapped.Tos}
+	for _, from := range table.Wrapped.Froms {
+		row := &htmlTruthTableRow{From: from}
+		for _, to := range table.Wrapped.Tos {
+			jobResults := table.Get(from, to).JobResults
+			var values, titles []string
+			for _, key := range slice.Sort(maps.Keys(jobResults)) {
+				values = append(values, jobResults[key].ShortString())
+				titles = append(titles, fmt.Sprintf("%s: %s", key, jobResults[key].Combined))
+			}
+			cell := &htmlTruthTableCell{Value: strings.Join(values, " "), Title: strings.Join(titles, "\n")}
+			if comparison != nil {
+				switch {
+				case ignoreLoopback && from == to:
+					cell.Class = "ignored"
+				case comparison.Get(from, to).Comparison() == DifferentComparison:
+					cell.Class = "wrong"
+				case comparison.Get(from, to).Comparison() == FlakyComparison:
+					cell.Class = "flaky"
+				}
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		htmlTable.Rows = append(htmlTable.Rows, row)
+	}
+	return htmlTable
+}
@@ -0,0 +1,40 @@
+package connectivity
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func RunHTMLReportTests() {
+	Describe("HTML report", func() {
+		resources := newTwoPodResources()
+
+		It("Should highlight mismatched cells, and chart pass rates", func() {
+			step := NewStepResult(newTwoPodTable(resources, blockedCells("x/a -> x/a", "x/a -> x/b")), nil, nil)
+			step.AddKubeProbe(newTwoPodTable(resources, blockedCells("x/b -> x/a", "x/b -> x/b")))
+			testCase := generator.NewSingleStepTestCase("deny all <from x/a>", generator.NewStringSet(generator.TagDenyAll), generator.ProbeAllAvailable)
+			results := []*Result{{TestCase: testCase, Steps: []*StepResult{step}}}
+
+			report := newHTMLReport(nil, true, results)
+			Expect(report.Failed).To(Equal(1))
+			Expect(report.Tests[0].Wrong).To(Equal(2))
+			kubeTable := report.Tests[0].Steps[0].Tries[0]
+			Expect(kubeTable.Rows[0].Cells[0].Class).To(Equal("ignored"))
+			Expect(kubeTable.Rows[0].Cells[1].Class).To(Equal("wrong"))
+			Expect(kubeTable.Rows[1].Cells[0].Class).To(Equal("wrong"))
+			Expect(report.TagCharts).To(HaveLen(1))
+			Expect(report.TagCharts[0].Bars[0]).To(Equal(&htmlBar{Name: "all", Passed: 0, Total: 1, Percent: 0}))
+
+			path := filepath.Join(GinkgoT().TempDir(), "report.html")
+			Expect(WriteHTMLReport(path, nil, true, results)).To(Succeed())
+			html, err := os.ReadFile(path)
+			Expect(err).To(Succeed())
+			Expect(string(html)).To(ContainSubstring(`<td class="wrong" title="TCP/80: blocked">X</td>`))
+			Expect(string(html)).To(ContainSubstring("deny all &lt;from x/a&gt;"))
+		})
+	})
+}
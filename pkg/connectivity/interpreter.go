@@ -8,6 +8,7 @@ import (
 	"github.com/mattfenwick/cyclonus/pkg/generator"
 	"github.com/mattfenwick/cyclonus/pkg/kube"
 	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/mattfenwick/cyclonus/pkg/worker"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	networkingv1 "k8s.io/api/networking/v1"
@@ -26,21 +27,52 @@ type InterpreterConfig struct {
 	PerturbationWaitSeconds          int
 	VerifyClusterStateBeforeTestCase bool
 	BatchJobs                        bool
-	IgnoreLoopback                   bool
-	JobTimeoutSeconds                int
-	FailFast                         bool
+	// AgentAccess is how batches reach the agents in the probe pods; if empty, batches are issued by exec'ing
+	// the worker in the probe pods' server containers instead
+	AgentAccess       worker.AgentAccess
+	IgnoreLoopback    bool
+	JobTimeoutSeconds int
+	FailFast          bool
+	// ConvergenceTimeoutSeconds, if positive, replaces the fixed perturbation wait: after each step's actions,
+	// the probes whose expected results changed are re-run until they match, or for at most this long
+	ConvergenceTimeoutSeconds int
+	// DetectTransients keeps probing the cells whose expected results a step's policy actions don't change while
+	// the actions are applied and take effect, to catch connections briefly allowed or blocked by neither the old
+	// nor the new policies
+	DetectTransients bool
+	// ProbeSamples, if greater than 1, runs each kube probe that many times: probes are consistently allowed or
+	// blocked if at least ProbeConsistencyThreshold of the samples agree, and flaky otherwise.  Steps fail if
+	// more than MaxFlakyPercent of their cells are flaky.
+	ProbeSamples              int
+	ProbeConsistencyThreshold float64
+	MaxFlakyPercent           float64
+	// LongLivedHoldSeconds is how long the connections of long-lived connection tests are held open: it must
+	// cover a step's actions and the time it takes for them to take effect
+	LongLivedHoldSeconds int
 }
 
 func (i *InterpreterConfig) PerturbationWaitDuration() time.Duration {
 	return time.Duration(i.PerturbationWaitSeconds) * time.Second
 }
 
+func (i *InterpreterConfig) LongLivedHoldDuration() time.Duration {
+	return time.Duration(i.LongLivedHoldSeconds) * time.Second
+}
+
+func (i *InterpreterConfig) ConvergenceTimeout() time.Duration {
+	return time.Duration(i.ConvergenceTimeoutSeconds) * time.Second
+}
+
 type Interpreter struct {
 	kubernetes kube.IKubernetes
 	resources  *probe.Resources
 	kubeRunner *probe.Runner
-	jobBuilder *probe.JobBuilder
-	Config     *InterpreterConfig
+	// probeRunner runs the kube probes of probe steps, which may be sampled; kubeRunner is used for monitoring
+	probeRunner *probe.Runner
+	jobBuilder  *probe.JobBuilder
+	// agentClient, if batches are sent to agents, holds connections which Close tears down
+	agentClient *worker.AgentClient
+	Config      *InterpreterConfig
 }
 
 func NewInterpreter(kubernetes kube.IKubernetes, resources *probe.Resources, config *InterpreterConfig) *Interpreter {
@@ -48,23 +80,56 @@ func NewInterpreter(kubernetes kube.IKubernetes, resources *probe.Resources, con
 
 	jobBuilder := &probe.JobBuilder{TimeoutSeconds: config.JobTimeoutSeconds}
 	var kubeRunner *probe.Runner
+	var agentClient *worker.AgentClient
 	if config.BatchJobs {
-		kubeRunner = probe.NewKubeBatchRunner(kubernetes, defaultBatchWorkersCount, jobBuilder)
+		var client worker.BatchClient = &worker.Client{Kubernetes: kubernetes}
+		if config.AgentAccess != "" {
+			agentClient = worker.NewAgentClient(kubernetes, config.AgentAccess, worker.DefaultPort)
+			client = agentClient
+		}
+		kubeRunner = probe.NewKubeBatchRunner(client, defaultBatchWorkersCount, jobBuilder)
 	} else {
 		kubeRunner = probe.NewKubeRunner(kubernetes, defaultWorkersCount, jobBuilder)
 	}
+	probeRunner := kubeRunner
+	if config.ProbeSamples > 1 {
+		probeRunner = &probe.Runner{
+			JobRunner:  probe.NewSampledJobRunner(kubeRunner.JobRunner, config.ProbeSamples, config.ProbeConsistencyThreshold),
+			JobBuilder: jobBuilder,
+		}
+	}
 
 	return &Interpreter{
-		kubernetes: kubernetes,
-		resources:  resources,
-		kubeRunner: kubeRunner,
-		jobBuilder: jobBuilder,
-		Config:     config,
+		kubernetes:  kubernetes,
+		resources:   resources,
+		kubeRunner:  kubeRunner,
+		probeRunner: probeRunner,
+		jobBuilder:  jobBuilder,
+		agentClient: agentClient,
+		Config:      config,
 	}
 }
 
+// Close tears down the interpreter's connections to agents, if any
+func (t *Interpreter) Close() {
+	if t.agentClient != nil {
+		t.agentClient.Close()
+	}
+}
+
+// withResources is a copy of the interpreter which probes, and resets, just the pods of resources
+func (t *Interpreter) withResources(resources *probe.Resources) *Interpreter {
+	interpreter := *t
+	interpreter.resources = resources
+	return &interpreter
+}
+
 func (t *Interpreter) ExecuteTestCase(testCase *generator.TestCase) *Result {
 	result := &Result{InitialResources: t.resources, TestCase: testCase}
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
 	var err error
 
 	// keep track of what's in the cluster, so that we can correctly simulate expected results
@@ -94,43 +159,11 @@ func (t *Interpreter) ExecuteTestCase(testCase *generator.TestCase) *Result {
 
 	// perform perturbations one at a time, and run a probe after each change
 	for stepIndex, step := range testCase.Steps {
-		// TODO grab actual netpols from kube and record in results, for extra debugging/sanity checks
-
-		for actionIndex, action := range step.Actions {
-			if action.CreatePolicy != nil {
-				err = testCaseState.CreatePolicy(action.CreatePolicy.Policy)
-			} else if action.UpdatePolicy != nil {
-				err = testCaseState.UpdatePolicy(action.UpdatePolicy.Policy)
-			} else if action.DeletePolicy != nil {
-				err = testCaseState.DeletePolicy(action.DeletePolicy.Namespace, action.DeletePolicy.Name)
-			} else if action.CreateNamespace != nil {
-				err = testCaseState.CreateNamespace(action.CreateNamespace.Namespace, action.CreateNamespace.Labels)
-			} else if action.SetNamespaceLabels != nil {
-				err = testCaseState.SetNamespaceLabels(action.SetNamespaceLabels.Namespace, action.SetNamespaceLabels.Labels)
-			} else if action.DeleteNamespace != nil {
-				err = testCaseState.DeleteNamespace(action.DeleteNamespace.Namespace)
-			} else if action.ReadNetworkPolicies != nil {
-				err = testCaseState.ReadPolicies(action.ReadNetworkPolicies.Namespaces)
-			} else if action.CreatePod != nil {
-				err = testCaseState.CreatePod(action.CreatePod.Namespace, action.CreatePod.Pod, action.CreatePod.Labels)
-			} else if action.SetPodLabels != nil {
-				ns, pod, labels := action.SetPodLabels.Namespace, action.SetPodLabels.Pod, action.SetPodLabels.Labels
-				err = testCaseState.SetPodLabels(ns, pod, labels)
-			} else if action.DeletePod != nil {
-				err = testCaseState.DeletePod(action.DeletePod.Namespace, action.DeletePod.Pod)
-			} else {
-				err = errors.Errorf("invalid Action at step %d, action %d", stepIndex, actionIndex)
-			}
-			if err != nil {
-				result.Err = err
-				return result
-			}
+		stepResult, err := t.executeStep(testCaseState, stepIndex, step)
+		if err != nil {
+			result.Err = err
+			return result
 		}
-
-		logrus.Infof("step %d: waiting %d seconds for perturbation to take effect", stepIndex+1, t.Config.PerturbationWaitSeconds)
-		time.Sleep(t.Config.PerturbationWaitDuration())
-
-		stepResult := t.runProbe(testCaseState, step.Probe)
 		result.Steps = append(result.Steps, stepResult)
 
 		if t.Config.FailFast && !stepResult.Passed(t.Config.IgnoreLoopback) {
@@ -141,27 +174,221 @@ func (t *Interpreter) ExecuteTestCase(testCase *generator.TestCase) *Result {
 	return result
 }
 
-func (t *Interpreter) runProbe(testCaseState *TestCaseState, probeConfig *generator.ProbeConfig) *StepResult {
-	parsedPolicy := matcher.BuildNetworkPolicies(true, testCaseState.Policies)
+// executeStep applies a step's actions, and probes the cluster.  If the step fails, transient monitoring is
+// stopped and long-lived connections are waited for, so that their probes don't outlive the step.
+func (t *Interpreter) executeStep(testCaseState *TestCaseState, stepIndex int, step *generator.TestStep) (stepResult *StepResult, err error) {
+	// TODO grab actual netpols from kube and record in results, for extra debugging/sanity checks
+	stepStart := time.Now()
+
+	var stopMonitoring func() []*TimedJobResult
+	var longLived *longLivedRun
+	defer func() {
+		if err == nil {
+			return
+		}
+		if stopMonitoring != nil {
+			stopMonitoring()
+		}
+		if longLived != nil {
+			longLived.abandon()
+		}
+	}()
+
+	detectTransients := t.Config.DetectTransients && hasPolicyAction(step)
+	var before *probe.Table
+	if t.Config.ConvergenceTimeoutSeconds > 0 || detectTransients {
+		before, _, err = t.simulateProbe(testCaseState, step.Probe)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var monitoredJobs []*probe.Job
+	if detectTransients {
+		simulatedState, err := testCaseState.SimulateActions(step.Actions)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "step %d", stepIndex+1)
+		}
+		expectedAfter, _, err := t.simulateProbe(simulatedState, step.Probe)
+		if err != nil {
+			return nil, err
+		}
+		monitoredJobs = UnchangedJobs(before, expectedAfter)
+		logrus.Infof("step %d: monitoring %d probes, whose expected results the actions don't change, for transient changes", stepIndex+1, len(monitoredJobs))
+		// monitoring deliberately overlaps with convergence polling, which is when transients happen: job runners
+		// support concurrent RunJobs calls
+		stopMonitoring = MonitorJobs(t.kubeRunner.JobRunner, monitoredJobs, defaultTransientPollInterval)
+	}
+
+	if step.LongLived != nil {
+		longLived, err = t.startLongLivedConnections(testCaseState, step.LongLived)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for actionIndex, action := range step.Actions {
+		err = testCaseState.ApplyAction(action)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "step %d, action %d", stepIndex+1, actionIndex+1)
+		}
+	}
+
+	if longLived != nil {
+		longLived.actionsEnd = time.Since(longLived.start)
+	}
+
+	var convergence *Convergence
+	if t.Config.ConvergenceTimeoutSeconds > 0 {
+		convergence, err = t.awaitConvergence(testCaseState, step, before)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("step %d: %d changed probes converged: %t, after %s and %d polls",
+			stepIndex+1, convergence.ChangedProbes, convergence.Converged, convergence.Latency, convergence.Polls)
+	} else {
+		logrus.Infof("step %d: waiting %d seconds for perturbation to take effect", stepIndex+1, t.Config.PerturbationWaitSeconds)
+		time.Sleep(t.Config.PerturbationWaitDuration())
+	}
+
+	var transients *TransientReport
+	if stopMonitoring != nil {
+		observed := stopMonitoring()
+		stopMonitoring = nil
+		after, _, err := t.simulateProbe(testCaseState, step.Probe)
+		if err != nil {
+			return nil, err
+		}
+		transients = &TransientReport{
+			MonitoredProbes: len(monitoredJobs),
+			Observations:    FindTransientObservations(before, after, observed),
+		}
+		if len(monitoredJobs) > 0 {
+			transients.Polls = len(observed) / len(monitoredJobs)
+		}
+		if len(transients.Observations) > 0 {
+			logrus.Warnf("step %d: found %d transient observations", stepIndex+1, len(transients.Observations))
+		}
+	}
+
+	stepResult, err = t.runProbe(testCaseState, step.Probe)
+	if err != nil {
+		return nil, err
+	}
+	stepResult.Convergence = convergence
+	stepResult.Transients = transients
+	if longLived != nil {
+		expectedAfter, err := t.simulateJobs(testCaseState, longLived.jobs)
+		if err != nil {
+			return nil, err
+		}
+		stepResult.LongLived = longLived.finish(expectedAfter, t.longLivedCutDelay(convergence))
+	}
+	stepResult.Duration = time.Since(stepStart)
+	return stepResult, nil
+}
+
+// startLongLivedConnections opens the connections and gives them time to be established, before a step's actions
+func (t *Interpreter) startLongLivedConnections(testCaseState *TestCaseState, connections *generator.LongLivedConnections) (*longLivedRun, error) {
+	if !testCaseState.Resources.HasEchoServers() {
+		logrus.Warnf("long-lived connections need echo servers, which hold connections open; they'll likely be reported as cut")
+	}
+	jobs := LongLivedJobs(t.jobBuilder, testCaseState.Resources, connections)
+	expectedBefore, err := t.simulateJobs(testCaseState, jobs)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("holding %d long-lived connections open for %s", len(jobs), t.Config.LongLivedHoldDuration())
+	run := &longLivedRun{
+		jobs:           jobs,
+		expectedBefore: expectedBefore,
+		start:          time.Now(),
+		wait:           StartLongLivedConnections(t.kubernetes, jobs, t.Config.LongLivedHoldDuration()),
+	}
+	time.Sleep(defaultLongLivedWarmup)
+	run.actionsStart = time.Since(run.start)
+	return run, nil
+}
+
+// longLivedCutDelay is how long after a step's actions a connection may be cut, and still count as cut
+// immediately: by then, the actions are expected to have taken effect for new connections
+func (t *Interpreter) longLivedCutDelay(convergence *Convergence) time.Duration {
+	if convergence != nil && convergence.Converged {
+		return convergence.Latency + 2*defaultLongLivedPingInterval
+	}
+	return t.Config.PerturbationWaitDuration() + 2*defaultLongLivedPingInterval
+}
+
+// simulateJobs returns the expected results of the jobs, keyed by job
+func (t *Interpreter) simulateJobs(testCaseState *TestCaseState, jobs []*probe.Job) (map[string]probe.Connectivity, error) {
+	parsedPolicy, err := matcher.BuildNetworkPolicies(true, testCaseState.Policies)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to build network policies")
+	}
+	results := map[string]probe.Connectivity{}
+	for _, result := range (&probe.SimulatedJobRunner{Policies: parsedPolicy}).RunJobs(jobs) {
+		results[result.Job.Key()] = result.Combined
+	}
+	return results, nil
+}
+
+func hasPolicyAction(step *generator.TestStep) bool {
+	for _, action := range step.Actions {
+		if action.CreatePolicy != nil || action.UpdatePolicy != nil || action.DeletePolicy != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// awaitConvergence re-probes the cells whose expected values were changed by the step's actions,
+// until they match the simulation of the current cluster state
+func (t *Interpreter) awaitConvergence(testCaseState *TestCaseState, step *generator.TestStep, before *probe.Table) (*Convergence, error) {
+	after, _, err := t.simulateProbe(testCaseState, step.Probe)
+	if err != nil {
+		return nil, err
+	}
+	convergence := AwaitConvergence(t.kubeRunner.JobRunner, ChangedJobResults(before, after), t.Config.ConvergenceTimeout(), defaultConvergencePollInterval)
+	for _, action := range step.Actions {
+		convergence.ActionFeatures = append(convergence.ActionFeatures, action.Feature())
+	}
+	return convergence, nil
+}
 
+func (t *Interpreter) simulateProbe(testCaseState *TestCaseState, probeConfig *generator.ProbeConfig) (*probe.Table, *matcher.Policy, error) {
+	parsedPolicy, err := matcher.BuildNetworkPolicies(true, testCaseState.Policies)
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "unable to build network policies")
+	}
+	simRunner := probe.NewSimulatedRunner(parsedPolicy, t.jobBuilder)
+	return simRunner.RunProbeForConfig(probeConfig, testCaseState.Resources), parsedPolicy, nil
+}
+
+func (t *Interpreter) runProbe(testCaseState *TestCaseState, probeConfig *generator.ProbeConfig) (*StepResult, error) {
 	logrus.Infof("running probe %+v", probeConfig)
 	logrus.Debugf("with resources:\n%s", testCaseState.Resources.RenderTable())
 
-	simRunner := probe.NewSimulatedRunner(parsedPolicy, t.jobBuilder)
+	simulated, parsedPolicy, err := t.simulateProbe(testCaseState, probeConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	stepResult := NewStepResult(
-		simRunner.RunProbeForConfig(probeConfig, testCaseState.Resources),
+		simulated,
 		parsedPolicy,
 		append([]*networkingv1.NetworkPolicy{}, testCaseState.Policies...)) // this looks weird, but just making a new copy to avoid accidentally mutating it elsewhere
 
-	for i := 0; i <= t.Config.KubeProbeRetries; i++ {
-		logrus.Infof("running kube probe on try %d", i+1)
-		stepResult.AddKubeProbe(t.kubeRunner.RunProbeForConfig(probeConfig, testCaseState.Resources))
+	logrus.Infof("running kube probe on try 1")
+	stepResult.MaxFlakyPercent = t.Config.MaxFlakyPercent
+	stepResult.AddKubeProbe(t.probeRunner.RunProbeForConfig(probeConfig, testCaseState.Resources))
+	for i := 1; i <= t.Config.KubeProbeRetries; i++ {
 		// no differences between synthetic and kube probes?  then we can stop
-		if stepResult.Passed(t.Config.IgnoreLoopback) {
+		mismatched := stepResult.MismatchedJobs(t.Config.IgnoreLoopback)
+		if len(mismatched) == 0 {
 			break
 		}
+		logrus.Infof("re-running %d mismatched kube probes on try %d", len(mismatched), i+1)
+		stepResult.AddKubeProbeRetry(testCaseState.Resources, t.probeRunner.JobRunner.RunJobs(mismatched))
 	}
 
-	return stepResult
+	return stepResult, nil
 }
@@ -2,29 +2,59 @@ package connectivity
 
 import (
 	"encoding/xml"
-	junit "github.com/jstemmer/go-junit-report/formatter"
-	"github.com/sirupsen/logrus"
+	"fmt"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
 )
 
-type JUnitTestResult struct {
-	Passed bool
-	Name   string
+// JUnitTestSuite follows the commonly-supported subset of the JUnit xml format: each test case step is a
+// testcase, grouped by test case into a class
+type JUnitTestSuite struct {
+	XMLName    xml.Name        `xml:"testsuite"`
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []JUnitProperty `xml:"properties>property,omitempty"`
+	TestCases  []JUnitTestCase `xml:"testcase"`
+}
+
+type JUnitTestCase struct {
+	XMLName    xml.Name        `xml:"testcase"`
+	Classname  string          `xml:"classname,attr"`
+	Name       string          `xml:"name,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []JUnitProperty `xml:"properties>property,omitempty"`
+	Failure    *JUnitFailure   `xml:"failure,omitempty"`
+	Error      *JUnitFailure   `xml:"error,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
 }
 
-func PrintJUnitResults(filename string, results []*Result, ignoreLoopback bool) error {
+type JUnitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// JUnitFailure is used both for failures -- results which differ from the simulation -- and for errors, which
+// prevented a step from running
+type JUnitFailure struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+func PrintJUnitResults(filename string, metadata *RunMetadata, results []*Result, ignoreLoopback bool) error {
 	if filename == "" {
 		return nil
 	}
 
-	var junitResults []*JUnitTestResult
-	for _, result := range results {
-		junitResults = append(junitResults, &JUnitTestResult{
-			Passed: result.Passed(ignoreLoopback),
-			Name:   result.TestCase.Description,
-		})
-	}
-
 	f, err := os.Create(filename)
 	if err != nil {
 		logrus.Errorf("Unable to create file %q for junit output: %v\n", filename, err)
@@ -32,29 +62,131 @@ func PrintJUnitResults(filename string, results []*Result, ignoreLoopback bool)
 	}
 	defer f.Close()
 
-	junitTestSuite := ResultsToJUnit(junitResults)
+	junitTestSuite := ResultsToJUnit(metadata, results, ignoreLoopback)
 	enc := xml.NewEncoder(f)
 	enc.Indent("", "    ")
 	return enc.Encode(junitTestSuite)
 }
 
-func ResultsToJUnit(results []*JUnitTestResult) junit.JUnitTestSuite {
-	var testCases []junit.JUnitTestCase
-	failed := 0
-
+func ResultsToJUnit(metadata *RunMetadata, results []*Result, ignoreLoopback bool) JUnitTestSuite {
+	suite := JUnitTestSuite{Name: "cyclonus"}
+	var duration time.Duration
 	for _, result := range results {
-		testCase := junit.JUnitTestCase{
-			Name: result.Name,
+		duration += result.Duration
+		for _, testCase := range resultToJUnit(result, ignoreLoopback) {
+			if testCase.Failure != nil {
+				suite.Failures++
+			}
+			if testCase.Error != nil {
+				suite.Errors++
+			}
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+	}
+	suite.Tests = len(suite.TestCases)
+	suite.Time = formatJUnitTime(duration)
+	if metadata != nil {
+		if !metadata.StartTime.IsZero() {
+			suite.Timestamp = metadata.StartTime.Format("2006-01-02T15:04:05")
+		}
+		suite.Properties = []JUnitProperty{
+			{Name: "cyclonus-version", Value: metadata.CyclonusVersion},
+			{Name: "cyclonus-git-sha", Value: metadata.CyclonusGitSHA},
+			{Name: "kubernetes-version", Value: metadata.KubernetesVersion},
+		}
+		for _, cni := range metadata.CNI {
+			suite.Properties = append(suite.Properties, JUnitProperty{Name: "cni", Value: cni})
+		}
+	}
+	return suite
+}
+
+// resultToJUnit reports each of the result's steps as a testcase; if the result has an error, the step which
+// didn't finish is reported as an error
+func resultToJUnit(result *Result, ignoreLoopback bool) []JUnitTestCase {
+	properties := resultJUnitProperties(result)
+
+	var testCases []JUnitTestCase
+	var stepsDuration time.Duration
+	for i, step := range result.Steps {
+		stepsDuration += step.Duration
+		testCase := JUnitTestCase{
+			Classname:  result.TestCase.Description,
+			Name:       fmt.Sprintf("step %d", i+1),
+			Time:       formatJUnitTime(step.Duration),
+			Properties: append([]JUnitProperty{{Name: "tries", Value: intToString(len(step.KubeProbes))}}, properties...),
+			SystemOut:  stepTriesSummary(step, ignoreLoopback),
 		}
-		if !result.Passed {
-			testCase.Failure = &junit.JUnitFailure{}
-			failed++
+		if !step.Passed(ignoreLoopback) {
+			counts := step.LastComparison().ValueCounts(ignoreLoopback)
+			testCase.Failure = &JUnitFailure{
+				Message:  fmt.Sprintf("%d wrong, %d flaky, %d ignored, %d correct after %d tries", counts[DifferentComparison], counts[FlakyComparison], counts[IgnoredComparison], counts[SameComparison], len(step.KubeProbes)),
+				Type:     "mismatch",
+				Contents: stepFailureDetails(step),
+			}
 		}
 		testCases = append(testCases, testCase)
 	}
-	return junit.JUnitTestSuite{
-		Name:      "cyclonus",
-		Failures:  failed,
-		TestCases: testCases,
+
+	if result.Err != nil {
+		// the error's step is the one after the last which finished
+		testCases = append(testCases, JUnitTestCase{
+			Classname:  result.TestCase.Description,
+			Name:       fmt.Sprintf("step %d", len(result.Steps)+1),
+			Time:       formatJUnitTime(result.Duration - stepsDuration),
+			Properties: properties,
+			Error:      &JUnitFailure{Message: result.Err.Error(), Type: "error", Contents: fmt.Sprintf("%+v", result.Err)},
+		})
+	}
+	return testCases
+}
+
+func resultJUnitProperties(result *Result) []JUnitProperty {
+	var properties []JUnitProperty
+	for _, tag := range result.TestCase.Tags.Keys() {
+		properties = append(properties, JUnitProperty{Name: "tag", Value: tag})
+	}
+	features := result.Features()
+	for _, primary := range slice.Sort(maps.Keys(features)) {
+		for _, sub := range slice.Sort(features[primary]) {
+			// some features, such as actions, are already prefixed
+			if !strings.HasPrefix(sub, primary+": ") {
+				sub = fmt.Sprintf("%s: %s", primary, sub)
+			}
+			properties = append(properties, JUnitProperty{Name: "feature", Value: sub})
+		}
+	}
+	return properties
+}
+
+// stepTriesSummary has a line for each try, so that flaky cells fixed by retries are visible
+func stepTriesSummary(step *StepResult, ignoreLoopback bool) string {
+	var lines []string
+	for i := range step.KubeProbes {
+		counts := step.Comparison(i).ValueCounts(ignoreLoopback)
+		lines = append(lines, fmt.Sprintf("try %d: %d wrong, %d flaky, %d ignored, %d correct", i+1, counts[DifferentComparison], counts[FlakyComparison], counts[IgnoredComparison], counts[SameComparison]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stepFailureDetails has the mismatch table, the expected and actual truth tables, and the step's policies
+func stepFailureDetails(step *StepResult) string {
+	details := &strings.Builder{}
+	details.WriteString(fmt.Sprintf("Mismatches ('.' matches, 'X' is wrong, '~' is flaky, '*' was blocked for a non-policy cause):\n%s\n", step.LastComparison().RenderSuccessTable()))
+	details.WriteString(fmt.Sprintf("Expected:\n%s\n", step.SimulatedProbe.RenderTable()))
+	details.WriteString(fmt.Sprintf("Actual:\n%s\n", step.LastKubeProbe().RenderTable()))
+	if step.Policy != nil {
+		details.WriteString(fmt.Sprintf("Policy explanation:\n%s\n", step.Policy.ExplainTable()))
+	}
+	if len(step.KubePolicies) == 0 {
+		details.WriteString("no network policies\n")
+	}
+	for _, policy := range step.KubePolicies {
+		details.WriteString(fmt.Sprintf("Network policy:\n\n%s\n", PrintNetworkPolicy(policy)))
 	}
+	return details.String()
+}
+
+func formatJUnitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
 }
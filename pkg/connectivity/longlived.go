@@ -0,0 +1,212 @@
+package connectivity
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/worker"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultLongLivedPingInterval = 500 * time.Millisecond
+	// defaultLongLivedWarmup gives connections time to be established before a step's actions are applied
+	defaultLongLivedWarmup = 2 * time.Second
+)
+
+type LongLivedOutcome string
+
+const (
+	LongLivedOutcomeKept           LongLivedOutcome = "kept"
+	LongLivedOutcomeCut            LongLivedOutcome = "cut"
+	LongLivedOutcomeCutAfterDelay  LongLivedOutcome = "cut-after-delay"
+	LongLivedOutcomeNotEstablished LongLivedOutcome = "not-established"
+	// LongLivedOutcomeUnstable means the connection failed before the actions were applied, so it says
+	// nothing about the actions
+	LongLivedOutcomeUnstable LongLivedOutcome = "unstable"
+	LongLivedOutcomeError    LongLivedOutcome = "error"
+)
+
+type LongLivedConnectionResult struct {
+	Job *probe.Job
+	// ExpectedBefore and ExpectedAfter are the simulated results for new connections
+	ExpectedBefore probe.Connectivity
+	ExpectedAfter  probe.Connectivity
+	Outcome        LongLivedOutcome
+	// CutAfter is the time from the end of the step's actions until the first failed ping
+	CutAfter time.Duration
+	Error    string
+}
+
+// LongLivedJobs builds a job for each of the connections, addressing pods by ip
+func LongLivedJobs(jobBuilder *probe.JobBuilder, resources *probe.Resources, connections *generator.LongLivedConnections) []*probe.Job {
+	from, to := map[string]bool{}, map[string]bool{}
+	for _, pod := range connections.From {
+		from[pod] = true
+	}
+	for _, pod := range connections.To {
+		to[pod] = true
+	}
+	var jobs []*probe.Job
+	for _, pp := range connections.PortProtocols {
+		for _, job := range jobBuilder.GetJobsForNamedPortProtocol(resources, pp.Port, pp.Protocol, generator.ProbeModePodIP).Valid {
+			if from[job.FromKey] && to[job.ToKey] {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	return jobs
+}
+
+// StartLongLivedConnections holds open a connection for each job -- grouped into one batch per source
+// container -- for `duration`.  The returned function waits for the batches to finish.
+func StartLongLivedConnections(kubernetes kube.IKubernetes, jobs []*probe.Job, duration time.Duration) func() (map[string]*worker.HoldResult, map[string]error) {
+	batches := map[string]*worker.HoldBatch{}
+	batchKeys := map[string]string{}
+	for _, job := range jobs {
+		key := fmt.Sprintf("%s/%s/%s", job.FromNamespace, job.FromPod, job.FromContainer)
+		if _, ok := batches[key]; !ok {
+			batches[key] = &worker.HoldBatch{
+				Namespace: job.FromNamespace,
+				Pod:       job.FromPod,
+				Container: job.FromContainer,
+				Duration:  duration,
+				Interval:  defaultLongLivedPingInterval,
+			}
+		}
+		batches[key].Requests = append(batches[key].Requests, &worker.Request{
+			Key:      job.Key(),
+			Protocol: job.Protocol,
+			Host:     job.ToHost,
+			Port:     job.ResolvedPort,
+		})
+		batchKeys[job.Key()] = key
+	}
+
+	client := &worker.Client{Kubernetes: kubernetes}
+	results := map[string]*worker.HoldResult{}
+	batchErrors := map[string]error{}
+	mutex := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for key, batch := range batches {
+		wg.Add(1)
+		go func(key string, batch *worker.HoldBatch) {
+			defer wg.Done()
+			batchResults, err := client.Hold(batch)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				logrus.Errorf("unable to hold connections from %s: %+v", key, err)
+				batchErrors[key] = err
+				return
+			}
+			for _, result := range batchResults {
+				results[result.Request.Key] = result
+			}
+		}(key, batch)
+	}
+
+	return func() (map[string]*worker.HoldResult, map[string]error) {
+		wg.Wait()
+		// report batch errors by job
+		jobErrors := map[string]error{}
+		for jobKey, batchKey := range batchKeys {
+			if err, ok := batchErrors[batchKey]; ok {
+				jobErrors[jobKey] = err
+			}
+		}
+		return results, jobErrors
+	}
+}
+
+// ClassifyLongLivedConnection determines what happened to a connection, given when the step's actions started
+// and ended -- measured from the start of the connection's batch -- and how long after the actions a cut
+// still counts as immediate.
+func ClassifyLongLivedConnection(result *worker.HoldResult, actionsStart time.Duration, actionsEnd time.Duration, cutDelay time.Duration) (LongLivedOutcome, time.Duration) {
+	if !result.IsEstablished() {
+		return LongLivedOutcomeNotEstablished, 0
+	}
+	failed := result.FirstFailedPing()
+	if failed == nil {
+		return LongLivedOutcomeKept, 0
+	}
+	if failed.Elapsed < actionsStart {
+		return LongLivedOutcomeUnstable, 0
+	}
+	cutAfter := failed.Elapsed - actionsEnd
+	if cutAfter < 0 {
+		cutAfter = 0
+	}
+	if cutAfter <= cutDelay {
+		return LongLivedOutcomeCut, cutAfter
+	}
+	return LongLivedOutcomeCutAfterDelay, cutAfter
+}
+
+var AllLongLivedOutcomes = []LongLivedOutcome{
+	LongLivedOutcomeKept,
+	LongLivedOutcomeCut,
+	LongLivedOutcomeCutAfterDelay,
+	LongLivedOutcomeNotEstablished,
+	LongLivedOutcomeUnstable,
+	LongLivedOutcomeError,
+}
+
+// LongLivedOutcomeCounts groups the results by protocol, and then by outcome
+func LongLivedOutcomeCounts(results []*LongLivedConnectionResult) map[string]map[LongLivedOutcome]int {
+	counts := map[string]map[LongLivedOutcome]int{}
+	for _, result := range results {
+		protocol := strings.ToLower(string(result.Job.Protocol))
+		if _, ok := counts[protocol]; !ok {
+			counts[protocol] = map[LongLivedOutcome]int{}
+		}
+		counts[protocol][result.Outcome]++
+	}
+	return counts
+}
+
+// longLivedRun tracks the connections held open across a step's actions
+type longLivedRun struct {
+	jobs           []*probe.Job
+	expectedBefore map[string]probe.Connectivity
+	start          time.Time
+	actionsStart   time.Duration
+	actionsEnd     time.Duration
+	wait           func() (map[string]*worker.HoldResult, map[string]error)
+}
+
+// abandon waits for the connections to be released, without classifying them, for steps which fail before
+// their results are needed
+func (l *longLivedRun) abandon() {
+	holdResults, holdErrors := l.wait()
+	logrus.Warnf("discarding results of %d long-lived connections, and %d errors, from a failed step", len(holdResults), len(holdErrors))
+}
+
+// finish waits for the connections to be released, and classifies them
+func (l *longLivedRun) finish(expectedAfter map[string]probe.Connectivity, cutDelay time.Duration) []*LongLivedConnectionResult {
+	holdResults, holdErrors := l.wait()
+	var results []*LongLivedConnectionResult
+	for _, job := range l.jobs {
+		result := &LongLivedConnectionResult{
+			Job:            job,
+			ExpectedBefore: l.expectedBefore[job.Key()],
+			ExpectedAfter:  expectedAfter[job.Key()],
+		}
+		if holdResult, ok := holdResults[job.Key()]; ok {
+			result.Outcome, result.CutAfter = ClassifyLongLivedConnection(holdResult, l.actionsStart, l.actionsEnd, cutDelay)
+			result.Error = holdResult.Error
+		} else {
+			result.Outcome = LongLivedOutcomeError
+			if err, ok := holdErrors[job.Key()]; ok {
+				result.Error = err.Error()
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
@@ -0,0 +1,68 @@
+package connectivity
+
+import (
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/worker"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+func RunLongLivedTests() {
+	Describe("Long-lived connections", func() {
+		// pings every second, failing from `failFrom` on
+		holdResult := func(failFrom time.Duration) *worker.HoldResult {
+			result := &worker.HoldResult{}
+			for elapsed := time.Duration(0); elapsed < 10*time.Second; elapsed += time.Second {
+				ping := &worker.Ping{Elapsed: elapsed}
+				if failFrom >= 0 && elapsed >= failFrom {
+					ping.Error = "unable to read: i/o timeout"
+				}
+				result.Pings = append(result.Pings, ping)
+			}
+			return result
+		}
+		actionsStart, actionsEnd, cutDelay := 2*time.Second, 3*time.Second, 2*time.Second
+
+		It("Should classify connections", func() {
+			outcome, _ := ClassifyLongLivedConnection(holdResult(-1), actionsStart, actionsEnd, cutDelay)
+			Expect(outcome).To(Equal(LongLivedOutcomeKept))
+
+			outcome, cutAfter := ClassifyLongLivedConnection(holdResult(4*time.Second), actionsStart, actionsEnd, cutDelay)
+			Expect(outcome).To(Equal(LongLivedOutcomeCut))
+			Expect(cutAfter).To(Equal(time.Second))
+
+			// cut while the actions were being applied
+			outcome, cutAfter = ClassifyLongLivedConnection(holdResult(2*time.Second), actionsStart, actionsEnd, cutDelay)
+			Expect(outcome).To(Equal(LongLivedOutcomeCut))
+			Expect(cutAfter).To(Equal(time.Duration(0)))
+
+			outcome, cutAfter = ClassifyLongLivedConnection(holdResult(8*time.Second), actionsStart, actionsEnd, cutDelay)
+			Expect(outcome).To(Equal(LongLivedOutcomeCutAfterDelay))
+			Expect(cutAfter).To(Equal(5 * time.Second))
+
+			outcome, _ = ClassifyLongLivedConnection(holdResult(time.Second), actionsStart, actionsEnd, cutDelay)
+			Expect(outcome).To(Equal(LongLivedOutcomeUnstable))
+
+			outcome, _ = ClassifyLongLivedConnection(&worker.HoldResult{Error: "connection refused"}, actionsStart, actionsEnd, cutDelay)
+			Expect(outcome).To(Equal(LongLivedOutcomeNotEstablished))
+		})
+
+		It("Should count outcomes by protocol", func() {
+			result := func(protocol v1.Protocol, outcome LongLivedOutcome) *LongLivedConnectionResult {
+				return &LongLivedConnectionResult{Job: &probe.Job{Protocol: protocol}, Outcome: outcome}
+			}
+			counts := LongLivedOutcomeCounts([]*LongLivedConnectionResult{
+				result(v1.ProtocolTCP, LongLivedOutcomeCut),
+				result(v1.ProtocolTCP, LongLivedOutcomeCut),
+				result(v1.ProtocolUDP, LongLivedOutcomeKept),
+			})
+			Expect(counts).To(Equal(map[string]map[LongLivedOutcome]int{
+				"tcp": {LongLivedOutcomeCut: 2},
+				"udp": {LongLivedOutcomeKept: 1},
+			}))
+		})
+	})
+}
@@ -1,248 +1,234 @@
 package connectivity
 
-/*
-TODO
 import (
 	"fmt"
-	connectivitykube "github.com/mattfenwick/cyclonus/pkg/connectivity/kube"
-	"github.com/mattfenwick/cyclonus/pkg/connectivity/synthetic"
-	"github.com/mattfenwick/cyclonus/pkg/explainer"
-	"github.com/mattfenwick/cyclonus/pkg/kube"
-	"github.com/mattfenwick/cyclonus/pkg/matcher"
-	"github.com/mattfenwick/cyclonus/pkg/utils"
-	"github.com/olekukonko/tablewriter"
-	"github.com/sirupsen/logrus"
-	v1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
-	"os"
-	"sigs.k8s.io/yaml"
 	"strings"
-	"time"
+	"sync"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/maps"
 )
 
-type MultipleContextTestCase struct {
-	KubePolicies              []*networkingv1.NetworkPolicy
-	NetpolCreationWaitSeconds int
-	Port                      intstr.IntOrString
-	Protocol                  v1.Protocol
-	KubeClients               map[string]*kube.Kubernetes
-	KubeResources             map[string]*connectivitykube.Resources
-	SyntheticResources        *synthetic.Resources
-	NamespacesToClean         []string
-	Policy                    *matcher.Policy
+// ContextTarget is a cluster to run test cases on.  PodIP and PodIPv6 are the ips of the pod which the test
+// cases' ipblocks are built around, in this cluster.
+type ContextTarget struct {
+	Interpreter *Interpreter
+	PodIP       string
+	PodIPv6     string
 }
 
-type MultipleContextTestCaseResult struct {
-	TestCase        *MultipleContextTestCase
-	SyntheticResult *synthetic.Result
-	KubeResults     map[string]*connectivitykube.Results
-	Errors          []error
+// MultipleContextTester runs each test case on several clusters in parallel.  The test cases' ipblocks are
+// built around the reference ips, and rewritten for each cluster, since pod ips differ between clusters.
+type MultipleContextTester struct {
+	Targets          map[string]*ContextTarget
+	ReferencePodIP   string
+	ReferencePodIPv6 string
 }
 
-type MultipleContextTester struct{}
+func NewMultipleContextTester(targets map[string]*ContextTarget, referencePodIP string, referencePodIPv6 string) *MultipleContextTester {
+	return &MultipleContextTester{
+		Targets:          targets,
+		ReferencePodIP:   referencePodIP,
+		ReferencePodIPv6: referencePodIPv6,
+	}
+}
 
-func NewMultipleContextTester() *MultipleContextTester {
-	return &MultipleContextTester{}
+func (m *MultipleContextTester) Contexts() []string {
+	return slice.Sort(maps.Keys(m.Targets))
 }
 
-type workerResult struct {
-	ContextName string
-	Results     *connectivitykube.Results
-	Err         error
+// MultipleContextResult is a test case's result on each of the clusters, by context
+type MultipleContextResult struct {
+	TestCase *generator.TestCase
+	Results  map[string]*Result
 }
 
-func (t *MultipleContextTester) TestNetworkPolicy(testCase *MultipleContextTestCase) *MultipleContextTestCaseResult {
-	result := &MultipleContextTestCaseResult{
-		TestCase: testCase,
-		SyntheticResult: synthetic.RunSyntheticProbe(&synthetic.Request{
-			Protocol:  testCase.Protocol,
-			Port:      testCase.Port,
-			Resources: testCase.SyntheticResources,
-			Policies:  testCase.Policy,
-		}),
-		KubeResults: map[string]*connectivitykube.Results{},
+func (m *MultipleContextTester) ExecuteTestCase(testCase *generator.TestCase) *MultipleContextResult {
+	result := &MultipleContextResult{TestCase: testCase, Results: map[string]*Result{}}
+	mutex := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for context, target := range m.Targets {
+		wg.Add(1)
+		go func(context string, target *ContextTarget) {
+			defer wg.Done()
+			contextResult := m.executeOnTarget(testCase, target)
+			mutex.Lock()
+			defer mutex.Unlock()
+			result.Results[context] = contextResult
+		}(context, target)
 	}
+	wg.Wait()
+	return result
+}
 
-	resultChan := make(chan *workerResult, len(testCase.KubeClients))
-	for contextName := range testCase.KubeClients {
-		go func(context string) {
-			results, err := t.testWorker(testCase, context)
-			resultChan <- &workerResult{
-				ContextName: context,
-				Results:     results,
-				Err:         err,
-			}
-		}(contextName)
+func (m *MultipleContextTester) executeOnTarget(testCase *generator.TestCase, target *ContextTarget) *Result {
+	rewritten, err := m.rewriteIPBlocks(testCase, target)
+	if err != nil {
+		return &Result{TestCase: testCase, Err: err}
 	}
+	return target.Interpreter.ExecuteTestCase(rewritten)
+}
 
-	for i := 0; i < len(testCase.KubeClients); i++ {
-		results := <-resultChan
-		if results.Err == nil {
-			result.KubeResults[results.ContextName] = results.Results
-		} else {
-			result.Errors = append(result.Errors, results.Err)
+func (m *MultipleContextTester) rewriteIPBlocks(testCase *generator.TestCase, target *ContextTarget) (*generator.TestCase, error) {
+	rewritten, err := testCase.RewriteIPBlocks(m.ReferencePodIP, target.PodIP)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to rewrite ipv4 ipblocks")
+	}
+	if m.ReferencePodIPv6 != "" && target.PodIPv6 != "" {
+		rewritten, err = rewritten.RewriteIPBlocks(m.ReferencePodIPv6, target.PodIPv6)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to rewrite ipv6 ipblocks")
 		}
 	}
-
-	return result
+	return rewritten, nil
 }
 
-func (t *MultipleContextTester) testWorker(testCase *MultipleContextTestCase, contextName string) (*connectivitykube.Results, error) {
-	kubeClient := testCase.KubeClients[contextName]
-	utils.DoOrDie(kubeClient.DeleteAllNetworkPoliciesInNamespaces(testCase.NamespacesToClean))
-
-	for _, kubePolicy := range testCase.KubePolicies {
-		_, err := kubeClient.CreateNetworkPolicy(kubePolicy)
-		if err != nil {
-			return nil, err
+// CellComparisons compares, for each cluster, the kube results of a step's last try to the simulation.  It's
+// keyed by cell -- "from -> to" and the port/protocol -- and then by context.  Contexts which didn't get to
+// the step are absent.
+func (r *MultipleContextResult) CellComparisons(stepIndex int, ignoreLoopback bool) map[string]map[string]Comparison {
+	cells := map[string]map[string]Comparison{}
+	for context, result := range r.Results {
+		if stepIndex >= len(result.Steps) {
+			continue
+		}
+		comparison := result.Steps[stepIndex].LastComparison()
+		for _, key := range comparison.Wrapped.Keys() {
+			item := comparison.Get(key.From, key.To)
+			for jobKey, kr := range item.Kube.JobResults {
+				cell := fmt.Sprintf("%s -> %s %s", key.From, key.To, jobKey)
+				if _, ok := cells[cell]; !ok {
+					cells[cell] = map[string]Comparison{}
+				}
+				switch {
+				case ignoreLoopback && key.From == key.To:
+					cells[cell][context] = IgnoredComparison
+				case kr.Combined == probe.ConnectivityFlaky:
+					cells[cell][context] = FlakyComparison
+				case kr.Combined == item.Simulated.JobResults[jobKey].Combined:
+					cells[cell][context] = SameComparison
+				default:
+					cells[cell][context] = DifferentComparison
+				}
+			}
 		}
 	}
-
-	logrus.Infof("waiting %d seconds for network policy to create and become active", testCase.NetpolCreationWaitSeconds)
-	time.Sleep(time.Duration(testCase.NetpolCreationWaitSeconds) * time.Second)
-
-	logrus.Infof("running probe on context %s", contextName)
-
-	return connectivitykube.RunKubeProbe(kubeClient, &connectivitykube.Request{
-		Resources:       testCase.KubeResources[contextName],
-		Port:            testCase.Port,
-		Protocol:        testCase.Protocol,
-		NumberOfWorkers: 5,
-	}), nil
+	return cells
 }
 
-type MultipleContextTestCasePrinter struct {
-	Noisy            bool
-	IgnoreLoopback   bool
-	Contexts         []string
-	DifferenceCounts [][]int
+type MultipleContextPrinter struct {
+	Noisy          bool
+	IgnoreLoopback bool
+	Contexts       []string
+	Results        []*MultipleContextResult
 }
 
-func (t *MultipleContextTestCasePrinter) PrintTestCaseResult(result *MultipleContextTestCaseResult) {
-	policy := result.TestCase.Policy
+func (p *MultipleContextPrinter) PrintTestCaseResult(result *MultipleContextResult) {
+	p.Results = append(p.Results, result)
 
-	policyBytes, err := yaml.Marshal(result.TestCase.KubePolicies)
-	utils.DoOrDie(err)
-	fmt.Printf("Network policy:\n\n%s\n", policyBytes)
-
-	fmt.Printf("Policy explained:\n%s\n", explainer.TableExplainer(policy))
-
-	//fmt.Println("expected results:")
-	//fmt.Println("Expected ingress:")
-	//result.SyntheticResult.Ingress.Table().Render()
-	//
-	//fmt.Println("Expected egress:")
-	//result.SyntheticResult.Egress.Table().Render()
-
-	fmt.Println("Expected connectivity:")
-	fmt.Println(result.SyntheticResult.Combined.Table())
-
-	foundDiscrepancy := false
+	fmt.Printf("evaluating test case: %s\n", result.TestCase.Description)
+	for _, context := range p.Contexts {
+		if err := result.Results[context].Err; err != nil {
+			fmt.Printf("test case failed to execute on context %s: %+v\n", context, err)
+		}
+	}
+	for i := range result.TestCase.Steps {
+		fmt.Printf("step %d:\n", i+1)
+		if policies := p.stepPolicies(result, i); len(policies) > 0 {
+			for _, policy := range policies {
+				fmt.Printf("Network policy:\n\n%s\n", policy)
+			}
+		} else {
+			fmt.Println("no network policies")
+		}
+		cells := result.CellComparisons(i, p.IgnoreLoopback)
+		fmt.Printf("%s\n", p.renderCellMatrix(cells))
+	}
+}
 
-	var falseCounts []int
-	for _, contextName := range t.Contexts {
-		kubeResults := result.KubeResults[contextName]
-		comparison := result.SyntheticResult.Combined.Compare(kubeResults.TruthTable())
-		counts := comparison.ValueCounts(t.IgnoreLoopback)
-		if counts.False > 0 {
-			fmt.Printf("results for context %s:\n", contextName)
-			fmt.Printf("found %d true, %d false, %d no value, %d ignored from %d total\n", counts.True, counts.False, counts.NoValue, counts.Ignored, counts.Total)
-			foundDiscrepancy = true
+// stepPolicies are the policies of the first context which got to the step; other contexts' policies differ
+// at most in their ipblocks
+func (p *MultipleContextPrinter) stepPolicies(result *MultipleContextResult, stepIndex int) []string {
+	for _, context := range p.Contexts {
+		if contextResult := result.Results[context]; stepIndex < len(contextResult.Steps) {
+			return slice.Map(PrintNetworkPolicy, contextResult.Steps[stepIndex].KubePolicies)
 		}
-		falseCounts = append(falseCounts, counts.False)
 	}
-	t.DifferenceCounts = append(t.DifferenceCounts, falseCounts)
+	return nil
+}
 
-	if foundDiscrepancy {
-		for _, contextName := range t.Contexts {
-			fmt.Printf("results for context %s:\n", contextName)
-			kubeResults := result.KubeResults[contextName]
-			fmt.Println(kubeResults.TruthTable().Table())
+// renderCellMatrix has a row for each cell which differs from the simulation on any cluster -- or for every
+// cell, if noisy -- and a column for each cluster
+func (p *MultipleContextPrinter) renderCellMatrix(cells map[string]map[string]Comparison) string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	table.SetHeader(append([]string{"Cell"}, p.Contexts...))
+
+	shown := 0
+	for _, cell := range slice.Sort(maps.Keys(cells)) {
+		row := []string{cell}
+		isDifferent := false
+		for _, context := range p.Contexts {
+			comparison, ok := cells[cell][context]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			if comparison == DifferentComparison || comparison == FlakyComparison {
+				isDifferent = true
+			}
+			row = append(row, comparison.ShortString())
+		}
+		if isDifferent || p.Noisy {
+			table.Append(row)
+			shown++
 		}
-	} else {
-		fmt.Println("no differences found for policy")
 	}
+	if shown == 0 {
+		return fmt.Sprintf("all %d cells matched the simulation on every context", len(cells))
+	}
+	table.Render()
+	return fmt.Sprintf("cells compared to the simulation ('.' matches, 'X' is wrong, '~' is flaky, '?' is ignored):\n%s", str.String())
 }
 
-func (t *MultipleContextTestCasePrinter) PrintFinish() {
-	csv := []string{strings.Join(t.Contexts, ",")}
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader(t.Contexts)
-	for _, falseCounts := range t.DifferenceCounts {
-		var row []string
-		for _, falses := range falseCounts {
-			row = append(row, fmt.Sprintf("%d", falses))
+func (p *MultipleContextPrinter) PrintSummary() {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	table.SetRowLine(true)
+	table.SetHeader(append([]string{"Test"}, p.Contexts...))
+
+	passed := map[string]int{}
+	for i, result := range p.Results {
+		row := []string{fmt.Sprintf("%d: %s", i+1, result.TestCase.Description)}
+		for _, context := range p.Contexts {
+			contextResult := result.Results[context]
+			switch {
+			case contextResult.Err != nil:
+				row = append(row, "error")
+			case contextResult.Passed(p.IgnoreLoopback):
+				row = append(row, "passed")
+				passed[context]++
+			default:
+				wrong := 0
+				for _, step := range contextResult.Steps {
+					wrong += step.LastComparison().ValueCounts(p.IgnoreLoopback)[DifferentComparison]
+				}
+				row = append(row, fmt.Sprintf("failed (%d wrong)", wrong))
+			}
 		}
-		csv = append(csv, strings.Join(row, ","))
 		table.Append(row)
 	}
+	footer := []string{"Passed"}
+	for _, context := range p.Contexts {
+		footer = append(footer, fmt.Sprintf("%d / %d", passed[context], len(p.Results)))
+	}
+	table.SetFooter(footer)
 	table.Render()
-
-	fmt.Printf("\n\n%s\n\n", strings.Join(csv, "\n"))
+	fmt.Printf("Summary by context:\n%s\n", str.String())
 }
-*/
-
-//func SetupClusterTODODelete(kubernetes *kube.Kubernetes, namespaces []string, pods []string, port int, protocol v1.Protocol) (*connectivitykube.Resources, *synthetic.Resources, error) {
-//	kubeResources := connectivitykube.NewDefaultResources(namespaces, pods, []int{port}, []v1.Protocol{protocol})
-//
-//	err := kubeResources.CreateResourcesInKube(kubernetes)
-//	if err != nil {
-//		return nil, nil, err
-//	}
-//
-//	err = waitForPodsReadyTODODelete(kubernetes, namespaces, pods, 60)
-//	if err != nil {
-//		return nil, nil, err
-//	}
-//
-//	podList, err := kubernetes.GetPodsInNamespaces(namespaces)
-//	if err != nil {
-//		return nil, nil, err
-//	}
-//	var syntheticPods []*synthetic.Pod
-//	for _, pod := range podList {
-//		ip := pod.Status.PodIP
-//		if ip == "" {
-//			return nil, nil, errors.Errorf("no ip found for pod %s/%s", pod.Namespace, pod.Name)
-//		}
-//		syntheticPods = append(syntheticPods, &synthetic.Pod{
-//			Namespace: pod.Namespace,
-//			Name:      pod.Name,
-//			Labels:    pod.Labels,
-//			IP:        ip,
-//		})
-//		log.Infof("ip for pod %s/%s: %s", pod.Namespace, pod.Name, ip)
-//	}
-//
-//	resources, err := synthetic.NewResources(kubeResources.Namespaces, syntheticPods)
-//	if err != nil {
-//		return nil, nil, err
-//	}
-//
-//	return kubeResources, resources, nil
-//}
-
-//func waitForPodsReadyTODODelete(kubernetes *kube.Kubernetes, namespaces []string, pods []string, timeoutSeconds int) error {
-//	sleep := 5
-//	for i := 0; i < timeoutSeconds; i += sleep {
-//		podList, err := kubernetes.GetPodsInNamespaces(namespaces)
-//		if err != nil {
-//			return err
-//		}
-//
-//		ready := 0
-//		for _, pod := range podList {
-//			if pod.Status.Phase == "Running" && pod.Status.PodIP != "" {
-//				ready++
-//			}
-//		}
-//		if ready == len(namespaces)*len(pods) {
-//			return nil
-//		}
-//
-//		log.Infof("waiting for pods to be running and have IP addresses")
-//		time.Sleep(time.Duration(sleep) * time.Second)
-//	}
-//	return errors.Errorf("pods not ready")
-//}
@@ -0,0 +1,39 @@
+package connectivity
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func RunMultipleContextTesterTests() {
+	Describe("MultipleContextResult", func() {
+		resources := newTwoPodResources()
+
+		It("Should compare each context's cells to its simulation", func() {
+			expected := map[string]probe.Connectivity{"x/a -> x/b": probe.ConnectivityBlocked}
+
+			correct := NewStepResult(newTwoPodTable(resources, expected), nil, nil)
+			correct.AddKubeProbe(newTwoPodTable(resources, expected))
+			wrong := NewStepResult(newTwoPodTable(resources, expected), nil, nil)
+			wrong.AddKubeProbe(newTwoPodTable(resources, map[string]probe.Connectivity{"x/b -> x/a": probe.ConnectivityFlaky}))
+
+			testCase := generator.NewSingleStepTestCase("deny", generator.NewStringSet(generator.TagDenyAll), generator.ProbeAllAvailable)
+			result := &MultipleContextResult{
+				TestCase: testCase,
+				Results: map[string]*Result{
+					"correct": {TestCase: testCase, Steps: []*StepResult{correct}},
+					"wrong":   {TestCase: testCase, Steps: []*StepResult{wrong}},
+					"errored": {TestCase: testCase},
+				},
+			}
+
+			cells := result.CellComparisons(0, true)
+			Expect(cells).To(HaveLen(4))
+			Expect(cells["x/a -> x/b TCP/80"]).To(Equal(map[string]Comparison{"correct": SameComparison, "wrong": DifferentComparison}))
+			Expect(cells["x/b -> x/a TCP/80"]).To(Equal(map[string]Comparison{"correct": SameComparison, "wrong": FlakyComparison}))
+			Expect(cells["x/a -> x/a TCP/80"]).To(Equal(map[string]Comparison{"correct": IgnoredComparison, "wrong": IgnoredComparison}))
+		})
+	})
+}
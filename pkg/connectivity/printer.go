@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"time"
 
 	"github.com/mattfenwick/collections/pkg/slice"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
 
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
 	"github.com/mattfenwick/cyclonus/pkg/generator"
 	"github.com/mattfenwick/cyclonus/pkg/utils"
 	"github.com/olekukonko/tablewriter"
@@ -23,6 +25,12 @@ type Printer struct {
 	Noisy            bool
 	IgnoreLoopback   bool
 	JunitResultsFile string
+	// ResultsFile and HTMLReportFile, if set, are where PrintSummary writes the results, along with Metadata
+	ResultsFile    string
+	HTMLReportFile string
+	Metadata       *RunMetadata
+	// CoverageStrength, if positive, is the size of the feature combinations whose coverage PrintSummary reports
+	CoverageStrength int
 	Results          []*Result
 }
 
@@ -33,13 +41,64 @@ func (t *Printer) PrintSummary() {
 		fmt.Println(passFailTable(primary, counts, nil, nil))
 	}
 	fmt.Println(protocolPassFailTable(summary.ProtocolCounts))
+	if len(summary.ProtocolLatencies) > 0 {
+		fmt.Println(protocolLatencyTable(summary.ProtocolLatencies))
+	}
+	if len(summary.ActionConvergences) > 0 {
+		fmt.Println(actionConvergenceTable(summary.ActionConvergences))
+	}
+	if len(summary.TransientSteps) > 0 {
+		fmt.Println(transientStepsTable(summary.TransientSteps))
+	}
+	if len(summary.LongLivedCounts) > 0 {
+		fmt.Println(longLivedOutcomesTable(summary.LongLivedCounts))
+	}
+	if len(summary.RetriedSteps) > 0 {
+		fmt.Println(retriedStepsTable(summary.RetriedSteps, summary.FlakyCells, summary.FailingCells))
+	}
 
 	fmt.Printf("Feature results:\n%s\n\n", t.printMarkdownFeatureTable(summary.FeaturePrimaryCounts, summary.FeatureCounts))
 	fmt.Printf("Tag results:\n%s\n", t.printMarkdownFeatureTable(summary.TagPrimaryCounts, summary.TagCounts))
 
-	if err := PrintJUnitResults(t.JunitResultsFile, t.Results, t.IgnoreLoopback); err != nil {
+	if t.CoverageStrength > 0 {
+		coverage, err := NewFeatureCoverageFromResults(t.CoverageStrength, t.Results)
+		if err != nil {
+			logrus.Errorf("unable to compute feature combination coverage: %+v", err)
+		} else {
+			fmt.Println(FeatureCoverageTable(coverage))
+		}
+	}
+
+	if err := PrintJUnitResults(t.JunitResultsFile, t.Metadata, t.Results, t.IgnoreLoopback); err != nil {
 		logrus.Errorf("unable to dump JUnit test results: %+v", err)
 	}
+
+	t.recordEndTime()
+	t.WriteResultsFile()
+
+	if t.HTMLReportFile != "" {
+		if err := WriteHTMLReport(t.HTMLReportFile, t.Metadata, t.IgnoreLoopback, t.Results); err != nil {
+			logrus.Errorf("unable to write html report: %+v", err)
+		}
+	}
+}
+
+// WriteResultsFile writes the results so far, if a results file was requested
+func (t *Printer) WriteResultsFile() {
+	if t.ResultsFile == "" {
+		return
+	}
+	t.recordEndTime()
+	if err := NewResultsFile(t.Metadata, t.IgnoreLoopback, t.Results).Write(t.ResultsFile); err != nil {
+		logrus.Errorf("unable to write results file: %+v", err)
+	}
+}
+
+// recordEndTime only records the end time once, so that re-rendering a run's results doesn't change it
+func (t *Printer) recordEndTime() {
+	if t.Metadata != nil && t.Metadata.EndTime.IsZero() {
+		t.Metadata.EndTime = time.Now()
+	}
 }
 
 const (
@@ -105,7 +164,7 @@ func (t *Printer) printTestSummary(rows [][]string) {
 	table := tablewriter.NewWriter(tableString)
 	table.SetRowLine(true)
 
-	table.SetHeader([]string{"Test", "Result", "Step/Try", "Wrong", "Right", "Ignored", "TCP", "SCTP", "UDP"})
+	table.SetHeader([]string{"Test", "Result", "Step/Try", "Wrong", "Right", "Ignored", "Flaky", "TCP", "SCTP", "UDP"})
 
 	table.AppendBulk(rows)
 
@@ -153,25 +212,145 @@ func passFailTable(caption string, passFailCounts map[string]map[bool]int, passe
 	return str.String()
 }
 
+// FeatureCoverageTable shows how many of the possible feature combinations are covered, by categories
+func FeatureCoverageTable(coverage *generator.FeatureCoverage) string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	str.WriteString(fmt.Sprintf("Feature combination coverage, of %d features:\n", coverage.Strength))
+
+	table.SetHeader([]string{"Categories", "Covered", "Total", "Covered %"})
+
+	for _, row := range append(coverage.ByCategories(), coverage.Total()) {
+		table.Append([]string{row.Categories, intToString(row.Covered), intToString(row.Total), fmt.Sprintf("%.0f", percentage(row.Covered, row.Total))})
+	}
+
+	table.Render()
+	return str.String()
+}
+
 func protocolPassFailTable(protocolCounts map[v1.Protocol]map[Comparison]int) string {
 	str := &strings.Builder{}
 	table := tablewriter.NewWriter(str)
 	table.SetAutoWrapText(false)
 	str.WriteString("Pass/Fail for probes on protocols:\n")
 
-	table.SetHeader([]string{"Protocol", "Passed", "Failed", "Passed %"})
+	table.SetHeader([]string{"Protocol", "Passed", "Failed", "Flaky", "Passed %"})
 
-	var rows []*passFailRow
 	for protocol, counts := range protocolCounts {
-		rows = append(rows, &passFailRow{
+		row := &passFailRow{
 			Feature: fmt.Sprintf("probe on %s", protocol),
 			Passed:  counts[SameComparison],
 			Failed:  counts[DifferentComparison],
+		}
+		table.Append([]string{row.Feature, intToString(row.Passed), intToString(row.Failed), intToString(counts[FlakyComparison]), fmt.Sprintf("%.0f", PassedPercentage(row))})
+	}
+
+	table.Render()
+	return str.String()
+}
+
+func protocolLatencyTable(protocolLatencies map[v1.Protocol][]time.Duration) string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	str.WriteString("Latencies for probes on protocols:\n")
+
+	table.SetHeader([]string{"Protocol", "Probes", "p50", "p90", "p99", "Max"})
+
+	for _, protocol := range slice.Sort(maps.Keys(protocolLatencies)) {
+		latencies := protocolLatencies[protocol]
+		table.Append([]string{
+			fmt.Sprintf("probe on %s", protocol),
+			intToString(len(latencies)),
+			probe.FormatLatency(LatencyPercentile(latencies, 50)),
+			probe.FormatLatency(LatencyPercentile(latencies, 90)),
+			probe.FormatLatency(LatencyPercentile(latencies, 99)),
+			probe.FormatLatency(LatencyPercentile(latencies, 100)),
 		})
 	}
 
-	for _, row := range rows {
-		table.Append([]string{row.Feature, intToString(row.Passed), intToString(row.Failed), fmt.Sprintf("%.0f", PassedPercentage(row))})
+	table.Render()
+	return str.String()
+}
+
+// actionConvergenceTable only computes latency percentiles over converged steps
+func actionConvergenceTable(actionConvergences map[string][]*Convergence) string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	str.WriteString("Convergence latencies for actions:\n")
+
+	table.SetHeader([]string{"Action", "Steps", "Converged", "Timed out", "p50", "p90", "Max"})
+
+	for _, action := range slice.Sort(maps.Keys(actionConvergences)) {
+		var latencies []time.Duration
+		for _, convergence := range actionConvergences[action] {
+			if convergence.Converged {
+				latencies = append(latencies, convergence.Latency)
+			}
+		}
+		total := len(actionConvergences[action])
+		table.Append([]string{
+			action,
+			intToString(total),
+			intToString(len(latencies)),
+			intToString(total - len(latencies)),
+			probe.FormatLatency(LatencyPercentile(latencies, 50)),
+			probe.FormatLatency(LatencyPercentile(latencies, 90)),
+			probe.FormatLatency(LatencyPercentile(latencies, 100)),
+		})
+	}
+
+	table.Render()
+	return str.String()
+}
+
+func transientStepsTable(rows [][]string) string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	str.WriteString("Transient observations during policy actions:\n")
+
+	table.SetHeader([]string{"Test", "Step", "Monitored probes", "Polls", "Transients"})
+	table.AppendBulk(rows)
+
+	table.Render()
+	return str.String()
+}
+
+func retriedStepsTable(rows [][]string, flaky int, failing int) string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	str.WriteString("Cells re-run after differing from the simulation:\n")
+
+	table.SetHeader([]string{"Test", "Step", "Tries", "Flaky", "Consistently failing"})
+	table.AppendBulk(rows)
+	table.SetFooter([]string{"", "", "Total", intToString(flaky), intToString(failing)})
+
+	table.Render()
+	return str.String()
+}
+
+func longLivedOutcomesTable(counts map[string]map[LongLivedOutcome]int) string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	str.WriteString("Long-lived connection outcomes (reported, not counted towards pass/fail):\n")
+
+	header := []string{"Protocol"}
+	for _, outcome := range AllLongLivedOutcomes {
+		header = append(header, string(outcome))
+	}
+	table.SetHeader(header)
+
+	for _, protocol := range slice.Sort(maps.Keys(counts)) {
+		row := []string{protocol}
+		for _, outcome := range AllLongLivedOutcomes {
+			row = append(row, intToString(counts[protocol][outcome]))
+		}
+		table.Append(row)
 	}
 
 	table.Render()
@@ -238,14 +417,41 @@ func (t *Printer) PrintStep(i int, step *generator.TestStep, stepResult *StepRes
 		panic(errors.Errorf("found 0 KubeResults for step, expected 1 or more"))
 	}
 
+	if convergence := stepResult.Convergence; convergence != nil {
+		if convergence.Converged {
+			fmt.Printf("%d changed probes converged after %s (%d polls)\n", convergence.ChangedProbes, probe.FormatLatency(convergence.Latency), convergence.Polls)
+		} else {
+			fmt.Printf("%d changed probes did not converge (%d polls)\n", convergence.ChangedProbes, convergence.Polls)
+		}
+	}
+
+	if transients := stepResult.Transients; transients != nil && len(transients.Observations) > 0 {
+		fmt.Printf("Warning: %d observations, over %d polls of %d probes, were inconsistent with both the before and after states of the policy actions:\n%s\n",
+			len(transients.Observations), transients.Polls, transients.MonitoredProbes, renderTransientObservationsTable(transients.Observations))
+	}
+
+	if len(stepResult.LongLived) > 0 {
+		fmt.Printf("Long-lived connections (reported, not counted towards pass/fail):\n%s\n", renderLongLivedTable(stepResult.LongLived))
+	}
+
+	if len(stepResult.CellHistories) > 0 {
+		flaky, failing := stepResult.FlakyAndFailingCells()
+		fmt.Printf("%d cells were re-run: %d flaky, %d consistently failing:\n%s\n", len(stepResult.CellHistories), flaky, failing, renderCellHistoriesTable(stepResult.CellHistories))
+	}
+
 	comparison := stepResult.LastComparison()
 	counts := comparison.ValueCounts(t.IgnoreLoopback)
 	if counts[DifferentComparison] > 0 {
 		fmt.Printf("Discrepancy found:")
 	}
-	fmt.Printf("%d wrong, %d ignored, %d correct\n", counts[DifferentComparison], counts[IgnoredComparison], counts[SameComparison])
+	fmt.Printf("%d wrong, %d flaky, %d ignored, %d correct\n", counts[DifferentComparison], counts[FlakyComparison], counts[IgnoredComparison], counts[SameComparison])
+
+	if nonPolicyBlocked := comparison.NonPolicyBlocked(); len(nonPolicyBlocked) > 0 {
+		fmt.Printf("Warning: %d probes were blocked for reasons other than network policies, and are marked with '*':\n%s\n",
+			len(nonPolicyBlocked), renderNonPolicyBlockedTable(nonPolicyBlocked))
+	}
 
-	if counts[DifferentComparison] > 0 || t.Noisy {
+	if counts[DifferentComparison] > 0 || counts[FlakyComparison] > 0 || t.Noisy {
 		fmt.Printf("Expected ingress:\n%s\n", stepResult.SimulatedProbe.RenderIngress())
 
 		fmt.Printf("Expected egress:\n%s\n", stepResult.SimulatedProbe.RenderEgress())
@@ -255,6 +461,9 @@ func (t *Printer) PrintStep(i int, step *generator.TestStep, stepResult *StepRes
 		for i, kubeResult := range stepResult.KubeProbes {
 			fmt.Printf("kube results, try %d:\n%s\n", i, kubeResult.RenderTable())
 		}
+		if t.Noisy {
+			fmt.Printf("kube latencies (last round):\n%s\n", stepResult.LastKubeProbe().RenderLatency())
+		}
 
 		fmt.Printf("\nActual vs expected (last round):\n%s\n", comparison.RenderSuccessTable())
 	} else {
@@ -262,6 +471,71 @@ func (t *Printer) PrintStep(i int, step *generator.TestStep, stepResult *StepRes
 	}
 }
 
+func renderNonPolicyBlockedTable(results []*probe.JobResult) string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"From", "To", "Port/Protocol", "Cause", "Output"})
+	table.SetAutoWrapText(false)
+	for _, result := range results {
+		table.Append([]string{result.Job.FromKey, result.Job.ToKey, result.Key(), string(result.ProbeError), result.Output})
+	}
+	table.Render()
+	return tableString.String()
+}
+
+func renderTransientObservationsTable(observations []*TransientObservation) string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"From", "To", "Port/Protocol", "Observed", "Before", "After", "Elapsed"})
+	table.SetAutoWrapText(false)
+	for _, o := range observations {
+		table.Append([]string{o.Result.Job.FromKey, o.Result.Job.ToKey, o.Result.Key(),
+			string(o.Result.Combined), string(o.Before), string(o.After), probe.FormatLatency(o.Elapsed)})
+	}
+	table.Render()
+	return tableString.String()
+}
+
+func renderCellHistoriesTable(histories map[string]*CellHistory) string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"From", "To", "Port/Protocol", "Expected", "Tries", "Outcome"})
+	table.SetAutoWrapText(false)
+	for _, key := range slice.Sort(maps.Keys(histories)) {
+		history := histories[key]
+		var tries []string
+		for _, attempt := range history.Attempts {
+			tries = append(tries, fmt.Sprintf("%d: %s", attempt.Try, attempt.Result.Combined.ShortString()))
+		}
+		outcome := "consistently failing"
+		if history.IsFlaky() {
+			outcome = "flaky"
+		}
+		job := history.Job()
+		table.Append([]string{job.FromKey, job.ToKey, fmt.Sprintf("%d/%s", job.ResolvedPort, job.Protocol),
+			history.Expected.ShortString(), strings.Join(tries, ", "), outcome})
+	}
+	table.Render()
+	return tableString.String()
+}
+
+func renderLongLivedTable(results []*LongLivedConnectionResult) string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"From", "To", "Port/Protocol", "New connections before", "New connections after", "Outcome", "Cut after", "Error"})
+	table.SetAutoWrapText(false)
+	for _, r := range results {
+		cutAfter := ""
+		if r.Outcome == LongLivedOutcomeCut || r.Outcome == LongLivedOutcomeCutAfterDelay {
+			cutAfter = probe.FormatLatency(r.CutAfter)
+		}
+		table.Append([]string{r.Job.FromKey, r.Job.ToKey, fmt.Sprintf("%d/%s", r.Job.ResolvedPort, r.Job.Protocol),
+			string(r.ExpectedBefore), string(r.ExpectedAfter), string(r.Outcome), cutAfter, r.Error})
+	}
+	table.Render()
+	return tableString.String()
+}
+
 func PrintNetworkPolicy(p *networkingv1.NetworkPolicy) string {
 	// TODO is this a bad idea?
 	// nil these out so the output isn't full of junk
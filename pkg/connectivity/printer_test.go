@@ -1,50 +1,104 @@
 package connectivity
 
 import (
-	junit "github.com/jstemmer/go-junit-report/formatter"
+	"encoding/xml"
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/generator"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
 )
 
 func RunPrinterTests() {
 	Describe("JUnit cyclonus output", func() {
-		It("should convert results to junit", func() {
-			testCases := []struct {
-				desc    string
-				results []*JUnitTestResult
-				junit   junit.JUnitTestSuite
-			}{
-				{
-					desc:    "Empty summary",
-					results: nil,
-					junit: junit.JUnitTestSuite{
-						Failures:  0,
-						Name:      "cyclonus",
-						TestCases: nil,
-					},
-				}, {
-					desc: "2 pass 2 fail",
-					results: []*JUnitTestResult{
-						{Name: "test1", Passed: true},
-						{Name: "test2 with spaces", Passed: false},
-						{Name: "test3 with + special %chars/", Passed: true},
-						{Name: "test4 with\nnewlines", Passed: false},
-					},
-					junit: junit.JUnitTestSuite{
-						Failures: 2,
-						Name:     "cyclonus",
-						TestCases: []junit.JUnitTestCase{
-							{Name: "test1", Failure: nil},
-							{Name: "test2 with spaces", Failure: &junit.JUnitFailure{}},
-							{Name: "test3 with + special %chars/", Failure: nil},
-							{Name: "test4 with\nnewlines", Failure: &junit.JUnitFailure{}},
-						},
-					},
-				},
+		resources := newTwoPodResources()
+		blocked := blockedCells("x/a -> x/b", "x/b -> x/a")
+		// step simulates blocked traffic, and gets the given kube results on each try
+		step := func(duration time.Duration, kubeBlocked ...bool) *StepResult {
+			stepResult := NewStepResult(newTwoPodTable(resources, blocked), nil, nil)
+			for _, isBlocked := range kubeBlocked {
+				if isBlocked {
+					stepResult.AddKubeProbe(newTwoPodTable(resources, blocked))
+				} else {
+					stepResult.AddKubeProbe(newTwoPodTable(resources, nil))
+				}
+			}
+			stepResult.Duration = duration
+			return stepResult
+		}
+		testCase := func(description string) *generator.TestCase {
+			return generator.NewTestCase(description, generator.NewStringSet(generator.TagDenyAll),
+				generator.NewTestStep(generator.ProbeAllAvailable), generator.NewTestStep(generator.ProbeAllAvailable))
+		}
+
+		It("should convert empty results to junit", func() {
+			Expect(ResultsToJUnit(nil, nil, false)).To(Equal(JUnitTestSuite{Name: "cyclonus", Time: "0.000"}))
+		})
+
+		It("should report each step as a testcase, and errors as errors", func() {
+			results := []*Result{
+				{TestCase: testCase("passed after retry"), Duration: 3 * time.Second, Steps: []*StepResult{step(time.Second, true), step(2*time.Second, false, true)}},
+				{TestCase: testCase("failed"), Duration: time.Second, Steps: []*StepResult{step(time.Second, false)}},
+				{TestCase: testCase("errored"), Duration: 1500 * time.Millisecond, Steps: []*StepResult{step(time.Second, true)}, Err: errors.New("unable to create policy")},
 			}
-			for _, testCase := range testCases {
-				actual := ResultsToJUnit(testCase.results)
-				Expect(actual).To(Equal(testCase.junit))
+			suite := ResultsToJUnit(&RunMetadata{KubernetesVersion: "v1.30.0", CNI: []string{"calico/node:v3.28.0"}}, results, true)
+
+			Expect(suite.Tests).To(Equal(5))
+			Expect(suite.Failures).To(Equal(1))
+			Expect(suite.Errors).To(Equal(1))
+			Expect(suite.Time).To(Equal("5.500"))
+			Expect(suite.Properties).To(ContainElements(
+				JUnitProperty{Name: "kubernetes-version", Value: "v1.30.0"},
+				JUnitProperty{Name: "cni", Value: "calico/node:v3.28.0"}))
+
+			retried := suite.TestCases[1]
+			Expect(retried.Classname).To(Equal("passed after retry"))
+			Expect(retried.Name).To(Equal("step 2"))
+			Expect(retried.Time).To(Equal("2.000"))
+			Expect(retried.Failure).To(BeNil())
+			Expect(retried.SystemOut).To(Equal("try 1: 2 wrong, 0 flaky, 2 ignored, 0 correct\ntry 2: 0 wrong, 0 flaky, 2 ignored, 2 correct"))
+			Expect(retried.Properties).To(ContainElements(
+				JUnitProperty{Name: "tries", Value: "2"},
+				JUnitProperty{Name: "tag", Value: generator.TagDenyAll}))
+
+			failed := suite.TestCases[2]
+			Expect(failed.Failure).ToNot(BeNil())
+			Expect(failed.Failure.Message).To(Equal("2 wrong, 0 flaky, 2 ignored, 0 correct after 1 tries"))
+			Expect(failed.Failure.Contents).To(ContainSubstring("Mismatches"))
+			Expect(failed.Failure.Contents).To(ContainSubstring("no network policies"))
+
+			errored := suite.TestCases[4]
+			Expect(errored.Classname).To(Equal("errored"))
+			Expect(errored.Name).To(Equal("step 2"))
+			Expect(errored.Time).To(Equal("0.500"))
+			Expect(errored.Failure).To(BeNil())
+			Expect(errored.Error.Message).To(Equal("unable to create policy"))
+		})
+
+		It("should keep names with spaces, special characters and newlines", func() {
+			descriptions := []string{"test1", "test2 with spaces", "test3 with + special %chars/", "test4 with\nnewlines"}
+			var results []*Result
+			for i, description := range descriptions {
+				// the 2nd and 4th test cases fail
+				results = append(results, &Result{TestCase: testCase(description), Duration: time.Second, Steps: []*StepResult{step(time.Second, i%2 == 0)}})
+			}
+			suite := ResultsToJUnit(nil, results, true)
+
+			Expect(suite.Tests).To(Equal(4))
+			Expect(suite.Failures).To(Equal(2))
+			for i, description := range descriptions {
+				Expect(suite.TestCases[i].Classname).To(Equal(description))
+				Expect(suite.TestCases[i].Name).To(Equal("step 1"))
+				Expect(suite.TestCases[i].Failure == nil).To(Equal(i%2 == 0))
+			}
+
+			bs, err := xml.Marshal(suite)
+			Expect(err).To(Succeed())
+			var parsed JUnitTestSuite
+			Expect(xml.Unmarshal(bs, &parsed)).To(Succeed())
+			for i, description := range descriptions {
+				Expect(parsed.TestCases[i].Classname).To(Equal(description))
 			}
 		})
 	})
@@ -1,6 +1,10 @@
 package probe
 
-import "github.com/pkg/errors"
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
 
 type Connectivity string
 
@@ -11,6 +15,8 @@ const (
 	ConnectivityInvalidPortProtocol Connectivity = "invalidportprotocol"
 	ConnectivityBlocked             Connectivity = "blocked"
 	ConnectivityAllowed             Connectivity = "allowed"
+	// ConnectivityFlaky is for sampled kube probes which were neither consistently allowed nor blocked
+	ConnectivityFlaky Connectivity = "flaky"
 )
 
 var AllConnectivity = []Connectivity{
@@ -20,6 +26,7 @@ var AllConnectivity = []Connectivity{
 	ConnectivityInvalidPortProtocol,
 	ConnectivityBlocked,
 	ConnectivityAllowed,
+	ConnectivityFlaky,
 }
 
 func (p Connectivity) ShortString() string {
@@ -32,6 +39,8 @@ func (p Connectivity) ShortString() string {
 		return "X"
 	case ConnectivityAllowed:
 		return "."
+	case ConnectivityFlaky:
+		return "~"
 	case ConnectivityInvalidNamedPort:
 		return "P"
 	case ConnectivityInvalidPortProtocol:
@@ -40,3 +49,35 @@ func (p Connectivity) ShortString() string {
 		panic(errors.Errorf("invalid Connectivity value: %+v", p))
 	}
 }
+
+// ProbeError explains why a kube probe failed to connect
+type ProbeError string
+
+const (
+	ProbeErrorNone    ProbeError = ""
+	ProbeErrorTimeout ProbeError = "timeout"
+	ProbeErrorRefused ProbeError = "refused"
+	ProbeErrorDNS     ProbeError = "dns"
+	ProbeErrorUnknown ProbeError = "unknown"
+)
+
+// ParseProbeError classifies the output of a failed probe.  It recognizes both the markers
+// printed by 'agnhost connect' -- TIMEOUT, REFUSED, DNS -- and go's dial errors.
+func ParseProbeError(output string) ProbeError {
+	switch {
+	case strings.Contains(output, "TIMEOUT") || strings.Contains(output, "i/o timeout"):
+		return ProbeErrorTimeout
+	case strings.Contains(output, "REFUSED") || strings.Contains(output, "connection refused"):
+		return ProbeErrorRefused
+	case strings.Contains(output, "DNS") || strings.Contains(output, "no such host"):
+		return ProbeErrorDNS
+	default:
+		return ProbeErrorUnknown
+	}
+}
+
+// IsPolicyCause is true for failures that a network policy could cause: dropped packets time out,
+// and rejected packets are refused.  DNS failures and unknown errors point to a problem elsewhere.
+func (e ProbeError) IsPolicyCause() bool {
+	return e == ProbeErrorNone || e == ProbeErrorTimeout || e == ProbeErrorRefused
+}
@@ -0,0 +1,35 @@
+package probe
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func RunConnectivityTests() {
+	Describe("ProbeError", func() {
+		It("Should classify agnhost and go dial errors", func() {
+			Expect(ParseProbeError("TIMEOUT")).To(Equal(ProbeErrorTimeout))
+			Expect(ParseProbeError("dial tcp 10.0.0.1:80: i/o timeout")).To(Equal(ProbeErrorTimeout))
+			Expect(ParseProbeError("REFUSED\ncommand terminated with exit code 1")).To(Equal(ProbeErrorRefused))
+			Expect(ParseProbeError("dial tcp 10.0.0.1:80: connect: connection refused")).To(Equal(ProbeErrorRefused))
+			Expect(ParseProbeError("DNS")).To(Equal(ProbeErrorDNS))
+			Expect(ParseProbeError("OTHER: dial tcp: lookup s-x-a.x.svc.cluster.local: no such host")).To(Equal(ProbeErrorDNS))
+			Expect(ParseProbeError("OTHER: something else")).To(Equal(ProbeErrorUnknown))
+		})
+
+		It("Should not mistake the command line's timeout flag for a timeout", func() {
+			output := "unable to run command '/agnhost connect s-x-a.x.svc.cluster.local:80 --timeout=1s --protocol=tcp': DNS: exit status 1"
+			Expect(ParseProbeError(output)).To(Equal(ProbeErrorDNS))
+		})
+
+		It("Should flag blocked results with non-policy causes", func() {
+			Expect((&JobResult{Combined: ConnectivityBlocked, ProbeError: ProbeErrorTimeout}).IsBlockedByNonPolicyCause()).To(BeFalse())
+			Expect((&JobResult{Combined: ConnectivityBlocked, ProbeError: ProbeErrorRefused}).IsBlockedByNonPolicyCause()).To(BeFalse())
+			Expect((&JobResult{Combined: ConnectivityBlocked, ProbeError: ProbeErrorDNS}).IsBlockedByNonPolicyCause()).To(BeTrue())
+			Expect((&JobResult{Combined: ConnectivityBlocked, ProbeError: ProbeErrorUnknown}).IsBlockedByNonPolicyCause()).To(BeTrue())
+			// simulated results don't have probe errors
+			Expect((&JobResult{Combined: ConnectivityBlocked}).IsBlockedByNonPolicyCause()).To(BeFalse())
+			Expect((&JobResult{Combined: ConnectivityCheckFailed, ProbeError: ProbeErrorUnknown}).IsBlockedByNonPolicyCause()).To(BeFalse())
+		})
+	})
+}
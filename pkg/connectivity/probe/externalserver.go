@@ -0,0 +1,61 @@
+package probe
+
+import (
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	ExternalServerNamespace = "cyclonus-external"
+	ExternalServerPodName   = "echo"
+)
+
+// NewExternalServer models a cyclonus-managed stand-in for an out-of-cluster destination, so that egress
+// ipblocks can be probed without internet access.  It serves the same ports and protocols as the test pods.
+func NewExternalServer(ports []int, protocols []v1.Protocol, imageRegistry string) *Pod {
+	return NewDefaultPod(ExternalServerNamespace, ExternalServerPodName, ports, protocols, false, false, imageRegistry)
+}
+
+// KubeExternalServerPod runs the server on the host network: its ip is the node's, which pod and namespace
+// selectors don't match -- just like an out-of-cluster address.
+func KubeExternalServerPod(server *Pod) *v1.Pod {
+	kubePod := server.KubePod()
+	kubePod.Spec.HostNetwork = true
+	return kubePod
+}
+
+// CreateExternalServer creates the server -- in its own namespace, outside of the test namespaces -- if it
+// doesn't already exist, and waits for it to get an ip.
+func CreateExternalServer(kubernetes kube.IKubernetes, server *Pod, timeoutSeconds int) (string, error) {
+	if _, err := kubernetes.GetNamespace(server.Namespace); err != nil {
+		_, err = kubernetes.CreateNamespace(KubeNamespace(server.Namespace, map[string]string{"ns": server.Namespace}))
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := kubernetes.GetPod(server.Namespace, server.Name); err != nil {
+		_, err = kubernetes.CreatePod(KubeExternalServerPod(server))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	sleep := 5
+	for i := 0; i < timeoutSeconds; i += sleep {
+		kubePod, err := kubernetes.GetPod(server.Namespace, server.Name)
+		if err != nil {
+			return "", err
+		}
+		if kubePod.Status.Phase == v1.PodRunning && kubePod.Status.PodIP != "" {
+			logrus.Infof("external server %s/%s running at %s", server.Namespace, server.Name, kubePod.Status.PodIP)
+			return kubePod.Status.PodIP, nil
+		}
+		logrus.Infof("waiting for external server %s/%s to be running and have an IP address", server.Namespace, server.Name)
+		time.Sleep(time.Duration(sleep) * time.Second)
+	}
+	return "", errors.Errorf("external server %s/%s not ready", server.Namespace, server.Name)
+}
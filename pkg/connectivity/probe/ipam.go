@@ -0,0 +1,186 @@
+package probe
+
+import (
+	"math/big"
+	"net/netip"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/pkg/errors"
+)
+
+var (
+	DefaultPodCIDRs     = []string{"10.244.0.0/16"}
+	DefaultServiceCIDRs = []string{"10.96.0.0/12"}
+
+	DefaultDualStackPodCIDRs     = []string{"10.244.0.0/16", "fd00:10:244::/56"}
+	DefaultDualStackServiceCIDRs = []string{"10.96.0.0/12", "fd00:10:96::/112"}
+)
+
+// IPAM simulates the assignment of pod and service IPs, so that ipblock policies can be evaluated
+// without a cluster.  Each CIDR corresponds to one IP family; with two CIDRs -- one v4, one v6 --
+// pods and services are dual-stack.  Assignment is deterministic: the nth address handed out
+// from a CIDR is always the same.
+type IPAM struct {
+	PodCIDRs     []string
+	ServiceCIDRs []string
+}
+
+func NewIPAM(podCIDRs []string, serviceCIDRs []string) (*IPAM, error) {
+	if err := validateCIDRs(podCIDRs); err != nil {
+		return nil, errors.WithMessagef(err, "invalid pod cidrs")
+	}
+	if err := validateCIDRs(serviceCIDRs); err != nil {
+		return nil, errors.WithMessagef(err, "invalid service cidrs")
+	}
+	if len(podCIDRs) != len(serviceCIDRs) {
+		return nil, errors.Errorf("pod and service cidrs must have the same number of ip families, found %d and %d", len(podCIDRs), len(serviceCIDRs))
+	}
+	for i := range podCIDRs {
+		if netip.MustParsePrefix(podCIDRs[i]).Addr().Is4() != netip.MustParsePrefix(serviceCIDRs[i]).Addr().Is4() {
+			return nil, errors.Errorf("pod cidr %s and service cidr %s must be of the same ip family", podCIDRs[i], serviceCIDRs[i])
+		}
+	}
+	return &IPAM{PodCIDRs: podCIDRs, ServiceCIDRs: serviceCIDRs}, nil
+}
+
+func NewDefaultIPAM() *IPAM {
+	return &IPAM{PodCIDRs: DefaultPodCIDRs, ServiceCIDRs: DefaultServiceCIDRs}
+}
+
+func validateCIDRs(cidrs []string) error {
+	if len(cidrs) < 1 || len(cidrs) > 2 {
+		return errors.Errorf("expected 1 or 2 cidrs, found %d", len(cidrs))
+	}
+	var families []bool
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return errors.Wrapf(err, "unable to parse cidr %s", cidr)
+		}
+		families = append(families, prefix.Addr().Is4())
+	}
+	if len(families) == 2 && families[0] == families[1] {
+		return errors.Errorf("dual-stack cidrs must be of different ip families: %+v", cidrs)
+	}
+	return nil
+}
+
+// PodIPs returns the addresses -- one per family -- for the nth pod
+func (i *IPAM) PodIPs(n int) ([]string, error) {
+	return nthAddresses(i.PodCIDRs, n)
+}
+
+// ServiceIPs returns the addresses -- one per family -- for the nth service
+func (i *IPAM) ServiceIPs(n int) ([]string, error) {
+	return nthAddresses(i.ServiceCIDRs, n)
+}
+
+func nthAddresses(cidrs []string, n int) ([]string, error) {
+	var ips []string
+	for _, cidr := range cidrs {
+		ip, err := NthAddressInCIDR(cidr, n)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// NthAddressInCIDR skips the network address, so that n = 0 gives the first usable address.
+func NthAddressInCIDR(cidr string, n int) (string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to parse cidr %s", cidr)
+	}
+	prefix = prefix.Masked()
+	base := prefix.Addr()
+	hostBits := base.BitLen() - prefix.Bits()
+	offset := big.NewInt(int64(n) + 1)
+	// reserve the broadcast address for ipv4
+	size := new(big.Int).Lsh(big.NewInt(1), uint(hostBits))
+	if base.Is4() {
+		size.Sub(size, big.NewInt(1))
+	}
+	if offset.Cmp(size) >= 0 {
+		return "", errors.Errorf("cidr %s exhausted: unable to allocate address %d", cidr, n)
+	}
+	bytes := base.AsSlice()
+	sum := new(big.Int).Add(new(big.Int).SetBytes(bytes), offset).Bytes()
+	// left-pad back to the original length
+	padded := make([]byte, len(bytes))
+	copy(padded[len(padded)-len(sum):], sum)
+	addr, ok := netip.AddrFromSlice(padded)
+	if !ok {
+		return "", errors.Errorf("unable to compute address %d in cidr %s", n, cidr)
+	}
+	return addr.String(), nil
+}
+
+// AssignIPs returns a new object in which every pod without IPs gets pod and service IPs from the IPAM.
+// Pods which already have IPs keep them; assigned IPs never collide with existing ones.
+// It should not affect the original Resources object.
+func (r *Resources) AssignIPs(ipam *IPAM) (*Resources, error) {
+	usedPodIPs, usedServiceIPs := r.usedIPs()
+	pods := slice.SortOn(func(p *Pod) string { return p.PodString().String() }, r.Pods)
+	assigned := map[string]*Pod{}
+	nextPod, nextService := 0, 0
+	for _, pod := range pods {
+		newPod := pod.Copy()
+		if pod.IP == "" {
+			ips, next, err := allocate(ipam.PodIPs, nextPod, usedPodIPs)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "unable to assign pod ips to %s", pod.PodString())
+			}
+			nextPod = next
+			newPod.IP, newPod.IPs = ips[0], ips
+		}
+		if pod.ServiceIP == "" {
+			ips, next, err := allocate(ipam.ServiceIPs, nextService, usedServiceIPs)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "unable to assign service ips to %s", pod.PodString())
+			}
+			nextService = next
+			newPod.ServiceIP, newPod.ServiceIPs = ips[0], ips
+		}
+		assigned[pod.PodString().String()] = newPod
+	}
+	// preserve the original pod order
+	newPods := slice.Map(func(p *Pod) *Pod { return assigned[p.PodString().String()] }, r.Pods)
+	return &Resources{
+		Namespaces:  r.Namespaces,
+		Pods:        newPods,
+		IPAM:        ipam,
+		ExternalIPs: r.ExternalIPs,
+	}, nil
+}
+
+func (r *Resources) usedIPs() (map[string]bool, map[string]bool) {
+	podIPs, serviceIPs := map[string]bool{}, map[string]bool{}
+	for _, pod := range r.Pods {
+		for _, ip := range append([]string{pod.IP}, pod.IPs...) {
+			podIPs[ip] = true
+		}
+		for _, ip := range append([]string{pod.ServiceIP}, pod.ServiceIPs...) {
+			serviceIPs[ip] = true
+		}
+	}
+	return podIPs, serviceIPs
+}
+
+// allocate finds the first set of addresses, starting at index `start`, which don't collide with `used`.
+// It returns the addresses and the next index to try.
+func allocate(nthIPs func(int) ([]string, error), start int, used map[string]bool) ([]string, int, error) {
+	for n := start; ; n++ {
+		ips, err := nthIPs(n)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !slice.Any(func(ip string) bool { return used[ip] }, ips) {
+			for _, ip := range ips {
+				used[ip] = true
+			}
+			return ips, n + 1, nil
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package probe
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func RunIPAMTests() {
+	Describe("IPAM", func() {
+		It("Should compute addresses in ipv4 and ipv6 cidrs", func() {
+			ip, err := NthAddressInCIDR("10.244.0.0/16", 0)
+			Expect(err).To(Succeed())
+			Expect(ip).To(Equal("10.244.0.1"))
+
+			ip, err = NthAddressInCIDR("10.244.0.0/16", 300)
+			Expect(err).To(Succeed())
+			Expect(ip).To(Equal("10.244.1.45"))
+
+			ip, err = NthAddressInCIDR("fd00:10:244::/56", 255)
+			Expect(err).To(Succeed())
+			Expect(ip).To(Equal("fd00:10:244::100"))
+		})
+
+		It("Should report an exhausted cidr", func() {
+			_, err := NthAddressInCIDR("10.0.0.0/30", 1)
+			Expect(err).To(Succeed())
+			_, err = NthAddressInCIDR("10.0.0.0/30", 2)
+			Expect(err).ToNot(Succeed())
+		})
+
+		It("Should reject invalid cidrs", func() {
+			_, err := NewIPAM([]string{"10.0.0.0/8", "11.0.0.0/8"}, []string{"10.96.0.0/12", "fd00::/112"})
+			Expect(err).ToNot(Succeed())
+			_, err = NewIPAM([]string{"10.0.0.0/8"}, []string{"fd00::/112"})
+			Expect(err).ToNot(Succeed())
+			_, err = NewIPAM([]string{"abc"}, []string{"10.96.0.0/12"})
+			Expect(err).ToNot(Succeed())
+		})
+
+		It("Should assign ips deterministically and nondestructively, keeping existing ips", func() {
+			r := &Resources{
+				Namespaces: map[string]map[string]string{"x": {}},
+				Pods: []*Pod{
+					{Namespace: "x", Name: "b"},
+					{Namespace: "x", Name: "a", IP: "10.244.0.1", ServiceIP: "10.96.0.1"},
+					{Namespace: "x", Name: "c"},
+				},
+			}
+			r2, err := r.AssignIPs(NewDefaultIPAM())
+			Expect(err).To(Succeed())
+
+			Expect(r.Pods[0].IP).To(Equal(""))
+			Expect(r2.Pods[0].IP).To(Equal("10.244.0.2"))
+			Expect(r2.Pods[0].ServiceIP).To(Equal("10.96.0.2"))
+			Expect(r2.Pods[1].IP).To(Equal("10.244.0.1"))
+			Expect(r2.Pods[2].IP).To(Equal("10.244.0.3"))
+			Expect(r2.Pods[2].ServiceIP).To(Equal("10.96.0.3"))
+
+			r3, err := r.AssignIPs(NewDefaultIPAM())
+			Expect(err).To(Succeed())
+			Expect(r3.Pods).To(Equal(r2.Pods))
+		})
+
+		It("Should assign dual-stack ips", func() {
+			ipam, err := NewIPAM(DefaultDualStackPodCIDRs, DefaultDualStackServiceCIDRs)
+			Expect(err).To(Succeed())
+			r := &Resources{
+				Namespaces: map[string]map[string]string{"x": {}},
+				Pods:       []*Pod{{Namespace: "x", Name: "a"}},
+			}
+			r2, err := r.AssignIPs(ipam)
+			Expect(err).To(Succeed())
+			Expect(r2.Pods[0].IP).To(Equal("10.244.0.1"))
+			Expect(r2.Pods[0].IPs).To(Equal([]string{"10.244.0.1", "fd00:10:244::1"}))
+			Expect(r2.Pods[0].ServiceIPs).To(Equal([]string{"10.96.0.1", "fd00:10:96::1"}))
+		})
+
+		It("Should assign an unused ip to a created pod", func() {
+			r := &Resources{
+				Namespaces: map[string]map[string]string{"x": {}},
+				Pods:       []*Pod{{Namespace: "x", Name: "a", IP: "10.244.0.1", ServiceIP: "10.96.0.1"}},
+			}
+			r2, err := r.CreatePod("x", "b", map[string]string{})
+			Expect(err).To(Succeed())
+			pod, err := r2.GetPod("x", "b")
+			Expect(err).To(Succeed())
+			Expect(pod.IP).To(Equal("10.244.0.2"))
+			Expect(pod.ServiceIP).To(Equal("10.96.0.2"))
+		})
+
+		It("Should probe dual-stack pods per ip family", func() {
+			ipam, err := NewIPAM(DefaultDualStackPodCIDRs, DefaultDualStackServiceCIDRs)
+			Expect(err).To(Succeed())
+			containers := []*Container{{Name: "cont-80-tcp", Port: 80, Protocol: v1.ProtocolTCP, PortName: "serve-80-tcp"}}
+			r, err := (&Resources{
+				Namespaces: map[string]map[string]string{"x": {}},
+				Pods: []*Pod{
+					{Namespace: "x", Name: "a", Containers: containers},
+					{Namespace: "x", Name: "b", Containers: containers},
+				},
+			}).AssignIPs(ipam)
+			Expect(err).To(Succeed())
+
+			podA, err := r.GetPod("x", "a")
+			Expect(err).To(Succeed())
+			Expect(podA.IPv6()).To(Equal("fd00:10:244::1"))
+			Expect(podA.Host(generator.ProbeModePodIPv6)).To(Equal("fd00:10:244::1"))
+			Expect(podA.TrafficIP(generator.ProbeModePodIP)).To(Equal("10.244.0.1"))
+
+			// only allow ingress from pod a's ipv6 address
+			policies, err := matcher.BuildNetworkPolicies(true, []*networkingv1.NetworkPolicy{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "allow-ipv6"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "fd00:10:244::/120"}}},
+					}},
+				},
+			}})
+			Expect(err).To(Succeed())
+			runner := &SimulatedJobRunner{Policies: policies}
+
+			combined := func(mode generator.ProbeMode) Connectivity {
+				jobs := (&JobBuilder{}).GetJobsAllAvailableServers(r, mode)
+				for _, job := range jobs.Valid {
+					if job.FromKey == "x/a" && job.ToKey == "x/b" {
+						return runner.RunJob(job).Combined
+					}
+				}
+				Fail("unable to find job x/a -> x/b")
+				return ""
+			}
+			Expect(combined(generator.ProbeModePodIPv6)).To(Equal(ConnectivityAllowed))
+			Expect(combined(generator.ProbeModePodIP)).To(Equal(ConnectivityBlocked))
+		})
+	})
+}
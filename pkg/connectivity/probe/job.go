@@ -7,6 +7,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Jobs struct {
@@ -20,6 +21,38 @@ type JobResult struct {
 	Ingress  *Connectivity
 	Egress   *Connectivity
 	Combined Connectivity
+	// ProbeError, Output, Latency and ExecDuration are only set for kube probes.
+	// Latency is how long the connection attempt took, as measured within the pod by batch workers; it's 0
+	// for exec probes, which only have ExecDuration, including the overhead of the kube exec.
+	ProbeError   ProbeError
+	Output       string
+	Latency      time.Duration
+	ExecDuration time.Duration
+	// Samples and AllowedSamples are only set when each job is run several times
+	Samples        int
+	AllowedSamples int
+}
+
+// ShortString renders the combined result; flaky results are rendered with their share of allowed samples
+func (jr *JobResult) ShortString() string {
+	if jr.Combined == ConnectivityFlaky {
+		return fmt.Sprintf("~%.0f%%", 100*jr.AllowedRatio())
+	}
+	return jr.Combined.ShortString()
+}
+
+// AllowedRatio is the share of samples which were allowed
+func (jr *JobResult) AllowedRatio() float64 {
+	if jr.Samples == 0 {
+		return 0
+	}
+	return float64(jr.AllowedSamples) / float64(jr.Samples)
+}
+
+// IsBlockedByNonPolicyCause is true for probes which failed to connect for some reason other than
+// a network policy -- such as a DNS failure -- and so don't say anything about policy enforcement
+func (jr *JobResult) IsBlockedByNonPolicyCause() bool {
+	return jr.Combined == ConnectivityBlocked && !jr.ProbeError.IsPolicyCause()
 }
 
 func (jr *JobResult) Key() string {
@@ -34,6 +67,7 @@ type Job struct {
 	FromPodLabels       map[string]string
 	FromContainer       string
 	FromIP              string
+	FromIPs             []string
 
 	ToKey             string
 	ToHost            string
@@ -42,6 +76,9 @@ type Job struct {
 	ToPodLabels       map[string]string
 	ToContainer       string
 	ToIP              string
+	ToIPs             []string
+	// ToExternal is true for out-of-cluster destinations, which have no namespace or labels
+	ToExternal bool
 
 	ResolvedPort     int
 	ResolvedPortName string
@@ -76,6 +113,20 @@ func (j *Job) KubeExecCommand() []string {
 }
 
 func (j *Job) Traffic() *matcher.Traffic {
+	var destination *matcher.TrafficPeer
+	if j.ToExternal {
+		destination = &matcher.TrafficPeer{IP: j.ToIP, IPs: j.ToIPs}
+	} else {
+		destination = &matcher.TrafficPeer{
+			Internal: &matcher.InternalPeer{
+				PodLabels:       j.ToPodLabels,
+				NamespaceLabels: j.ToNamespaceLabels,
+				Namespace:       j.ToNamespace,
+			},
+			IP:  j.ToIP,
+			IPs: j.ToIPs,
+		}
+	}
 	return &matcher.Traffic{
 		Source: &matcher.TrafficPeer{
 			Internal: &matcher.InternalPeer{
@@ -83,16 +134,10 @@ func (j *Job) Traffic() *matcher.Traffic {
 				NamespaceLabels: j.FromNamespaceLabels,
 				Namespace:       j.FromNamespace,
 			},
-			IP: j.FromIP,
-		},
-		Destination: &matcher.TrafficPeer{
-			Internal: &matcher.InternalPeer{
-				PodLabels:       j.ToPodLabels,
-				NamespaceLabels: j.ToNamespaceLabels,
-				Namespace:       j.ToNamespace,
-			},
-			IP: j.ToIP,
+			IP:  j.FromIP,
+			IPs: j.FromIPs,
 		},
+		Destination:      destination,
 		ResolvedPort:     j.ResolvedPort,
 		ResolvedPortName: j.ResolvedPortName,
 		Protocol:         j.Protocol,
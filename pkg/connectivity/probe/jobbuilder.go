@@ -32,48 +32,81 @@ func (j *JobBuilder) GetJobsForNamedPortProtocol(resources *Resources, port ints
 				FromPod:             podFrom.Name,
 				FromPodLabels:       podFrom.Labels,
 				FromContainer:       podFrom.Containers[0].Name,
-				FromIP:              podFrom.IP,
+				FromIP:              podFrom.TrafficIP(mode),
+				FromIPs:             podFrom.AllIPs(),
 				ToKey:               podTo.PodString().String(),
 				ToHost:              podTo.Host(mode),
 				ToNamespace:         podTo.Namespace,
 				ToNamespaceLabels:   resources.Namespaces[podTo.Namespace],
 				ToPodLabels:         podTo.Labels,
-				ToIP:                podTo.IP,
+				ToIP:                podTo.TrafficIP(mode),
+				ToIPs:               podTo.AllIPs(),
 				ResolvedPort:        -1,
 				ResolvedPortName:    "",
 				Protocol:            protocol,
 				TimeoutSeconds:      j.TimeoutSeconds,
 			}
-
-			switch port.Type {
-			case intstr.String:
-				job.ResolvedPortName = port.StrVal
-				// TODO what about protocol?
-				portInt, err := podTo.ResolveNamedPort(port.StrVal)
-				if err != nil {
-					jobs.BadNamedPort = append(jobs.BadNamedPort, job)
-					continue
-				}
-				job.ResolvedPort = portInt
-			case intstr.Int:
-				job.ResolvedPort = int(port.IntVal)
-				// TODO what about protocol?
-				portName, err := podTo.ResolveNumberedPort(int(port.IntVal))
-				if err != nil {
-					jobs.BadPortProtocol = append(jobs.BadPortProtocol, job)
-					continue
-				}
-				job.ResolvedPortName = portName
-			default:
-				panic(errors.Errorf("invalid IntOrString value %+v", port))
-			}
-
-			jobs.Valid = append(jobs.Valid, job)
+			jobs.addResolvingPort(job, podTo, port)
+		}
+		externalServer := resources.externalServer()
+		for _, ip := range resources.ExternalIPs {
+			job := j.newExternalJob(resources, podFrom, ip)
+			job.Protocol = protocol
+			jobs.addResolvingPort(job, externalServer, port)
 		}
 	}
 	return jobs
 }
 
+func (jobs *Jobs) addResolvingPort(job *Job, podTo *Pod, port intstr.IntOrString) {
+	switch port.Type {
+	case intstr.String:
+		job.ResolvedPortName = port.StrVal
+		// TODO what about protocol?
+		portInt, err := podTo.ResolveNamedPort(port.StrVal)
+		if err != nil {
+			jobs.BadNamedPort = append(jobs.BadNamedPort, job)
+			return
+		}
+		job.ResolvedPort = portInt
+	case intstr.Int:
+		job.ResolvedPort = int(port.IntVal)
+		// TODO what about protocol?
+		portName, err := podTo.ResolveNumberedPort(int(port.IntVal))
+		if err != nil {
+			jobs.BadPortProtocol = append(jobs.BadPortProtocol, job)
+			return
+		}
+		job.ResolvedPortName = portName
+	default:
+		panic(errors.Errorf("invalid IntOrString value %+v", port))
+	}
+
+	jobs.Valid = append(jobs.Valid, job)
+}
+
+// newExternalJob creates a job from a pod to an external ip, which is addressed directly regardless of probe mode
+func (j *JobBuilder) newExternalJob(resources *Resources, podFrom *Pod, ip string) *Job {
+	return &Job{
+		FromKey:             podFrom.PodString().String(),
+		FromNamespace:       podFrom.Namespace,
+		FromNamespaceLabels: resources.Namespaces[podFrom.Namespace],
+		FromPod:             podFrom.Name,
+		FromPodLabels:       podFrom.Labels,
+		FromContainer:       podFrom.Containers[0].Name,
+		FromIP:              podFrom.IP,
+		FromIPs:             podFrom.AllIPs(),
+		ToKey:               ip,
+		ToHost:              ip,
+		ToExternal:          true,
+		ToIP:                ip,
+		ToIPs:               []string{ip},
+		ResolvedPort:        -1,
+		ResolvedPortName:    "",
+		TimeoutSeconds:      j.TimeoutSeconds,
+	}
+}
+
 func (j *JobBuilder) GetJobsAllAvailableServers(resources *Resources, mode generator.ProbeMode) *Jobs {
 	var jobs []*Job
 	for _, podFrom := range resources.Pods {
@@ -86,14 +119,16 @@ func (j *JobBuilder) GetJobsAllAvailableServers(resources *Resources, mode gener
 					FromPod:             podFrom.Name,
 					FromPodLabels:       podFrom.Labels,
 					FromContainer:       podFrom.Containers[0].Name,
-					FromIP:              podFrom.IP,
+					FromIP:              podFrom.TrafficIP(mode),
+					FromIPs:             podFrom.AllIPs(),
 					ToKey:               podTo.PodString().String(),
 					ToHost:              podTo.Host(mode),
 					ToNamespace:         podTo.Namespace,
 					ToNamespaceLabels:   resources.Namespaces[podTo.Namespace],
 					ToPodLabels:         podTo.Labels,
 					ToContainer:         contTo.Name,
-					ToIP:                podTo.IP,
+					ToIP:                podTo.TrafficIP(mode),
+					ToIPs:               podTo.AllIPs(),
 					ResolvedPort:        contTo.Port,
 					ResolvedPortName:    contTo.PortName,
 					Protocol:            contTo.Protocol,
@@ -101,6 +136,16 @@ func (j *JobBuilder) GetJobsAllAvailableServers(resources *Resources, mode gener
 				})
 			}
 		}
+		for _, ip := range resources.ExternalIPs {
+			for _, contTo := range resources.externalServer().Containers {
+				job := j.newExternalJob(resources, podFrom, ip)
+				job.ToContainer = contTo.Name
+				job.ResolvedPort = contTo.Port
+				job.ResolvedPortName = contTo.PortName
+				job.Protocol = contTo.Protocol
+				jobs = append(jobs, job)
+			}
+		}
 	}
 	return &Jobs{Valid: jobs}
 }
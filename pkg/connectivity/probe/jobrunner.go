@@ -2,6 +2,7 @@ package probe
 
 import (
 	"strings"
+	"time"
 
 	"github.com/mattfenwick/collections/pkg/json"
 	"github.com/mattfenwick/cyclonus/pkg/generator"
@@ -24,8 +25,8 @@ func NewKubeRunner(kubernetes kube.IKubernetes, workers int, jobBuilder *JobBuil
 	return &Runner{JobRunner: &KubeJobRunner{Kubernetes: kubernetes, Workers: workers}, JobBuilder: jobBuilder}
 }
 
-func NewKubeBatchRunner(kubernetes kube.IKubernetes, workers int, jobBuilder *JobBuilder) *Runner {
-	return &Runner{JobRunner: NewKubeBatchJobRunner(kubernetes, workers), JobBuilder: jobBuilder}
+func NewKubeBatchRunner(client worker.BatchClient, workers int, jobBuilder *JobBuilder) *Runner {
+	return &Runner{JobRunner: NewKubeBatchJobRunner(client, workers), JobBuilder: jobBuilder}
 }
 
 func (p *Runner) RunProbeForConfig(probeConfig *generator.ProbeConfig, resources *Resources) *Table {
@@ -59,6 +60,8 @@ func (p *Runner) runProbe(jobs *Jobs) []*JobResult {
 	return resultSlice
 }
 
+// JobRunner runs jobs; RunJobs may be called concurrently, as when transients are monitored while awaiting
+// convergence
 type JobRunner interface {
 	RunJobs(job []*Job) []*JobResult
 }
@@ -76,7 +79,12 @@ func (s *SimulatedJobRunner) RunJobs(jobs []*Job) []*JobResult {
 }
 
 func (s *SimulatedJobRunner) RunJob(job *Job) *JobResult {
-	allowed := s.Policies.IsTrafficAllowed(job.Traffic())
+	allowed, err := s.Policies.IsTrafficAllowed(job.Traffic())
+	if err != nil {
+		logrus.Errorf("unable to evaluate traffic for job %s: %+v", job.Key(), err)
+		checkFailed := ConnectivityCheckFailed
+		return &JobResult{Job: job, Ingress: &checkFailed, Egress: &checkFailed, Combined: ConnectivityCheckFailed}
+	}
 	// TODO could also keep the whole `allowed` struct somewhere
 
 	logrus.Tracef("to %s\n%s\n", json.MustMarshalToString(job), allowed.Table())
@@ -125,36 +133,46 @@ func (k *KubeJobRunner) RunJobs(jobs []*Job) []*JobResult {
 // it only writes pass/fail status to a channel and has no failure side effects, this is by design since we do not want to fail inside a goroutine.
 func (k *KubeJobRunner) worker(jobs <-chan *Job, results chan<- *JobResult) {
 	for job := range jobs {
-		connectivity, _ := probeConnectivity(k.Kubernetes, job)
+		start := time.Now()
+		connectivity, probeError, output := probeConnectivity(k.Kubernetes, job)
+		// there's no measurement from within the pod, so Latency is left unset: the exec's duration is mostly
+		// the overhead of the kube exec, not the connection attempt
 		results <- &JobResult{
-			Job:      job,
-			Combined: connectivity,
+			Job:          job,
+			Combined:     connectivity,
+			ProbeError:   probeError,
+			Output:       output,
+			ExecDuration: time.Since(start),
 		}
 	}
 }
 
-func probeConnectivity(k8s kube.IKubernetes, job *Job) (Connectivity, string) {
+// probeConnectivity returns the connectivity, the reason for a failure to connect, and the raw output of the probe
+func probeConnectivity(k8s kube.IKubernetes, job *Job) (Connectivity, ProbeError, string) {
 	commandDebugString := strings.Join(job.KubeExecCommand(), " ")
 	stdout, stderr, commandErr, err := k8s.ExecuteRemoteCommand(job.FromNamespace, job.FromPod, job.FromContainer, job.ClientCommand())
 	logrus.Debugf("stdout, stderr from %s: \n%s\n%s", commandDebugString, stdout, stderr)
+	output := strings.TrimSpace(stdout + stderr)
 	if err != nil {
 		logrus.Errorf("unable to set up command %s: %+v", commandDebugString, err)
-		return ConnectivityCheckFailed, commandDebugString
+		return ConnectivityCheckFailed, ProbeErrorUnknown, err.Error()
 	}
 	if commandErr != nil {
 		logrus.Debugf("unable to run command %s: %+v", commandDebugString, commandErr)
-		return ConnectivityBlocked, commandDebugString
+		return ConnectivityBlocked, ParseProbeError(output), output
 	}
-	return ConnectivityAllowed, commandDebugString
+	return ConnectivityAllowed, ProbeErrorNone, output
 }
 
+// KubeBatchJobRunner sends the jobs from each pod as a single batch: either by exec'ing the worker, or to the
+// pod's agent
 type KubeBatchJobRunner struct {
-	Client  *worker.Client
+	Client  worker.BatchClient
 	Workers int
 }
 
-func NewKubeBatchJobRunner(k8s kube.IKubernetes, workers int) *KubeBatchJobRunner {
-	return &KubeBatchJobRunner{Client: &worker.Client{Kubernetes: k8s}, Workers: workers}
+func NewKubeBatchJobRunner(client worker.BatchClient, workers int) *KubeBatchJobRunner {
+	return &KubeBatchJobRunner{Client: client, Workers: workers}
 }
 
 func (k *KubeBatchJobRunner) RunJobs(jobs []*Job) []*JobResult {
@@ -173,6 +191,7 @@ func (k *KubeBatchJobRunner) RunJobs(jobs []*Job) []*JobResult {
 			Protocol: job.Protocol,
 			Host:     job.ToHost,
 			Port:     job.ResolvedPort,
+			Timeout:  time.Duration(job.TimeoutSeconds) * time.Second,
 		})
 
 		jobMap[job.Key()] = job
@@ -201,29 +220,58 @@ func (k *KubeBatchJobRunner) RunJobs(jobs []*Job) []*JobResult {
 
 func (k *KubeBatchJobRunner) worker(jobMap map[string]*Job, batches <-chan *worker.Batch, jobResults chan<- *JobResult) {
 	for b := range batches {
+		start := time.Now()
 		results, err := k.Client.Batch(b)
+		execDuration := time.Since(start)
 		if err != nil {
 			logrus.Errorf("unable to issue batch request: %+v", err)
 			for _, r := range b.Requests {
 				jobResults <- &JobResult{
-					Job:      jobMap[r.Key],
-					Combined: ConnectivityCheckFailed,
+					Job:          jobMap[r.Key],
+					Combined:     ConnectivityCheckFailed,
+					ProbeError:   ProbeErrorUnknown,
+					Output:       err.Error(),
+					ExecDuration: execDuration,
 				}
 			}
 		} else {
 			for _, r := range results {
 				var c Connectivity
+				probeError := ProbeErrorNone
 				if r.IsSuccess() {
 					c = ConnectivityAllowed
 				} else {
 					logrus.Debugf("request to %s failed: %s", r.Request.Key, r.Error)
 					c = ConnectivityBlocked
+					probeError = ProbeErrorFromWorkerResult(r)
 				}
 				jobResults <- &JobResult{
-					Job:      jobMap[r.Request.Key],
-					Combined: c,
+					Job:          jobMap[r.Request.Key],
+					Combined:     c,
+					ProbeError:   probeError,
+					Output:       strings.TrimSpace(r.Output + "\n" + r.Error),
+					Latency:      r.Latency,
+					ExecDuration: execDuration,
 				}
 			}
 		}
 	}
 }
+
+// ProbeErrorFromWorkerResult maps the worker's structured error type; results from workers which don't set
+// it fall back to parsing the error
+func ProbeErrorFromWorkerResult(r *worker.Result) ProbeError {
+	switch r.ErrorType {
+	case worker.ErrorTypeTimeout, worker.ErrorTypeNoReply:
+		return ProbeErrorTimeout
+	// rejected packets may come back as icmp unreachable, depending on the CNI
+	case worker.ErrorTypeRefused, worker.ErrorTypeUnreachable:
+		return ProbeErrorRefused
+	case worker.ErrorTypeDNS:
+		return ProbeErrorDNS
+	case worker.ErrorTypeUnknown:
+		return ProbeErrorUnknown
+	default:
+		return ParseProbeError(r.Error)
+	}
+}
@@ -7,14 +7,22 @@ import (
 	"github.com/mattfenwick/collections/pkg/slice"
 	"github.com/mattfenwick/cyclonus/pkg/generator"
 	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/worker"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+var preferDualStack = v1.IPFamilyPolicyPreferDualStack
+
 const (
 	agnhostImage        = "e2e-test-images/agnhost:2.43"
 	cyclonusWorkerImage = "mfenwick100/cyclonus-worker:latest"
+	// AgentContainerName is the sidecar running the worker's agent in pods with batch jobs; it has no ports,
+	// and so isn't a probe target
+	AgentContainerName = "cyclonus-agent"
 )
 
 func NewPod(ns string, name string, labels map[string]string, ip string, containers []*Container) *Pod {
@@ -27,28 +35,31 @@ func NewPod(ns string, name string, labels map[string]string, ip string, contain
 	}
 }
 
-func NewDefaultPod(ns string, name string, ports []int, protocols []v1.Protocol, batchJobs bool, imageRegistry string) *Pod {
+func NewDefaultPod(ns string, name string, ports []int, protocols []v1.Protocol, batchJobs bool, echoServers bool, imageRegistry string) *Pod {
 	var containers []*Container
 	for _, port := range ports {
 		for _, protocol := range protocols {
-			containers = append(containers, NewDefaultContainer(port, protocol, batchJobs, imageRegistry))
+			containers = append(containers, NewDefaultContainer(port, protocol, batchJobs, echoServers, imageRegistry))
 		}
 	}
 	return &Pod{
 		Namespace:  ns,
 		Name:       name,
 		Labels:     map[string]string{"pod": name},
-		IP:         "TODO",
+		IP:         "",
 		Containers: containers,
 	}
 }
 
 type Pod struct {
-	Namespace  string
-	Name       string
-	Labels     map[string]string
-	ServiceIP  string
-	IP         string
+	Namespace string
+	Name      string
+	Labels    map[string]string
+	ServiceIP string
+	IP        string
+	// ServiceIPs and IPs hold one address per ip family; ServiceIP and IP are the primary addresses
+	ServiceIPs []string
+	IPs        []string
 	Containers []*Container
 }
 
@@ -58,6 +69,8 @@ func (p *Pod) Host(probeMode generator.ProbeMode) string {
 		return kube.QualifiedServiceAddress(p.ServiceName(), p.Namespace)
 	case generator.ProbeModePodIP:
 		return p.IP
+	case generator.ProbeModePodIPv6:
+		return p.IPv6()
 	case generator.ProbeModeServiceIP:
 		return p.ServiceIP
 	default:
@@ -66,7 +79,7 @@ func (p *Pod) Host(probeMode generator.ProbeMode) string {
 }
 
 func (p *Pod) IsEqualToKubePod(kubePod v1.Pod) (string, bool) {
-	kubeConts := kubePod.Spec.Containers
+	kubeConts := slice.Filter(func(cont v1.Container) bool { return cont.Name != AgentContainerName }, kubePod.Spec.Containers)
 	if len(kubeConts) != len(p.Containers) {
 		return fmt.Sprintf("have %d containers, expected %d", len(p.Containers), len(kubeConts)), false
 	}
@@ -114,12 +127,51 @@ func (p *Pod) KubeService() *v1.Service {
 		Spec: v1.ServiceSpec{
 			Ports:    slice.Map(func(cont *Container) v1.ServicePort { return cont.KubeServicePort() }, p.Containers),
 			Selector: p.Labels,
+			// on dual-stack clusters, get a cluster ip of each family; single-stack clusters fall back to one
+			IPFamilyPolicy: &preferDualStack,
 		},
 	}
 }
 
 func (p *Pod) KubeContainers() []v1.Container {
-	return slice.Map(func(cont *Container) v1.Container { return cont.KubeContainer() }, p.Containers)
+	containers := slice.Map(func(cont *Container) v1.Container { return cont.KubeContainer() }, p.Containers)
+	if p.HasBatchJobs() {
+		containers = append(containers, KubeAgentContainer())
+	}
+	return containers
+}
+
+func (p *Pod) HasBatchJobs() bool {
+	for _, cont := range p.Containers {
+		if cont.BatchJobs {
+			return true
+		}
+	}
+	return false
+}
+
+// KubeAgentContainer runs the worker as a long-lived agent, which issues batches of requests received over http
+func KubeAgentContainer() v1.Container {
+	return v1.Container{
+		Name:            AgentContainerName,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Image:           cyclonusWorkerImage,
+		Command:         []string{"/worker", "serve", "--port", fmt.Sprintf("%d", worker.DefaultPort)},
+		SecurityContext: &v1.SecurityContext{},
+		ReadinessProbe: &v1.Probe{
+			ProbeHandler: v1.ProbeHandler{
+				HTTPGet: &v1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt32(worker.DefaultPort)},
+			},
+			PeriodSeconds: 5,
+		},
+		LivenessProbe: &v1.Probe{
+			ProbeHandler: v1.ProbeHandler{
+				HTTPGet: &v1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt32(worker.DefaultPort)},
+			},
+			PeriodSeconds:    10,
+			FailureThreshold: 3,
+		},
+	}
 }
 
 func (p *Pod) ResolveNamedPort(port string) (int, error) {
@@ -150,11 +202,62 @@ func (p *Pod) IsServingPortProtocol(port int, protocol v1.Protocol) bool {
 }
 
 func (p *Pod) SetLabels(labels map[string]string) *Pod {
+	pod := p.Copy()
+	pod.Labels = labels
+	return pod
+}
+
+// TrafficIP is the pod's address used for traffic in the probe mode: the ipv6 address for pod-ipv6, and
+// the primary address otherwise.
+func (p *Pod) TrafficIP(probeMode generator.ProbeMode) string {
+	if probeMode == generator.ProbeModePodIPv6 {
+		return p.IPv6()
+	}
+	return p.IP
+}
+
+// AllIPs returns the pod's addresses, one per ip family
+func (p *Pod) AllIPs() []string {
+	if len(p.IPs) == 0 && p.IP != "" {
+		return []string{p.IP}
+	}
+	return p.IPs
+}
+
+// IPv6 returns the pod's ipv6 address, or "" if it doesn't have one
+func (p *Pod) IPv6() string {
+	ip, err := kube.IPForFamily(p.AllIPs(), true)
+	if err != nil {
+		logrus.Errorf("unable to find ipv6 address for pod %s/%s: %+v", p.Namespace, p.Name, err)
+		return ""
+	}
+	return ip
+}
+
+func (p *Pod) ipsString() string {
+	if len(p.IPs) > 1 {
+		return strings.Join(p.IPs, ", ")
+	}
+	return p.IP
+}
+
+func (p *Pod) serviceIPsString() string {
+	if len(p.ServiceIPs) > 1 {
+		return strings.Join(p.ServiceIPs, ", ")
+	}
+	return p.ServiceIP
+}
+
+// Copy makes a shallow copy of the pod
+func (p *Pod) Copy() *Pod {
 	return &Pod{
 		Namespace:  p.Namespace,
 		Name:       p.Name,
-		Labels:     labels,
+		Labels:     p.Labels,
+		ServiceIP:  p.ServiceIP,
 		IP:         p.IP,
+		ServiceIPs: p.ServiceIPs,
+		IPs:        p.IPs,
 		Containers: p.Containers,
 	}
 }
@@ -164,21 +267,25 @@ func (p *Pod) PodString() PodString {
 }
 
 type Container struct {
-	Name          string
-	Port          int
-	Protocol      v1.Protocol
-	PortName      string
-	BatchJobs     bool
+	Name      string
+	Port      int
+	Protocol  v1.Protocol
+	PortName  string
+	BatchJobs bool
+	// EchoServer serves with the cyclonus worker's echo server, which -- unlike agnhost -- holds connections
+	// open, as needed for long-lived connection tests
+	EchoServer    bool
 	ImageRegistry string
 }
 
-func NewDefaultContainer(port int, protocol v1.Protocol, batchJobs bool, imageRegistry string) *Container {
+func NewDefaultContainer(port int, protocol v1.Protocol, batchJobs bool, echoServer bool, imageRegistry string) *Container {
 	return &Container{
 		Name:          fmt.Sprintf("cont-%d-%s", port, strings.ToLower(string(protocol))),
 		Port:          port,
 		Protocol:      protocol,
 		PortName:      fmt.Sprintf("serve-%d-%s", port, strings.ToLower(string(protocol))),
 		BatchJobs:     batchJobs,
+		EchoServer:    echoServer,
 		ImageRegistry: imageRegistry,
 	}
 }
@@ -192,7 +299,7 @@ func (c *Container) KubeServicePort() v1.ServicePort {
 }
 
 func (c *Container) Image() string {
-	if c.BatchJobs {
+	if c.BatchJobs || c.EchoServer {
 		return cyclonusWorkerImage
 	}
 	return c.ImageRegistry + "/" + agnhostImage
@@ -202,12 +309,15 @@ func (c *Container) KubeContainer() v1.Container {
 	var cmd []string
 	var env []v1.EnvVar
 
-	switch c.Protocol {
-	case v1.ProtocolTCP:
+	switch {
+	// the worker image doesn't include agnhost
+	case c.EchoServer || c.BatchJobs:
+		cmd = []string{"/worker", "echo-server", "--protocol", string(c.Protocol), "--port", fmt.Sprintf("%d", c.Port)}
+	case c.Protocol == v1.ProtocolTCP:
 		cmd = []string{"/agnhost", "serve-hostname", "--tcp", "--http=false", "--port", fmt.Sprintf("%d", c.Port)}
-	case v1.ProtocolUDP:
+	case c.Protocol == v1.ProtocolUDP:
 		cmd = []string{"/agnhost", "serve-hostname", "--udp", "--http=false", "--port", fmt.Sprintf("%d", c.Port)}
-	case v1.ProtocolSCTP:
+	case c.Protocol == v1.ProtocolSCTP:
 		//cmd = []string{"/agnhost", "netexec", "--sctp-port", fmt.Sprintf("%d", c.Port)}
 		env = append(env, v1.EnvVar{
 			Name:  fmt.Sprintf("SERVE_SCTP_PORT_%d", c.Port),
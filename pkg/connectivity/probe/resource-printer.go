@@ -41,7 +41,7 @@ func (r *Resources) RenderTable() string {
 					nsLabelLines,
 					pod.Name,
 					podLabelLines,
-					fmt.Sprintf("pod: %s\nservice: %s", pod.IP, pod.ServiceIP),
+					fmt.Sprintf("pod: %s\nservice: %s", pod.ipsString(), pod.serviceIPsString()),
 					fmt.Sprintf("%s, port %s: %d on %s", cont.Name, cont.PortName, cont.Port, cont.Protocol),
 				})
 			}
@@ -1,6 +1,7 @@
 package probe
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/mattfenwick/collections/pkg/slice"
@@ -15,20 +16,22 @@ import (
 type Resources struct {
 	Namespaces map[string]map[string]string
 	Pods       []*Pod
-	//ExternalIPs []string
+	// IPAM is used to assign ips to new pods; if nil, the default is used
+	IPAM *IPAM
+	// ExternalIPs are out-of-cluster destinations, probed as additional truth table columns.  They're assumed
+	// to serve the same ports and protocols as the pods.
+	ExternalIPs []string
 }
 
-func NewDefaultResources(kubernetes kube.IKubernetes, namespaces []string, podNames []string, ports []int, protocols []v1.Protocol, externalIPs []string, podCreationTimeoutSeconds int, batchJobs bool, imageRegistry string) (*Resources, error) {
-	//sort.Strings(externalIPs) // TODO why is this here?
-
+func NewDefaultResources(kubernetes kube.IKubernetes, namespaces []string, podNames []string, ports []int, protocols []v1.Protocol, externalIPs []string, podCreationTimeoutSeconds int, batchJobs bool, echoServers bool, imageRegistry string) (*Resources, error) {
 	r := &Resources{
-		Namespaces: map[string]map[string]string{},
-		//ExternalIPs: externalIPs,
+		Namespaces:  map[string]map[string]string{},
+		ExternalIPs: slice.Sort(externalIPs),
 	}
 
 	for _, ns := range namespaces {
 		for _, podName := range podNames {
-			r.Pods = append(r.Pods, NewDefaultPod(ns, podName, ports, protocols, batchJobs, imageRegistry))
+			r.Pods = append(r.Pods, NewDefaultPod(ns, podName, ports, protocols, batchJobs, echoServers, imageRegistry))
 		}
 		r.Namespaces[ns] = map[string]string{"ns": ns}
 	}
@@ -49,6 +52,57 @@ func NewDefaultResources(kubernetes kube.IKubernetes, namespaces []string, podNa
 	return r, nil
 }
 
+// NewResourcesFromKubePods builds a simulated inventory from kube pods and namespaces -- which may come from
+// a live cluster or from manifests.  Each container port becomes a Container; pods without ports are skipped.
+func NewResourcesFromKubePods(kubePods []v1.Pod, kubeNamespaces []v1.Namespace) *Resources {
+	r := &Resources{
+		Namespaces: map[string]map[string]string{},
+		Pods:       []*Pod{},
+	}
+
+	for _, ns := range kubeNamespaces {
+		r.Namespaces[ns.Name] = ns.Labels
+	}
+
+	for _, pod := range kubePods {
+		var containers []*Container
+		for _, cont := range pod.Spec.Containers {
+			if len(cont.Ports) == 0 {
+				logrus.Warnf("skipping container %s/%s/%s, no ports available", pod.Namespace, pod.Name, cont.Name)
+				continue
+			}
+			for _, port := range cont.Ports {
+				name := cont.Name
+				if len(cont.Ports) > 1 {
+					name = fmt.Sprintf("%s-%d", cont.Name, port.ContainerPort)
+				}
+				protocol := port.Protocol
+				if protocol == "" {
+					protocol = v1.ProtocolTCP
+				}
+				containers = append(containers, &Container{
+					Name:     name,
+					Port:     int(port.ContainerPort),
+					Protocol: protocol,
+					PortName: port.Name,
+				})
+			}
+		}
+		if len(containers) == 0 {
+			logrus.Warnf("skipping pod %s/%s, no containers available", pod.Namespace, pod.Name)
+			continue
+		}
+		if _, ok := r.Namespaces[pod.Namespace]; !ok {
+			r.Namespaces[pod.Namespace] = map[string]string{kube.DefaultNamespaceLabel: pod.Namespace}
+		}
+		newPod := NewPod(pod.Namespace, pod.Name, pod.Labels, pod.Status.PodIP, containers)
+		newPod.IPs = kube.PodIPs(&pod)
+		r.Pods = append(r.Pods, newPod)
+	}
+
+	return r
+}
+
 func (r *Resources) waitForPodsReady(kubernetes kube.IKubernetes, timeoutSeconds int) error {
 	sleep := 5
 	for i := 0; i < timeoutSeconds; i += sleep {
@@ -88,14 +142,14 @@ func (r *Resources) getPodIPsFromKube(kubernetes kube.IKubernetes) error {
 		if err != nil {
 			return errors.Errorf("unable to find pod %s/%s in resources", kubePod.Namespace, kubePod.Name)
 		}
-		pod.IP = kubePod.Status.PodIP
+		pod.IP, pod.IPs = kubePod.Status.PodIP, kube.PodIPs(&kubePod)
 		kubeService, err := kubernetes.GetService(pod.Namespace, pod.ServiceName())
 		if err != nil {
 			return err
 		}
-		pod.ServiceIP = kubeService.Spec.ClusterIP
+		pod.ServiceIP, pod.ServiceIPs = kubeService.Spec.ClusterIP, kube.ServiceIPs(kubeService)
 
-		logrus.Debugf("ip for pod %s/%s: %s", pod.Namespace, pod.Name, pod.IP)
+		logrus.Debugf("ips for pod %s/%s: %+v", pod.Namespace, pod.Name, pod.IPs)
 	}
 
 	return nil
@@ -138,8 +192,10 @@ func (r *Resources) CreateNamespace(ns string, labels map[string]string) (*Resou
 	}
 	newNamespaces[ns] = labels
 	return &Resources{
-		Namespaces: newNamespaces,
-		Pods:       r.Pods,
+		Namespaces:  newNamespaces,
+		Pods:        r.Pods,
+		IPAM:        r.IPAM,
+		ExternalIPs: r.ExternalIPs,
 	}, nil
 }
 
@@ -154,8 +210,10 @@ func (r *Resources) UpdateNamespaceLabels(ns string, labels map[string]string) (
 	}
 	newNamespaces[ns] = labels
 	return &Resources{
-		Namespaces: newNamespaces,
-		Pods:       r.Pods,
+		Namespaces:  newNamespaces,
+		Pods:        r.Pods,
+		IPAM:        r.IPAM,
+		ExternalIPs: r.ExternalIPs,
 	}, nil
 }
 
@@ -179,8 +237,10 @@ func (r *Resources) DeleteNamespace(ns string) (*Resources, error) {
 		}
 	}
 	return &Resources{
-		Namespaces: newNamespaces,
-		Pods:       pods,
+		Namespaces:  newNamespaces,
+		Pods:        pods,
+		IPAM:        r.IPAM,
+		ExternalIPs: r.ExternalIPs,
 	}, nil
 }
 
@@ -191,11 +251,20 @@ func (r *Resources) CreatePod(ns string, podName string, labels map[string]strin
 	if _, ok := r.Namespaces[ns]; !ok {
 		return nil, errors.Errorf("can't find namespace %s", ns)
 	}
-	return &Resources{
-		Namespaces: r.Namespaces,
-		Pods:       append(append([]*Pod{}, r.Pods...), NewPod(ns, podName, labels, "TODO", r.Pods[0].Containers)),
-		//ExternalIPs: r.ExternalIPs,
-	}, nil
+	newResources := &Resources{
+		Namespaces:  r.Namespaces,
+		Pods:        append(append([]*Pod{}, r.Pods...), NewPod(ns, podName, labels, "", r.Pods[0].Containers)),
+		IPAM:        r.IPAM,
+		ExternalIPs: r.ExternalIPs,
+	}
+	return newResources.AssignIPs(r.getIPAM())
+}
+
+func (r *Resources) getIPAM() *IPAM {
+	if r.IPAM == nil {
+		return NewDefaultIPAM()
+	}
+	return r.IPAM
 }
 
 // SetPodLabels returns a new object with an updated pod.  It should not affect the original Resources object.
@@ -214,9 +283,10 @@ func (r *Resources) SetPodLabels(ns string, podName string, labels map[string]st
 		return nil, errors.Errorf("no pod named %s/%s found", ns, podName)
 	}
 	return &Resources{
-		Namespaces: r.Namespaces,
-		Pods:       pods,
-		//ExternalIPs: r.ExternalIPs,
+		Namespaces:  r.Namespaces,
+		Pods:        pods,
+		IPAM:        r.IPAM,
+		ExternalIPs: r.ExternalIPs,
 	}, nil
 }
 
@@ -235,9 +305,10 @@ func (r *Resources) DeletePod(ns string, podName string) (*Resources, error) {
 		return nil, errors.Errorf("pod %s/%s not found", ns, podName)
 	}
 	return &Resources{
-		Namespaces: r.Namespaces,
-		Pods:       newPods,
-		//ExternalIPs: r.ExternalIPs,
+		Namespaces:  r.Namespaces,
+		Pods:        newPods,
+		IPAM:        r.IPAM,
+		ExternalIPs: r.ExternalIPs,
 	}, nil
 }
 
@@ -247,6 +318,31 @@ func (r *Resources) SortedPodNames() []string {
 		r.Pods))
 }
 
+// HasEchoServers is true if every container serves with the echo server, as needed by long-lived connection tests
+func (r *Resources) HasEchoServers() bool {
+	for _, pod := range r.Pods {
+		for _, cont := range pod.Containers {
+			if !cont.EchoServer {
+				return false
+			}
+		}
+	}
+	return len(r.Pods) > 0
+}
+
+// SortedTargetNames returns the truth table columns: the pods, followed by the external ips
+func (r *Resources) SortedTargetNames() []string {
+	return append(r.SortedPodNames(), r.ExternalIPs...)
+}
+
+// externalServer models the ports and protocols served by external ips: the same as the pods'
+func (r *Resources) externalServer() *Pod {
+	if len(r.Pods) == 0 {
+		return &Pod{}
+	}
+	return &Pod{Containers: r.Pods[0].Containers}
+}
+
 func (r *Resources) NamespacesSlice() []string {
 	return maps.Keys(r.Namespaces)
 }
@@ -1,8 +1,15 @@
 package probe
 
 import (
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func RunResourcesTests() {
@@ -49,5 +56,97 @@ func RunResourcesTests() {
 			Expect(r.Pods[0].Labels).To(Equal(labels))
 			Expect(r2.Pods[0].Labels).To(Equal(map[string]string{}))
 		})
+
+		It("Should build resources from kube pods, one container per port", func() {
+			pods := []v1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "a", Labels: map[string]string{"pod": "a"}},
+					Spec: v1.PodSpec{Containers: []v1.Container{{
+						Name:  "web",
+						Ports: []v1.ContainerPort{{ContainerPort: 80, Name: "http"}, {ContainerPort: 53, Protocol: v1.ProtocolUDP}},
+					}}},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "y", Name: "no-ports"},
+					Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "client"}}},
+				},
+			}
+			namespaces := []v1.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "x", Labels: map[string]string{"ns": "x"}}}}
+			r := NewResourcesFromKubePods(pods, namespaces)
+
+			Expect(r.Namespaces).To(Equal(map[string]map[string]string{"x": {"ns": "x"}}))
+			Expect(r.Pods).To(HaveLen(1))
+			Expect(r.Pods[0].Containers).To(Equal([]*Container{
+				{Name: "web-80", Port: 80, Protocol: v1.ProtocolTCP, PortName: "http"},
+				{Name: "web-53", Port: 53, Protocol: v1.ProtocolUDP},
+			}))
+		})
+
+		It("Should add namespaces for pods", func() {
+			pods := []v1.Pod{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "z", Name: "a"},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "web", Ports: []v1.ContainerPort{{ContainerPort: 80}}}}},
+			}}
+			r := NewResourcesFromKubePods(pods, nil)
+			Expect(r.Namespaces).To(Equal(map[string]map[string]string{"z": {kube.DefaultNamespaceLabel: "z"}}))
+		})
+
+		It("Should probe external ips as truth table columns", func() {
+			containers := []*Container{{Name: "cont-80-tcp", Port: 80, Protocol: v1.ProtocolTCP, PortName: "serve-80-tcp"}}
+			r := &Resources{
+				Namespaces:  map[string]map[string]string{"x": {}},
+				Pods:        []*Pod{{Namespace: "x", Name: "a", IP: "10.244.0.1", Containers: containers}},
+				ExternalIPs: []string{"192.0.2.10"},
+			}
+			Expect(r.SortedTargetNames()).To(Equal([]string{"x/a", "192.0.2.10"}))
+
+			jobs := (&JobBuilder{}).GetJobsForNamedPortProtocol(r, intstr.FromInt32(80), v1.ProtocolTCP, generator.ProbeModePodIP)
+			Expect(jobs.Valid).To(HaveLen(2))
+			external := jobs.Valid[1]
+			Expect(external.ToKey).To(Equal("192.0.2.10"))
+			Expect(external.ToAddress()).To(Equal("192.0.2.10:80"))
+			Expect(external.Traffic().Destination.IsExternal()).To(BeTrue())
+
+			jobs = (&JobBuilder{}).GetJobsForNamedPortProtocol(r, intstr.FromInt32(81), v1.ProtocolTCP, generator.ProbeModePodIP)
+			Expect(jobs.BadPortProtocol).To(HaveLen(2))
+
+			// deny all egress except to the external ip
+			policies, err := matcher.BuildNetworkPolicies(true, []*networkingv1.NetworkPolicy{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "allow-external"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress: []networkingv1.NetworkPolicyEgressRule{{
+						To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "192.0.2.0/24"}}},
+					}},
+				},
+			}})
+			Expect(err).To(Succeed())
+			table := NewSimulatedRunner(policies, &JobBuilder{}).RunProbeForConfig(generator.NewAllAvailable(generator.ProbeModePodIP), r)
+			Expect(table.Get("x/a", "192.0.2.10").JobResults["TCP/80"].Combined).To(Equal(ConnectivityAllowed))
+			Expect(table.Get("x/a", "x/a").JobResults["TCP/80"].Combined).To(Equal(ConnectivityBlocked))
+		})
+
+		It("Should run an agent sidecar in pods with batch jobs, without probing it", func() {
+			pod := NewDefaultPod("x", "a", []int{80}, []v1.Protocol{v1.ProtocolTCP}, true, false, "registry.k8s.io")
+			kubePod := pod.KubePod()
+			Expect(kubePod.Spec.Containers).To(HaveLen(2))
+			agent := kubePod.Spec.Containers[1]
+			Expect(agent.Name).To(Equal(AgentContainerName))
+			Expect(agent.Ports).To(BeEmpty())
+			Expect(agent.ReadinessProbe.HTTPGet.Path).To(Equal("/healthz"))
+
+			diff, ok := pod.IsEqualToKubePod(*kubePod)
+			Expect(diff).To(Equal(""))
+			Expect(ok).To(BeTrue())
+
+			r := NewResourcesFromKubePods([]v1.Pod{*kubePod}, nil)
+			Expect(r.Pods).To(HaveLen(1))
+			Expect(r.Pods[0].Containers).To(HaveLen(1))
+			Expect(r.Pods[0].Containers[0].Port).To(Equal(80))
+
+			withoutBatchJobs := NewDefaultPod("x", "a", []int{80}, []v1.Protocol{v1.ProtocolTCP}, false, false, "registry.k8s.io")
+			Expect(withoutBatchJobs.KubePod().Spec.Containers).To(HaveLen(1))
+		})
 	})
 }
@@ -0,0 +1,64 @@
+package probe
+
+// SampledJobRunner runs each job several times, and classifies it by how its samples agree
+type SampledJobRunner struct {
+	JobRunner JobRunner
+	Samples   int
+	// ConsistencyThreshold is the share of samples -- between 0 and 1 -- which must be allowed, or blocked, for
+	// a job to be consistently allowed, or blocked; otherwise it's flaky
+	ConsistencyThreshold float64
+}
+
+func NewSampledJobRunner(jobRunner JobRunner, samples int, consistencyThreshold float64) *SampledJobRunner {
+	return &SampledJobRunner{JobRunner: jobRunner, Samples: samples, ConsistencyThreshold: consistencyThreshold}
+}
+
+func (s *SampledJobRunner) RunJobs(jobs []*Job) []*JobResult {
+	samples := map[string][]*JobResult{}
+	for i := 0; i < s.Samples; i++ {
+		for _, result := range s.JobRunner.RunJobs(jobs) {
+			samples[result.Job.Key()] = append(samples[result.Job.Key()], result)
+		}
+	}
+	var results []*JobResult
+	for _, job := range jobs {
+		if jobSamples, ok := samples[job.Key()]; ok {
+			results = append(results, AggregateSamples(jobSamples, s.ConsistencyThreshold))
+		}
+	}
+	return results
+}
+
+// AggregateSamples picks a representative sample: one which agrees with at least `threshold` of the samples.
+// If there isn't one, the job is flaky.  Samples which were neither allowed nor blocked count against both.
+func AggregateSamples(samples []*JobResult, threshold float64) *JobResult {
+	allowed, blocked := 0, 0
+	var lastAllowed, lastBlocked *JobResult
+	for _, sample := range samples {
+		switch sample.Combined {
+		case ConnectivityAllowed:
+			allowed++
+			lastAllowed = sample
+		case ConnectivityBlocked:
+			blocked++
+			lastBlocked = sample
+		}
+	}
+
+	var aggregate JobResult
+	total := float64(len(samples))
+	switch {
+	case allowed == 0 && blocked == 0:
+		aggregate = *samples[len(samples)-1]
+	case float64(allowed)/total >= threshold:
+		aggregate = *lastAllowed
+	case float64(blocked)/total >= threshold:
+		aggregate = *lastBlocked
+	default:
+		aggregate = *samples[len(samples)-1]
+		aggregate.Combined = ConnectivityFlaky
+	}
+	aggregate.Samples = len(samples)
+	aggregate.AllowedSamples = allowed
+	return &aggregate
+}
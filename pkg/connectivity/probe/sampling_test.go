@@ -0,0 +1,68 @@
+package probe
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+// cyclingJobRunner returns each job's results from `values` in turn
+type cyclingJobRunner struct {
+	values []Connectivity
+	runs   int
+}
+
+func (c *cyclingJobRunner) RunJobs(jobs []*Job) []*JobResult {
+	value := c.values[c.runs%len(c.values)]
+	c.runs++
+	var results []*JobResult
+	for _, job := range jobs {
+		results = append(results, &JobResult{Job: job, Combined: value})
+	}
+	return results
+}
+
+func RunSamplingTests() {
+	Describe("SampledJobRunner", func() {
+		job := &Job{FromKey: "x/a", ToKey: "x/b", Protocol: v1.ProtocolTCP, ResolvedPort: 80}
+		samples := func(values ...Connectivity) []*JobResult {
+			var results []*JobResult
+			for _, value := range values {
+				results = append(results, &JobResult{Job: job, Combined: value})
+			}
+			return results
+		}
+
+		It("Should classify samples by the consistency threshold", func() {
+			allowed := AggregateSamples(samples(ConnectivityAllowed, ConnectivityAllowed, ConnectivityAllowed, ConnectivityAllowed, ConnectivityBlocked), 0.8)
+			Expect(allowed.Combined).To(Equal(ConnectivityAllowed))
+			Expect(allowed.Samples).To(Equal(5))
+			Expect(allowed.AllowedSamples).To(Equal(4))
+			Expect(allowed.AllowedRatio()).To(BeNumerically("~", 0.8))
+
+			blocked := AggregateSamples(samples(ConnectivityBlocked, ConnectivityBlocked, ConnectivityBlocked, ConnectivityBlocked, ConnectivityAllowed), 0.8)
+			Expect(blocked.Combined).To(Equal(ConnectivityBlocked))
+
+			flaky := AggregateSamples(samples(ConnectivityAllowed, ConnectivityAllowed, ConnectivityAllowed, ConnectivityBlocked, ConnectivityBlocked), 0.8)
+			Expect(flaky.Combined).To(Equal(ConnectivityFlaky))
+			Expect(flaky.AllowedRatio()).To(BeNumerically("~", 0.6))
+
+			// the same samples are consistent at a lower threshold
+			Expect(AggregateSamples(samples(ConnectivityAllowed, ConnectivityAllowed, ConnectivityAllowed, ConnectivityBlocked, ConnectivityBlocked), 0.6).Combined).To(Equal(ConnectivityAllowed))
+		})
+
+		It("Should count samples which were neither allowed nor blocked against both", func() {
+			Expect(AggregateSamples(samples(ConnectivityAllowed, ConnectivityCheckFailed), 0.8).Combined).To(Equal(ConnectivityFlaky))
+			Expect(AggregateSamples(samples(ConnectivityCheckFailed, ConnectivityCheckFailed), 0.8).Combined).To(Equal(ConnectivityCheckFailed))
+		})
+
+		It("Should run each job once per sample", func() {
+			inner := &cyclingJobRunner{values: []Connectivity{ConnectivityAllowed, ConnectivityBlocked}}
+			results := NewSampledJobRunner(inner, 4, 0.8).RunJobs([]*Job{job})
+			Expect(inner.runs).To(Equal(4))
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Combined).To(Equal(ConnectivityFlaky))
+			Expect(results[0].AllowedSamples).To(Equal(2))
+		})
+	})
+}
@@ -10,5 +10,9 @@ import (
 func TestProbe(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunResourcesTests()
+	RunIPAMTests()
+	RunConnectivityTests()
+	RunTableTests()
+	RunSamplingTests()
 	RunSpecs(t, "generator suite")
 }
@@ -1,11 +1,14 @@
 package probe
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/mattfenwick/collections/pkg/slice"
 	"github.com/mattfenwick/cyclonus/pkg/utils"
 	"github.com/pkg/errors"
 	"golang.org/x/exp/maps"
 	"strings"
+	"time"
 )
 
 type Item struct {
@@ -26,8 +29,8 @@ type Table struct {
 	Wrapped *TruthTable
 }
 
-func NewTable(items []string) *Table {
-	return &Table{Wrapped: NewTruthTableFromItems(items, func(fr, to string) interface{} {
+func NewTable(froms []string, tos []string) *Table {
+	return &Table{Wrapped: NewTruthTable(froms, tos, func(fr, to string) interface{} {
 		return &Item{
 			From:       fr,
 			To:         to,
@@ -37,7 +40,7 @@ func NewTable(items []string) *Table {
 }
 
 func NewTableFromJobResults(resources *Resources, jobResults []*JobResult) *Table {
-	table := NewTable(resources.SortedPodNames())
+	table := NewTable(resources.SortedPodNames(), resources.SortedTargetNames())
 	for _, result := range jobResults {
 		fr := result.Job.FromKey
 		to := result.Job.ToKey
@@ -56,6 +59,50 @@ func (t *Table) Get(from string, to string) *Item {
 	return t.Wrapped.Get(from, to).(*Item)
 }
 
+// JobResults returns every result in the table, ordered by cell and then by key
+func (t *Table) JobResults() []*JobResult {
+	var results []*JobResult
+	for _, key := range t.Wrapped.Keys() {
+		dict := t.Get(key.From, key.To).JobResults
+		for _, k := range slice.Sort(maps.Keys(dict)) {
+			results = append(results, dict[k])
+		}
+	}
+	return results
+}
+
+// tableJSON is a table's serialized form: its cells' results are flattened, and re-grouped on load
+type tableJSON struct {
+	Froms      []string
+	Tos        []string
+	JobResults []*JobResult
+}
+
+func (t *Table) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&tableJSON{Froms: t.Wrapped.Froms, Tos: t.Wrapped.Tos, JobResults: t.JobResults()})
+}
+
+func (t *Table) UnmarshalJSON(data []byte) error {
+	serialized := &tableJSON{}
+	if err := json.Unmarshal(data, serialized); err != nil {
+		return errors.Wrapf(err, "unable to unmarshal table")
+	}
+	table := NewTable(serialized.Froms, serialized.Tos)
+	for _, result := range serialized.JobResults {
+		if result.Job == nil {
+			return errors.Errorf("unable to unmarshal table: job result without job")
+		}
+		if !table.Wrapped.HasKey(result.Job.FromKey, result.Job.ToKey) {
+			return errors.Errorf("unable to unmarshal table: job result %s outside of table", result.Key())
+		}
+		if err := table.Get(result.Job.FromKey, result.Job.ToKey).AddJobResult(result); err != nil {
+			return err
+		}
+	}
+	*t = *table
+	return nil
+}
+
 func (t *Table) RenderIngress() string {
 	return t.renderTableHelper(getIngress)
 }
@@ -68,6 +115,11 @@ func (t *Table) RenderTable() string {
 	return t.renderTableHelper(getCombined)
 }
 
+// RenderLatency renders a heatmap of probe latencies; latencies which weren't measured are "n/a"
+func (t *Table) RenderLatency() string {
+	return t.renderTableHelper(getLatency)
+}
+
 func (t *Table) renderTableHelper(render func(*JobResult) string) string {
 	isSchemaUniform, isSingleElement := true, true
 	schema := map[string]bool{}
@@ -95,7 +147,38 @@ func (t *Table) renderTableHelper(render func(*JobResult) string) string {
 }
 
 func getCombined(result *JobResult) string {
-	return result.Combined.ShortString()
+	return result.ShortString()
+}
+
+func getLatency(result *JobResult) string {
+	if result.Latency == 0 {
+		return "n/a"
+	}
+	return LatencyHeat(result.Latency) + " " + FormatLatency(result.Latency)
+}
+
+var latencyHeatLevels = []struct {
+	Below  time.Duration
+	Symbol string
+}{
+	{Below: 10 * time.Millisecond, Symbol: "\u2591"},
+	{Below: 100 * time.Millisecond, Symbol: "\u2592"},
+	{Below: time.Second, Symbol: "\u2593"},
+}
+
+// LatencyHeat shades a latency: the darker, the slower
+func LatencyHeat(latency time.Duration) string {
+	for _, level := range latencyHeatLevels {
+		if latency < level.Below {
+			return level.Symbol
+		}
+	}
+	return "\u2588"
+}
+
+// FormatLatency rounds to milliseconds
+func FormatLatency(latency time.Duration) string {
+	return fmt.Sprintf("%dms", latency.Milliseconds())
 }
 
 func getIngress(result *JobResult) string {
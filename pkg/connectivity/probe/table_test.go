@@ -0,0 +1,39 @@
+package probe
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+func RunTableTests() {
+	Describe("Table", func() {
+		It("Should render a latency heatmap", func() {
+			table := NewTable([]string{"x/a"}, []string{"x/a", "x/b"})
+			for to, latency := range map[string]time.Duration{"x/a": 3 * time.Millisecond, "x/b": 2500 * time.Millisecond} {
+				job := &Job{FromKey: "x/a", ToKey: to, Protocol: v1.ProtocolTCP, ResolvedPort: 80}
+				Expect(table.Get("x/a", to).AddJobResult(&JobResult{Job: job, Combined: ConnectivityAllowed, Latency: latency})).To(Succeed())
+			}
+
+			Expect(table.JobResults()).To(HaveLen(2))
+			Expect(table.JobResults()[1].Job.ToKey).To(Equal("x/b"))
+
+			heatmap := table.RenderLatency()
+			Expect(heatmap).To(ContainSubstring(LatencyHeat(3*time.Millisecond) + " 3ms"))
+			Expect(heatmap).To(ContainSubstring(LatencyHeat(2500*time.Millisecond) + " 2500ms"))
+			Expect(LatencyHeat(3 * time.Millisecond)).ToNot(Equal(LatencyHeat(2500 * time.Millisecond)))
+		})
+
+		It("Should show latencies which weren't measured as n/a", func() {
+			table := NewTable([]string{"x/a"}, []string{"x/b"})
+			job := &Job{FromKey: "x/a", ToKey: "x/b", Protocol: v1.ProtocolTCP, ResolvedPort: 80}
+			Expect(table.Get("x/a", "x/b").AddJobResult(&JobResult{Job: job, Combined: ConnectivityAllowed, ExecDuration: 400 * time.Millisecond})).To(Succeed())
+
+			heatmap := table.RenderLatency()
+			Expect(heatmap).To(ContainSubstring("n/a"))
+			Expect(heatmap).ToNot(ContainSubstring("400ms"))
+		})
+	})
+}
@@ -84,6 +84,14 @@ func (tt *TruthTable) Get(from string, to string) interface{} {
 	return val
 }
 
+// HasKey returns whether from->to is a cell of the table
+func (tt *TruthTable) HasKey(from string, to string) bool {
+	if _, ok := tt.Values[from]; !ok {
+		return false
+	}
+	return tt.toSet[to]
+}
+
 func (tt *TruthTable) GetKey(key *TableKey) interface{} {
 	return tt.Get(key.From, key.To)
 }
@@ -1,9 +1,10 @@
 package connectivity
 
 import (
+	"time"
+
 	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
 	"github.com/mattfenwick/cyclonus/pkg/generator"
-	v1 "k8s.io/api/core/v1"
 )
 
 type Result struct {
@@ -12,18 +13,7 @@ type Result struct {
 	TestCase         *generator.TestCase
 	Steps            []*StepResult
 	Err              error
-}
-
-func (r *Result) ResultsByProtocol() map[bool]map[v1.Protocol]int {
-	counts := map[bool]map[v1.Protocol]int{true: {}, false: {}}
-	for _, step := range r.Steps {
-		for isSuccess, protocolCounts := range step.LastComparison().ResultsByProtocol() {
-			for protocol, count := range protocolCounts {
-				counts[isSuccess][protocol] += count
-			}
-		}
-	}
-	return counts
+	Duration         time.Duration
 }
 
 func (r *Result) Features() map[string][]string {
@@ -0,0 +1,260 @@
+package connectivity
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/exp/maps"
+)
+
+type TestCaseChange string
+
+const (
+	TestCaseUnchanged    TestCaseChange = "unchanged"
+	TestCaseNewlyFailing TestCaseChange = "newly-failing"
+	TestCaseNewlyPassing TestCaseChange = "newly-passing"
+	// TestCaseCellsChanged is for test cases which failed in both runs, but on different cells
+	TestCaseCellsChanged TestCaseChange = "cells-changed"
+	// TestCaseAdded and TestCaseRemoved are for test cases found in only one of the runs
+	TestCaseAdded   TestCaseChange = "added"
+	TestCaseRemoved TestCaseChange = "removed"
+)
+
+// TestCaseDiff compares a test case's results between two runs.  Test cases are matched by description;
+// repeated descriptions are told apart by the order in which they were run.
+type TestCaseDiff struct {
+	Description       string
+	Change            TestCaseChange
+	NewlyFailingCells []string
+	NewlyPassingCells []string
+}
+
+// PassRateDelta compares the pass rate of a tag or feature between two runs; Sub is empty for primary rows
+type PassRateDelta struct {
+	Primary      string
+	Sub          string
+	BeforePassed int
+	BeforeTotal  int
+	AfterPassed  int
+	AfterTotal   int
+}
+
+func (p *PassRateDelta) BeforePercentage() float64 {
+	return percentage(p.BeforePassed, p.BeforeTotal)
+}
+
+func (p *PassRateDelta) AfterPercentage() float64 {
+	return percentage(p.AfterPassed, p.AfterTotal)
+}
+
+// Delta is the change in pass rate, in percentage points
+func (p *PassRateDelta) Delta() float64 {
+	return p.AfterPercentage() - p.BeforePercentage()
+}
+
+func (p *PassRateDelta) IsChanged() bool {
+	return p.BeforePassed != p.AfterPassed || p.BeforeTotal != p.AfterTotal
+}
+
+type ResultsDiff struct {
+	TestCases     []*TestCaseDiff
+	TagDeltas     []*PassRateDelta
+	FeatureDeltas []*PassRateDelta
+}
+
+func DiffResults(ignoreLoopback bool, before []*Result, after []*Result) *ResultsDiff {
+	beforeByKey, beforeKeys := resultsByKey(before)
+	afterByKey, afterKeys := resultsByKey(after)
+
+	diff := &ResultsDiff{}
+	for _, key := range beforeKeys {
+		afterResult, ok := afterByKey[key]
+		if !ok {
+			diff.TestCases = append(diff.TestCases, &TestCaseDiff{Description: key, Change: TestCaseRemoved})
+			continue
+		}
+		diff.TestCases = append(diff.TestCases, diffTestCase(key, ignoreLoopback, beforeByKey[key], afterResult))
+	}
+	for _, key := range afterKeys {
+		if _, ok := beforeByKey[key]; !ok {
+			diff.TestCases = append(diff.TestCases, &TestCaseDiff{Description: key, Change: TestCaseAdded})
+		}
+	}
+
+	beforeSummary := NewSummaryTableFromResults(ignoreLoopback, before)
+	afterSummary := NewSummaryTableFromResults(ignoreLoopback, after)
+	diff.TagDeltas = passRateDeltas(beforeSummary.TagPrimaryCounts, beforeSummary.TagCounts, afterSummary.TagPrimaryCounts, afterSummary.TagCounts)
+	diff.FeatureDeltas = passRateDeltas(beforeSummary.FeaturePrimaryCounts, beforeSummary.FeatureCounts, afterSummary.FeaturePrimaryCounts, afterSummary.FeatureCounts)
+	return diff
+}
+
+// ChangedTestCases returns the test cases whose results differ between the runs
+func (d *ResultsDiff) ChangedTestCases() []*TestCaseDiff {
+	return slice.Filter(func(t *TestCaseDiff) bool { return t.Change != TestCaseUnchanged }, d.TestCases)
+}
+
+func resultsByKey(results []*Result) (map[string]*Result, []string) {
+	byKey := map[string]*Result{}
+	var keys []string
+	seen := map[string]int{}
+	for _, result := range results {
+		key := result.TestCase.Description
+		seen[key]++
+		if seen[key] > 1 {
+			key = fmt.Sprintf("%s (#%d)", key, seen[key])
+		}
+		byKey[key] = result
+		keys = append(keys, key)
+	}
+	return byKey, keys
+}
+
+func diffTestCase(description string, ignoreLoopback bool, before *Result, after *Result) *TestCaseDiff {
+	beforePassed, afterPassed := resultPassed(before, ignoreLoopback), resultPassed(after, ignoreLoopback)
+	beforeCells, afterCells := failingCells(before, ignoreLoopback), failingCells(after, ignoreLoopback)
+	diff := &TestCaseDiff{Description: description}
+	for _, cell := range slice.Sort(maps.Keys(afterCells)) {
+		if !beforeCells[cell] {
+			diff.NewlyFailingCells = append(diff.NewlyFailingCells, cell)
+		}
+	}
+	for _, cell := range slice.Sort(maps.Keys(beforeCells)) {
+		if !afterCells[cell] {
+			diff.NewlyPassingCells = append(diff.NewlyPassingCells, cell)
+		}
+	}
+	switch {
+	case beforePassed && !afterPassed:
+		diff.Change = TestCaseNewlyFailing
+	case !beforePassed && afterPassed:
+		diff.Change = TestCaseNewlyPassing
+	case !beforePassed && !afterPassed && (len(diff.NewlyFailingCells) > 0 || len(diff.NewlyPassingCells) > 0):
+		diff.Change = TestCaseCellsChanged
+	default:
+		diff.Change = TestCaseUnchanged
+	}
+	return diff
+}
+
+func resultPassed(result *Result, ignoreLoopback bool) bool {
+	return result.Err == nil && result.Passed(ignoreLoopback)
+}
+
+// failingCells returns the cells -- "step N: from -> to protocol/port" -- whose kube results differed from the
+// simulation on each step's last try.  Flaky results aren't included.
+func failingCells(result *Result, ignoreLoopback bool) map[string]bool {
+	cells := map[string]bool{}
+	if result.Err != nil {
+		cells["error: "+result.Err.Error()] = true
+	}
+	for i, step := range result.Steps {
+		comparison := step.LastComparison()
+		for _, key := range comparison.Wrapped.Keys() {
+			if ignoreLoopback && key.From == key.To {
+				continue
+			}
+			item := comparison.Get(key.From, key.To)
+			for jobKey, kubeResult := range item.Kube.JobResults {
+				if kubeResult.Combined == probe.ConnectivityFlaky {
+					continue
+				}
+				if simulated, ok := item.Simulated.JobResults[jobKey]; !ok || simulated.Combined != kubeResult.Combined {
+					cells[fmt.Sprintf("step %d: %s -> %s %s", i+1, key.From, key.To, kubeResult.Key())] = true
+				}
+			}
+		}
+	}
+	return cells
+}
+
+func passRateDeltas(beforePrimaries map[string]map[bool]int, before map[string]map[string]map[bool]int, afterPrimaries map[string]map[bool]int, after map[string]map[string]map[bool]int) []*PassRateDelta {
+	newDelta := func(primary string, sub string, beforeCounts map[bool]int, afterCounts map[bool]int) *PassRateDelta {
+		return &PassRateDelta{
+			Primary:      primary,
+			Sub:          sub,
+			BeforePassed: beforeCounts[true],
+			BeforeTotal:  beforeCounts[true] + beforeCounts[false],
+			AfterPassed:  afterCounts[true],
+			AfterTotal:   afterCounts[true] + afterCounts[false],
+		}
+	}
+
+	primaries := map[string]bool{}
+	for primary := range before {
+		primaries[primary] = true
+	}
+	for primary := range after {
+		primaries[primary] = true
+	}
+	var deltas []*PassRateDelta
+	for _, primary := range slice.Sort(maps.Keys(primaries)) {
+		deltas = append(deltas, newDelta(primary, "", beforePrimaries[primary], afterPrimaries[primary]))
+		subs := map[string]bool{}
+		for sub := range before[primary] {
+			subs[sub] = true
+		}
+		for sub := range after[primary] {
+			subs[sub] = true
+		}
+		for _, sub := range slice.Sort(maps.Keys(subs)) {
+			deltas = append(deltas, newDelta(primary, sub, before[primary][sub], after[primary][sub]))
+		}
+	}
+	return deltas
+}
+
+// RenderTestCases renders a table of the test cases whose results changed, with their changed cells
+func (d *ResultsDiff) RenderTestCases() string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	table.SetRowLine(true)
+	table.SetHeader([]string{"Test", "Change", "Newly failing cells", "Newly passing cells"})
+	for _, testCase := range d.ChangedTestCases() {
+		table.Append([]string{
+			testCase.Description,
+			string(testCase.Change),
+			strings.Join(testCase.NewlyFailingCells, "\n"),
+			strings.Join(testCase.NewlyPassingCells, "\n"),
+		})
+	}
+	table.Render()
+	return str.String()
+}
+
+// RenderPassRateDeltas renders a table of pass rates; if changedOnly, rows whose counts didn't change are skipped
+func RenderPassRateDeltas(caption string, deltas []*PassRateDelta, changedOnly bool) string {
+	str := &strings.Builder{}
+	table := tablewriter.NewWriter(str)
+	table.SetAutoWrapText(false)
+	str.WriteString(fmt.Sprintf("%s pass rates:\n", caption))
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeader([]string{caption, "Before", "After", "Delta"})
+	// keep primary rows for context, if any of their sub rows changed
+	changedPrimaries := map[string]bool{}
+	for _, delta := range deltas {
+		if delta.IsChanged() {
+			changedPrimaries[delta.Primary] = true
+		}
+	}
+	for _, delta := range deltas {
+		if changedOnly && !delta.IsChanged() && !(delta.Sub == "" && changedPrimaries[delta.Primary]) {
+			continue
+		}
+		name := delta.Primary
+		if delta.Sub != "" {
+			name = " - " + delta.Sub
+		}
+		table.Append([]string{
+			name,
+			fmt.Sprintf("%d / %d = %.0f%%", delta.BeforePassed, delta.BeforeTotal, delta.BeforePercentage()),
+			fmt.Sprintf("%d / %d = %.0f%%", delta.AfterPassed, delta.AfterTotal, delta.AfterPercentage()),
+			fmt.Sprintf("%+.0f", delta.Delta()),
+		})
+	}
+	table.Render()
+	return str.String()
+}
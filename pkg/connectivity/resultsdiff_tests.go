@@ -0,0 +1,108 @@
+package connectivity
+
+import (
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+func RunResultsDiffTests() {
+	Describe("ResultsDiff", func() {
+		resources := newTwoPodResources()
+		// result simulates x/a -> x/b as blocked, and gets the given kube results
+		result := func(description string, tag string, kubeBlocked ...string) *Result {
+			step := NewStepResult(newTwoPodTable(resources, blockedCells("x/a -> x/b")), nil, nil)
+			step.AddKubeProbe(newTwoPodTable(resources, blockedCells(kubeBlocked...)))
+			testCase := generator.NewSingleStepTestCase(description, generator.NewStringSet(tag), generator.ProbeAllAvailable)
+			return &Result{TestCase: testCase, Steps: []*StepResult{step}}
+		}
+
+		It("Should classify test cases by how their results changed", func() {
+			before := []*Result{
+				result("unchanged", generator.TagDenyAll, "x/a -> x/b"),
+				result("newly failing", generator.TagDenyAll, "x/a -> x/b"),
+				result("newly passing", generator.TagAllowAll),
+				result("cells changed", generator.TagAllowAll),
+				result("removed", generator.TagAllowAll),
+			}
+			after := []*Result{
+				result("unchanged", generator.TagDenyAll, "x/a -> x/b"),
+				result("newly failing", generator.TagDenyAll),
+				result("newly passing", generator.TagAllowAll, "x/a -> x/b"),
+				result("cells changed", generator.TagAllowAll, "x/b -> x/a"),
+				result("added", generator.TagAllowAll),
+			}
+
+			diff := DiffResults(false, before, after)
+			changes := map[string]TestCaseChange{}
+			for _, testCase := range diff.TestCases {
+				changes[testCase.Description] = testCase.Change
+			}
+			Expect(changes).To(Equal(map[string]TestCaseChange{
+				"unchanged":     TestCaseUnchanged,
+				"newly failing": TestCaseNewlyFailing,
+				"newly passing": TestCaseNewlyPassing,
+				"cells changed": TestCaseCellsChanged,
+				"removed":       TestCaseRemoved,
+				"added":         TestCaseAdded,
+			}))
+			Expect(diff.ChangedTestCases()).To(HaveLen(5))
+
+			cellsChanged := diff.TestCases[3]
+			Expect(cellsChanged.NewlyFailingCells).To(Equal([]string{"step 1: x/b -> x/a TCP/80"}))
+			Expect(cellsChanged.NewlyPassingCells).To(BeEmpty())
+			Expect(diff.TestCases[1].NewlyFailingCells).To(Equal([]string{"step 1: x/a -> x/b TCP/80"}))
+
+			deltas := map[string]*PassRateDelta{}
+			for _, delta := range diff.TagDeltas {
+				deltas[delta.Primary+"/"+delta.Sub] = delta
+			}
+			// before: 2 of 2 deny-all passed; after: 1 of 2
+			Expect(deltas["rule/"+generator.TagDenyAll]).To(Equal(&PassRateDelta{Primary: "rule", Sub: generator.TagDenyAll, BeforePassed: 2, BeforeTotal: 2, AfterPassed: 1, AfterTotal: 2}))
+			Expect(deltas["rule/"+generator.TagDenyAll].Delta()).To(BeNumerically("==", -50))
+		})
+
+		It("Should tell apart cells by port and protocol", func() {
+			// table has TCP/80 and UDP/81 results for x/a -> x/b, blocking the given port and protocol
+			table := func(blocked string) *probe.Table {
+				var results []*probe.JobResult
+				for _, job := range []*probe.Job{
+					{FromKey: "x/a", ToKey: "x/b", Protocol: v1.ProtocolTCP, ResolvedPort: 80},
+					{FromKey: "x/a", ToKey: "x/b", Protocol: v1.ProtocolUDP, ResolvedPort: 81},
+				} {
+					combined := probe.ConnectivityAllowed
+					if job.Key() == blocked {
+						combined = probe.ConnectivityBlocked
+					}
+					results = append(results, &probe.JobResult{Job: job, Combined: combined})
+				}
+				return probe.NewTableFromJobResults(resources, results)
+			}
+			result := func(kubeBlocked string) *Result {
+				step := NewStepResult(table(""), nil, nil)
+				step.AddKubeProbe(table(kubeBlocked))
+				return &Result{TestCase: generator.NewSingleStepTestCase("probe", generator.NewStringSet(), generator.ProbeAllAvailable), Steps: []*StepResult{step}}
+			}
+
+			before := []*Result{result("x/a//x/b//TCP/80")}
+			after := []*Result{result("x/a//x/b//UDP/81")}
+			changed := DiffResults(false, before, after).ChangedTestCases()
+			Expect(changed).To(HaveLen(1))
+			Expect(changed[0].Change).To(Equal(TestCaseCellsChanged))
+			Expect(changed[0].NewlyFailingCells).To(Equal([]string{"step 1: x/a -> x/b UDP/81"}))
+			Expect(changed[0].NewlyPassingCells).To(Equal([]string{"step 1: x/a -> x/b TCP/80"}))
+		})
+
+		It("Should tell apart test cases with the same description", func() {
+			before := []*Result{result("probe", generator.TagDenyAll, "x/a -> x/b"), result("probe", generator.TagDenyAll, "x/a -> x/b")}
+			after := []*Result{result("probe", generator.TagDenyAll, "x/a -> x/b"), result("probe", generator.TagDenyAll)}
+
+			changed := DiffResults(false, before, after).ChangedTestCases()
+			Expect(changed).To(HaveLen(1))
+			Expect(changed[0].Description).To(Equal("probe (#2)"))
+			Expect(changed[0].Change).To(Equal(TestCaseNewlyFailing))
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package connectivity
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	"github.com/pkg/errors"
+)
+
+// ResultsFileVersion is bumped on incompatible changes to the results file's format
+const ResultsFileVersion = "v1"
+
+// RunMetadata describes what a test run was: which cyclonus, against which cluster and with which arguments
+type RunMetadata struct {
+	Command            string
+	Args               interface{}
+	CyclonusVersion    string
+	CyclonusGitSHA     string
+	CyclonusBuildTime  string
+	KubernetesVersion  string
+	KubernetesPlatform string
+	// CNI lists the images of the pods in kube-system which look like they belong to a CNI
+	CNI       []string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// ResultRecord is the serialized form of a Result
+type ResultRecord struct {
+	TestCase         *generator.TestCase
+	InitialResources *probe.Resources
+	Steps            []*StepResult
+	Err              string
+	Duration         time.Duration
+}
+
+// ResultsFile holds everything needed to re-render a run's reports without a cluster
+type ResultsFile struct {
+	Version        string
+	Metadata       *RunMetadata
+	IgnoreLoopback bool
+	Results        []*ResultRecord
+}
+
+func NewResultsFile(metadata *RunMetadata, ignoreLoopback bool, results []*Result) *ResultsFile {
+	file := &ResultsFile{
+		Version:        ResultsFileVersion,
+		Metadata:       metadata,
+		IgnoreLoopback: ignoreLoopback,
+	}
+	for _, result := range results {
+		record := &ResultRecord{
+			TestCase:         result.TestCase,
+			InitialResources: result.InitialResources,
+			Steps:            result.Steps,
+			Duration:         result.Duration,
+		}
+		if result.Err != nil {
+			record.Err = result.Err.Error()
+		}
+		file.Results = append(file.Results, record)
+	}
+	return file
+}
+
+func (r *ResultsFile) Write(path string) error {
+	bytes, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal results")
+	}
+	return errors.Wrapf(os.WriteFile(path, bytes, 0644), "unable to write results file %s", path)
+}
+
+func ReadResultsFile(path string) (*ResultsFile, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read results file %s", path)
+	}
+	// check the version first, so that an incompatible file gets a helpful error rather than a parse error
+	header := &struct{ Version string }{}
+	if err = json.Unmarshal(bytes, header); err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal results file %s", path)
+	}
+	if header.Version != ResultsFileVersion {
+		return nil, errors.Errorf("unsupported results file version %q in %s: expected %q", header.Version, path, ResultsFileVersion)
+	}
+	file := &ResultsFile{}
+	if err = json.Unmarshal(bytes, file); err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal results file %s", path)
+	}
+	return file, nil
+}
+
+// GetResults rebuilds the results, including what isn't serialized, so that they can be printed
+func (r *ResultsFile) GetResults() ([]*Result, error) {
+	var results []*Result
+	for _, record := range r.Results {
+		result := &Result{
+			InitialResources: record.InitialResources,
+			TestCase:         record.TestCase,
+			Steps:            record.Steps,
+			Duration:         record.Duration,
+		}
+		if record.Err != "" {
+			result.Err = errors.New(record.Err)
+		}
+		for i, step := range result.Steps {
+			policy, err := matcher.BuildNetworkPolicies(true, step.KubePolicies)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "unable to rebuild policy for step %d of test case '%s'", i+1, record.TestCase.Description)
+			}
+			step.Policy = policy
+			step.comparisons = make([]*ComparisonTable, len(step.KubeProbes))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,98 @@
+package connectivity
+
+import (
+	"path/filepath"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newTwoPodResources has pods x/a and x/b
+func newTwoPodResources() *probe.Resources {
+	return &probe.Resources{Pods: []*probe.Pod{{Namespace: "x", Name: "a"}, {Namespace: "x", Name: "b"}}}
+}
+
+// newTwoPodTable has a TCP/80 result for each pair of the resources' pods: the cells -- "from -> to" -- in cells
+// get the given connectivity, and the rest are allowed
+func newTwoPodTable(resources *probe.Resources, cells map[string]probe.Connectivity) *probe.Table {
+	var results []*probe.JobResult
+	for _, from := range resources.Pods {
+		for _, to := range resources.Pods {
+			fromKey, toKey := from.PodString().String(), to.PodString().String()
+			combined := probe.ConnectivityAllowed
+			if c, ok := cells[fromKey+" -> "+toKey]; ok {
+				combined = c
+			}
+			job := &probe.Job{FromKey: fromKey, ToKey: toKey, Protocol: v1.ProtocolTCP, ResolvedPort: 80}
+			results = append(results, &probe.JobResult{Job: job, Combined: combined, Ingress: &combined, Egress: &combined})
+		}
+	}
+	return probe.NewTableFromJobResults(resources, results)
+}
+
+// blockedCells blocks each of the cells, for newTwoPodTable
+func blockedCells(cells ...string) map[string]probe.Connectivity {
+	blocked := map[string]probe.Connectivity{}
+	for _, cell := range cells {
+		blocked[cell] = probe.ConnectivityBlocked
+	}
+	return blocked
+}
+
+func RunResultsFileTests() {
+	Describe("ResultsFile", func() {
+		resources := newTwoPodResources()
+		blocked := blockedCells("x/a -> x/b", "x/b -> x/a")
+		denyAll := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "deny-all"},
+			Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+		}
+
+		It("Should round trip results, and rebuild what isn't serialized", func() {
+			step := NewStepResult(newTwoPodTable(resources, blocked), nil, []*networkingv1.NetworkPolicy{denyAll})
+			step.AddKubeProbe(newTwoPodTable(resources, nil))
+			step.AddKubeProbe(newTwoPodTable(resources, blocked))
+			testCase := generator.NewSingleStepTestCase("deny all", generator.NewStringSet(generator.TagDenyAll), generator.ProbeAllAvailable, generator.CreatePolicy(denyAll))
+			results := []*Result{
+				{InitialResources: resources, TestCase: testCase, Steps: []*StepResult{step}},
+				{InitialResources: resources, TestCase: testCase, Err: errors.New("unable to create policy")},
+			}
+
+			path := filepath.Join(GinkgoT().TempDir(), "results.json")
+			Expect(NewResultsFile(&RunMetadata{Command: "generate", KubernetesVersion: "v1.30.0"}, true, results).Write(path)).To(Succeed())
+
+			file, err := ReadResultsFile(path)
+			Expect(err).To(Succeed())
+			Expect(file.Version).To(Equal(ResultsFileVersion))
+			Expect(file.IgnoreLoopback).To(BeTrue())
+			Expect(file.Metadata.KubernetesVersion).To(Equal("v1.30.0"))
+
+			loaded, err := file.GetResults()
+			Expect(err).To(Succeed())
+			Expect(loaded).To(HaveLen(2))
+			Expect(loaded[0].TestCase.Tags).To(Equal(testCase.Tags))
+			Expect(loaded[0].Steps[0].Policy).ToNot(BeNil())
+			Expect(loaded[0].Steps[0].KubeProbes).To(HaveLen(2))
+			Expect(loaded[0].Steps[0].SimulatedProbe.RenderTable()).To(Equal(step.SimulatedProbe.RenderTable()))
+			Expect(loaded[0].Steps[0].Comparison(0).ValueCounts(false)).To(Equal(step.Comparison(0).ValueCounts(false)))
+			Expect(loaded[0].Passed(false)).To(BeTrue())
+			Expect(loaded[1].Err).To(MatchError("unable to create policy"))
+		})
+
+		It("Should reject other versions", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "results.json")
+			file := NewResultsFile(nil, false, nil)
+			file.Version = "v0"
+			Expect(file.Write(path)).To(Succeed())
+
+			_, err := ReadResultsFile(path)
+			Expect(err).To(MatchError(ContainSubstring("unsupported results file version")))
+		})
+	})
+}
@@ -0,0 +1,265 @@
+package connectivity
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+// Shrinker minimizes failing test cases: it repeatedly simplifies a test case and re-runs it, keeping each
+// simplification only if the same cells still differ from the simulation, in the same way.
+type Shrinker struct {
+	Interpreter *Interpreter
+	// MaxRuns bounds how many times simplified test cases are run
+	MaxRuns int
+}
+
+// ShrinkResult is a failing test case's minimal reproducer: Reproducer, run on the pods in Resources, still gets
+// each of the Cells wrong
+type ShrinkResult struct {
+	Original   *generator.TestCase
+	Reproducer *generator.TestCase
+	Resources  *probe.Resources
+	// Cells are the mismatched cells, as of the last run which kept a simplification
+	Cells           map[string]*CellMismatch
+	Simplifications []string
+	Runs            int
+}
+
+// Shrink minimizes the failing test case of result.  First the topology is shrunk to the pods of the
+// mismatched cells, and the probes to their port and protocol, if they share one; then the simplifications of
+// generator.TestCase.ShrinkCandidates are tried, coarsest first, until none of them still fails the same way, or
+// MaxRuns is reached.
+func (s *Shrinker) Shrink(result *Result) (*ShrinkResult, error) {
+	if result.Err != nil {
+		return nil, errors.WithMessagef(result.Err, "unable to shrink test case which failed to run")
+	}
+	cells := MismatchedCells(result, s.Interpreter.Config.IgnoreLoopback)
+	if len(cells) == 0 {
+		return nil, errors.Errorf("unable to shrink test case %s: no cells differ from the simulation", result.TestCase.Description)
+	}
+
+	shrunk := &ShrinkResult{
+		Original:   result.TestCase,
+		Reproducer: result.TestCase,
+		Resources:  s.Interpreter.resources,
+		Cells:      cells,
+	}
+	defer func() {
+		// leave the cluster as the interpreter expects it, whichever pods the last run was restricted to
+		if err := s.reset(); err != nil {
+			logrus.Warnf("unable to reset cluster after shrinking: %+v", err)
+		}
+	}()
+
+	if resources := shrinkTopology(s.Interpreter.resources, result.TestCase, cells); len(resources.Pods) < len(s.Interpreter.resources.Pods) {
+		s.try(shrunk, "restrict topology to pods "+strings.Join(resources.SortedTargetNames(), ", "), shrunk.Reproducer, resources)
+	}
+	if narrowed, ok := narrowProbes(shrunk.Reproducer, cells); ok {
+		s.try(shrunk, "restrict probes to the mismatched port and protocol", narrowed, shrunk.Resources)
+	}
+
+	for simplified := true; simplified; {
+		simplified = false
+		for _, candidate := range shrunk.Reproducer.ShrinkCandidates() {
+			if shrunk.Runs >= s.MaxRuns {
+				logrus.Warnf("stopped shrinking test case %s after %d runs", result.TestCase.Description, shrunk.Runs)
+				return shrunk, nil
+			}
+			if s.try(shrunk, candidate.Description, candidate.TestCase, shrunk.Resources) {
+				simplified = true
+				break
+			}
+		}
+	}
+	return shrunk, nil
+}
+
+// try runs the test case on the pods of resources, and keeps it if it gets the same cells wrong the same way:
+// a cell which was expected to be blocked but was allowed mustn't now be expected to be allowed but be blocked
+func (s *Shrinker) try(shrunk *ShrinkResult, description string, testCase *generator.TestCase, resources *probe.Resources) bool {
+	shrunk.Runs++
+	logrus.Infof("shrink run %d: trying '%s'", shrunk.Runs, description)
+	if err := s.reset(); err != nil {
+		logrus.Warnf("unable to reset cluster: %+v", err)
+		return false
+	}
+	result := s.Interpreter.withResources(resources).ExecuteTestCase(testCase)
+	if result.Err != nil {
+		logrus.Infof("shrink run %d: rejected, unable to run: %s", shrunk.Runs, result.Err)
+		return false
+	}
+	cells := MismatchedCells(result, s.Interpreter.Config.IgnoreLoopback)
+	for cell, mismatch := range shrunk.Cells {
+		current, ok := cells[cell]
+		if !ok {
+			logrus.Infof("shrink run %d: rejected, cell %s no longer differs from the simulation", shrunk.Runs, cell)
+			return false
+		}
+		if current.Expected != mismatch.Expected || current.Actual != mismatch.Actual {
+			logrus.Infof("shrink run %d: rejected, cell %s now expected %s, got %s, instead of expected %s, got %s", shrunk.Runs, cell, current.Expected, current.Actual, mismatch.Expected, mismatch.Actual)
+			return false
+		}
+	}
+	logrus.Infof("shrink run %d: kept", shrunk.Runs)
+	for cell := range shrunk.Cells {
+		shrunk.Cells[cell] = cells[cell]
+	}
+	shrunk.Reproducer = testCase
+	shrunk.Resources = resources
+	shrunk.Simplifications = append(shrunk.Simplifications, description)
+	return true
+}
+
+// reset undoes label changes on all the interpreter's pods, since runs restricted to fewer pods only reset those
+func (s *Shrinker) reset() error {
+	state := &TestCaseState{
+		Kubernetes: s.Interpreter.kubernetes,
+		Resources:  s.Interpreter.resources,
+		Policies:   []*networkingv1.NetworkPolicy{},
+	}
+	return state.ResetClusterState()
+}
+
+// CellMismatch is a cell whose kube result differs from the simulation
+type CellMismatch struct {
+	Job      *probe.Job
+	Step     int
+	Expected probe.Connectivity
+	Actual   probe.Connectivity
+}
+
+func (c *CellMismatch) String() string {
+	return fmt.Sprintf("step %d: expected %s, got %s", c.Step+1, c.Expected, c.Actual)
+}
+
+// MismatchedCells finds the cells -- "from -> to protocol/port" -- whose kube results on a step's last try
+// differ from the simulation, as of the first step on which they're wrong.  Flaky results aren't included.
+func MismatchedCells(result *Result, ignoreLoopback bool) map[string]*CellMismatch {
+	cells := map[string]*CellMismatch{}
+	for i, step := range result.Steps {
+		expected := jobResultValues(step.SimulatedProbe)
+		for _, jobResult := range step.LastKubeProbe().JobResults() {
+			job := jobResult.Job
+			if (ignoreLoopback && job.FromKey == job.ToKey) || jobResult.Combined == probe.ConnectivityFlaky {
+				continue
+			}
+			cell := fmt.Sprintf("%s -> %s %s", job.FromKey, job.ToKey, jobResult.Key())
+			if value, ok := expected[job.Key()]; ok && value != jobResult.Combined {
+				if _, seen := cells[cell]; !seen {
+					cells[cell] = &CellMismatch{Job: job, Step: i, Expected: value, Actual: jobResult.Combined}
+				}
+			}
+		}
+	}
+	return cells
+}
+
+// shrinkTopology keeps the pods of the mismatched cells, and those which the test case refers to.  Dropping the
+// other pods doesn't change whether the remaining pods can connect: they stay in the cluster, and are just no
+// longer probed.
+func shrinkTopology(resources *probe.Resources, testCase *generator.TestCase, cells map[string]*CellMismatch) *probe.Resources {
+	keep := map[string]bool{}
+	for _, cell := range cells {
+		keep[cell.Job.FromKey], keep[cell.Job.ToKey] = true, true
+	}
+	for _, step := range testCase.Steps {
+		for _, action := range step.Actions {
+			if action.SetPodLabels != nil {
+				keep[string(probe.NewPodString(action.SetPodLabels.Namespace, action.SetPodLabels.Pod))] = true
+			} else if action.DeletePod != nil {
+				keep[string(probe.NewPodString(action.DeletePod.Namespace, action.DeletePod.Pod))] = true
+			}
+		}
+		if step.LongLived != nil {
+			for _, pod := range append(append([]string{}, step.LongLived.From...), step.LongLived.To...) {
+				keep[pod] = true
+			}
+		}
+	}
+
+	return &probe.Resources{
+		Namespaces:  resources.Namespaces,
+		Pods:        slice.Filter(func(pod *probe.Pod) bool { return keep[pod.PodString().String()] }, resources.Pods),
+		IPAM:        resources.IPAM,
+		ExternalIPs: slice.Filter(func(ip string) bool { return keep[ip] }, resources.ExternalIPs),
+	}
+}
+
+// narrowProbes points every step's probe at the mismatched cells' port and protocol, if they share one
+func narrowProbes(testCase *generator.TestCase, cells map[string]*CellMismatch) (*generator.TestCase, bool) {
+	var job *probe.Job
+	for _, cell := range cells {
+		if job != nil && (cell.Job.Protocol != job.Protocol || cell.Job.ResolvedPort != job.ResolvedPort) {
+			return nil, false
+		}
+		job = cell.Job
+	}
+
+	narrowed := &generator.TestCase{Description: testCase.Description, Tags: testCase.Tags}
+	changed := false
+	for _, step := range testCase.Steps {
+		probeConfig := generator.NewProbeConfig(intstr.FromInt(job.ResolvedPort), job.Protocol, step.Probe.Mode)
+		if step.Probe.PortProtocol == nil || step.Probe.PortProtocol.Port != probeConfig.PortProtocol.Port || step.Probe.PortProtocol.Protocol != probeConfig.PortProtocol.Protocol {
+			changed = true
+		}
+		narrowed.Steps = append(narrowed.Steps, &generator.TestStep{Probe: probeConfig, LongLived: step.LongLived, Actions: step.Actions})
+	}
+	return narrowed, changed
+}
+
+// RenderYaml writes the reproducer as a yaml test case, which can be loaded with generator.LoadTestCases.  A
+// comment header explains which cells it gets wrong, and which pods it needs.
+func (s *ShrinkResult) RenderYaml() (string, error) {
+	bs, err := yaml.Marshal(s.Reproducer)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to marshal reproducer")
+	}
+
+	header := &strings.Builder{}
+	header.WriteString(fmt.Sprintf("# minimal reproducer of test case: %s\n", s.Original.Description))
+	header.WriteString(fmt.Sprintf("# found in %d runs, with %d simplifications:\n", s.Runs, len(s.Simplifications)))
+	for _, simplification := range s.Simplifications {
+		header.WriteString(fmt.Sprintf("#   - %s\n", simplification))
+	}
+	header.WriteString("# cells which differ from the expected results:\n")
+	for _, cell := range slice.Sort(maps.Keys(s.Cells)) {
+		header.WriteString(fmt.Sprintf("#   - %s (%s)\n", cell, s.Cells[cell].String()))
+	}
+	header.WriteString("# pods:\n")
+	for _, pod := range s.Resources.Pods {
+		header.WriteString(fmt.Sprintf("#   - %s, labels %s, namespace labels %s\n", pod.PodString().String(), labelsString(pod.Labels), labelsString(s.Resources.Namespaces[pod.Namespace])))
+	}
+	for _, ip := range s.Resources.ExternalIPs {
+		header.WriteString(fmt.Sprintf("#   - external ip %s\n", ip))
+	}
+	return header.String() + string(bs), nil
+}
+
+func labelsString(labels map[string]string) string {
+	var pairs []string
+	for _, key := range slice.Sort(maps.Keys(labels)) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// WriteYaml writes the reproducer to dir, named after the index and description of the test case it came from
+func (s *ShrinkResult) WriteYaml(dir string, index int) (string, error) {
+	rendered, err := s.RenderYaml()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%03d-%s.yaml", index, slugify(s.Original.Description)))
+	return path, writeFile(path, []byte(rendered))
+}
@@ -0,0 +1,134 @@
+package connectivity
+
+import (
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func RunShrinkerTests() {
+	Describe("Shrinker", func() {
+		It("Should simplify a failing test case, keeping what gets the same cells wrong", func() {
+			// the mock cluster allows everything, so that cells which policies block are always wrong
+			kubernetes := kube.NewMockKubernetes(1.0)
+			resources, err := probe.NewDefaultResources(kubernetes, []string{"x", "y", "z"}, []string{"a", "b", "c"}, []int{80, 81}, []v1.Protocol{v1.ProtocolTCP}, nil, 1, false, false, "registry.k8s.io")
+			Expect(err).To(Succeed())
+			interpreter := NewInterpreter(kubernetes, resources, &InterpreterConfig{ResetClusterBeforeTestCase: true, VerifyClusterStateBeforeTestCase: true})
+
+			port80, port81 := intstr.FromInt(80), intstr.FromInt(81)
+			allowAll := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "z", Name: "allow-all"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+					Ingress:     []networkingv1.NetworkPolicyIngressRule{{}},
+				},
+			}
+			egressToY := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "egress-to-y"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"pod": "a"}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress: []networkingv1.NetworkPolicyEgressRule{{
+						To:    []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ns": "y"}}}},
+						Ports: []networkingv1.NetworkPolicyPort{{Port: &port80}, {Port: &port81}},
+					}},
+				},
+			}
+			testCase := generator.NewTestCase("egress to y", generator.NewStringSet(generator.TagEgress),
+				generator.NewTestStep(generator.ProbeAllAvailable, generator.CreatePolicy(allowAll)),
+				generator.NewTestStep(generator.ProbeAllAvailable, generator.CreatePolicy(egressToY)))
+
+			result := interpreter.ExecuteTestCase(testCase)
+			Expect(result.Err).To(Succeed())
+			cells := MismatchedCells(result, false)
+			Expect(cells).To(HaveLen(12))
+			Expect(cells["x/a -> z/c TCP/81"].String()).To(Equal("step 2: expected blocked, got allowed"))
+
+			shrunk, err := (&Shrinker{Interpreter: interpreter, MaxRuns: 50}).Shrink(result)
+			Expect(err).To(Succeed())
+			Expect(shrunk.Resources.SortedPodNames()).To(Equal([]string{"x/a", "x/b", "x/c", "z/a", "z/b", "z/c"}))
+			Expect(shrunk.Cells).To(HaveLen(12))
+
+			// the allow-all policy is dropped, and denying all egress still blocks the same cells
+			Expect(shrunk.Reproducer.Steps).To(HaveLen(1))
+			Expect(shrunk.Reproducer.Steps[0].Probe.PortProtocol).To(BeNil())
+			Expect(shrunk.Reproducer.Steps[0].Actions).To(HaveLen(1))
+			policy := shrunk.Reproducer.Steps[0].Actions[0].CreatePolicy.Policy
+			Expect(policy.Name).To(Equal("egress-to-y"))
+			Expect(policy.Spec.Egress).To(BeEmpty())
+			Expect(testCase.Steps[1].Actions[0].CreatePolicy.Policy.Spec.Egress).To(HaveLen(1))
+
+			rendered, err := shrunk.RenderYaml()
+			Expect(err).To(Succeed())
+			loaded, err := generator.ParseTestCases([]byte(rendered))
+			Expect(err).To(Succeed())
+			Expect(loaded).To(HaveLen(1))
+			Expect(loaded[0].Steps[0].Actions[0].CreatePolicy.Policy.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeEgress}))
+			Expect(loaded[0].Steps[0].Actions[0].CreatePolicy.Policy.Spec.Egress).To(BeEmpty())
+		})
+
+		It("Should reject simplifications which flip a cell's mismatch", func() {
+			kubernetes := kube.NewMockKubernetes(1.0)
+			resources, err := probe.NewDefaultResources(kubernetes, []string{"x", "y", "z"}, []string{"a", "b", "c"}, []int{80}, []v1.Protocol{v1.ProtocolTCP}, nil, 1, false, false, "registry.k8s.io")
+			Expect(err).To(Succeed())
+			interpreter := NewInterpreter(kubernetes, resources, &InterpreterConfig{ResetClusterBeforeTestCase: true, VerifyClusterStateBeforeTestCase: true})
+			// every cell is wrong: dropping the policy still gets them all wrong, but the other way around
+			runner := &probe.Runner{JobRunner: &invertingJobRunner{kubernetes: kubernetes, namespaces: []string{"x", "y", "z"}}, JobBuilder: interpreter.jobBuilder}
+			interpreter.kubeRunner, interpreter.probeRunner = runner, runner
+
+			denyAll := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "deny-all"},
+				Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+			}
+			testCase := generator.NewSingleStepTestCase("deny all", generator.NewStringSet(generator.TagDenyAll), generator.ProbeAllAvailable, generator.CreatePolicy(denyAll))
+
+			result := interpreter.ExecuteTestCase(testCase)
+			Expect(result.Err).To(Succeed())
+			Expect(MismatchedCells(result, false)).To(HaveLen(81))
+			Expect(MismatchedCells(result, false)["y/a -> x/b TCP/80"].String()).To(Equal("step 1: expected blocked, got allowed"))
+
+			shrunk, err := (&Shrinker{Interpreter: interpreter, MaxRuns: 10}).Shrink(result)
+			Expect(err).To(Succeed())
+			Expect(shrunk.Simplifications).To(Equal([]string{"restrict probes to the mismatched port and protocol"}))
+			Expect(shrunk.Reproducer.Steps[0].Actions).To(HaveLen(1))
+			Expect(shrunk.Cells["y/a -> x/b TCP/80"].String()).To(Equal("step 1: expected blocked, got allowed"))
+		})
+
+		It("Should not shrink a test case which passed", func() {
+			result := &Result{TestCase: generator.NewSingleStepTestCase("passed", generator.NewStringSet(), generator.ProbeAllAvailable)}
+			_, err := (&Shrinker{Interpreter: &Interpreter{Config: &InterpreterConfig{}}}).Shrink(result)
+			Expect(err).ToNot(Succeed())
+		})
+	})
+}
+
+// invertingJobRunner gets every cell wrong: it simulates the cluster's policies, and reports the opposite
+type invertingJobRunner struct {
+	kubernetes kube.IKubernetes
+	namespaces []string
+}
+
+func (r *invertingJobRunner) RunJobs(jobs []*probe.Job) []*probe.JobResult {
+	netpols, err := kube.GetNetworkPoliciesInNamespaces(r.kubernetes, r.namespaces)
+	Expect(err).To(Succeed())
+	policies, err := matcher.BuildNetworkPolicies(true, slice.Map(func(p networkingv1.NetworkPolicy) *networkingv1.NetworkPolicy { return &p }, netpols))
+	Expect(err).To(Succeed())
+
+	results := (&probe.SimulatedJobRunner{Policies: policies}).RunJobs(jobs)
+	for _, result := range results {
+		if result.Combined == probe.ConnectivityAllowed {
+			result.Combined = probe.ConnectivityBlocked
+		} else if result.Combined == probe.ConnectivityBlocked {
+			result.Combined = probe.ConnectivityAllowed
+		}
+	}
+	return results
+}
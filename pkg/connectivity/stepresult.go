@@ -1,6 +1,8 @@
 package connectivity
 
 import (
+	"time"
+
 	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
 	"github.com/mattfenwick/cyclonus/pkg/matcher"
 	networkingv1 "k8s.io/api/networking/v1"
@@ -9,9 +11,45 @@ import (
 type StepResult struct {
 	SimulatedProbe *probe.Table
 	KubeProbes     []*probe.Table
-	Policy         *matcher.Policy
-	KubePolicies   []*networkingv1.NetworkPolicy
-	comparisons    []*ComparisonTable
+	// Policy isn't serialized, since it can be rebuilt from KubePolicies
+	Policy       *matcher.Policy `json:"-"`
+	KubePolicies []*networkingv1.NetworkPolicy
+	// Duration covers the step's actions, waiting for them to take effect, and probing
+	Duration time.Duration
+	// Convergence is only set when running in adaptive convergence mode
+	Convergence *Convergence
+	// Transients is only set when detecting transients, on steps with policy actions
+	Transients *TransientReport
+	// LongLived is only set on steps with long-lived connections; it doesn't affect whether the step passed
+	LongLived []*LongLivedConnectionResult
+	// CellHistories tracks, by job key, the jobs which were re-run because their kube results differed from
+	// the simulation
+	CellHistories map[string]*CellHistory
+	// MaxFlakyPercent is the share of compared cells -- between 0 and 100 -- which may be flaky for the step
+	// to pass
+	MaxFlakyPercent float64
+	comparisons     []*ComparisonTable
+}
+
+// CellAttempt is a job's kube result on one try
+type CellAttempt struct {
+	Try    int
+	Result *probe.JobResult
+}
+
+// CellHistory is a job's kube results on each try in which it was run, starting from the first try
+type CellHistory struct {
+	Expected probe.Connectivity
+	Attempts []*CellAttempt
+}
+
+func (c *CellHistory) Job() *probe.Job {
+	return c.Attempts[0].Result.Job
+}
+
+// IsFlaky is true if the job's kube result agreed with the simulation on a later try
+func (c *CellHistory) IsFlaky() bool {
+	return c.Attempts[len(c.Attempts)-1].Result.Combined == c.Expected
 }
 
 func NewStepResult(simulated *probe.Table, policy *matcher.Policy, kubePolicies []*networkingv1.NetworkPolicy) *StepResult {
@@ -27,6 +65,73 @@ func (s *StepResult) AddKubeProbe(kubeProbe *probe.Table) {
 	s.comparisons = append(s.comparisons, nil)
 }
 
+// AddKubeProbeRetry records a try in which only some jobs were re-run: the try's table is the previous try's,
+// with the re-run jobs' results replaced
+func (s *StepResult) AddKubeProbeRetry(resources *probe.Resources, results []*probe.JobResult) {
+	try := len(s.KubeProbes) + 1
+	previous := s.LastKubeProbe()
+	previousResults := map[string]*probe.JobResult{}
+	for _, result := range previous.JobResults() {
+		previousResults[result.Job.Key()] = result
+	}
+	expected := jobResultValues(s.SimulatedProbe)
+	if s.CellHistories == nil {
+		s.CellHistories = map[string]*CellHistory{}
+	}
+
+	rerun := map[string]*probe.JobResult{}
+	for _, result := range results {
+		key := result.Job.Key()
+		rerun[key] = result
+		history, ok := s.CellHistories[key]
+		if !ok {
+			// a job is only re-run until it matches, so one which hasn't been re-run yet still has its
+			// result from the first try
+			history = &CellHistory{Expected: expected[key], Attempts: []*CellAttempt{{Try: 1, Result: previousResults[key]}}}
+			s.CellHistories[key] = history
+		}
+		history.Attempts = append(history.Attempts, &CellAttempt{Try: try, Result: result})
+	}
+
+	var merged []*probe.JobResult
+	for key, result := range previousResults {
+		if rerunResult, ok := rerun[key]; ok {
+			merged = append(merged, rerunResult)
+		} else {
+			merged = append(merged, result)
+		}
+	}
+	s.AddKubeProbe(probe.NewTableFromJobResults(resources, merged))
+}
+
+// MismatchedJobs returns the jobs whose results on the last try differ from the simulation
+func (s *StepResult) MismatchedJobs(ignoreLoopback bool) []*probe.Job {
+	expected := jobResultValues(s.SimulatedProbe)
+	var jobs []*probe.Job
+	for _, result := range s.LastKubeProbe().JobResults() {
+		if ignoreLoopback && result.Job.FromKey == result.Job.ToKey {
+			continue
+		}
+		if value, ok := expected[result.Job.Key()]; ok && value != result.Combined {
+			jobs = append(jobs, result.Job)
+		}
+	}
+	return jobs
+}
+
+// FlakyAndFailingCells counts the re-run jobs which eventually agreed with the simulation, and those which never did
+func (s *StepResult) FlakyAndFailingCells() (int, int) {
+	flaky, failing := 0, 0
+	for _, history := range s.CellHistories {
+		if history.IsFlaky() {
+			flaky++
+		} else {
+			failing++
+		}
+	}
+	return flaky, failing
+}
+
 func (s *StepResult) Comparison(i int) *ComparisonTable {
 	if s.comparisons[i] == nil {
 		s.comparisons[i] = NewComparisonTableFrom(s.KubeProbes[i], s.SimulatedProbe)
@@ -43,5 +148,10 @@ func (s *StepResult) LastKubeProbe() *probe.Table {
 }
 
 func (s *StepResult) Passed(ignoreLoopback bool) bool {
-	return s.LastComparison().ValueCounts(ignoreLoopback)[DifferentComparison] == 0
+	counts := s.LastComparison().ValueCounts(ignoreLoopback)
+	if counts[DifferentComparison] > 0 {
+		return false
+	}
+	flaky := counts[FlakyComparison]
+	return flaky == 0 || percentage(flaky, counts[SameComparison]+flaky) <= s.MaxFlakyPercent
 }
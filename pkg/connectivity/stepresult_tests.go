@@ -0,0 +1,53 @@
+package connectivity
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func RunStepResultTests() {
+	Describe("StepResult", func() {
+		resources := newTwoPodResources()
+
+		It("Should re-run only the mismatched jobs, and keep their history", func() {
+			stepResult := NewStepResult(newTwoPodTable(resources, nil), nil, nil)
+
+			// 1. the first try: x/a -> x/b and x/b -> x/a are blocked
+			stepResult.AddKubeProbe(newTwoPodTable(resources, blockedCells("x/a -> x/b", "x/b -> x/a")))
+			mismatched := stepResult.MismatchedJobs(false)
+			Expect(mismatched).To(HaveLen(2))
+
+			// 2. the second try: still blocked
+			runner := &laggingJobRunner{lag: 1}
+			stepResult.AddKubeProbeRetry(resources, runner.RunJobs(mismatched))
+			Expect(stepResult.KubeProbes).To(HaveLen(2))
+			Expect(stepResult.Passed(false)).To(BeFalse())
+			Expect(stepResult.MismatchedJobs(false)).To(HaveLen(2))
+
+			// 3. the third try: x/a -> x/b is allowed; x/b -> x/a isn't re-run, and so is still blocked
+			stepResult.AddKubeProbeRetry(resources, runner.RunJobs(mismatched[:1]))
+			Expect(stepResult.KubeProbes).To(HaveLen(3))
+			Expect(stepResult.LastKubeProbe().JobResults()).To(HaveLen(4))
+			Expect(stepResult.MismatchedJobs(false)).To(HaveLen(1))
+
+			Expect(stepResult.CellHistories).To(HaveLen(2))
+			flakyHistory := stepResult.CellHistories[mismatched[0].Key()]
+			Expect(flakyHistory.IsFlaky()).To(BeTrue())
+			Expect(flakyHistory.Attempts).To(HaveLen(3))
+			Expect(flakyHistory.Attempts[0].Try).To(Equal(1))
+			Expect(flakyHistory.Attempts[2].Try).To(Equal(3))
+			Expect(stepResult.CellHistories[mismatched[1].Key()].IsFlaky()).To(BeFalse())
+
+			flaky, failing := stepResult.FlakyAndFailingCells()
+			Expect(flaky).To(Equal(1))
+			Expect(failing).To(Equal(1))
+		})
+
+		It("Should not re-run ignored loopback jobs", func() {
+			stepResult := NewStepResult(newTwoPodTable(resources, nil), nil, nil)
+			stepResult.AddKubeProbe(newTwoPodTable(resources, blockedCells("x/a -> x/a", "x/b -> x/b")))
+			Expect(stepResult.MismatchedJobs(false)).To(HaveLen(2))
+			Expect(stepResult.MismatchedJobs(true)).To(BeEmpty())
+		})
+	})
+}
@@ -11,5 +11,17 @@ func TestConnectivity(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunTestCaseStateTests()
 	RunPrinterTests()
+	RunComparisonTableTests()
+	RunSummaryTests()
+	RunConvergenceTests()
+	RunTransientTests()
+	RunLongLivedTests()
+	RunStepResultTests()
+	RunResultsFileTests()
+	RunResultsDiffTests()
+	RunHTMLReportTests()
+	RunMultipleContextTesterTests()
+	RunExportTests()
+	RunShrinkerTests()
 	RunSpecs(t, "connectivity suite")
 }
@@ -2,14 +2,33 @@ package connectivity
 
 import (
 	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mattfenwick/collections/pkg/set"
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
 	v1 "k8s.io/api/core/v1"
 )
 
 type SummaryTable struct {
-	Tests                [][]string
-	Passed               int
-	Failed               int
-	ProtocolCounts       map[v1.Protocol]map[Comparison]int
+	Tests             [][]string
+	Passed            int
+	Failed            int
+	ProtocolCounts    map[v1.Protocol]map[Comparison]int
+	ProtocolLatencies map[v1.Protocol][]time.Duration
+	// ActionConvergences groups step convergences by the types of the step's actions
+	ActionConvergences map[string][]*Convergence
+	// TransientSteps has a row for each step which was monitored for transients
+	TransientSteps [][]string
+	// LongLivedCounts counts long-lived connection outcomes by protocol
+	LongLivedCounts map[string]map[LongLivedOutcome]int
+	// RetriedSteps has a row for each step with re-run cells; FlakyCells agreed with the simulation on a
+	// later try, while FailingCells never did
+	RetriedSteps         [][]string
+	FlakyCells           int
+	FailingCells         int
 	TagCounts            map[string]map[string]map[bool]int
 	TagPrimaryCounts     map[string]map[bool]int
 	FeatureCounts        map[string]map[string]map[bool]int
@@ -22,12 +41,17 @@ func NewSummaryTableFromResults(ignoreLoopback bool, results []*Result) *Summary
 		Passed:               0,
 		Failed:               0,
 		ProtocolCounts:       map[v1.Protocol]map[Comparison]int{v1.ProtocolTCP: {}, v1.ProtocolSCTP: {}, v1.ProtocolUDP: {}},
+		ProtocolLatencies:    map[v1.Protocol][]time.Duration{},
+		ActionConvergences:   map[string][]*Convergence{},
+		LongLivedCounts:      map[string]map[LongLivedOutcome]int{},
 		TagCounts:            map[string]map[string]map[bool]int{},
 		TagPrimaryCounts:     map[string]map[bool]int{},
 		FeatureCounts:        map[string]map[string]map[bool]int{},
 		FeaturePrimaryCounts: map[string]map[bool]int{},
 	}
 	passedTotal, failedTotal := 0, 0
+	// retries carry over the results of jobs which weren't re-run, so only count each result's latency once
+	countedLatencies := map[*probe.JobResult]bool{}
 
 	for testNumber, result := range results {
 		passed := result.Passed(ignoreLoopback)
@@ -60,11 +84,45 @@ func NewSummaryTableFromResults(ignoreLoopback bool, results []*Result) *Summary
 
 		summary.Tests = append(summary.Tests, []string{
 			fmt.Sprintf("%d: %s", testNumber+1, result.TestCase.Description),
-			testResult, "", "", "", "",
+			testResult, "", "", "", "", "",
 			"", "", "",
 		})
 
 		for stepNumber, step := range result.Steps {
+			for protocol, counts := range LongLivedOutcomeCounts(step.LongLived) {
+				if _, ok := summary.LongLivedCounts[protocol]; !ok {
+					summary.LongLivedCounts[protocol] = map[LongLivedOutcome]int{}
+				}
+				for outcome, count := range counts {
+					summary.LongLivedCounts[protocol][outcome] += count
+				}
+			}
+			if step.Transients != nil {
+				summary.TransientSteps = append(summary.TransientSteps, []string{
+					fmt.Sprintf("%d: %s", testNumber+1, result.TestCase.Description),
+					fmt.Sprintf("Step %d", stepNumber+1),
+					intToString(step.Transients.MonitoredProbes),
+					intToString(step.Transients.Polls),
+					intToString(len(step.Transients.Observations)),
+				})
+			}
+			if len(step.CellHistories) > 0 {
+				flaky, failing := step.FlakyAndFailingCells()
+				summary.FlakyCells += flaky
+				summary.FailingCells += failing
+				summary.RetriedSteps = append(summary.RetriedSteps, []string{
+					fmt.Sprintf("%d: %s", testNumber+1, result.TestCase.Description),
+					fmt.Sprintf("Step %d", stepNumber+1),
+					intToString(len(step.KubeProbes)),
+					intToString(flaky),
+					intToString(failing),
+				})
+			}
+			if step.Convergence != nil {
+				for _, feature := range set.FromSlice(step.Convergence.ActionFeatures).ToSlice() {
+					summary.ActionConvergences[feature] = append(summary.ActionConvergences[feature], step.Convergence)
+				}
+			}
 			for tryNumber := range step.KubeProbes {
 				counts := step.Comparison(tryNumber).ValueCounts(ignoreLoopback)
 				tryProtocolCounts := step.Comparison(tryNumber).ValueCountsByProtocol(ignoreLoopback)
@@ -78,17 +136,25 @@ func NewSummaryTableFromResults(ignoreLoopback bool, results []*Result) *Summary
 					intToString(counts[DifferentComparison]),
 					intToString(counts[SameComparison]),
 					intToString(counts[IgnoredComparison]),
+					intToString(counts[FlakyComparison]),
 					protocolResult(tcp[SameComparison], tcp[DifferentComparison]),
 					protocolResult(sctp[SameComparison], sctp[DifferentComparison]),
 					protocolResult(udp[SameComparison], udp[DifferentComparison]),
 				})
 
-				summary.ProtocolCounts[v1.ProtocolTCP][SameComparison] += tcp[SameComparison]
-				summary.ProtocolCounts[v1.ProtocolTCP][DifferentComparison] += tcp[DifferentComparison]
-				summary.ProtocolCounts[v1.ProtocolSCTP][SameComparison] += sctp[SameComparison]
-				summary.ProtocolCounts[v1.ProtocolSCTP][DifferentComparison] += sctp[DifferentComparison]
-				summary.ProtocolCounts[v1.ProtocolUDP][SameComparison] += udp[SameComparison]
-				summary.ProtocolCounts[v1.ProtocolUDP][DifferentComparison] += udp[DifferentComparison]
+				for _, comparison := range []Comparison{SameComparison, DifferentComparison, FlakyComparison} {
+					summary.ProtocolCounts[v1.ProtocolTCP][comparison] += tcp[comparison]
+					summary.ProtocolCounts[v1.ProtocolSCTP][comparison] += sctp[comparison]
+					summary.ProtocolCounts[v1.ProtocolUDP][comparison] += udp[comparison]
+				}
+
+				for _, jobResult := range step.KubeProbes[tryNumber].JobResults() {
+					if jobResult.Latency > 0 && !countedLatencies[jobResult] {
+						countedLatencies[jobResult] = true
+						protocol := jobResult.Job.Protocol
+						summary.ProtocolLatencies[protocol] = append(summary.ProtocolLatencies[protocol], jobResult.Latency)
+					}
+				}
 			}
 		}
 	}
@@ -99,6 +165,18 @@ func NewSummaryTableFromResults(ignoreLoopback bool, results []*Result) *Summary
 	return summary
 }
 
+// NewFeatureCoverageFromResults measures the feature combinations of the results' test cases
+func NewFeatureCoverageFromResults(strength int, results []*Result) (*generator.FeatureCoverage, error) {
+	coverage, err := generator.NewFeatureCoverage(strength)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		coverage.Add(result.TestCase)
+	}
+	return coverage, nil
+}
+
 func incrementCounts(dict map[string]map[bool]int, keys []string, b bool) {
 	for _, k := range keys {
 		if _, ok := dict[k]; !ok {
@@ -108,6 +186,20 @@ func incrementCounts(dict map[string]map[bool]int, keys []string, b bool) {
 	}
 }
 
+// LatencyPercentile uses the nearest-rank method; p is between 0 and 100
+func LatencyPercentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
 func protocolResult(passed int, failed int) string {
 	total := passed + failed
 	if total == 0 {
@@ -0,0 +1,26 @@
+package connectivity
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func RunSummaryTests() {
+	Describe("Summary", func() {
+		It("Should compute latency percentiles", func() {
+			var latencies []time.Duration
+			for i := 100; i >= 1; i-- {
+				latencies = append(latencies, time.Duration(i)*time.Millisecond)
+			}
+			Expect(LatencyPercentile(latencies, 50)).To(Equal(50 * time.Millisecond))
+			Expect(LatencyPercentile(latencies, 99)).To(Equal(99 * time.Millisecond))
+			Expect(LatencyPercentile(latencies, 100)).To(Equal(100 * time.Millisecond))
+			Expect(LatencyPercentile(latencies[:1], 50)).To(Equal(100 * time.Millisecond))
+			Expect(LatencyPercentile(nil, 50)).To(Equal(time.Duration(0)))
+			// the input isn't modified
+			Expect(latencies[0]).To(Equal(100 * time.Millisecond))
+		})
+	})
+}
@@ -2,6 +2,7 @@ package connectivity
 
 import (
 	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
 	"github.com/mattfenwick/cyclonus/pkg/kube"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -16,6 +17,68 @@ type TestCaseState struct {
 	Policies   []*networkingv1.NetworkPolicy
 }
 
+// ApplyAction performs the action on the cluster, and records its effect on the cluster's expected state
+func (t *TestCaseState) ApplyAction(action *generator.Action) error {
+	if action.CreatePolicy != nil {
+		return t.CreatePolicy(action.CreatePolicy.Policy)
+	} else if action.UpdatePolicy != nil {
+		return t.UpdatePolicy(action.UpdatePolicy.Policy)
+	} else if action.DeletePolicy != nil {
+		return t.DeletePolicy(action.DeletePolicy.Namespace, action.DeletePolicy.Name)
+	} else if action.CreateNamespace != nil {
+		return t.CreateNamespace(action.CreateNamespace.Namespace, action.CreateNamespace.Labels)
+	} else if action.SetNamespaceLabels != nil {
+		return t.SetNamespaceLabels(action.SetNamespaceLabels.Namespace, action.SetNamespaceLabels.Labels)
+	} else if action.DeleteNamespace != nil {
+		return t.DeleteNamespace(action.DeleteNamespace.Namespace)
+	} else if action.ReadNetworkPolicies != nil {
+		return t.ReadPolicies(action.ReadNetworkPolicies.Namespaces)
+	} else if action.CreatePod != nil {
+		return t.CreatePod(action.CreatePod.Namespace, action.CreatePod.Pod, action.CreatePod.Labels)
+	} else if action.SetPodLabels != nil {
+		return t.SetPodLabels(action.SetPodLabels.Namespace, action.SetPodLabels.Pod, action.SetPodLabels.Labels)
+	} else if action.DeletePod != nil {
+		return t.DeletePod(action.DeletePod.Namespace, action.DeletePod.Pod)
+	}
+	return errors.Errorf("invalid Action %+v", action)
+}
+
+// SimulateActions returns the state expected after the actions, without changing the cluster: the actions are
+// applied to a mock cluster holding the state's namespaces, pods and policies instead
+func (t *TestCaseState) SimulateActions(actions []*generator.Action) (*TestCaseState, error) {
+	mock := kube.NewMockKubernetes(1.0)
+	for ns, labels := range t.Resources.Namespaces {
+		if _, err := mock.CreateNamespace(probe.KubeNamespace(ns, labels)); err != nil {
+			return nil, err
+		}
+	}
+	for _, pod := range t.Resources.Pods {
+		if _, err := mock.CreatePod(pod.KubePod()); err != nil {
+			return nil, err
+		}
+		if _, err := mock.CreateService(pod.KubeService()); err != nil {
+			return nil, err
+		}
+	}
+	for _, policy := range t.Policies {
+		if _, err := mock.CreateNetworkPolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+
+	simulated := &TestCaseState{
+		Kubernetes: mock,
+		Resources:  t.Resources,
+		Policies:   append([]*networkingv1.NetworkPolicy{}, t.Policies...),
+	}
+	for i, action := range actions {
+		if err := simulated.ApplyAction(action); err != nil {
+			return nil, errors.WithMessagef(err, "unable to simulate action %d", i+1)
+		}
+	}
+	return simulated, nil
+}
+
 func (t *TestCaseState) CreatePolicy(policy *networkingv1.NetworkPolicy) error {
 	// do we already have this policy?
 	for _, kubePol := range t.Policies {
@@ -92,10 +155,14 @@ func (t *TestCaseState) CreatePod(ns string, pod string, labels map[string]strin
 	if err != nil {
 		return err
 	}
-	_, err = t.Kubernetes.CreateService(newPod.KubeService())
+	kubeService, err := t.Kubernetes.CreateService(newPod.KubeService())
 	if err != nil {
 		return err
 	}
+	// replace the simulated ips with the real ones
+	if kubeService.Spec.ClusterIP != "" {
+		newPod.ServiceIP, newPod.ServiceIPs = kubeService.Spec.ClusterIP, kube.ServiceIPs(kubeService)
+	}
 	// wait for ready, get ip
 	for i := 0; i < 12; i++ {
 		kubePod, err := t.Kubernetes.GetPod(ns, pod)
@@ -103,7 +170,7 @@ func (t *TestCaseState) CreatePod(ns string, pod string, labels map[string]strin
 			return err
 		}
 		if kubePod.Status.Phase == "Running" && kubePod.Status.PodIP != "" {
-			newPod.IP = kubePod.Status.PodIP
+			newPod.IP, newPod.IPs = kubePod.Status.PodIP, kube.PodIPs(kubePod)
 			return nil
 		}
 		time.Sleep(5 * time.Second)
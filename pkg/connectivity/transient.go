@@ -0,0 +1,102 @@
+package connectivity
+
+import (
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+)
+
+const defaultTransientPollInterval = 100 * time.Millisecond
+
+// TimedJobResult is a result observed while monitoring, with the time since monitoring started
+type TimedJobResult struct {
+	Result  *probe.JobResult
+	Elapsed time.Duration
+}
+
+// TransientObservation is a result which is inconsistent with both the before and the after state of a step:
+// for example, a connection allowed while policies were being replaced, although both the old and the new
+// policies block it.
+type TransientObservation struct {
+	*TimedJobResult
+	Before probe.Connectivity
+	After  probe.Connectivity
+}
+
+// TransientReport summarizes the monitoring of a step's policy actions
+type TransientReport struct {
+	MonitoredProbes int
+	Polls           int
+	Observations    []*TransientObservation
+}
+
+// UnchangedJobs returns the jobs whose expected results are the same before and after a step: only these can
+// be observed to be inconsistent with both
+func UnchangedJobs(before *probe.Table, after *probe.Table) []*probe.Job {
+	afterValues := jobResultValues(after)
+	var jobs []*probe.Job
+	for _, result := range before.JobResults() {
+		if value, ok := afterValues[result.Job.Key()]; ok && value == result.Combined {
+			jobs = append(jobs, result.Job)
+		}
+	}
+	return jobs
+}
+
+// MonitorJobs runs the jobs repeatedly in the background, until the returned function is called; that
+// function returns every result observed, including from at least one complete poll if there are any jobs.  The
+// runner may be used by other callers at the same time.
+func MonitorJobs(runner probe.JobRunner, jobs []*probe.Job, pollInterval time.Duration) func() []*TimedJobResult {
+	if len(jobs) == 0 {
+		return func() []*TimedJobResult { return nil }
+	}
+	stop := make(chan struct{})
+	done := make(chan []*TimedJobResult)
+	start := time.Now()
+	go func() {
+		var observed []*TimedJobResult
+		for {
+			elapsed := time.Since(start)
+			for _, result := range runner.RunJobs(jobs) {
+				observed = append(observed, &TimedJobResult{Result: result, Elapsed: elapsed})
+			}
+			select {
+			case <-stop:
+				done <- observed
+				return
+			case <-time.After(pollInterval):
+			}
+		}
+	}()
+	return func() []*TimedJobResult {
+		close(stop)
+		return <-done
+	}
+}
+
+// FindTransientObservations returns the observed results which match neither `before` nor `after`.  Results
+// blocked for reasons other than network policies are skipped, as are results for cells absent from either table.
+func FindTransientObservations(before *probe.Table, after *probe.Table, observed []*TimedJobResult) []*TransientObservation {
+	beforeValues, afterValues := jobResultValues(before), jobResultValues(after)
+	var transients []*TransientObservation
+	for _, o := range observed {
+		if o.Result.IsBlockedByNonPolicyCause() {
+			continue
+		}
+		key := o.Result.Job.Key()
+		beforeValue, beforeOk := beforeValues[key]
+		afterValue, afterOk := afterValues[key]
+		if beforeOk && afterOk && o.Result.Combined != beforeValue && o.Result.Combined != afterValue {
+			transients = append(transients, &TransientObservation{TimedJobResult: o, Before: beforeValue, After: afterValue})
+		}
+	}
+	return transients
+}
+
+func jobResultValues(table *probe.Table) map[string]probe.Connectivity {
+	values := map[string]probe.Connectivity{}
+	for _, result := range table.JobResults() {
+		values[result.Job.Key()] = result.Combined
+	}
+	return values
+}
@@ -0,0 +1,182 @@
+package connectivity
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/connectivity/probe"
+	"github.com/mattfenwick/cyclonus/pkg/generator"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/matcher"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// trackingJobRunner counts the calls to a job runner, and how many of them overlap
+type trackingJobRunner struct {
+	runner    probe.JobRunner
+	delay     time.Duration
+	mutex     sync.Mutex
+	calls     int
+	active    int
+	maxActive int
+}
+
+func (r *trackingJobRunner) RunJobs(jobs []*probe.Job) []*probe.JobResult {
+	r.mutex.Lock()
+	r.calls++
+	r.active++
+	if r.active > r.maxActive {
+		r.maxActive = r.active
+	}
+	r.mutex.Unlock()
+	defer func() {
+		r.mutex.Lock()
+		r.active--
+		r.mutex.Unlock()
+	}()
+	time.Sleep(r.delay)
+	return r.runner.RunJobs(jobs)
+}
+
+func (r *trackingJobRunner) counts() (int, int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.calls, r.maxActive
+}
+
+// rejectingKubernetes fails to create the named policy
+type rejectingKubernetes struct {
+	kube.IKubernetes
+	rejectedPolicy string
+}
+
+func (k *rejectingKubernetes) CreateNetworkPolicy(policy *networkingv1.NetworkPolicy) (*networkingv1.NetworkPolicy, error) {
+	if policy.Name == k.rejectedPolicy {
+		return nil, errors.Errorf("policy %s/%s rejected", policy.Namespace, policy.Name)
+	}
+	return k.IKubernetes.CreateNetworkPolicy(policy)
+}
+
+func RunTransientTests() {
+	Describe("Transients", func() {
+		job := &probe.Job{FromKey: "x/a", ToKey: "x/b", Protocol: v1.ProtocolTCP, ResolvedPort: 80}
+		table := func(combined probe.Connectivity) *probe.Table {
+			t := probe.NewTable([]string{"x/a"}, []string{"x/b"})
+			Expect(t.Get("x/a", "x/b").AddJobResult(&probe.JobResult{Job: job, Combined: combined})).To(Succeed())
+			return t
+		}
+		observe := func(combined probe.Connectivity, probeError probe.ProbeError) *TimedJobResult {
+			return &TimedJobResult{Result: &probe.JobResult{Job: job, Combined: combined, ProbeError: probeError}, Elapsed: time.Second}
+		}
+
+		It("Should find observations inconsistent with both before and after", func() {
+			observed := []*TimedJobResult{
+				observe(probe.ConnectivityBlocked, probe.ProbeErrorTimeout),
+				observe(probe.ConnectivityAllowed, probe.ProbeErrorNone),
+				observe(probe.ConnectivityBlocked, probe.ProbeErrorTimeout),
+			}
+			transients := FindTransientObservations(table(probe.ConnectivityBlocked), table(probe.ConnectivityBlocked), observed)
+			Expect(transients).To(HaveLen(1))
+			Expect(transients[0].Result.Combined).To(Equal(probe.ConnectivityAllowed))
+			Expect(transients[0].Before).To(Equal(probe.ConnectivityBlocked))
+			Expect(transients[0].After).To(Equal(probe.ConnectivityBlocked))
+
+			// consistent with the after state
+			Expect(FindTransientObservations(table(probe.ConnectivityBlocked), table(probe.ConnectivityAllowed), observed)).To(BeEmpty())
+		})
+
+		It("Should ignore observations blocked for non-policy causes", func() {
+			observed := []*TimedJobResult{observe(probe.ConnectivityBlocked, probe.ProbeErrorDNS)}
+			Expect(FindTransientObservations(table(probe.ConnectivityAllowed), table(probe.ConnectivityAllowed), observed)).To(BeEmpty())
+		})
+
+		It("Should monitor jobs until stopped", func() {
+			stop := MonitorJobs(&laggingJobRunner{lag: 1}, []*probe.Job{job}, time.Millisecond)
+			time.Sleep(20 * time.Millisecond)
+			observed := stop()
+			Expect(len(observed)).To(BeNumerically(">", 1))
+			Expect(observed[0].Result.Combined).To(Equal(probe.ConnectivityBlocked))
+			Expect(observed[len(observed)-1].Result.Combined).To(Equal(probe.ConnectivityAllowed))
+
+			Expect(MonitorJobs(&laggingJobRunner{}, nil, time.Millisecond)()).To(BeEmpty())
+		})
+
+		It("Should monitor jobs while awaiting convergence on the same runner", func() {
+			runner := &trackingJobRunner{runner: &probe.SimulatedJobRunner{Policies: matcher.NewPolicy()}, delay: 5 * time.Millisecond}
+			allowed := &probe.JobResult{Job: job, Combined: probe.ConnectivityAllowed}
+			stop := MonitorJobs(runner, []*probe.Job{job}, time.Millisecond)
+			time.Sleep(10 * time.Millisecond)
+			convergence := AwaitConvergence(runner, []*probe.JobResult{allowed}, time.Second, time.Millisecond)
+			observed := stop()
+
+			Expect(convergence.Converged).To(BeTrue())
+			Expect(observed).ToNot(BeEmpty())
+			_, maxActive := runner.counts()
+			Expect(maxActive).To(Equal(2))
+		})
+
+		It("Should monitor the cells which a step doesn't change, whether allowed or blocked", func() {
+			kubernetes := kube.NewMockKubernetes(1.0)
+			resources, err := probe.NewDefaultResources(kubernetes, []string{"x", "y"}, []string{"a", "b"}, []int{80}, []v1.Protocol{v1.ProtocolTCP}, nil, 1, false, false, "registry.k8s.io")
+			Expect(err).To(Succeed())
+			interpreter := NewInterpreter(kubernetes, resources, &InterpreterConfig{ResetClusterBeforeTestCase: true, DetectTransients: true})
+
+			denyAll := func(ns string) *networkingv1.NetworkPolicy {
+				return &networkingv1.NetworkPolicy{
+					ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "deny-all"},
+					Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+				}
+			}
+			// step 1 blocks the 8 cells into x, and leaves the 8 cells into y allowed; step 2 blocks the cells into
+			// y, and leaves the cells into x blocked
+			testCase := generator.NewTestCase("deny x, then y", generator.NewStringSet(),
+				generator.NewTestStep(generator.ProbeAllAvailable, generator.CreatePolicy(denyAll("x"))),
+				generator.NewTestStep(generator.ProbeAllAvailable, generator.CreatePolicy(denyAll("y"))))
+
+			result := interpreter.ExecuteTestCase(testCase)
+			Expect(result.Err).To(Succeed())
+			for _, step := range result.Steps {
+				Expect(step.Transients.MonitoredProbes).To(Equal(8))
+			}
+			// the mock cluster allows everything, so that the cells into x are wrongly allowed throughout step 2
+			Expect(result.Steps[0].Transients.Observations).To(BeEmpty())
+			Expect(result.Steps[1].Transients.Observations).ToNot(BeEmpty())
+		})
+
+		It("Should stop monitoring when a step fails", func() {
+			mock := kube.NewMockKubernetes(1.0)
+			resources, err := probe.NewDefaultResources(mock, []string{"x", "y"}, []string{"a", "b"}, []int{80}, []v1.Protocol{v1.ProtocolTCP}, nil, 1, false, false, "registry.k8s.io")
+			Expect(err).To(Succeed())
+			kubernetes := &rejectingKubernetes{IKubernetes: mock, rejectedPolicy: "rejected"}
+			interpreter := NewInterpreter(kubernetes, resources, &InterpreterConfig{ResetClusterBeforeTestCase: true, DetectTransients: true, ConvergenceTimeoutSeconds: 1})
+			runner := &trackingJobRunner{runner: interpreter.kubeRunner.JobRunner}
+			interpreter.kubeRunner = &probe.Runner{JobRunner: runner, JobBuilder: interpreter.kubeRunner.JobBuilder}
+
+			denyAll := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "deny-all"},
+				Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+			}
+			// the policy can be simulated, so monitoring starts, but the cluster rejects it
+			rejected := &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "y", Name: "rejected"},
+				Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+			}
+			testCase := generator.NewTestCase("fails in step 2", generator.NewStringSet(),
+				generator.NewTestStep(generator.ProbeAllAvailable, generator.CreatePolicy(denyAll)),
+				generator.NewTestStep(generator.ProbeAllAvailable, generator.CreatePolicy(rejected)))
+
+			result := interpreter.ExecuteTestCase(testCase)
+			Expect(result.Err).To(MatchError(ContainSubstring("step 2, action 1")))
+			calls, _ := runner.counts()
+			Expect(calls).To(BeNumerically(">", 0))
+			time.Sleep(3 * defaultTransientPollInterval)
+			callsAfter, _ := runner.counts()
+			Expect(callsAfter).To(Equal(calls))
+		})
+	})
+}
@@ -1,26 +1,55 @@
 package generator
 
-import networkingv1 "k8s.io/api/networking/v1"
+import (
+	"github.com/pkg/errors"
+	networkingv1 "k8s.io/api/networking/v1"
+)
 
 // Action models a sum type (discriminated union): exactly one field must be non-null.
 type Action struct {
-	CreatePolicy *CreatePolicyAction
-	UpdatePolicy *UpdatePolicyAction
-	DeletePolicy *DeletePolicyAction
-
-	CreateNamespace    *CreateNamespaceAction
-	SetNamespaceLabels *SetNamespaceLabelsAction
-	DeleteNamespace    *DeleteNamespaceAction
-
-	ReadNetworkPolicies *ReadNetworkPoliciesAction
-
-	CreatePod    *CreatePodAction
-	SetPodLabels *SetPodLabelsAction
-	DeletePod    *DeletePodAction
+	CreatePolicy *CreatePolicyAction `json:"createPolicy,omitempty"`
+	UpdatePolicy *UpdatePolicyAction `json:"updatePolicy,omitempty"`
+	DeletePolicy *DeletePolicyAction `json:"deletePolicy,omitempty"`
+
+	CreateNamespace    *CreateNamespaceAction    `json:"createNamespace,omitempty"`
+	SetNamespaceLabels *SetNamespaceLabelsAction `json:"setNamespaceLabels,omitempty"`
+	DeleteNamespace    *DeleteNamespaceAction    `json:"deleteNamespace,omitempty"`
+
+	ReadNetworkPolicies *ReadNetworkPoliciesAction `json:"readNetworkPolicies,omitempty"`
+
+	CreatePod    *CreatePodAction    `json:"createPod,omitempty"`
+	SetPodLabels *SetPodLabelsAction `json:"setPodLabels,omitempty"`
+	DeletePod    *DeletePodAction    `json:"deletePod,omitempty"`
+}
+
+// Feature returns the action's type, as one of the ActionFeature* values
+func (a *Action) Feature() string {
+	if a.CreatePolicy != nil {
+		return ActionFeatureCreatePolicy
+	} else if a.UpdatePolicy != nil {
+		return ActionFeatureUpdatePolicy
+	} else if a.DeletePolicy != nil {
+		return ActionFeatureDeletePolicy
+	} else if a.CreateNamespace != nil {
+		return ActionFeatureCreateNamespace
+	} else if a.SetNamespaceLabels != nil {
+		return ActionFeatureSetNamespaceLabels
+	} else if a.DeleteNamespace != nil {
+		return ActionFeatureDeleteNamespace
+	} else if a.ReadNetworkPolicies != nil {
+		return ActionFeatureReadPolicies
+	} else if a.CreatePod != nil {
+		return ActionFeatureCreatePod
+	} else if a.SetPodLabels != nil {
+		return ActionFeatureSetPodLabels
+	} else if a.DeletePod != nil {
+		return ActionFeatureDeletePod
+	}
+	panic(errors.Errorf("invalid Action %+v", a))
 }
 
 type CreatePolicyAction struct {
-	Policy *networkingv1.NetworkPolicy
+	Policy *networkingv1.NetworkPolicy `json:"policy"`
 }
 
 func CreatePolicy(policy *networkingv1.NetworkPolicy) *Action {
@@ -28,7 +57,7 @@ func CreatePolicy(policy *networkingv1.NetworkPolicy) *Action {
 }
 
 type UpdatePolicyAction struct {
-	Policy *networkingv1.NetworkPolicy
+	Policy *networkingv1.NetworkPolicy `json:"policy"`
 }
 
 func UpdatePolicy(policy *networkingv1.NetworkPolicy) *Action {
@@ -36,8 +65,8 @@ func UpdatePolicy(policy *networkingv1.NetworkPolicy) *Action {
 }
 
 type DeletePolicyAction struct {
-	Namespace string
-	Name      string
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
 }
 
 func DeletePolicy(ns string, name string) *Action {
@@ -45,8 +74,8 @@ func DeletePolicy(ns string, name string) *Action {
 }
 
 type CreateNamespaceAction struct {
-	Namespace string
-	Labels    map[string]string
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 func CreateNamespace(ns string, labels map[string]string) *Action {
@@ -54,8 +83,8 @@ func CreateNamespace(ns string, labels map[string]string) *Action {
 }
 
 type SetNamespaceLabelsAction struct {
-	Namespace string
-	Labels    map[string]string
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels"`
 }
 
 func SetNamespaceLabels(ns string, labels map[string]string) *Action {
@@ -63,7 +92,7 @@ func SetNamespaceLabels(ns string, labels map[string]string) *Action {
 }
 
 type DeleteNamespaceAction struct {
-	Namespace string
+	Namespace string `json:"namespace"`
 }
 
 func DeleteNamespace(ns string) *Action {
@@ -71,7 +100,7 @@ func DeleteNamespace(ns string) *Action {
 }
 
 type ReadNetworkPoliciesAction struct {
-	Namespaces []string
+	Namespaces []string `json:"namespaces"`
 }
 
 func ReadNetworkPolicies(namespaces []string) *Action {
@@ -79,9 +108,9 @@ func ReadNetworkPolicies(namespaces []string) *Action {
 }
 
 type CreatePodAction struct {
-	Namespace string
-	Pod       string
-	Labels    map[string]string
+	Namespace string            `json:"namespace"`
+	Pod       string            `json:"pod"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 func CreatePod(namespace string, pod string, labels map[string]string) *Action {
@@ -93,9 +122,9 @@ func CreatePod(namespace string, pod string, labels map[string]string) *Action {
 }
 
 type SetPodLabelsAction struct {
-	Namespace string
-	Pod       string
-	Labels    map[string]string
+	Namespace string            `json:"namespace"`
+	Pod       string            `json:"pod"`
+	Labels    map[string]string `json:"labels"`
 }
 
 func SetPodLabels(namespace string, pod string, labels map[string]string) *Action {
@@ -107,8 +136,8 @@ func SetPodLabels(namespace string, pod string, labels map[string]string) *Actio
 }
 
 type DeletePodAction struct {
-	Namespace string
-	Pod       string
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
 }
 
 func DeletePod(namespace string, pod string) *Action {
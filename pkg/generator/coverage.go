@@ -0,0 +1,193 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/pkg/errors"
+)
+
+const (
+	FeatureCategoryGeneral = "general"
+	FeatureCategoryIngress = "ingress"
+	FeatureCategoryEgress  = "egress"
+	FeatureCategoryAction  = "action"
+)
+
+// FeatureCategories are the primary features of TestCase.GetFeatures, in order
+var FeatureCategories = []string{FeatureCategoryGeneral, FeatureCategoryIngress, FeatureCategoryEgress, FeatureCategoryAction}
+
+var (
+	generalFeatures = []string{
+		PolicyFeatureIngress,
+		PolicyFeatureEgress,
+		PolicyFeatureIngressAndEgress,
+		TargetFeatureSpecificNamespace,
+		TargetFeatureNamespaceEmpty,
+		TargetFeaturePodSelectorEmpty,
+		TargetFeaturePodSelectorMatchLabels,
+		TargetFeaturePodSelectorMatchExpressions,
+	}
+	ingressOrEgressFeatures = []string{
+		RuleFeatureAllPeersAllPortsAllProtocols,
+		RuleFeatureSliceEmpty,
+		RuleFeatureSliceSize1,
+		RuleFeatureSliceSize2Plus,
+		PeerFeaturePortSliceEmpty,
+		PeerFeaturePortSliceSize1,
+		PeerFeaturePortSliceSize2Plus,
+		PeerFeatureNumberedPort,
+		PeerFeatureNamedPort,
+		PeerFeatureNilPort,
+		PeerFeatureNilProtocol,
+		PeerFeatureTCPProtocol,
+		PeerFeatureUDPProtocol,
+		PeerFeatureSCTPProtocol,
+		PeerFeaturePeerSliceEmpty,
+		PeerFeaturePeerSliceSize1,
+		PeerFeaturePeerSliceSize2Plus,
+		PeerFeatureIPBlockEmptyExcept,
+		PeerFeatureIPBlockNonemptyExcept,
+		PeerFeaturePodSelectorNil,
+		PeerFeaturePodSelectorEmpty,
+		PeerFeaturePodSelectorMatchLabels,
+		PeerFeaturePodSelectorMatchExpressions,
+		PeerFeatureNamespaceSelectorNil,
+		PeerFeatureNamespaceSelectorEmpty,
+		PeerFeatureNamespaceSelectorMatchLabels,
+		PeerFeatureNamespaceSelectorMatchExpressions,
+	}
+	actionFeatures = []string{
+		ActionFeatureCreatePolicy,
+		ActionFeatureUpdatePolicy,
+		ActionFeatureDeletePolicy,
+		ActionFeatureCreateNamespace,
+		ActionFeatureSetNamespaceLabels,
+		ActionFeatureDeleteNamespace,
+		ActionFeatureReadPolicies,
+		ActionFeatureCreatePod,
+		ActionFeatureSetPodLabels,
+		ActionFeatureDeletePod,
+	}
+
+	// AllFeatures are the features which NetpolTraverser and Action.Feature find, by category
+	AllFeatures = map[string][]string{
+		FeatureCategoryGeneral: generalFeatures,
+		FeatureCategoryIngress: ingressOrEgressFeatures,
+		FeatureCategoryEgress:  ingressOrEgressFeatures,
+		FeatureCategoryAction:  actionFeatures,
+	}
+)
+
+// FeatureCoverage tracks which feature combinations test cases exercise.  A combination is Strength features,
+// each from a different category -- for example, a general feature with an ingress feature -- which a single
+// test case has.
+type FeatureCoverage struct {
+	Strength int
+	Covered  map[string]bool
+}
+
+func NewFeatureCoverage(strength int) (*FeatureCoverage, error) {
+	if strength < 2 || strength > len(FeatureCategories) {
+		return nil, errors.Errorf("invalid feature combination strength %d: must be between 2 and %d", strength, len(FeatureCategories))
+	}
+	return &FeatureCoverage{Strength: strength, Covered: map[string]bool{}}, nil
+}
+
+// Add records the test case's feature combinations, and returns how many of them weren't covered before
+func (f *FeatureCoverage) Add(testCase *TestCase) int {
+	added := 0
+	for _, combination := range f.NewCombinations(testCase) {
+		f.Covered[combination] = true
+		added++
+	}
+	return added
+}
+
+// NewCombinations returns the test case's feature combinations which aren't covered yet
+func (f *FeatureCoverage) NewCombinations(testCase *TestCase) []string {
+	return slice.Filter(func(combination string) bool { return !f.Covered[combination] }, FeatureCombinations(testCase.GetFeatures(), f.Strength))
+}
+
+// CategoryCoverage is how many of the possible combinations of a set of categories -- such as "general x
+// ingress" -- are covered
+type CategoryCoverage struct {
+	Categories string
+	Covered    int
+	Total      int
+}
+
+// ByCategories breaks coverage down by the categories of the combinations.  Totals count every combination of
+// the categories' features, some of which can't occur together: "0 rules" and "1 peer", for example.
+func (f *FeatureCoverage) ByCategories() []*CategoryCoverage {
+	covered := map[string]int{}
+	for combination := range f.Covered {
+		covered[combinationCategories(combination)]++
+	}
+	var coverages []*CategoryCoverage
+	for _, categories := range choose(FeatureCategories, f.Strength) {
+		total := 1
+		for _, category := range categories {
+			total *= len(AllFeatures[category])
+		}
+		name := strings.Join(categories, " x ")
+		coverages = append(coverages, &CategoryCoverage{Categories: name, Covered: covered[name], Total: total})
+	}
+	return coverages
+}
+
+// Total sums the coverage of all categories
+func (f *FeatureCoverage) Total() *CategoryCoverage {
+	total := &CategoryCoverage{Categories: "Total"}
+	for _, coverage := range f.ByCategories() {
+		total.Covered += coverage.Covered
+		total.Total += coverage.Total
+	}
+	return total
+}
+
+// FeatureCombinations lists the combinations of strength features, from different categories, of a test case's
+// features -- as returned by TestCase.GetFeatures.  A combination is written as its features, in category order,
+// joined by " + ", such as "general: policy with ingress + ingress: 1 peer".
+func FeatureCombinations(features map[string][]string, strength int) []string {
+	var combinations []string
+	for _, categories := range choose(FeatureCategories, strength) {
+		partials := []string{""}
+		for _, category := range categories {
+			var extended []string
+			for _, partial := range partials {
+				for _, feature := range slice.Sort(features[category]) {
+					extended = append(extended, partial+fmt.Sprintf("%s: %s + ", category, feature))
+				}
+			}
+			partials = extended
+		}
+		for _, partial := range partials {
+			combinations = append(combinations, strings.TrimSuffix(partial, " + "))
+		}
+	}
+	return combinations
+}
+
+func combinationCategories(combination string) string {
+	var categories []string
+	for _, feature := range strings.Split(combination, " + ") {
+		categories = append(categories, strings.SplitN(feature, ": ", 2)[0])
+	}
+	return strings.Join(categories, " x ")
+}
+
+// choose lists the subsets of size k of items, keeping their order
+func choose(items []string, k int) [][]string {
+	if k == 0 {
+		return [][]string{{}}
+	}
+	var subsets [][]string
+	for i := 0; i+k <= len(items); i++ {
+		for _, rest := range choose(items[i+1:], k-1) {
+			subsets = append(subsets, append([]string{items[i]}, rest...))
+		}
+	}
+	return subsets
+}
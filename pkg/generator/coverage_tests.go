@@ -0,0 +1,110 @@
+package generator
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func RunCoverageTests() {
+	Describe("FeatureCoverage", func() {
+		It("Should combine features of different categories", func() {
+			features := map[string][]string{
+				FeatureCategoryGeneral: {PolicyFeatureIngress},
+				FeatureCategoryIngress: {RuleFeatureSliceSize1, PeerFeaturePeerSliceSize1},
+				FeatureCategoryAction:  {ActionFeatureCreatePolicy},
+			}
+			Expect(FeatureCombinations(features, 2)).To(Equal([]string{
+				"general: " + PolicyFeatureIngress + " + ingress: " + PeerFeaturePeerSliceSize1,
+				"general: " + PolicyFeatureIngress + " + ingress: " + RuleFeatureSliceSize1,
+				"general: " + PolicyFeatureIngress + " + action: " + ActionFeatureCreatePolicy,
+				"ingress: " + PeerFeaturePeerSliceSize1 + " + action: " + ActionFeatureCreatePolicy,
+				"ingress: " + RuleFeatureSliceSize1 + " + action: " + ActionFeatureCreatePolicy,
+			}))
+			Expect(FeatureCombinations(features, 3)).To(HaveLen(2))
+		})
+
+		It("Should count covered combinations by categories", func() {
+			coverage, err := NewFeatureCoverage(2)
+			Expect(err).To(Succeed())
+			gen := NewTestCaseGenerator(true, "1.2.3.4", "", []string{"x", "y", "z"}, []string{}, []string{})
+			testCase := gen.GenerateTestCases()[0]
+
+			added := coverage.Add(testCase)
+			Expect(added).To(BeNumerically(">", 0))
+			Expect(coverage.Add(testCase)).To(Equal(0))
+
+			byCategories := coverage.ByCategories()
+			Expect(byCategories).To(HaveLen(6))
+			Expect(byCategories[0].Categories).To(Equal("general x ingress"))
+			Expect(byCategories[0].Total).To(Equal(len(generalFeatures) * len(ingressOrEgressFeatures)))
+			Expect(coverage.Total().Covered).To(Equal(added))
+		})
+
+		It("Should reject invalid strengths", func() {
+			_, err := NewFeatureCoverage(1)
+			Expect(err).ToNot(Succeed())
+			_, err = NewFeatureCoverage(5)
+			Expect(err).ToNot(Succeed())
+		})
+	})
+
+	Describe("coveringArray", func() {
+		levelCounts := []int{3, 4, 2, 5, 3}
+		for _, strength := range []int{2, 3} {
+			It(fmt.Sprintf("Should cover every combination of %d levels", strength), func() {
+				rows := coveringArray(levelCounts, strength)
+				covered := map[string]bool{}
+				for _, row := range rows {
+					for _, factors := range chooseIndices(len(levelCounts), strength) {
+						covered[combinationKey(factors, levelsOf(row, factors))] = true
+					}
+				}
+				for _, factors := range chooseIndices(len(levelCounts), strength) {
+					for _, levels := range levelProduct(factors, levelCounts) {
+						Expect(covered[combinationKey(factors, levels)]).To(BeTrue())
+					}
+				}
+				// far fewer rows than every combination of all the factors' levels
+				Expect(len(rows)).To(BeNumerically("<", len(levelProduct([]int{0, 1, 2, 3, 4}, levelCounts))/4))
+			})
+		}
+	})
+
+	Describe("CoverageTestCases", func() {
+		namespaces := []string{"x", "y", "z"}
+
+		It("Should add valid test cases which increase coverage", func() {
+			gen := NewTestCaseGenerator(true, "1.2.3.4", "", namespaces, []string{}, []string{})
+			coverage, err := NewFeatureCoverage(2)
+			Expect(err).To(Succeed())
+			for _, testCase := range gen.GenerateTestCases() {
+				coverage.Add(testCase)
+			}
+			before := coverage.Total().Covered
+
+			cases := gen.CoverageTestCases(coverage, 200)
+			Expect(cases).ToNot(BeEmpty())
+			Expect(coverage.Total().Covered).To(BeNumerically(">", before))
+			for _, testCase := range cases {
+				Expect(testCase.Validate()).To(Succeed())
+				Expect(testCase.Tags[TagCoverage]).To(BeTrue())
+			}
+
+			Expect(gen.CoverageTestCases(coverage, 200)).To(BeEmpty())
+		})
+
+		It("Should respect tags and the maximum", func() {
+			gen := NewTestCaseGenerator(true, "1.2.3.4", "", namespaces, []string{TagEgress}, []string{TagSCTPProtocol})
+			coverage, err := NewFeatureCoverage(2)
+			Expect(err).To(Succeed())
+			cases := gen.CoverageTestCases(coverage, 5)
+			Expect(cases).To(HaveLen(5))
+			for _, testCase := range cases {
+				Expect(testCase.Tags[TagEgress]).To(BeTrue())
+				Expect(testCase.Tags[TagSCTPProtocol]).To(BeFalse())
+			}
+		})
+	})
+}
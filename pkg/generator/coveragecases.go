@@ -0,0 +1,401 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	. "k8s.io/api/networking/v1"
+)
+
+// coverageComposition is a test case under construction: each coverage factor sets part of it
+type coverageComposition struct {
+	target       *NetpolTarget
+	ingress      *NetpolPeers
+	egress       *NetpolPeers
+	ingressPeers []NetworkPolicyPeer
+	ingressPorts []NetworkPolicyPort
+	egressPeers  []NetworkPolicyPeer
+	egressPorts  []NetworkPolicyPort
+	action       *coverageAction
+}
+
+type coverageAction struct {
+	tag   string
+	steps func(policy *NetworkPolicy) []*TestStep
+}
+
+type coverageLevel struct {
+	description string
+	apply       func(c *coverageComposition)
+}
+
+type coverageFactor struct {
+	name string
+	// direction, if set, is the direction whose first rule the factor sets: it's left out of descriptions if
+	// the direction has no rules
+	direction string
+	levels    []*coverageLevel
+}
+
+// coverageFactors are the choices which coverage test cases are composed of.  Each level of a factor brings in
+// different features; a covering array of the factors' levels exercises many feature combinations with
+// relatively few test cases.
+func (t *TestCaseGenerator) coverageFactors() []*coverageFactor {
+	targetLevels := []*coverageLevel{
+		{"target pods by label", func(c *coverageComposition) {
+			c.target = &NetpolTarget{Namespace: "x", PodSelector: *podAMatchLabelsSelector}
+		}},
+		{"target all pods", func(c *coverageComposition) {
+			c.target = &NetpolTarget{Namespace: "x", PodSelector: *emptySelector}
+		}},
+		{"target pods by expression in namespace y", func(c *coverageComposition) {
+			c.target = &NetpolTarget{Namespace: "y", PodSelector: *podABMatchExpressionsSelector}
+		}},
+	}
+
+	rulesLevels := func(isIngress bool) []*coverageLevel {
+		set := func(c *coverageComposition, peers *NetpolPeers) {
+			if isIngress {
+				c.ingress = peers
+			} else {
+				c.egress = peers
+			}
+		}
+		direction := describeDirectionality(isIngress)
+		return []*coverageLevel{
+			{"no " + direction, func(c *coverageComposition) { set(c, nil) }},
+			{direction + " deny all", func(c *coverageComposition) { set(c, &NetpolPeers{Rules: []*Rule{}}) }},
+			{direction + " 1 rule", func(c *coverageComposition) { set(c, &NetpolPeers{Rules: []*Rule{{}}}) }},
+			{direction + " 2 rules", func(c *coverageComposition) {
+				set(c, &NetpolPeers{Rules: []*Rule{{}, {
+					Peers: []NetworkPolicyPeer{{PodSelector: podCMatchLabelsSelector, NamespaceSelector: nsYZMatchExpressionsSelector}},
+					Ports: []NetworkPolicyPort{{Protocol: &tcp, Port: &port81}},
+				}}})
+			}},
+		}
+	}
+
+	peersLevels := func(isIngress bool) []*coverageLevel {
+		set := func(c *coverageComposition, peers []NetworkPolicyPeer) {
+			if isIngress {
+				c.ingressPeers = peers
+			} else {
+				c.egressPeers = peers
+			}
+		}
+		direction := describeDirectionality(isIngress)
+		levels := []*coverageLevel{
+			{direction + " any peer", func(c *coverageComposition) { set(c, nil) }},
+		}
+		peers := makePeers(t.PodIP)
+		for _, p := range peers {
+			peer := p.Peer
+			levels = append(levels, &coverageLevel{direction + " peer " + p.Description, func(c *coverageComposition) {
+				set(c, []NetworkPolicyPeer{peer})
+			}})
+		}
+		levels = append(levels, &coverageLevel{direction + " 2 peers", func(c *coverageComposition) {
+			set(c, []NetworkPolicyPeer{{PodSelector: podAMatchLabelsSelector}, peers[len(peers)-2].Peer})
+		}})
+		return levels
+	}
+
+	portsLevels := func(isIngress bool) []*coverageLevel {
+		set := func(c *coverageComposition, ports []NetworkPolicyPort) {
+			if isIngress {
+				c.ingressPorts = ports
+			} else {
+				c.egressPorts = ports
+			}
+		}
+		direction := describeDirectionality(isIngress)
+		return []*coverageLevel{
+			{direction + " any port", func(c *coverageComposition) { set(c, nil) }},
+			{direction + " numbered port", func(c *coverageComposition) { set(c, []NetworkPolicyPort{{Port: &port80}}) }},
+			{direction + " numbered port on udp", func(c *coverageComposition) { set(c, []NetworkPolicyPort{{Protocol: &udp, Port: &port81}}) }},
+			{direction + " named port", func(c *coverageComposition) { set(c, []NetworkPolicyPort{{Protocol: &tcp, Port: &portServe80TCP}}) }},
+			{direction + " any port on sctp", func(c *coverageComposition) { set(c, []NetworkPolicyPort{{Protocol: &sctp}}) }},
+			{direction + " 2 ports", func(c *coverageComposition) {
+				set(c, []NetworkPolicyPort{{Protocol: &tcp, Port: &port80}, {Protocol: &udp, Port: &portServe81UDP}})
+			}},
+		}
+	}
+
+	actionLevels := []*coverageLevel{
+		{"create policy", func(c *coverageComposition) {
+			c.action = &coverageAction{TagCreatePolicy, func(policy *NetworkPolicy) []*TestStep {
+				return []*TestStep{NewTestStep(ProbeAllAvailable, CreatePolicy(policy))}
+			}}
+		}},
+		{"update policy", func(c *coverageComposition) {
+			c.action = &coverageAction{TagUpdatePolicy, func(policy *NetworkPolicy) []*TestStep {
+				denyAll := policy.DeepCopy()
+				denyAll.Spec.PolicyTypes = []PolicyType{PolicyTypeIngress}
+				denyAll.Spec.Ingress, denyAll.Spec.Egress = nil, nil
+				return []*TestStep{
+					NewTestStep(ProbeAllAvailable, CreatePolicy(denyAll)),
+					NewTestStep(ProbeAllAvailable, UpdatePolicy(policy)),
+				}
+			}}
+		}},
+		{"delete policy", func(c *coverageComposition) {
+			c.action = &coverageAction{TagDeletePolicy, func(policy *NetworkPolicy) []*TestStep {
+				return []*TestStep{
+					NewTestStep(ProbeAllAvailable, CreatePolicy(policy)),
+					NewTestStep(ProbeAllAvailable, DeletePolicy(policy.Namespace, policy.Name)),
+				}
+			}}
+		}},
+		{"set pod labels", func(c *coverageComposition) {
+			c.action = &coverageAction{TagSetPodLabels, func(policy *NetworkPolicy) []*TestStep {
+				return []*TestStep{
+					NewTestStep(ProbeAllAvailable, CreatePolicy(policy)),
+					NewTestStep(ProbeAllAvailable, SetPodLabels("x", "b", map[string]string{"pod": "a"})),
+					NewTestStep(ProbeAllAvailable, SetPodLabels("x", "b", map[string]string{"pod": "b"})),
+				}
+			}}
+		}},
+		{"set namespace labels", func(c *coverageComposition) {
+			c.action = &coverageAction{TagSetNamespaceLabels, func(policy *NetworkPolicy) []*TestStep {
+				return []*TestStep{
+					NewTestStep(ProbeAllAvailable, CreatePolicy(policy)),
+					NewTestStep(ProbeAllAvailable, SetNamespaceLabels("y", map[string]string{"ns": "x"})),
+					NewTestStep(ProbeAllAvailable, SetNamespaceLabels("y", map[string]string{"ns": "y"})),
+				}
+			}}
+		}},
+		{"create/delete pod", func(c *coverageComposition) {
+			c.action = &coverageAction{TagCreatePod, func(policy *NetworkPolicy) []*TestStep {
+				return []*TestStep{
+					NewTestStep(ProbeAllAvailable, CreatePolicy(policy)),
+					NewTestStep(ProbeAllAvailable, CreatePod("x", "d", map[string]string{"pod": "a"})),
+					NewTestStep(ProbeAllAvailable, DeletePod("x", "d")),
+				}
+			}}
+		}},
+		{"create/delete namespace", func(c *coverageComposition) {
+			c.action = &coverageAction{TagCreateNamespace, func(policy *NetworkPolicy) []*TestStep {
+				return []*TestStep{
+					NewTestStep(ProbeAllAvailable, CreatePolicy(policy)),
+					NewTestStep(ProbeAllAvailable,
+						CreateNamespace("y-2", map[string]string{"ns": "y"}),
+						CreatePod("y-2", "a", map[string]string{"pod": "a"})),
+					NewTestStep(ProbeAllAvailable, DeleteNamespace("y-2")),
+				}
+			}}
+		}},
+		{"read policies", func(c *coverageComposition) {
+			c.action = &coverageAction{TagCreatePolicy, func(policy *NetworkPolicy) []*TestStep {
+				return []*TestStep{NewTestStep(ProbeAllAvailable, CreatePolicy(policy), ReadNetworkPolicies([]string{policy.Namespace}))}
+			}}
+		}},
+	}
+
+	return []*coverageFactor{
+		{"target", "", targetLevels},
+		{"ingress rules", "", rulesLevels(true)},
+		{"ingress peers", TagIngress, peersLevels(true)},
+		{"ingress ports", TagIngress, portsLevels(true)},
+		{"egress rules", "", rulesLevels(false)},
+		{"egress peers", TagEgress, peersLevels(false)},
+		{"egress ports", TagEgress, portsLevels(false)},
+		{"action", "", actionLevels},
+	}
+}
+
+// CoverageTestCases adds test cases which exercise the feature combinations that coverage is missing.  The test
+// cases are composed from a covering array of the coverage factors' levels, of coverage's strength: a test case
+// is kept if it matches the generator's tags and covers new feature combinations, until maxCases are kept.
+// coverage is updated with the kept test cases' combinations.
+func (t *TestCaseGenerator) CoverageTestCases(coverage *FeatureCoverage, maxCases int) []*TestCase {
+	factors := t.coverageFactors()
+	levelCounts := slice.Map(func(f *coverageFactor) int { return len(f.levels) }, factors)
+
+	var cases []*TestCase
+	for _, row := range coveringArray(levelCounts, coverage.Strength) {
+		if len(cases) >= maxCases {
+			break
+		}
+		testCase := t.composeCoverageTestCase(fmt.Sprintf("coverage #%d", len(cases)+1), factors, row)
+		if len(FilterTestCases([]*TestCase{testCase}, t.Tags, t.ExcludedTags)) == 0 {
+			continue
+		}
+		if coverage.Add(testCase) > 0 {
+			cases = append(cases, testCase)
+		}
+	}
+	return cases
+}
+
+func (t *TestCaseGenerator) composeCoverageTestCase(name string, factors []*coverageFactor, row []int) *TestCase {
+	composition := &coverageComposition{}
+	for i, factor := range factors {
+		factor.levels[row[i]].apply(composition)
+	}
+	// a policy needs at least one direction
+	if composition.ingress == nil && composition.egress == nil {
+		composition.ingress = &NetpolPeers{Rules: []*Rule{}}
+	}
+	hasRules := map[string]bool{
+		TagIngress: composition.ingress != nil && len(composition.ingress.Rules) > 0,
+		TagEgress:  composition.egress != nil && len(composition.egress.Rules) > 0,
+	}
+	var descriptions []string
+	for i, factor := range factors {
+		if factor.direction == "" || hasRules[factor.direction] {
+			descriptions = append(descriptions, factor.levels[row[i]].description)
+		}
+	}
+
+	policy := &Netpol{Name: "coverage", Target: composition.target}
+	policy.Ingress = composition.ingress.withFirstRule(composition.ingressPeers, composition.ingressPorts)
+	policy.Egress = composition.egress.withFirstRule(composition.egressPeers, composition.egressPorts)
+
+	tags := NewStringSet(TagCoverage, composition.action.tag)
+	tagPolicy(policy, tags)
+	steps := composition.action.steps(policy.NetworkPolicy())
+	if policy.Egress != nil && t.AllowDNS {
+		allowDNS := AllowDNSPolicy(policy.Target)
+		allowDNS.Name = "coverage-allow-dns"
+		steps[0].Actions = append([]*Action{CreatePolicy(allowDNS.NetworkPolicy())}, steps[0].Actions...)
+	}
+	return NewTestCase(fmt.Sprintf("%s: %s", name, strings.Join(descriptions, ", ")), tags, steps...)
+}
+
+// withFirstRule is a copy of the peers, whose first rule -- if any -- has the peers and ports
+func (n *NetpolPeers) withFirstRule(peers []NetworkPolicyPeer, ports []NetworkPolicyPort) *NetpolPeers {
+	if n == nil {
+		return nil
+	}
+	rules := append([]*Rule{}, n.Rules...)
+	if len(rules) > 0 {
+		rules[0] = &Rule{Peers: peers, Ports: ports}
+	}
+	return &NetpolPeers{Rules: rules}
+}
+
+// coveringArray builds rows -- a level for each factor, given the factors' level counts -- which together have
+// every combination of levels of any strength factors.  It's greedy: each row starts from a combination which
+// isn't covered yet, and then picks each other factor's level to cover as many new combinations as possible,
+// preferring lower levels on ties.
+func coveringArray(levelCounts []int, strength int) [][]int {
+	if strength > len(levelCounts) {
+		strength = len(levelCounts)
+	}
+	factorSets := chooseIndices(len(levelCounts), strength)
+
+	type combination struct {
+		factors []int
+		levels  []int
+	}
+	var combinations []*combination
+	uncovered := map[string]bool{}
+	for _, factors := range factorSets {
+		for _, levels := range levelProduct(factors, levelCounts) {
+			combinations = append(combinations, &combination{factors: factors, levels: levels})
+			uncovered[combinationKey(factors, levels)] = true
+		}
+	}
+
+	var rows [][]int
+	next := 0
+	for len(uncovered) > 0 {
+		for !uncovered[combinationKey(combinations[next].factors, combinations[next].levels)] {
+			next++
+		}
+		row := make([]int, len(levelCounts))
+		for i := range row {
+			row[i] = -1
+		}
+		for i, factor := range combinations[next].factors {
+			row[factor] = combinations[next].levels[i]
+		}
+
+		for factor := range row {
+			if row[factor] >= 0 {
+				continue
+			}
+			best, bestCount := 0, -1
+			for level := 0; level < levelCounts[factor]; level++ {
+				row[factor] = level
+				count := 0
+				for _, factors := range factorSets {
+					if containsIndex(factors, factor) && isAssigned(row, factors) && uncovered[combinationKey(factors, levelsOf(row, factors))] {
+						count++
+					}
+				}
+				if count > bestCount {
+					best, bestCount = level, count
+				}
+			}
+			row[factor] = best
+		}
+
+		for _, factors := range factorSets {
+			delete(uncovered, combinationKey(factors, levelsOf(row, factors)))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func combinationKey(factors []int, levels []int) string {
+	var assignments []string
+	for i, factor := range factors {
+		assignments = append(assignments, fmt.Sprintf("%d=%d", factor, levels[i]))
+	}
+	return strings.Join(assignments, ",")
+}
+
+func levelsOf(row []int, factors []int) []int {
+	return slice.Map(func(factor int) int { return row[factor] }, factors)
+}
+
+func isAssigned(row []int, factors []int) bool {
+	for _, factor := range factors {
+		if row[factor] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func containsIndex(indices []int, index int) bool {
+	i := sort.SearchInts(indices, index)
+	return i < len(indices) && indices[i] == index
+}
+
+// levelProduct lists every assignment of levels to the factors
+func levelProduct(factors []int, levelCounts []int) [][]int {
+	products := [][]int{{}}
+	for _, factor := range factors {
+		var extended [][]int
+		for _, product := range products {
+			for level := 0; level < levelCounts[factor]; level++ {
+				extended = append(extended, append(append([]int{}, product...), level))
+			}
+		}
+		products = extended
+	}
+	return products
+}
+
+// chooseIndices lists the sorted subsets of size k of 0, ..., n-1
+func chooseIndices(n int, k int) [][]int {
+	if k == 0 {
+		return [][]int{{}}
+	}
+	var subsets [][]int
+	for i := 0; i+k <= n; i++ {
+		for _, rest := range chooseIndices(n-i-1, k-1) {
+			subset := []int{i}
+			for _, j := range rest {
+				subset = append(subset, i+1+j)
+			}
+			subsets = append(subsets, subset)
+		}
+	}
+	return subsets
+}
@@ -0,0 +1,37 @@
+package generator
+
+func (t *TestCaseGenerator) LongLivedConnectionTestCases() []*TestCase {
+	// base policies target x/a
+	ingressConnections := &LongLivedConnections{
+		From:          []string{"x/b", "y/b"},
+		To:            []string{"x/a"},
+		PortProtocols: longLivedPortProtocols,
+	}
+	egressConnections := &LongLivedConnections{
+		From:          []string{"x/a"},
+		To:            []string{"x/b", "y/b"},
+		PortProtocols: longLivedPortProtocols,
+	}
+	allowAllBoth := BuildPolicy(SetRules(true, AllowAllRules), SetRules(false, AllowAllRules)).NetworkPolicy()
+	return []*TestCase{
+		NewTestCase("Long-lived connections: create ingress deny-all",
+			NewStringSet(TagLongLivedConnection, TagCreatePolicy, TagIngress, TagDenyAll),
+			NewLongLivedTestStep(ingressConnections, ProbeAllAvailable,
+				CreatePolicy(BuildPolicy(SetRules(true, DenyAllRules)).NetworkPolicy()))),
+		NewTestCase("Long-lived connections: create egress deny-all",
+			NewStringSet(TagLongLivedConnection, TagCreatePolicy, TagEgress, TagDenyAll),
+			NewLongLivedTestStep(egressConnections, ProbeAllAvailable,
+				CreatePolicy(BuildPolicy(SetRules(false, DenyAllRules)).NetworkPolicy()))),
+		NewTestCase("Long-lived connections: update allow-all to deny-all",
+			NewStringSet(TagLongLivedConnection, TagCreatePolicy, TagUpdatePolicy, TagIngress, TagEgress, TagDenyAll, TagAllowAll),
+			NewTestStep(ProbeAllAvailable, CreatePolicy(allowAllBoth)),
+			NewLongLivedTestStep(ingressConnections, ProbeAllAvailable,
+				UpdatePolicy(BuildPolicy(SetRules(true, DenyAllRules), SetRules(false, AllowAllRules)).NetworkPolicy()))),
+	}
+}
+
+var longLivedPortProtocols = []*PortProtocol{
+	{Protocol: tcp, Port: port80},
+	{Protocol: udp, Port: port80},
+	{Protocol: sctp, Port: port80},
+}
@@ -2,7 +2,10 @@ package generator
 
 import (
 	"fmt"
+
 	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	. "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -12,13 +15,29 @@ type peer struct {
 	Peer        NetworkPolicyPeer
 }
 
-func ipBlockPeers(podIP string) []*peer {
-	cidrBut8 := kube.MakeCIDRFromZeroes(podIP, 8)
-	cidrBut4 := kube.MakeCIDRFromZeroes(podIP, 4)
+func ipBlockPeers(podIP string) ([]*peer, error) {
+	cidrBut8, err := kube.MakeCIDRFromZeroes(podIP, 8)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to make ipblock cidr for pod ip '%s'", podIP)
+	}
+	cidrBut4, err := kube.MakeCIDRFromZeroes(podIP, 4)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to make ipblock except for pod ip '%s'", podIP)
+	}
 	return []*peer{
 		{Description: "simple ipblock", Peer: NetworkPolicyPeer{IPBlock: &IPBlock{CIDR: cidrBut8}}},
 		{Description: "ipblock with except", Peer: NetworkPolicyPeer{IPBlock: &IPBlock{CIDR: cidrBut8, Except: []string{cidrBut4}}}},
+	}, nil
+}
+
+// usableIPBlockPeers skips ipblock peers, with a warning, if the pod ip can't be made into ipblocks
+func usableIPBlockPeers(podIP string) []*peer {
+	peers, err := ipBlockPeers(podIP)
+	if err != nil {
+		logrus.Warnf("skipping ipblock test cases: %+v", err)
+		return nil
 	}
+	return peers
 }
 
 func podPeers() []*peer {
@@ -39,7 +58,7 @@ func podPeers() []*peer {
 }
 
 func makePeers(podIP string) []*peer {
-	return append(podPeers(), ipBlockPeers(podIP)...)
+	return append(podPeers(), usableIPBlockPeers(podIP)...)
 }
 
 func describePeerPodSelector(selector *metav1.LabelSelector) string {
@@ -117,9 +136,41 @@ func (t *TestCaseGenerator) TwoPeersTestCases() []*TestCase {
 	return cases
 }
 
+// IPv6PeersTestCases checks that ipblocks are evaluated per ip family: ipv6 ipblocks are probed over both
+// ipv6 and ipv4, and ipv4 ipblocks over ipv6.  These cases are only generated for dual-stack clusters.
+func (t *TestCaseGenerator) IPv6PeersTestCases() []*TestCase {
+	if t.PodIPv6 == "" {
+		return nil
+	}
+	probeIPv6 := NewAllAvailable(ProbeModePodIPv6)
+	v6Peers := usableIPBlockPeers(t.PodIPv6)
+	v4Peers := usableIPBlockPeers(t.PodIP)
+	var cases []*TestCase
+	for _, isIngress := range []bool{true, false} {
+		dir := describeDirectionality(isIngress)
+		for _, p := range v6Peers {
+			tags := append(describePeer(p.Peer), dir, TagIPBlockIPv6)
+			policy := BuildPolicy(SetPeers(isIngress, []NetworkPolicyPeer{p.Peer})).NetworkPolicy()
+			cases = append(cases,
+				NewSingleStepTestCase(fmt.Sprintf("%s: ipv6 %s", dir, p.Description), NewStringSet(tags...), probeIPv6,
+					CreatePolicy(policy)),
+				NewSingleStepTestCase(fmt.Sprintf("%s: ipv6 %s, probed over ipv4", dir, p.Description), NewStringSet(tags...), ProbeAllAvailable,
+					CreatePolicy(policy)))
+		}
+		for _, p := range v4Peers {
+			tags := append(describePeer(p.Peer), dir, TagIPBlockIPv6)
+			cases = append(cases,
+				NewSingleStepTestCase(fmt.Sprintf("%s: ipv4 %s, probed over ipv6", dir, p.Description), NewStringSet(tags...), probeIPv6,
+					CreatePolicy(BuildPolicy(SetPeers(isIngress, []NetworkPolicyPeer{p.Peer})).NetworkPolicy())))
+		}
+	}
+	return cases
+}
+
 func (t *TestCaseGenerator) PeersTestCases() []*TestCase {
 	return flatten(
 		t.ZeroPeersTestCases(),
 		t.SinglePeersTestCases(),
-		t.TwoPeersTestCases())
+		t.TwoPeersTestCases(),
+		t.IPv6PeersTestCases())
 }
@@ -0,0 +1,323 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	. "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// randomCandidatesPerTestCase is how many candidates are composed for each random test case; the one
+	// exercising the least-seen features is kept
+	randomCandidatesPerTestCase = 8
+	// randomMaxAttemptsPerTestCase bounds the search for candidates which match the tags
+	randomMaxAttemptsPerTestCase = 200
+)
+
+var (
+	randomPodLabels       = []string{"a", "b", "c"}
+	randomNumberedPorts   = []int{79, 80, 81}
+	randomNamedPorts      = []intstr.IntOrString{portServe80TCP, portServe81TCP, portServe80UDP, portServe81UDP, portServe80SCTP, portServe81SCTP}
+	randomNamedPortProtos = []v1.Protocol{tcp, tcp, udp, udp, sctp, sctp}
+	randomProtocols       = []v1.Protocol{tcp, udp, sctp}
+	randomSelectorOps     = []metav1.LabelSelectorOperator{metav1.LabelSelectorOpIn, metav1.LabelSelectorOpNotIn, metav1.LabelSelectorOpExists, metav1.LabelSelectorOpDoesNotExist}
+)
+
+// RandomTestCases composes count random test cases -- targets, rules, peers and ports -- which match the
+// generator's tags.  The same seed always produces the same test cases.  Candidates are weighted towards the
+// policy features which appear least in existing and in the random test cases chosen so far.  Fewer than
+// count test cases are returned if not enough candidates match the tags.
+func (t *TestCaseGenerator) RandomTestCases(count int, seed int64, existing []*TestCase) []*TestCase {
+	r := newRandomComposer(seed, t.PodIP, t.Namespaces, t.AllowDNS)
+	featureCounts := map[string]int{}
+	for _, testCase := range existing {
+		countFeatures(testCase, featureCounts)
+	}
+
+	var cases []*TestCase
+	for attempts := 0; len(cases) < count && attempts < count*randomMaxAttemptsPerTestCase; {
+		var best *TestCase
+		bestScore := -1.0
+		for candidates := 0; candidates < randomCandidatesPerTestCase && attempts < count*randomMaxAttemptsPerTestCase; attempts++ {
+			candidate := r.testCase(fmt.Sprintf("random #%d (seed %d)", len(cases)+1, seed))
+			if len(FilterTestCases([]*TestCase{candidate}, t.Tags, t.ExcludedTags)) == 0 {
+				continue
+			}
+			candidates++
+			if score := featureRarityScore(candidate, featureCounts); score > bestScore {
+				best, bestScore = candidate, score
+			}
+		}
+		if best == nil {
+			break
+		}
+		countFeatures(best, featureCounts)
+		cases = append(cases, best)
+	}
+	return cases
+}
+
+func countFeatures(testCase *TestCase, counts map[string]int) {
+	for primary, features := range testCase.GetFeatures() {
+		for _, feature := range features {
+			counts[primary+": "+feature]++
+		}
+	}
+}
+
+// featureRarityScore is higher for test cases whose features have been seen less.  Features are summed in
+// order, so that scores -- and so the chosen test cases -- don't depend on map iteration order.
+func featureRarityScore(testCase *TestCase, counts map[string]int) float64 {
+	var keys []string
+	for primary, features := range testCase.GetFeatures() {
+		for _, feature := range features {
+			keys = append(keys, primary+": "+feature)
+		}
+	}
+	score := 0.0
+	for _, key := range slice.Sort(keys) {
+		score += 1 / float64(1+counts[key])
+	}
+	return score
+}
+
+type randomComposer struct {
+	rand *rand.Rand
+	// ipBlockCIDRs are the CIDRs around the pod ip, indexed by their number of zeroes; it's empty if the pod ip
+	// can't be made into ipblocks, in which case no ipblock peers are composed
+	ipBlockCIDRs []string
+	namespaces   []string
+	allowDNS     bool
+}
+
+func newRandomComposer(seed int64, podIP string, namespaces []string, allowDNS bool) *randomComposer {
+	r := &randomComposer{
+		rand:       rand.New(rand.NewSource(seed)),
+		namespaces: namespaces,
+		allowDNS:   allowDNS,
+	}
+	for zeroes := 0; zeroes <= kube.MaxGeneratedCIDRZeroes; zeroes++ {
+		cidr, err := kube.MakeCIDRFromZeroes(podIP, zeroes)
+		if err != nil {
+			logrus.Warnf("skipping random ipblock peers: %+v", errors.WithMessagef(err, "unable to make ipblock cidr for pod ip '%s'", podIP))
+			r.ipBlockCIDRs = nil
+			break
+		}
+		r.ipBlockCIDRs = append(r.ipBlockCIDRs, cidr)
+	}
+	return r
+}
+
+func (r *randomComposer) chance(percent int) bool {
+	return r.rand.Intn(100) < percent
+}
+
+func (r *randomComposer) testCase(description string) *TestCase {
+	tags := NewStringSet(TagRandom)
+	var actions []*Action
+	policyCount := 1 + r.rand.Intn(2)
+	if policyCount > 1 {
+		tags[TagPolicyStack] = true
+	}
+	for i := 0; i < policyCount; i++ {
+		policy := r.policy(fmt.Sprintf("random-%d", i+1), tags)
+		actions = append(actions, CreatePolicy(policy.NetworkPolicy()))
+		if policy.Egress != nil && r.allowDNS {
+			allowDNS := AllowDNSPolicy(policy.Target)
+			allowDNS.Name = fmt.Sprintf("%s-allow-dns", policy.Name)
+			actions = append(actions, CreatePolicy(allowDNS.NetworkPolicy()))
+		}
+	}
+	return NewSingleStepTestCase(description, tags, ProbeAllAvailable, actions...)
+}
+
+func (r *randomComposer) policy(name string, tags StringSet) *Netpol {
+	policy := &Netpol{Name: name, Target: r.target()}
+	switch r.rand.Intn(3) {
+	case 0:
+		policy.Ingress = r.peers()
+	case 1:
+		policy.Egress = r.peers()
+	default:
+		policy.Ingress = r.peers()
+		policy.Egress = r.peers()
+	}
+	tagPolicy(policy, tags)
+	return policy
+}
+
+func (r *randomComposer) target() *NetpolTarget {
+	target := &NetpolTarget{Namespace: r.namespaces[r.rand.Intn(len(r.namespaces))]}
+	if selector := r.selector("pod", randomPodLabels, false); selector != nil {
+		target.PodSelector = *selector
+	}
+	return target
+}
+
+// peers has 0 to 3 rules; 0 rules denies all traffic
+func (r *randomComposer) peers() *NetpolPeers {
+	peers := &NetpolPeers{Rules: []*Rule{}}
+	for i := r.rand.Intn(4); i > 0; i-- {
+		peers.Rules = append(peers.Rules, r.rule())
+	}
+	return peers
+}
+
+func (r *randomComposer) rule() *Rule {
+	rule := &Rule{}
+	for i := r.rand.Intn(3); i > 0; i-- {
+		rule.Peers = append(rule.Peers, r.peer())
+	}
+	for i := r.rand.Intn(3); i > 0; i-- {
+		rule.Ports = append(rule.Ports, r.port())
+	}
+	return rule
+}
+
+func (r *randomComposer) peer() NetworkPolicyPeer {
+	if len(r.ipBlockCIDRs) > 0 && r.chance(25) {
+		return NetworkPolicyPeer{IPBlock: r.ipBlock()}
+	}
+	// at least one of the selectors must be non-nil
+	var peer NetworkPolicyPeer
+	for peer.PodSelector == nil && peer.NamespaceSelector == nil {
+		peer.PodSelector = r.selector("pod", randomPodLabels, true)
+		peer.NamespaceSelector = r.selector("ns", r.namespaces, true)
+	}
+	return peer
+}
+
+// ipBlock is around the pod ip, with a random prefix; its except, if any, is a narrower block around the pod ip
+func (r *randomComposer) ipBlock() *IPBlock {
+	zeroes := 4 + r.rand.Intn(kube.MaxGeneratedCIDRZeroes-3)
+	block := &IPBlock{CIDR: r.ipBlockCIDRs[zeroes]}
+	if r.chance(50) {
+		block.Except = []string{r.ipBlockCIDRs[r.rand.Intn(zeroes)]}
+	}
+	return block
+}
+
+// selector is one of: nil (if allowNil), empty, match labels, or match expressions; its labels are drawn from
+// key=values
+func (r *randomComposer) selector(key string, values []string, allowNil bool) *metav1.LabelSelector {
+	choices := 3
+	if allowNil {
+		choices = 4
+	}
+	switch r.rand.Intn(choices) {
+	case 0:
+		return &metav1.LabelSelector{}
+	case 1:
+		return &metav1.LabelSelector{MatchLabels: map[string]string{key: values[r.rand.Intn(len(values))]}}
+	case 2:
+		op := randomSelectorOps[r.rand.Intn(len(randomSelectorOps))]
+		requirement := metav1.LabelSelectorRequirement{Key: key, Operator: op}
+		if op == metav1.LabelSelectorOpIn || op == metav1.LabelSelectorOpNotIn {
+			for _, value := range values {
+				if r.chance(50) {
+					requirement.Values = append(requirement.Values, value)
+				}
+			}
+			if len(requirement.Values) == 0 {
+				requirement.Values = []string{values[r.rand.Intn(len(values))]}
+			}
+		}
+		return &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{requirement}}
+	default:
+		return nil
+	}
+}
+
+// port is one of: any port, a numbered port, a named port, or a numbered port range; its protocol is nil or
+// random, except for named ports, whose protocol usually matches the port
+func (r *randomComposer) port() NetworkPolicyPort {
+	var port NetworkPolicyPort
+	if r.chance(25) {
+		protocol := randomProtocols[r.rand.Intn(len(randomProtocols))]
+		port.Protocol = &protocol
+	}
+	switch r.rand.Intn(4) {
+	case 0:
+	case 1:
+		numbered := intstr.FromInt(randomNumberedPorts[r.rand.Intn(len(randomNumberedPorts))])
+		port.Port = &numbered
+	case 2:
+		i := r.rand.Intn(len(randomNamedPorts))
+		named := randomNamedPorts[i]
+		port.Port = &named
+		if r.chance(75) {
+			protocol := randomNamedPortProtos[i]
+			port.Protocol = &protocol
+		}
+	default:
+		start := randomNumberedPorts[r.rand.Intn(len(randomNumberedPorts))] - r.rand.Intn(3)
+		numbered := intstr.FromInt(start)
+		end := int32(start + 1 + r.rand.Intn(4))
+		port.Port, port.EndPort = &numbered, &end
+	}
+	return port
+}
+
+// tagPolicy adds the tags describing a composed policy: its target, its directions, and its rules' peers and ports
+func tagPolicy(policy *Netpol, tags StringSet) {
+	if policy.Target.Namespace != baseTestPolicy().Target.Namespace {
+		tags.Add(TagTargetNamespace)
+	}
+	if !kube.IsLabelSelectorEmpty(policy.Target.PodSelector) {
+		tags.Add(TagTargetPodSelector)
+	}
+	for _, direction := range []struct {
+		isIngress bool
+		peers     *NetpolPeers
+	}{{true, policy.Ingress}, {false, policy.Egress}} {
+		if direction.peers == nil {
+			continue
+		}
+		tags.Add(describeDirectionality(direction.isIngress))
+		if len(direction.peers.Rules) == 0 {
+			tags.Add(TagDenyAll)
+		}
+		for _, rule := range direction.peers.Rules {
+			tagRule(rule, tags)
+		}
+	}
+}
+
+func tagRule(rule *Rule, tags StringSet) {
+	switch {
+	case len(rule.Peers) == 0 && len(rule.Ports) == 0:
+		tags.Add(TagAllowAll)
+	case len(rule.Peers) == 0:
+		tags.Add(TagAnyPeer)
+	case len(rule.Ports) == 0:
+		tags.Add(TagAnyPortProtocol)
+	}
+	if len(rule.Peers) > 1 {
+		tags.Add(TagMultiPeer)
+	}
+	if len(rule.Ports) > 1 {
+		tags.Add(TagMultiPortProtocol)
+	}
+	for _, peer := range rule.Peers {
+		for _, tag := range describePeer(peer) {
+			tags.Add(tag)
+		}
+	}
+	for _, port := range rule.Ports {
+		tags.Add(describePort(port.Port))
+		if tag := describeProtocol(port.Protocol); tag != nil {
+			tags.Add(*tag)
+		}
+		if tag := describeEndPort(port.EndPort); tag != nil {
+			tags.Add(*tag)
+		}
+	}
+}
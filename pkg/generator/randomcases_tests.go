@@ -0,0 +1,75 @@
+package generator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+)
+
+func RunRandomTestCaseTests() {
+	Describe("RandomTestCases", func() {
+		namespaces := []string{"x", "y", "z"}
+
+		It("Should produce the same test cases from the same seed", func() {
+			gen := NewTestCaseGenerator(true, "1.2.3.4", "", namespaces, []string{}, []string{})
+			first, err := yaml.Marshal(gen.RandomTestCases(20, 7, nil))
+			Expect(err).To(Succeed())
+			second, err := yaml.Marshal(gen.RandomTestCases(20, 7, nil))
+			Expect(err).To(Succeed())
+			other, err := yaml.Marshal(gen.RandomTestCases(20, 8, nil))
+			Expect(err).To(Succeed())
+
+			Expect(string(first)).To(Equal(string(second)))
+			Expect(string(first)).ToNot(Equal(string(other)))
+		})
+
+		It("Should respect tags", func() {
+			gen := NewTestCaseGenerator(true, "1.2.3.4", "", namespaces, []string{TagIPBlockWithExcept, TagNamedPort}, []string{TagMultiPeer, TagEndPort})
+			cases := gen.RandomTestCases(25, 1, nil)
+			Expect(cases).To(HaveLen(25))
+			for _, testCase := range cases {
+				Expect(testCase.Validate()).To(Succeed())
+				Expect(testCase.Tags[TagRandom]).To(BeTrue())
+				Expect(testCase.Tags.ContainsAny([]string{TagIPBlockWithExcept, TagNamedPort})).To(BeTrue())
+				Expect(testCase.Tags.ContainsAny([]string{TagMultiPeer, TagEndPort})).To(BeFalse())
+			}
+		})
+
+		It("Should favor the least-seen features", func() {
+			gen := NewTestCaseGenerator(true, "1.2.3.4", "", namespaces, []string{}, []string{})
+			seen := gen.RandomTestCases(1, 3, nil)[0]
+			counts := map[string]int{}
+			countFeatures(seen, counts)
+			Expect(featureRarityScore(seen, map[string]int{})).To(BeNumerically(">", featureRarityScore(seen, counts)))
+		})
+
+		It("Should favor features missing from the existing test cases", func() {
+			// without a pod ip, there are no ipblock peers -- so ipblock features are missing from these test cases
+			existing := NewTestCaseGenerator(true, "", "", namespaces, []string{}, []string{}).RandomTestCases(200, 1, nil)
+			gen := NewTestCaseGenerator(true, "1.2.3.4", "", namespaces, []string{}, []string{})
+			countIPBlocks := func(cases []*TestCase) int {
+				count := 0
+				for _, testCase := range cases {
+					if testCase.Tags.ContainsAny([]string{TagIPBlockNoExcept, TagIPBlockWithExcept}) {
+						count++
+					}
+				}
+				return count
+			}
+			favored := countIPBlocks(gen.RandomTestCases(20, 2, existing))
+			Expect(favored).To(BeNumerically(">=", 18))
+			Expect(favored).To(BeNumerically(">", countIPBlocks(gen.RandomTestCases(20, 2, nil))))
+		})
+
+		It("Should skip ipblock peers if the pod ip is unusable", func() {
+			for _, podIP := range []string{"", "not-an-ip"} {
+				gen := NewTestCaseGenerator(true, podIP, "", namespaces, []string{}, []string{})
+				cases := gen.RandomTestCases(50, 1, nil)
+				Expect(cases).To(HaveLen(50))
+				for _, testCase := range cases {
+					Expect(testCase.Tags.ContainsAny([]string{TagIPBlockNoExcept, TagIPBlockWithExcept})).To(BeFalse())
+				}
+			}
+		})
+	})
+}
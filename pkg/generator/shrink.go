@@ -0,0 +1,160 @@
+package generator
+
+import (
+	"fmt"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// ShrinkCandidate is a test case with one simplification applied
+type ShrinkCandidate struct {
+	Description string
+	TestCase    *TestCase
+}
+
+// ShrinkCandidates lists the test case's one-step simplifications, coarsest first: dropping or merging steps,
+// dropping long-lived connections and actions, and then dropping policy types, rules, peers and ports from
+// each policy.  Candidates share unchanged steps and actions with the test case, which isn't modified.
+func (t *TestCase) ShrinkCandidates() []*ShrinkCandidate {
+	var candidates []*ShrinkCandidate
+	add := func(description string, steps []*TestStep) {
+		candidates = append(candidates, &ShrinkCandidate{
+			Description: description,
+			TestCase:    &TestCase{Description: t.Description, Tags: t.Tags, Steps: steps},
+		})
+	}
+
+	if len(t.Steps) > 1 {
+		for i := range t.Steps {
+			add(fmt.Sprintf("drop step %d", i+1), t.withoutStep(i))
+		}
+		for i := 0; i < len(t.Steps)-1; i++ {
+			next := &TestStep{
+				Probe:     t.Steps[i+1].Probe,
+				LongLived: t.Steps[i+1].LongLived,
+				Actions:   append(append([]*Action{}, t.Steps[i].Actions...), t.Steps[i+1].Actions...),
+			}
+			steps := t.withStep(i+1, next)
+			add(fmt.Sprintf("merge step %d into step %d", i+1, i+2), append(steps[:i], steps[i+1:]...))
+		}
+	}
+
+	for i, step := range t.Steps {
+		if step.LongLived != nil {
+			add(fmt.Sprintf("step %d: drop long-lived connections", i+1), t.withStep(i, &TestStep{Probe: step.Probe, Actions: step.Actions}))
+		}
+	}
+
+	for i, step := range t.Steps {
+		for j := range step.Actions {
+			actions := append(append([]*Action{}, step.Actions[:j]...), step.Actions[j+1:]...)
+			add(fmt.Sprintf("step %d: drop action %d", i+1, j+1), t.withStep(i, &TestStep{Probe: step.Probe, LongLived: step.LongLived, Actions: actions}))
+		}
+	}
+
+	for i, step := range t.Steps {
+		for j, action := range step.Actions {
+			var policy *networkingv1.NetworkPolicy
+			if action.CreatePolicy != nil {
+				policy = action.CreatePolicy.Policy
+			} else if action.UpdatePolicy != nil {
+				policy = action.UpdatePolicy.Policy
+			} else {
+				continue
+			}
+			for _, simplified := range shrinkPolicy(policy) {
+				simplifiedAction := CreatePolicy(simplified.policy)
+				if action.UpdatePolicy != nil {
+					simplifiedAction = UpdatePolicy(simplified.policy)
+				}
+				actions := append([]*Action{}, step.Actions...)
+				actions[j] = simplifiedAction
+				add(fmt.Sprintf("step %d, action %d: %s", i+1, j+1, simplified.description), t.withStep(i, &TestStep{Probe: step.Probe, LongLived: step.LongLived, Actions: actions}))
+			}
+		}
+	}
+
+	return candidates
+}
+
+func (t *TestCase) withoutStep(i int) []*TestStep {
+	return append(append([]*TestStep{}, t.Steps[:i]...), t.Steps[i+1:]...)
+}
+
+func (t *TestCase) withStep(i int, step *TestStep) []*TestStep {
+	steps := append([]*TestStep{}, t.Steps...)
+	steps[i] = step
+	return steps
+}
+
+type shrunkPolicy struct {
+	description string
+	policy      *networkingv1.NetworkPolicy
+}
+
+// shrinkPolicy lists the policy's one-step simplifications: dropping a policy type, if it has both, a rule,
+// or one of a rule's peers or ports, if it has several.  Dropping a rule's only peer or port would widen the
+// rule to all peers or ports, rather than simplify it.
+func shrinkPolicy(policy *networkingv1.NetworkPolicy) []*shrunkPolicy {
+	var shrunk []*shrunkPolicy
+	add := func(description string, modify func(*networkingv1.NetworkPolicy)) {
+		simplified := policy.DeepCopy()
+		modify(simplified)
+		shrunk = append(shrunk, &shrunkPolicy{description: description, policy: simplified})
+	}
+
+	if len(policy.Spec.PolicyTypes) > 1 {
+		for k, policyType := range policy.Spec.PolicyTypes {
+			add(fmt.Sprintf("drop %s from policy %s", policyType, policy.Name), func(p *networkingv1.NetworkPolicy) {
+				p.Spec.PolicyTypes = append(p.Spec.PolicyTypes[:k], p.Spec.PolicyTypes[k+1:]...)
+				if policyType == networkingv1.PolicyTypeIngress {
+					p.Spec.Ingress = nil
+				} else {
+					p.Spec.Egress = nil
+				}
+			})
+		}
+	}
+
+	for k, rule := range policy.Spec.Ingress {
+		add(fmt.Sprintf("drop ingress rule %d from policy %s", k+1, policy.Name), func(p *networkingv1.NetworkPolicy) {
+			p.Spec.Ingress = append(p.Spec.Ingress[:k], p.Spec.Ingress[k+1:]...)
+		})
+		if len(rule.From) > 1 {
+			for m := range rule.From {
+				add(fmt.Sprintf("drop peer %d from ingress rule %d of policy %s", m+1, k+1, policy.Name), func(p *networkingv1.NetworkPolicy) {
+					p.Spec.Ingress[k].From = append(p.Spec.Ingress[k].From[:m], p.Spec.Ingress[k].From[m+1:]...)
+				})
+			}
+		}
+		if len(rule.Ports) > 1 {
+			for m := range rule.Ports {
+				add(fmt.Sprintf("drop port %d from ingress rule %d of policy %s", m+1, k+1, policy.Name), func(p *networkingv1.NetworkPolicy) {
+					p.Spec.Ingress[k].Ports = append(p.Spec.Ingress[k].Ports[:m], p.Spec.Ingress[k].Ports[m+1:]...)
+				})
+			}
+		}
+	}
+
+	for k, rule := range policy.Spec.Egress {
+		add(fmt.Sprintf("drop egress rule %d from policy %s", k+1, policy.Name), func(p *networkingv1.NetworkPolicy) {
+			p.Spec.Egress = append(p.Spec.Egress[:k], p.Spec.Egress[k+1:]...)
+		})
+		if len(rule.To) > 1 {
+			for m := range rule.To {
+				add(fmt.Sprintf("drop peer %d from egress rule %d of policy %s", m+1, k+1, policy.Name), func(p *networkingv1.NetworkPolicy) {
+					p.Spec.Egress[k].To = append(p.Spec.Egress[k].To[:m], p.Spec.Egress[k].To[m+1:]...)
+				})
+			}
+		}
+		if len(rule.Ports) > 1 {
+			for m := range rule.Ports {
+				add(fmt.Sprintf("drop port %d from egress rule %d of policy %s", m+1, k+1, policy.Name), func(p *networkingv1.NetworkPolicy) {
+					p.Spec.Egress[k].Ports = append(p.Spec.Egress[k].Ports[:m], p.Spec.Egress[k].Ports[m+1:]...)
+				})
+			}
+		}
+	}
+
+	return shrunk
+}
@@ -0,0 +1,45 @@
+package generator
+
+import (
+	"github.com/mattfenwick/collections/pkg/slice"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "k8s.io/api/networking/v1"
+)
+
+func RunShrinkTests() {
+	Describe("ShrinkCandidates", func() {
+		It("Should list simplifications, coarsest first, without modifying the test case", func() {
+			policy := (&Netpol{
+				Name:   "shrink",
+				Target: &NetpolTarget{Namespace: "x"},
+				Ingress: &NetpolPeers{Rules: []*Rule{
+					{Peers: []NetworkPolicyPeer{{PodSelector: podAMatchLabelsSelector}}, Ports: []NetworkPolicyPort{{Port: &port80}, {Port: &port81}}},
+				}},
+			}).NetworkPolicy()
+			testCase := NewTestCase("shrink", NewStringSet(TagIngress),
+				NewTestStep(ProbeAllAvailable, CreatePolicy(policy)),
+				NewTestStep(ProbeAllAvailable, DeletePolicy(policy.Namespace, policy.Name)))
+
+			candidates := testCase.ShrinkCandidates()
+			Expect(slice.Map(func(c *ShrinkCandidate) string { return c.Description }, candidates)).To(Equal([]string{
+				"drop step 1",
+				"drop step 2",
+				"merge step 1 into step 2",
+				"step 1: drop action 1",
+				"step 2: drop action 1",
+				"step 1, action 1: drop ingress rule 1 from policy shrink",
+				"step 1, action 1: drop port 1 from ingress rule 1 of policy shrink",
+				"step 1, action 1: drop port 2 from ingress rule 1 of policy shrink",
+			}))
+
+			merged := candidates[2].TestCase
+			Expect(merged.Steps).To(HaveLen(1))
+			Expect(merged.Steps[0].Actions).To(HaveLen(2))
+
+			Expect(candidates[6].TestCase.Steps[0].Actions[0].CreatePolicy.Policy.Spec.Ingress[0].Ports).To(Equal([]NetworkPolicyPort{{Port: &port81}}))
+			Expect(testCase.Steps).To(HaveLen(2))
+			Expect(testCase.Steps[0].Actions[0].CreatePolicy.Policy.Spec.Ingress[0].Ports).To(HaveLen(2))
+		})
+	})
+}
@@ -9,6 +9,11 @@ import (
 
 func TestGenerator(t *testing.T) {
 	RegisterFailHandler(Fail)
+	RunTestCaseTests()
 	RunTestCaseGeneratorTests()
+	RunTestCaseLoaderTests()
+	RunRandomTestCaseTests()
+	RunShrinkTests()
+	RunCoverageTests()
 	RunSpecs(t, "generator suite")
 }
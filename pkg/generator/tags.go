@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"encoding/json"
 	"github.com/mattfenwick/collections/pkg/slice"
 	"github.com/pkg/errors"
 	"golang.org/x/exp/maps"
@@ -64,6 +65,7 @@ const (
 const (
 	TagIPBlockNoExcept   = "ip-block-no-except"
 	TagIPBlockWithExcept = "ip-block-with-except"
+	TagIPBlockIPv6       = "ip-block-ipv6"
 )
 
 const (
@@ -84,6 +86,14 @@ const (
 	TagConflict     = "conflict"
 	TagExample      = "example"
 	TagUpstreamE2E  = "upstream-e2e"
+	// TagLongLivedConnection cases need servers which hold connections open
+	TagLongLivedConnection = "long-lived-connection"
+	// TagUserDefined cases are loaded from files, rather than generated
+	TagUserDefined = "user-defined"
+	// TagRandom cases are composed randomly, from a seed
+	TagRandom = "random"
+	// TagCoverage cases are composed to cover feature combinations which the other cases miss
+	TagCoverage = "coverage"
 )
 
 var AllTags = map[string][]string{
@@ -126,6 +136,7 @@ var AllTags = map[string][]string{
 	TagPeerIPBlock: {
 		TagIPBlockNoExcept,
 		TagIPBlockWithExcept,
+		TagIPBlockIPv6,
 	},
 	TagPort: {
 		TagAnyPort,
@@ -143,6 +154,10 @@ var AllTags = map[string][]string{
 		TagConflict,
 		TagExample,
 		TagUpstreamE2E,
+		TagLongLivedConnection,
+		TagUserDefined,
+		TagRandom,
+		TagCoverage,
 	},
 }
 
@@ -247,3 +262,34 @@ func (s StringSet) ContainsAny(stringSlice []string) bool {
 	}
 	return false
 }
+
+// MarshalJSON writes the set as a sorted list of tags
+func (s StringSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Keys())
+}
+
+// UnmarshalJSON reads either a list of tags -- adding the primary tag of each subordinate tag -- or, as
+// written by older versions, an object of tags to true
+func (s *StringSet) UnmarshalJSON(bs []byte) error {
+	var tags []string
+	if err := json.Unmarshal(bs, &tags); err != nil {
+		var dict map[string]bool
+		if err := json.Unmarshal(bs, &dict); err != nil {
+			return errors.Wrapf(err, "unable to unmarshal tags: expected a list")
+		}
+		tags = maps.Keys(dict)
+	}
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+	set := NewStringSet()
+	for _, tag := range tags {
+		if _, ok := AllTags[tag]; ok {
+			set[tag] = true
+		} else {
+			set.Add(tag)
+		}
+	}
+	*s = set
+	return nil
+}
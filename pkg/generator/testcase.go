@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"github.com/mattfenwick/cyclonus/pkg/kube"
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
@@ -10,9 +11,9 @@ import (
 )
 
 type TestCase struct {
-	Description string
-	Tags        StringSet
-	Steps       []*TestStep
+	Description string      `json:"description"`
+	Tags        StringSet   `json:"tags,omitempty"`
+	Steps       []*TestStep `json:"steps"`
 }
 
 func NewSingleStepTestCase(description string, tags StringSet, pp *ProbeConfig, actions ...*Action) *TestCase {
@@ -36,37 +37,45 @@ func NewTestCase(description string, tags StringSet, steps ...*TestStep) *TestCa
 	}
 }
 
+// RewriteIPBlocks returns a copy of the test case, whose policies' ipblocks built around fromIP are moved to
+// toIP instead: see kube.RewriteCIDR
+func (t *TestCase) RewriteIPBlocks(fromIP string, toIP string) (*TestCase, error) {
+	rewritten := &TestCase{Description: t.Description, Tags: t.Tags}
+	for _, step := range t.Steps {
+		rewrittenStep := &TestStep{Probe: step.Probe, LongLived: step.LongLived}
+		for _, action := range step.Actions {
+			if action.CreatePolicy != nil {
+				policy, err := kube.RewriteIPBlocks(action.CreatePolicy.Policy, fromIP, toIP)
+				if err != nil {
+					return nil, err
+				}
+				action = CreatePolicy(policy)
+			} else if action.UpdatePolicy != nil {
+				policy, err := kube.RewriteIPBlocks(action.UpdatePolicy.Policy, fromIP, toIP)
+				if err != nil {
+					return nil, err
+				}
+				action = UpdatePolicy(policy)
+			}
+			rewrittenStep.Actions = append(rewrittenStep.Actions, action)
+		}
+		rewritten.Steps = append(rewritten.Steps, rewrittenStep)
+	}
+	return rewritten, nil
+}
+
 func (t *TestCase) collectActionsAndPolicies() (map[string]bool, []*networkingv1.NetworkPolicy) {
 	features := map[string]bool{}
 	var policies []*networkingv1.NetworkPolicy
 	for _, step := range t.Steps {
 		for _, action := range step.Actions {
+			features[action.Feature()] = true
 			if action.CreatePolicy != nil {
-				features[ActionFeatureCreatePolicy] = true
 				policies = append(policies, action.CreatePolicy.Policy)
 			} else if action.UpdatePolicy != nil {
-				features[ActionFeatureUpdatePolicy] = true
 				policies = append(policies, action.UpdatePolicy.Policy)
-			} else if action.DeletePolicy != nil {
-				features[ActionFeatureDeletePolicy] = true
-			} else if action.CreateNamespace != nil {
-				features[ActionFeatureCreateNamespace] = true
-			} else if action.SetNamespaceLabels != nil {
-				features[ActionFeatureSetNamespaceLabels] = true
-			} else if action.DeleteNamespace != nil {
-				features[ActionFeatureDeleteNamespace] = true
-			} else if action.ReadNetworkPolicies != nil {
-				// TODO need to also analyze these policies after they get read
-				features[ActionFeatureReadPolicies] = true
-			} else if action.CreatePod != nil {
-				features[ActionFeatureCreatePod] = true
-			} else if action.SetPodLabels != nil {
-				features[ActionFeatureSetPodLabels] = true
-			} else if action.DeletePod != nil {
-				features[ActionFeatureDeletePod] = true
-			} else {
-				panic("invalid Action")
 			}
+			// TODO need to also analyze policies after they get read
 		}
 	}
 	return features, policies
@@ -114,12 +123,14 @@ const (
 	ProbeModeServiceName = "service-name"
 	ProbeModeServiceIP   = "service-ip"
 	ProbeModePodIP       = "pod-ip"
+	ProbeModePodIPv6     = "pod-ipv6"
 )
 
 var AllProbeModes = []string{
 	ProbeModeServiceName,
 	ProbeModeServiceIP,
 	ProbeModePodIP,
+	ProbeModePodIPv6,
 }
 
 func ParseProbeMode(mode string) (ProbeMode, error) {
@@ -130,6 +141,8 @@ func ParseProbeMode(mode string) (ProbeMode, error) {
 		return ProbeModeServiceIP, nil
 	case ProbeModePodIP:
 		return ProbeModePodIP, nil
+	case ProbeModePodIPv6:
+		return ProbeModePodIPv6, nil
 	}
 	return "", errors.Errorf("invalid probe mode %s", mode)
 }
@@ -138,9 +151,9 @@ func ParseProbeMode(mode string) (ProbeMode, error) {
 //
 //	models a discriminated union (sum type).
 type ProbeConfig struct {
-	AllAvailable bool
-	PortProtocol *PortProtocol
-	Mode         ProbeMode
+	AllAvailable bool          `json:"allAvailable,omitempty"`
+	PortProtocol *PortProtocol `json:"portProtocol,omitempty"`
+	Mode         ProbeMode     `json:"mode"`
 }
 
 func NewAllAvailable(mode ProbeMode) *ProbeConfig {
@@ -152,13 +165,32 @@ func NewProbeConfig(port intstr.IntOrString, protocol v1.Protocol, mode ProbeMod
 }
 
 type PortProtocol struct {
-	Protocol v1.Protocol
-	Port     intstr.IntOrString
+	Protocol v1.Protocol        `json:"protocol"`
+	Port     intstr.IntOrString `json:"port"`
 }
 
 type TestStep struct {
-	Probe   *ProbeConfig
-	Actions []*Action
+	Probe   *ProbeConfig `json:"probe"`
+	Actions []*Action    `json:"actions,omitempty"`
+	// LongLived is optional; its connections are opened before the step's actions and held open until after
+	LongLived *LongLivedConnections `json:"longLived,omitempty"`
+}
+
+// LongLivedConnections are opened from each of the From pods to each of the To pods, on each of the
+// numbered ports/protocols.  Whether they survive a step's actions isn't specified by kubernetes, so it's
+// reported but doesn't count towards passing or failing.
+type LongLivedConnections struct {
+	From          []string        `json:"from"`
+	To            []string        `json:"to"`
+	PortProtocols []*PortProtocol `json:"portProtocols"`
+}
+
+func NewLongLivedTestStep(connections *LongLivedConnections, pp *ProbeConfig, actions ...*Action) *TestStep {
+	return &TestStep{
+		Probe:     pp,
+		Actions:   actions,
+		LongLived: connections,
+	}
 }
 
 func NewTestStep(pp *ProbeConfig, actions ...*Action) *TestStep {
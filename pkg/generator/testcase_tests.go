@@ -0,0 +1,46 @@
+package generator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "k8s.io/api/networking/v1"
+)
+
+func RunTestCaseTests() {
+	Describe("TestCase", func() {
+		It("Should rewrite ipblocks built around the pod ip, and leave the rest", func() {
+			peers, err := ipBlockPeers("10.1.2.3")
+			Expect(err).To(Succeed())
+			withExcept := peers[1].Peer
+			wide := NetworkPolicyPeer{IPBlock: &IPBlock{CIDR: "0.0.0.0/0", Except: []string{"10.0.0.0/8"}}}
+			policy := BuildPolicy(SetPeers(true, []NetworkPolicyPeer{withExcept, wide})).NetworkPolicy()
+			testCase := NewTestCase("ipblocks", NewStringSet(TagIngress),
+				NewTestStep(ProbeAllAvailable, CreatePolicy(policy)),
+				NewTestStep(ProbeAllAvailable, UpdatePolicy(policy), SetPodLabels("x", "a", map[string]string{"pod": "b"})))
+
+			rewritten, err := testCase.RewriteIPBlocks("10.1.2.3", "10.244.7.8")
+			Expect(err).To(Succeed())
+			Expect(rewritten.Description).To(Equal(testCase.Description))
+			Expect(rewritten.Steps).To(HaveLen(2))
+			for _, from := range [][]NetworkPolicyPeer{
+				rewritten.Steps[0].Actions[0].CreatePolicy.Policy.Spec.Ingress[0].From,
+				rewritten.Steps[1].Actions[0].UpdatePolicy.Policy.Spec.Ingress[0].From,
+			} {
+				Expect(from[0].IPBlock).To(Equal(&IPBlock{CIDR: "10.244.7.0/24", Except: []string{"10.244.7.0/28"}}))
+				Expect(from[1].IPBlock).To(Equal(wide.IPBlock))
+			}
+			Expect(rewritten.Steps[1].Actions[1]).To(BeIdenticalTo(testCase.Steps[1].Actions[1]))
+
+			// the original is unchanged
+			Expect(policy.Spec.Ingress[0].From[0].IPBlock.CIDR).To(Equal("10.1.2.0/24"))
+		})
+
+		It("Should fail to rewrite ipblocks for an ip of a different family", func() {
+			peers, err := ipBlockPeers("10.1.2.3")
+			Expect(err).To(Succeed())
+			policy := BuildPolicy(SetPeers(false, []NetworkPolicyPeer{peers[0].Peer})).NetworkPolicy()
+			_, err = NewSingleStepTestCase("ipblock", NewStringSet(), ProbeAllAvailable, CreatePolicy(policy)).RewriteIPBlocks("10.1.2.3", "fd00::1")
+			Expect(err).ToNot(Succeed())
+		})
+	})
+}
@@ -37,16 +37,19 @@ Test cases:
 */
 
 type TestCaseGenerator struct {
-	PodIP        string
+	PodIP string
+	// PodIPv6 is optional: if empty, no ipv6 ipblock test cases are generated
+	PodIPv6      string
 	AllowDNS     bool
 	Namespaces   []string
 	Tags         []string
 	ExcludedTags []string
 }
 
-func NewTestCaseGenerator(allowDNS bool, podIP string, namespaces []string, tags []string, excludedTags []string) *TestCaseGenerator {
+func NewTestCaseGenerator(allowDNS bool, podIP string, podIPv6 string, namespaces []string, tags []string, excludedTags []string) *TestCaseGenerator {
 	return &TestCaseGenerator{
 		PodIP:        podIP,
+		PodIPv6:      podIPv6,
 		AllowDNS:     allowDNS,
 		Namespaces:   namespaces,
 		Tags:         tags,
@@ -72,13 +75,20 @@ func (t *TestCaseGenerator) GenerateAllTestCases() []*TestCase {
 		t.ActionTestCases(),
 		t.ConflictTestCases(),
 		t.NamespaceTestCases(),
-		t.UpstreamE2ETestCases())
+		t.UpstreamE2ETestCases(),
+		t.LongLivedConnectionTestCases())
 }
 
 func (t *TestCaseGenerator) GenerateTestCases() []*TestCase {
+	return FilterTestCases(t.GenerateAllTestCases(), t.Tags, t.ExcludedTags)
+}
+
+// FilterTestCases keeps the test cases with any of tags -- or all of them, if tags is empty -- and without any of
+// excludedTags
+func FilterTestCases(testCases []*TestCase, tags []string, excludedTags []string) []*TestCase {
 	var cases []*TestCase
-	for _, testcase := range t.GenerateAllTestCases() {
-		if (len(t.Tags) == 0 || testcase.Tags.ContainsAny(t.Tags)) && !testcase.Tags.ContainsAny(t.ExcludedTags) {
+	for _, testcase := range testCases {
+		if (len(tags) == 0 || testcase.Tags.ContainsAny(tags)) && !testcase.Tags.ContainsAny(excludedTags) {
 			cases = append(cases, testcase)
 		}
 	}
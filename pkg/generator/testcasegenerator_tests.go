@@ -8,7 +8,7 @@ import (
 func RunTestCaseGeneratorTests() {
 	Describe("TestCaseGenerator", func() {
 		It("Overall number of test cases", func() {
-			gen := NewTestCaseGenerator(true, "1.2.3.4", []string{"x", "y", "z"}, []string{}, []string{})
+			gen := NewTestCaseGenerator(true, "1.2.3.4", "", []string{"x", "y", "z"}, []string{}, []string{})
 
 			Expect(len(gen.PeersTestCases())).To(Equal(112))
 			Expect(len(gen.ActionTestCases())).To(Equal(6))
@@ -19,8 +19,29 @@ func RunTestCaseGeneratorTests() {
 			Expect(len(gen.PortProtocolTestCases())).To(Equal(70))
 			Expect(len(gen.ConflictTestCases())).To(Equal(16))
 			Expect(len(gen.NamespaceTestCases())).To(Equal(2))
+			Expect(len(gen.LongLivedConnectionTestCases())).To(Equal(3))
 
-			Expect(len(gen.GenerateTestCases())).To(Equal(230))
+			Expect(len(gen.GenerateTestCases())).To(Equal(233))
+		})
+
+		It("Generates ipv6 ipblock test cases for dual-stack clusters", func() {
+			gen := NewTestCaseGenerator(true, "1.2.3.4", "fd00:10:244::5", []string{"x", "y", "z"}, []string{TagIPBlockIPv6}, []string{})
+
+			Expect(len(gen.PeersTestCases())).To(Equal(124))
+			Expect(len(gen.GenerateTestCases())).To(Equal(12))
+		})
+
+		It("Skips ipblock test cases if the pod ip is unusable", func() {
+			for _, podIP := range []string{"", "not-an-ip"} {
+				gen := NewTestCaseGenerator(true, podIP, podIP, []string{"x", "y", "z"}, []string{}, []string{})
+
+				cases := gen.PeersTestCases()
+				Expect(cases).ToNot(BeEmpty())
+				Expect(len(cases)).To(BeNumerically("<", 112))
+				for _, testCase := range cases {
+					Expect(testCase.Tags.ContainsAny([]string{TagIPBlockNoExcept, TagIPBlockWithExcept, TagIPBlockIPv6})).To(BeFalse())
+				}
+			}
 		})
 	})
 }
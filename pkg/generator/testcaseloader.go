@@ -0,0 +1,166 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+var testCaseFileExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// LoadTestCases reads test cases from a yaml or json file, or from each yaml and json file under a directory.
+// Each file holds either a single test case or a list of them.  Loaded test cases are validated, and tagged
+// as user-defined.
+func LoadTestCases(path string) ([]*TestCase, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to stat test case path %s", path)
+	}
+	if !info.IsDir() {
+		return LoadTestCasesFromFile(path)
+	}
+
+	var paths []string
+	err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && testCaseFileExtensions[strings.ToLower(filepath.Ext(p))] {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to walk test case directory %s", path)
+	}
+	sort.Strings(paths)
+
+	var testCases []*TestCase
+	for _, p := range paths {
+		fileTestCases, err := LoadTestCasesFromFile(p)
+		if err != nil {
+			return nil, err
+		}
+		testCases = append(testCases, fileTestCases...)
+	}
+	return testCases, nil
+}
+
+func LoadTestCasesFromFile(path string) ([]*TestCase, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read test case file %s", path)
+	}
+	testCases, err := ParseTestCases(bs)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid test case file %s", path)
+	}
+	return testCases, nil
+}
+
+// ParseTestCases reads yaml or json holding either a single test case or a list of them.  Unknown fields are
+// rejected, to catch typos.
+func ParseTestCases(bs []byte) ([]*TestCase, error) {
+	jsonBytes, err := yaml.YAMLToJSON(bs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to convert yaml to json")
+	}
+
+	var testCases []*TestCase
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.DisallowUnknownFields()
+	if trimmed := bytes.TrimSpace(jsonBytes); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = decoder.Decode(&testCases)
+	} else {
+		testCase := &TestCase{}
+		err = decoder.Decode(testCase)
+		testCases = []*TestCase{testCase}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal test cases")
+	}
+
+	for i, testCase := range testCases {
+		if err := testCase.Validate(); err != nil {
+			return nil, errors.WithMessagef(err, "invalid test case #%d", i+1)
+		}
+		if testCase.Tags == nil {
+			testCase.Tags = NewStringSet()
+		}
+		testCase.Tags.Add(TagUserDefined)
+	}
+	return testCases, nil
+}
+
+// Validate checks that the test case can be run: that it has a description and steps, and that its probes and
+// actions each have exactly one of their fields set.  A probe's mode defaults to service-name.
+func (t *TestCase) Validate() error {
+	if t.Description == "" {
+		return errors.Errorf("missing description")
+	}
+	if len(t.Steps) == 0 {
+		return errors.Errorf("test case %s has no steps", t.Description)
+	}
+	for i, step := range t.Steps {
+		if err := step.validate(); err != nil {
+			return errors.WithMessagef(err, "test case %s, step %d", t.Description, i+1)
+		}
+	}
+	return nil
+}
+
+func (s *TestStep) validate() error {
+	if s == nil || s.Probe == nil {
+		return errors.Errorf("missing probe")
+	}
+	if s.Probe.AllAvailable == (s.Probe.PortProtocol != nil) {
+		return errors.Errorf("probe must have exactly one of allAvailable and portProtocol")
+	}
+	if s.Probe.Mode == "" {
+		s.Probe.Mode = ProbeModeServiceName
+	} else if _, err := ParseProbeMode(string(s.Probe.Mode)); err != nil {
+		return err
+	}
+	for i, action := range s.Actions {
+		if err := action.validate(); err != nil {
+			return errors.WithMessagef(err, "action %d", i+1)
+		}
+	}
+	if s.LongLived != nil && (len(s.LongLived.From) == 0 || len(s.LongLived.To) == 0 || len(s.LongLived.PortProtocols) == 0) {
+		return errors.Errorf("long-lived connections need from, to and portProtocols")
+	}
+	return nil
+}
+
+func (a *Action) validate() error {
+	if a == nil {
+		return errors.Errorf("empty action")
+	}
+	set := 0
+	for _, isSet := range []bool{
+		a.CreatePolicy != nil, a.UpdatePolicy != nil, a.DeletePolicy != nil,
+		a.CreateNamespace != nil, a.SetNamespaceLabels != nil, a.DeleteNamespace != nil,
+		a.ReadNetworkPolicies != nil,
+		a.CreatePod != nil, a.SetPodLabels != nil, a.DeletePod != nil,
+	} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.Errorf("action must have exactly one type, found %d", set)
+	}
+	if a.CreatePolicy != nil && a.CreatePolicy.Policy == nil {
+		return errors.Errorf("createPolicy is missing its policy")
+	}
+	if a.UpdatePolicy != nil && a.UpdatePolicy.Policy == nil {
+		return errors.Errorf("updatePolicy is missing its policy")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+func RunTestCaseLoaderTests() {
+	Describe("TestCaseLoader", func() {
+		It("Should parse a single test case, and tag it as user-defined", func() {
+			testCases, err := ParseTestCases([]byte(`
+description: deny all ingress in x
+tags: [deny-all]
+steps:
+- probe:
+    portProtocol:
+      protocol: TCP
+      port: 80
+  actions:
+  - createPolicy:
+      policy:
+        metadata: {name: deny-all, namespace: x}
+        spec:
+          podSelector: {}
+          policyTypes: [Ingress]
+  - setPodLabels: {namespace: x, pod: a, labels: {pod: a2}}
+`))
+			Expect(err).To(Succeed())
+			Expect(testCases).To(HaveLen(1))
+			testCase := testCases[0]
+			Expect(testCase.Tags.Keys()).To(Equal([]string{TagDenyAll, TagMiscellaneous, TagRule, TagUserDefined}))
+			Expect(testCase.Steps[0].Probe).To(Equal(NewProbeConfig(intstr.FromInt(80), v1.ProtocolTCP, ProbeModeServiceName)))
+			Expect(testCase.Steps[0].Actions[0].CreatePolicy.Policy.Name).To(Equal("deny-all"))
+			Expect(testCase.Steps[0].Actions[1]).To(Equal(SetPodLabels("x", "a", map[string]string{"pod": "a2"})))
+		})
+
+		It("Should round trip generated test cases through yaml", func() {
+			generated := NewTestCaseGenerator(true, "1.2.3.4", "", []string{"x", "y", "z"}, []string{TagConflict}, []string{}).GenerateTestCases()
+			bs, err := yaml.Marshal(generated)
+			Expect(err).To(Succeed())
+
+			path := filepath.Join(GinkgoT().TempDir(), "cases.yaml")
+			Expect(os.WriteFile(path, bs, 0644)).To(Succeed())
+			loaded, err := LoadTestCases(filepath.Dir(path))
+			Expect(err).To(Succeed())
+			Expect(loaded).To(HaveLen(len(generated)))
+			for i, testCase := range loaded {
+				Expect(testCase.Tags[TagUserDefined]).To(BeTrue())
+				delete(testCase.Tags, TagUserDefined)
+				Expect(testCase).To(Equal(generated[i]))
+			}
+		})
+
+		It("Should reject invalid test cases", func() {
+			_, err := ParseTestCases([]byte(`{description: no steps}`))
+			Expect(err).To(MatchError(ContainSubstring("has no steps")))
+
+			_, err = ParseTestCases([]byte(`{description: bad tag, tags: [nope], steps: [{probe: {allAvailable: true}}]}`))
+			Expect(err).To(MatchError(ContainSubstring("invalid tags: nope")))
+
+			_, err = ParseTestCases([]byte(`{description: two probes, steps: [{probe: {allAvailable: true, portProtocol: {protocol: TCP, port: 80}}}]}`))
+			Expect(err).To(MatchError(ContainSubstring("exactly one of allAvailable and portProtocol")))
+
+			_, err = ParseTestCases([]byte(`{description: typo, steps: [{probe: {allAvailable: true}, actoins: []}]}`))
+			Expect(err).To(MatchError(ContainSubstring(`unknown field "actoins"`)))
+
+			_, err = ParseTestCases([]byte(`{description: empty action, steps: [{probe: {allAvailable: true}, actions: [{}]}]}`))
+			Expect(err).To(MatchError(ContainSubstring("exactly one type, found 0")))
+		})
+	})
+}
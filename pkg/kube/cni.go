@@ -0,0 +1,41 @@
+package kube
+
+import (
+	"strings"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/maps"
+)
+
+// cniImageNames are substrings of the images of well-known CNIs and network policy implementations
+var cniImageNames = []string{
+	"antrea",
+	"calico",
+	"cilium",
+	"flannel",
+	"kindnet",
+	"kube-router",
+	"ovn-kubernetes",
+	"weave",
+}
+
+// DetectCNIImages returns the images of the pods in kube-system which look like they belong to a CNI.  It's a
+// best-effort guess, meant for recording which CNI -- and version -- a test run was against.
+func DetectCNIImages(kubernetes IKubernetes) ([]string, error) {
+	pods, err := kubernetes.GetPodsInNamespace("kube-system")
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to get pods in kube-system")
+	}
+	images := map[string]bool{}
+	for _, pod := range pods {
+		for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+			for _, name := range cniImageNames {
+				if strings.Contains(container.Image, name) {
+					images[container.Image] = true
+				}
+			}
+		}
+	}
+	return slice.Sort(maps.Keys(images)), nil
+}
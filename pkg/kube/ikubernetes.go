@@ -35,6 +35,7 @@ type IKubernetes interface {
 	GetPodsInNamespace(namespace string) ([]v1.Pod, error)
 
 	ExecuteRemoteCommand(namespace string, pod string, container string, command []string) (string, string, error, error)
+	PortForward(namespace string, pod string, port int) (int, func(), error)
 }
 
 func GetNetworkPoliciesInNamespaces(kubernetes IKubernetes, namespaces []string) ([]networkingv1.NetworkPolicy, error) {
@@ -359,7 +360,12 @@ func (m *MockKubernetes) ExecuteRemoteCommand(namespace string, pod string, cont
 	// TODO could look at netpols, pods, etc. to determine if this resolves?
 
 	if rand.Float64() > m.passRate {
-		return "", "", errors.Errorf("mock call randomly failed"), nil
+		// mimic 'agnhost connect', which reports the reason for the failure on stderr
+		return "", "TIMEOUT", errors.Errorf("mock call randomly failed"), nil
 	}
 	return "", "", nil, nil
 }
+
+func (m *MockKubernetes) PortForward(namespace string, pod string, port int) (int, func(), error) {
+	return 0, nil, errors.Errorf("unable to port-forward to %s/%s:%d: not supported by mock", namespace, pod, port)
+}
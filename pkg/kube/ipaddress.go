@@ -3,6 +3,7 @@ package kube
 import (
 	"fmt"
 	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"net"
 )
@@ -19,7 +20,20 @@ func IsIPInCIDR(ip string, cidr string) (bool, error) {
 	return cidrNet.Contains(trafficIP), nil
 }
 
+// IsIPAddressMatchForIPBlock evaluates ipblocks per ip family: an ipblock never matches an
+// address of the other family.
 func IsIPAddressMatchForIPBlock(ip string, ipBlock *networkingv1.IPBlock) (bool, error) {
+	isIPv4, err := IsIPV4Address(ip)
+	if err != nil {
+		return false, err
+	}
+	isCIDRIPv4, err := IsCIDRIPV4(ipBlock.CIDR)
+	if err != nil {
+		return false, err
+	}
+	if isIPv4 != isCIDRIPv4 {
+		return false, nil
+	}
 	isInCidr, err := IsIPInCIDR(ip, ipBlock.CIDR)
 	if err != nil {
 		return false, err
@@ -39,30 +53,57 @@ func IsIPAddressMatchForIPBlock(ip string, ipBlock *networkingv1.IPBlock) (bool,
 	return true, nil
 }
 
-func IsIPV4Address(s string) bool {
-	for i := 0; i < len(s); i++ {
-		switch s[i] {
-		case '.':
-			return true
-		case ':':
-			return false
+func IsIPV4Address(s string) (bool, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return false, errors.Errorf("address %s is neither IPv4 nor IPv6", s)
+	}
+	return ip.To4() != nil, nil
+}
+
+// IsCIDRIPV4 determines the ip family of a CIDR
+func IsCIDRIPV4(cidr string) (bool, error) {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to parse CIDR '%s'", cidr)
+	}
+	return ip.To4() != nil, nil
+}
+
+// IPForFamily picks the first address of the requested family, or "" if there isn't one
+func IPForFamily(ips []string, isIPv6 bool) (string, error) {
+	for _, ip := range ips {
+		isIPv4, err := IsIPV4Address(ip)
+		if err != nil {
+			return "", err
+		}
+		if isIPv4 != isIPv6 {
+			return ip, nil
 		}
 	}
-	panic(errors.Errorf("address %s is neither IPv4 nor IPv6", s))
+	return "", nil
 }
 
-func MakeCIDRFromZeroes(ipString string, zeroes int) string {
-	if IsIPV4Address(ipString) {
-		return makeCidr(ipString, 32-zeroes, 32)
+func MakeCIDRFromZeroes(ipString string, zeroes int) (string, error) {
+	isIPv4, err := IsIPV4Address(ipString)
+	if err != nil {
+		return "", err
+	}
+	if isIPv4 {
+		return makeCidr(ipString, 32-zeroes, 32), nil
 	}
-	return makeCidr(ipString, 128-zeroes, 128)
+	return makeCidr(ipString, 128-zeroes, 128), nil
 }
 
-func MakeCIDRFromOnes(ipString string, ones int) string {
-	if IsIPV4Address(ipString) {
-		return makeCidr(ipString, ones, 32)
+func MakeCIDRFromOnes(ipString string, ones int) (string, error) {
+	isIPv4, err := IsIPV4Address(ipString)
+	if err != nil {
+		return "", err
 	}
-	return makeCidr(ipString, ones, 128)
+	if isIPv4 {
+		return makeCidr(ipString, ones, 32), nil
+	}
+	return makeCidr(ipString, ones, 128), nil
 }
 
 func makeCidr(ipString string, ones int, bits int) string {
@@ -70,3 +111,88 @@ func makeCidr(ipString string, ones int, bits int) string {
 	ip := net.ParseIP(ipString)
 	return fmt.Sprintf("%s/%d", ip.Mask(mask).String(), ones)
 }
+
+// PodIPs returns all of a pod's addresses -- one per ip family for dual-stack pods -- falling back
+// to the primary address for clusters which don't populate status.podIPs
+func PodIPs(pod *v1.Pod) []string {
+	var ips []string
+	for _, podIP := range pod.Status.PodIPs {
+		ips = append(ips, podIP.IP)
+	}
+	if len(ips) == 0 && pod.Status.PodIP != "" {
+		ips = []string{pod.Status.PodIP}
+	}
+	return ips
+}
+
+// ServiceIPs returns all of a service's cluster ips -- one per ip family for dual-stack services
+func ServiceIPs(svc *v1.Service) []string {
+	if len(svc.Spec.ClusterIPs) > 0 {
+		return svc.Spec.ClusterIPs
+	}
+	if svc.Spec.ClusterIP != "" {
+		return []string{svc.Spec.ClusterIP}
+	}
+	return nil
+}
+
+// MaxGeneratedCIDRZeroes is the most host bits of the cidrs which test cases build around a pod's ip
+const MaxGeneratedCIDRZeroes = 11
+
+// RewriteCIDR moves a cidr which was built around fromIP -- it contains fromIP, and has at most
+// MaxGeneratedCIDRZeroes host bits -- so that it contains toIP instead, keeping its prefix length.  Other cidrs,
+// including wider ones which merely contain fromIP, such as 0.0.0.0/0, and those of the other ip family, are
+// returned unchanged.  This adapts ipblocks, built around a pod's ip in one cluster, to the same pod in
+// another cluster.
+func RewriteCIDR(cidr string, fromIP string, toIP string) (string, error) {
+	_, cidrNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to parse CIDR '%s'", cidr)
+	}
+	from, to := net.ParseIP(fromIP), net.ParseIP(toIP)
+	if from == nil || to == nil {
+		return "", errors.Errorf("unable to parse IPs '%s' and '%s'", fromIP, toIP)
+	}
+	ones, bits := cidrNet.Mask.Size()
+	if bits-ones > MaxGeneratedCIDRZeroes || !cidrNet.Contains(from) {
+		return cidr, nil
+	}
+	if (to.To4() == nil) != (bits == 128) {
+		return "", errors.Errorf("unable to rewrite CIDR '%s' for IP '%s' of a different family", cidr, toIP)
+	}
+	return makeCidr(toIP, ones, bits), nil
+}
+
+// RewriteIPBlocks returns a copy of the policy, with its ipblocks' cidrs and excepts rewritten by RewriteCIDR
+func RewriteIPBlocks(policy *networkingv1.NetworkPolicy, fromIP string, toIP string) (*networkingv1.NetworkPolicy, error) {
+	rewritten := policy.DeepCopy()
+	rewrite := func(peers []networkingv1.NetworkPolicyPeer) error {
+		for _, peer := range peers {
+			if peer.IPBlock == nil {
+				continue
+			}
+			cidr, err := RewriteCIDR(peer.IPBlock.CIDR, fromIP, toIP)
+			if err != nil {
+				return err
+			}
+			peer.IPBlock.CIDR = cidr
+			for i, except := range peer.IPBlock.Except {
+				if peer.IPBlock.Except[i], err = RewriteCIDR(except, fromIP, toIP); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, rule := range rewritten.Spec.Ingress {
+		if err := rewrite(rule.From); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range rewritten.Spec.Egress {
+		if err := rewrite(rule.To); err != nil {
+			return nil, err
+		}
+	}
+	return rewritten, nil
+}
@@ -104,6 +104,35 @@ func RunIPAddressTests() {
 			Expect(err).ToNot(BeNil())
 		})
 
+		It("Evaluates IPBlocks per ip family", func() {
+			isMatch, err := IsIPAddressMatchForIPBlock("1.2.3.4", &v1.IPBlock{CIDR: "::/0"})
+			Expect(err).To(BeNil())
+			Expect(isMatch).To(BeFalse())
+
+			isMatch, err = IsIPAddressMatchForIPBlock("fd00::1", &v1.IPBlock{CIDR: "0.0.0.0/0"})
+			Expect(err).To(BeNil())
+			Expect(isMatch).To(BeFalse())
+
+			isMatch, err = IsIPAddressMatchForIPBlock("fd00::1", &v1.IPBlock{CIDR: "fd00::/8", Except: []string{"10.0.0.0/8"}})
+			Expect(err).To(BeNil())
+			Expect(isMatch).To(BeTrue())
+		})
+
+		It("Picks addresses by ip family", func() {
+			ips := []string{"10.244.0.1", "fd00:10:244::1"}
+			ip, err := IPForFamily(ips, false)
+			Expect(err).To(BeNil())
+			Expect(ip).To(Equal("10.244.0.1"))
+
+			ip, err = IPForFamily(ips, true)
+			Expect(err).To(BeNil())
+			Expect(ip).To(Equal("fd00:10:244::1"))
+
+			ip, err = IPForFamily(ips[:1], true)
+			Expect(err).To(BeNil())
+			Expect(ip).To(Equal(""))
+		})
+
 		It("Handles IPBlocks with no exceptions", func() {
 			testCases := []struct {
 				IP      string
@@ -239,7 +268,8 @@ func RunIPAddressTests() {
 			}
 			for _, tc := range testCases {
 				fmt.Printf("%+v\n", net.ParseIP(tc.IP))
-				actual := MakeCIDRFromZeroes(tc.IP, tc.Zeroes)
+				actual, err := MakeCIDRFromZeroes(tc.IP, tc.Zeroes)
+				Expect(err).To(BeNil())
 				Expect(actual).To(Equal(tc.Expected))
 			}
 		})
@@ -313,9 +343,65 @@ func RunIPAddressTests() {
 			}
 			for _, tc := range testCases {
 				fmt.Printf("%+v\n", net.ParseIP(tc.IP))
-				actual := MakeCIDRFromOnes(tc.IP, tc.Bits)
+				actual, err := MakeCIDRFromOnes(tc.IP, tc.Bits)
+				Expect(err).To(BeNil())
+				Expect(actual).To(Equal(tc.Expected))
+			}
+		})
+
+		It("should return an error for addresses that are neither IPv4 nor IPv6", func() {
+			_, err := IsIPV4Address("abc")
+			Expect(err).ToNot(BeNil())
+
+			_, err = MakeCIDRFromZeroes("", 8)
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("should rewrite CIDRs built around one ip to contain another", func() {
+			for _, tc := range []struct{ CIDR, Expected string }{
+				{CIDR: "10.1.2.0/24", Expected: "10.244.7.0/24"},
+				{CIDR: "10.1.2.0/28", Expected: "10.244.7.0/28"},
+				{CIDR: "10.1.2.3/32", Expected: "10.244.7.8/32"},
+				{CIDR: "10.1.0.0/21", Expected: "10.244.0.0/21"},
+				// wider blocks containing the ip weren't built around it
+				{CIDR: "10.1.0.0/20", Expected: "10.1.0.0/20"},
+				{CIDR: "10.1.0.0/16", Expected: "10.1.0.0/16"},
+				{CIDR: "10.0.0.0/8", Expected: "10.0.0.0/8"},
+				{CIDR: "0.0.0.0/0", Expected: "0.0.0.0/0"},
+				// blocks not containing the ip
+				{CIDR: "0.0.0.0/31", Expected: "0.0.0.0/31"},
+				{CIDR: "10.1.3.0/24", Expected: "10.1.3.0/24"},
+				{CIDR: "fd00::/8", Expected: "fd00::/8"},
+			} {
+				actual, err := RewriteCIDR(tc.CIDR, "10.1.2.3", "10.244.7.8")
+				Expect(err).To(BeNil())
+				Expect(actual).To(Equal(tc.Expected))
+			}
+
+			_, err := RewriteCIDR("10.1.2.0/24", "10.1.2.3", "fd00::1")
+			Expect(err).ToNot(BeNil())
+
+			for _, tc := range []struct{ CIDR, Expected string }{
+				{CIDR: "fd00:10:244::/120", Expected: "fd00:20:244::100/120"},
+				{CIDR: "fd00:10:244::/64", Expected: "fd00:10:244::/64"},
+				{CIDR: "::/0", Expected: "::/0"},
+			} {
+				actual, err := RewriteCIDR(tc.CIDR, "fd00:10:244::5", "fd00:20:244::105")
+				Expect(err).To(BeNil())
 				Expect(actual).To(Equal(tc.Expected))
 			}
 		})
+
+		It("should rewrite a policy's ipblocks, without modifying it", func() {
+			policy := &v1.NetworkPolicy{Spec: v1.NetworkPolicySpec{
+				Ingress: []v1.NetworkPolicyIngressRule{{From: []v1.NetworkPolicyPeer{{IPBlock: &v1.IPBlock{CIDR: "10.1.2.0/24", Except: []string{"10.1.2.0/28"}}}}}},
+				Egress:  []v1.NetworkPolicyEgressRule{{To: []v1.NetworkPolicyPeer{{IPBlock: &v1.IPBlock{CIDR: "0.0.0.0/0"}}}}},
+			}}
+			rewritten, err := RewriteIPBlocks(policy, "10.1.2.3", "10.244.7.8")
+			Expect(err).To(BeNil())
+			Expect(rewritten.Spec.Ingress[0].From[0].IPBlock).To(Equal(&v1.IPBlock{CIDR: "10.244.7.0/24", Except: []string{"10.244.7.0/28"}}))
+			Expect(rewritten.Spec.Egress[0].To[0].IPBlock.CIDR).To(Equal("0.0.0.0/0"))
+			Expect(policy.Spec.Ingress[0].From[0].IPBlock.CIDR).To(Equal("10.1.2.0/24"))
+		})
 	})
 }
@@ -3,6 +3,10 @@ package kube
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -14,7 +18,9 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/portforward"
 	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
 )
 
 type Kubernetes struct {
@@ -217,3 +223,46 @@ func (k *Kubernetes) ExecuteRemoteCommand(namespace string, pod string, containe
 	out, errOut := buf.String(), errBuf.String()
 	return out, errOut, errors.Wrapf(err, "unable to stream command"), nil
 }
+
+// PortForward forwards a random local port to the pod's port, and returns that local port and a function which
+// stops forwarding
+func (k *Kubernetes) PortForward(namespace string, pod string, port int) (int, func(), error) {
+	request := k.ClientSet.
+		CoreV1().
+		RESTClient().
+		Post().
+		Namespace(namespace).
+		Resource("pods").
+		Name(pod).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(k.RestConfig)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "unable to instantiate spdy round tripper")
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", request.URL())
+
+	stopChan, readyChan := make(chan struct{}), make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"localhost"}, []string{fmt.Sprintf("0:%d", port)}, stopChan, readyChan, io.Discard, io.Discard)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "unable to instantiate port forwarder")
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- forwarder.ForwardPorts()
+	}()
+	select {
+	case <-readyChan:
+	case err = <-errChan:
+		return 0, nil, errors.Wrapf(err, "unable to port-forward to %s/%s:%d", namespace, pod, port)
+	}
+
+	stopOnce := &sync.Once{}
+	stop := func() { stopOnce.Do(func() { close(stopChan) }) }
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		stop()
+		return 0, nil, errors.Wrapf(err, "unable to get forwarded ports")
+	}
+	return int(ports[0].Local), stop, nil
+}
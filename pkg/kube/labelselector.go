@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/mattfenwick/collections/pkg/slice"
 	"github.com/mattfenwick/cyclonus/pkg/utils"
+	"github.com/pkg/errors"
 	"golang.org/x/exp/maps"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"strings"
@@ -22,40 +23,40 @@ func IsNameMatch(objectName string, matcher string) bool {
 	return objectName == matcher
 }
 
-func IsMatchExpressionMatchForLabels(labels map[string]string, exp metav1.LabelSelectorRequirement) bool {
+func IsMatchExpressionMatchForLabels(labels map[string]string, exp metav1.LabelSelectorRequirement) (bool, error) {
 	switch exp.Operator {
 	case metav1.LabelSelectorOpIn:
 		val, ok := labels[exp.Key]
 		if !ok {
-			return false
+			return false, nil
 		}
 		for _, v := range exp.Values {
 			if v == val {
-				return true
+				return true, nil
 			}
 		}
-		return false
+		return false, nil
 	case metav1.LabelSelectorOpNotIn:
 		val, ok := labels[exp.Key]
 		if !ok {
 			// see https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#resources-that-support-set-based-requirements
 			//   even for NotIn -- if the key isn't there, it's not a match
-			return false
+			return false, nil
 		}
 		for _, v := range exp.Values {
 			if v == val {
-				return false
+				return false, nil
 			}
 		}
-		return true
+		return true, nil
 	case metav1.LabelSelectorOpExists:
 		_, ok := labels[exp.Key]
-		return ok
+		return ok, nil
 	case metav1.LabelSelectorOpDoesNotExist:
 		_, ok := labels[exp.Key]
-		return !ok
+		return !ok, nil
 	default:
-		panic("invalid operator")
+		return false, errors.Errorf("invalid label selector operator %s", exp.Operator)
 	}
 }
 
@@ -64,26 +65,29 @@ func IsMatchExpressionMatchForLabels(labels map[string]string, exp metav1.LabelS
 // > A label selector is a label query over a set of resources. The result of matchLabels and
 // > matchExpressions are ANDed. An empty label selector matches all objects. A null
 // > label selector matches no objects.
-func IsLabelsMatchLabelSelector(labels map[string]string, labelSelector metav1.LabelSelector) bool {
+func IsLabelsMatchLabelSelector(labels map[string]string, labelSelector metav1.LabelSelector) (bool, error) {
 	// From the docs: "The requirements are ANDed."
 	//   Therefore, all MatchLabels must be matched.
 	for key, val := range labelSelector.MatchLabels {
 		if labels[key] != val {
-			return false
+			return false, nil
 		}
 	}
 
 	// From the docs: "The requirements are ANDed."
 	//   Therefore, all MatchExpressions must be matched.
 	for _, exp := range labelSelector.MatchExpressions {
-		isMatch := IsMatchExpressionMatchForLabels(labels, exp)
+		isMatch, err := IsMatchExpressionMatchForLabels(labels, exp)
+		if err != nil {
+			return false, err
+		}
 		if !isMatch {
-			return false
+			return false, nil
 		}
 	}
 
 	// From the docs: "An empty label selector matches all objects."
-	return true
+	return true, nil
 }
 
 func IsLabelSelectorEmpty(l metav1.LabelSelector) bool {
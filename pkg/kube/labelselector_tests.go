@@ -9,9 +9,18 @@ import (
 func RunLabelSelectorTests() {
 	Describe("LabelSelectors", func() {
 		It("Should not match empty labels", func() {
-			Expect(IsLabelsMatchLabelSelector(map[string]string{}, metav1.LabelSelector{
+			isMatch, err := IsLabelsMatchLabelSelector(map[string]string{}, metav1.LabelSelector{
 				MatchLabels: map[string]string{"pod": "b"},
-			})).To(BeFalse())
+			})
+			Expect(err).To(BeNil())
+			Expect(isMatch).To(BeFalse())
+		})
+
+		It("Should return an error for an invalid operator", func() {
+			_, err := IsLabelsMatchLabelSelector(map[string]string{"pod": "b"}, metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "pod", Operator: "Equals", Values: []string{"b"}}},
+			})
+			Expect(err).ToNot(BeNil())
 		})
 	})
 }
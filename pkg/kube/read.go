@@ -1,8 +1,13 @@
 package kube
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mattfenwick/collections/pkg/builtin"
 	"github.com/mattfenwick/collections/pkg/file"
@@ -10,65 +15,273 @@ import (
 	"github.com/mattfenwick/cyclonus/pkg/utils"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 )
 
+// StdinPath is the special path which causes manifests to be read from stdin
+const StdinPath = "-"
+
+// Manifests collects the objects from a set of manifests which are relevant to cyclonus:
+// network policies, plus pods, workloads and namespaces as inventory.  Everything else is skipped.
+type Manifests struct {
+	Policies     []*networkingv1.NetworkPolicy
+	Pods         []v1.Pod
+	Namespaces   []v1.Namespace
+	Deployments  []appsv1.Deployment
+	StatefulSets []appsv1.StatefulSet
+	DaemonSets   []appsv1.DaemonSet
+	Jobs         []batchv1.Job
+}
+
+func (m *Manifests) append(other *Manifests) {
+	m.Policies = append(m.Policies, other.Policies...)
+	m.Pods = append(m.Pods, other.Pods...)
+	m.Namespaces = append(m.Namespaces, other.Namespaces...)
+	m.Deployments = append(m.Deployments, other.Deployments...)
+	m.StatefulSets = append(m.StatefulSets, other.StatefulSets...)
+	m.DaemonSets = append(m.DaemonSets, other.DaemonSets...)
+	m.Jobs = append(m.Jobs, other.Jobs...)
+}
+
 func ReadNetworkPoliciesFromPath(policyPath string) ([]*networkingv1.NetworkPolicy, error) {
-	var allPolicies []*networkingv1.NetworkPolicy
-	err := filepath.Walk(policyPath, func(path string, info os.FileInfo, err error) error {
+	manifests, err := ReadManifestsFromPath(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	return manifests.Policies, nil
+}
+
+// ReadManifestsFromPath reads manifests from a file, from all files under a directory, or
+// from stdin if the path is '-'.  Each file may contain multiple '---'-separated yaml documents,
+// plain yaml lists, kubernetes lists (v1.List, NetworkPolicyList, etc.), or json.
+func ReadManifestsFromPath(path string) (*Manifests, error) {
+	allManifests := &Manifests{}
+	if path == StdinPath {
+		bytes, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			return errors.Wrapf(err, "unable to walk path %s", path)
+			return nil, errors.Wrapf(err, "unable to read stdin")
 		}
-		if info.IsDir() {
-			logrus.Tracef("not opening dir %s", path)
-			return nil
+		manifests, err := ParseManifests(bytes)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse manifests from stdin")
 		}
-		logrus.Debugf("walking path %s", path)
-		bytes, err := file.Read(path)
+		allManifests.append(manifests)
+	} else {
+		err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return errors.Wrapf(err, "unable to walk path %s", filePath)
+			}
+			if info.IsDir() {
+				logrus.Tracef("not opening dir %s", filePath)
+				return nil
+			}
+			if filePath != path && !isManifestFile(filePath) {
+				logrus.Debugf("skipping non-manifest file %s", filePath)
+				return nil
+			}
+			logrus.Debugf("walking path %s", filePath)
+			bytes, err := file.Read(filePath)
+			if err != nil {
+				return err
+			}
+			manifests, err := ParseManifests(bytes)
+			if err != nil {
+				return errors.WithMessagef(err, "unable to parse manifests from %s", filePath)
+			}
+			logrus.Debugf("parsed %d policies, %d pods and %d namespaces from %s", len(manifests.Policies), len(manifests.Pods), len(manifests.Namespaces), filePath)
+			allManifests.append(manifests)
+			return nil
+		})
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
+	for _, p := range allManifests.Policies {
+		if len(p.Spec.PolicyTypes) == 0 {
+			return nil, errors.Errorf("missing spec.policyTypes from network policy %s/%s", p.Namespace, p.Name)
+		}
+	}
+	return allManifests, nil
+}
 
-		// TODO try parsing plain yaml list (that is: not a NetworkPolicyList)
-		// policies, err := utils.ParseYaml[[]*networkingv1.NetworkPolicy](bytes)
-
-		// TODO try parsing multiple policies separated by '---' lines
-		// policies, err := yaml.ParseMany[networkingv1.NetworkPolicy](bytes)
-		// if err == nil {
-		// 	logrus.Debugf("parsed %d policies from %s", len(policies), path)
-		// 	allPolicies = append(allPolicies, refNetpolList(policies)...)
-		// 	return nil
-		// }
-		// logrus.Errorf("unable to parse multiple policies separated by '---' lines: %+v", err)
+func isManifestFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
 
-		// try parsing a NetworkPolicyList
-		policyList, err := utils.ParseYamlStrict[networkingv1.NetworkPolicyList](bytes)
-		if err == nil {
-			allPolicies = append(allPolicies, refNetpolList(policyList.Items)...)
-			return nil
+// ParseManifests parses a stream of '---'-separated yaml (or json) documents
+func ParseManifests(bs []byte) (*Manifests, error) {
+	manifests := &Manifests{}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(bs)))
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "unable to read yaml document %d", i)
 		}
+		parsed, err := parseManifestDocument(doc)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse yaml document %d", i)
+		}
+		manifests.append(parsed)
+	}
+	return manifests, nil
+}
 
-		logrus.Debugf("unable to parse list of policies: %+v", err)
+func parseManifestDocument(doc []byte) (*Manifests, error) {
+	manifests := &Manifests{}
 
-		policy, err := utils.ParseYamlStrict[networkingv1.NetworkPolicy](bytes)
+	// plain yaml list: not a kubernetes List, just a sequence of objects
+	if isYamlSequence(doc) {
+		items, err := utils.ParseYaml[[]json.RawMessage](doc)
 		if err != nil {
-			return errors.WithMessagef(err, "unable to parse single policy from yaml at %s", path)
+			return nil, err
 		}
+		for _, item := range *items {
+			parsed, err := parseManifestDocument(item)
+			if err != nil {
+				return nil, err
+			}
+			manifests.append(parsed)
+		}
+		return manifests, nil
+	}
 
-		logrus.Debugf("parsed single policy from %s: %+v", path, policy)
-		allPolicies = append(allPolicies, policy)
-		return nil
-	})
+	typeMeta, err := utils.ParseYaml[metav1.TypeMeta](doc)
 	if err != nil {
 		return nil, err
-		//return nil, errors.Wrapf(err, "unable to walk filesystem from %s", policyPath)
 	}
-	for _, p := range allPolicies {
-		if len(p.Spec.PolicyTypes) == 0 {
-			return nil, errors.Errorf("missing spec.policyTypes from network policy %s/%s", p.Namespace, p.Name)
+	switch {
+	case typeMeta.APIVersion == "" && typeMeta.Kind == "":
+		// empty documents are common, for example between '---' lines or as the result of templating
+		if isEmptyDocument(doc) {
+			return manifests, nil
+		}
+		// be lenient with policies which omit the type information
+		policy, err := utils.ParseYamlStrict[networkingv1.NetworkPolicy](doc)
+		if err != nil {
+			logrus.Debugf("skipping document without apiVersion or kind: %+v", err)
+			return manifests, nil
+		}
+		manifests.Policies = append(manifests.Policies, policy)
+	case strings.HasSuffix(typeMeta.Kind, "List"):
+		list, err := utils.ParseYaml[struct {
+			Items []json.RawMessage `json:"items"`
+		}](doc)
+		if err != nil {
+			return nil, err
 		}
+		for _, item := range list.Items {
+			// items of typed lists such as NetworkPolicyList usually omit their own type information
+			parsed, err := parseListItem(typeMeta, item)
+			if err != nil {
+				return nil, err
+			}
+			manifests.append(parsed)
+		}
+	case typeMeta.Kind == "NetworkPolicy":
+		policy, err := utils.ParseYamlStrict[networkingv1.NetworkPolicy](doc)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse network policy")
+		}
+		manifests.Policies = append(manifests.Policies, policy)
+	case typeMeta.Kind == "Pod":
+		pod, err := utils.ParseYaml[v1.Pod](doc)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse pod")
+		}
+		manifests.Pods = append(manifests.Pods, *pod)
+	case typeMeta.Kind == "Namespace":
+		ns, err := utils.ParseYaml[v1.Namespace](doc)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse namespace")
+		}
+		manifests.Namespaces = append(manifests.Namespaces, *ns)
+	case typeMeta.Kind == "Deployment":
+		deployment, err := utils.ParseYaml[appsv1.Deployment](doc)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse deployment")
+		}
+		manifests.Deployments = append(manifests.Deployments, *deployment)
+	case typeMeta.Kind == "StatefulSet":
+		statefulSet, err := utils.ParseYaml[appsv1.StatefulSet](doc)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse statefulset")
+		}
+		manifests.StatefulSets = append(manifests.StatefulSets, *statefulSet)
+	case typeMeta.Kind == "DaemonSet":
+		daemonSet, err := utils.ParseYaml[appsv1.DaemonSet](doc)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse daemonset")
+		}
+		manifests.DaemonSets = append(manifests.DaemonSets, *daemonSet)
+	case typeMeta.Kind == "Job":
+		job, err := utils.ParseYaml[batchv1.Job](doc)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse job")
+		}
+		manifests.Jobs = append(manifests.Jobs, *job)
+	default:
+		logrus.Debugf("skipping manifest of kind %s/%s", typeMeta.APIVersion, typeMeta.Kind)
+	}
+	return manifests, nil
+}
+
+func parseListItem(listType *metav1.TypeMeta, item []byte) (*Manifests, error) {
+	if listType.Kind == "List" {
+		return parseManifestDocument(item)
+	}
+	obj, err := utils.ParseYaml[map[string]interface{}](item)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := (*obj)["kind"]; !ok {
+		(*obj)["kind"] = strings.TrimSuffix(listType.Kind, "List")
+	}
+	if _, ok := (*obj)["apiVersion"]; !ok {
+		(*obj)["apiVersion"] = listType.APIVersion
+	}
+	typedItem, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to marshal json")
+	}
+	return parseManifestDocument(typedItem)
+}
+
+// significantLines drops blank lines and comments
+func significantLines(doc []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(doc), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func isEmptyDocument(doc []byte) bool {
+	return len(significantLines(doc)) == 0
+}
+
+func isYamlSequence(doc []byte) bool {
+	lines := significantLines(doc)
+	if len(lines) == 0 {
+		return false
 	}
-	return allPolicies, nil
+	first := strings.TrimSpace(lines[0])
+	return strings.HasPrefix(first, "[") || first == "-" || strings.HasPrefix(first, "- ")
 }
 
 func ReadNetworkPoliciesFromKube(kubeClient *Kubernetes, namespaces []string) ([]*networkingv1.NetworkPolicy, error) {
@@ -18,14 +18,34 @@ func RunReadNetworkPolicyTests() {
 			Expect(len(policies)).To(Equal(3))
 		})
 
-		// TODO test case to read multiple policies from plain yaml list
+		It("Should read multiple policies from a plain yaml list", func() {
+			policies, err := ReadNetworkPoliciesFromPath("../../networkpolicies/yaml-syntax/plain-yaml-list.yaml")
+			Expect(err).To(BeNil())
+			Expect(len(policies)).To(Equal(3))
+		})
+
+		It("Should read multiple policies separated by '---' lines from a single file", func() {
+			policies, err := ReadNetworkPoliciesFromPath("../../networkpolicies/yaml-syntax/triple-dash-separated.yaml")
+			Expect(err).To(BeNil())
+			Expect(len(policies)).To(Equal(3))
+		})
 
-		// TODO
-		// It("Should read multiple policies separated by '---' lines from a single file", func() {
-		// 	policies, err := ReadNetworkPoliciesFromPath("../../networkpolicies/yaml-syntax/triple-dash-separated.yaml")
-		// 	Expect(err).To(BeNil())
-		// 	Expect(len(policies)).To(Equal(3))
-		// })
+		It("Should read a typed list of policies from json", func() {
+			policies, err := ReadNetworkPoliciesFromPath("../../networkpolicies/yaml-syntax/policy-list.json")
+			Expect(err).To(BeNil())
+			Expect(len(policies)).To(Equal(1))
+			Expect(policies[0].Name).To(Equal("deny-all"))
+		})
+
+		It("Should skip other kinds and collect pods and namespaces from mixed manifests", func() {
+			manifests, err := ReadManifestsFromPath("../../networkpolicies/yaml-syntax/mixed-manifests.yaml")
+			Expect(err).To(BeNil())
+			Expect(len(manifests.Policies)).To(Equal(1))
+			Expect(len(manifests.Pods)).To(Equal(1))
+			Expect(manifests.Pods[0].Name).To(Equal("debug"))
+			Expect(len(manifests.Namespaces)).To(Equal(1))
+			Expect(manifests.Namespaces[0].Labels).To(Equal(map[string]string{"team": "shop"}))
+		})
 
 		It("Should read multiple policies from all files in a directory", func() {
 			policies, err := ReadNetworkPoliciesFromPath("../../networkpolicies/simple-example")
@@ -34,7 +54,7 @@ func RunReadNetworkPolicyTests() {
 
 			policies, err = ReadNetworkPoliciesFromPath("../../networkpolicies/")
 			Expect(err).To(BeNil())
-			Expect(len(policies)).To(Equal(14))
+			Expect(len(policies)).To(Equal(22))
 		})
 
 		// TODO test to show what happens for duplicate names
@@ -12,5 +12,6 @@ func TestModel(t *testing.T) {
 	RunIPAddressTests()
 	RunLabelSelectorTests()
 	RunReadNetworkPolicyTests()
+	RunWorkloadTests()
 	RunSpecs(t, "network policy matcher suite")
 }
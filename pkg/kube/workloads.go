@@ -0,0 +1,89 @@
+package kube
+
+import (
+	"fmt"
+
+	"github.com/mattfenwick/collections/pkg/slice"
+	"golang.org/x/exp/maps"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExpandPods returns the pods from the manifests, plus simulated pods for each workload's pod template.
+// If replicas is positive, it's used for every workload; otherwise, the replica count (or parallelism)
+// from the workload's spec is used, defaulting to 1.  DaemonSets get `replicas` pods, or 1.
+func (m *Manifests) ExpandPods(replicas int) []v1.Pod {
+	pods := append([]v1.Pod{}, m.Pods...)
+	for _, d := range m.Deployments {
+		pods = append(pods, podsFromTemplate(d.ObjectMeta, d.Spec.Template, workloadReplicas(replicas, d.Spec.Replicas))...)
+	}
+	for _, s := range m.StatefulSets {
+		pods = append(pods, podsFromTemplate(s.ObjectMeta, s.Spec.Template, workloadReplicas(replicas, s.Spec.Replicas))...)
+	}
+	for _, d := range m.DaemonSets {
+		pods = append(pods, podsFromTemplate(d.ObjectMeta, d.Spec.Template, workloadReplicas(replicas, nil))...)
+	}
+	for _, j := range m.Jobs {
+		pods = append(pods, podsFromTemplate(j.ObjectMeta, j.Spec.Template, workloadReplicas(replicas, j.Spec.Parallelism))...)
+	}
+	for i := range pods {
+		if pods[i].Namespace == "" {
+			pods[i].Namespace = v1.NamespaceDefault
+		}
+	}
+	return pods
+}
+
+// ExpandNamespaces returns the namespaces from the manifests, plus any namespaces referenced by
+// other objects' metadata.  As in a real cluster, every namespace gets the DefaultNamespaceLabel.
+func (m *Manifests) ExpandNamespaces() []v1.Namespace {
+	namespaces := map[string]v1.Namespace{}
+	addNamespace := func(name string, labels map[string]string) {
+		if name == "" {
+			name = v1.NamespaceDefault
+		}
+		ns, ok := namespaces[name]
+		if !ok {
+			ns = v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{DefaultNamespaceLabel: name}}}
+			namespaces[name] = ns
+		}
+		for key, value := range labels {
+			ns.Labels[key] = value
+		}
+	}
+	for _, ns := range m.Namespaces {
+		addNamespace(ns.Name, ns.Labels)
+	}
+	for _, pod := range m.ExpandPods(1) {
+		addNamespace(pod.Namespace, nil)
+	}
+	for _, policy := range m.Policies {
+		addNamespace(policy.Namespace, nil)
+	}
+	return slice.SortOn(func(ns v1.Namespace) string { return ns.Name }, maps.Values(namespaces))
+}
+
+func workloadReplicas(override int, specReplicas *int32) int {
+	if override > 0 {
+		return override
+	}
+	if specReplicas != nil {
+		return int(*specReplicas)
+	}
+	return 1
+}
+
+func podsFromTemplate(owner metav1.ObjectMeta, template v1.PodTemplateSpec, replicas int) []v1.Pod {
+	var pods []v1.Pod
+	for i := 0; i < replicas; i++ {
+		pods = append(pods, v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", owner.Name, i),
+				Namespace: owner.Namespace,
+				Labels:    template.Labels,
+			},
+			Spec: template.Spec,
+		})
+	}
+	return pods
+}
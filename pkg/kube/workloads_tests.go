@@ -0,0 +1,117 @@
+package kube
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const workloadManifests = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+spec:
+  replicas: 3
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        ports:
+        - containerPort: 80
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+  namespace: shop
+spec:
+  template:
+    metadata:
+      labels:
+        app: db
+    spec:
+      containers:
+      - name: db
+        image: postgres
+        ports:
+        - containerPort: 5432
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+spec:
+  template:
+    metadata:
+      labels:
+        app: agent
+    spec:
+      containers:
+      - name: agent
+        image: agent
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  namespace: shop
+spec:
+  parallelism: 2
+  template:
+    metadata:
+      labels:
+        app: migrate
+    spec:
+      containers:
+      - name: migrate
+        image: migrate
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: shop
+  labels:
+    team: shop
+`
+
+func RunWorkloadTests() {
+	Describe("Workloads", func() {
+		manifests, err := ParseManifests([]byte(workloadManifests))
+
+		It("Should parse workloads", func() {
+			Expect(err).To(BeNil())
+			Expect(manifests.Deployments).To(HaveLen(1))
+			Expect(manifests.StatefulSets).To(HaveLen(1))
+			Expect(manifests.DaemonSets).To(HaveLen(1))
+			Expect(manifests.Jobs).To(HaveLen(1))
+		})
+
+		It("Should use the workloads' replicas if no override is given", func() {
+			pods := manifests.ExpandPods(0)
+			Expect(pods).To(HaveLen(3 + 1 + 1 + 2))
+			Expect(pods[0].Name).To(Equal("web-0"))
+			Expect(pods[0].Namespace).To(Equal("shop"))
+			Expect(pods[0].Labels).To(Equal(map[string]string{"app": "web"}))
+			Expect(pods[4].Namespace).To(Equal("default"))
+		})
+
+		It("Should override the workloads' replicas", func() {
+			Expect(manifests.ExpandPods(1)).To(HaveLen(4))
+			Expect(manifests.ExpandPods(2)).To(HaveLen(8))
+		})
+
+		It("Should collect namespaces from objects and metadata", func() {
+			namespaces := manifests.ExpandNamespaces()
+			Expect(namespaces).To(HaveLen(2))
+			Expect(namespaces[0].Name).To(Equal("default"))
+			Expect(namespaces[0].Labels).To(Equal(map[string]string{DefaultNamespaceLabel: "default"}))
+			Expect(namespaces[1].Name).To(Equal("shop"))
+			Expect(namespaces[1].Labels).To(Equal(map[string]string{DefaultNamespaceLabel: "shop", "team": "shop"}))
+		})
+	})
+}
@@ -130,9 +130,16 @@ func WarningsTable(warnings []Warning) string {
 	return str.String()
 }
 
-func Lint(kubePolicies []*networkingv1.NetworkPolicy, skip *set.Set[Check]) []Warning {
-	policies := matcher.BuildNetworkPolicies(false, kubePolicies)
-	warnings := append(LintSourcePolicies(kubePolicies), LintResolvedPolicies(policies)...)
+func Lint(kubePolicies []*networkingv1.NetworkPolicy, skip *set.Set[Check]) ([]Warning, error) {
+	policies, err := matcher.BuildNetworkPolicies(false, kubePolicies)
+	if err != nil {
+		return nil, err
+	}
+	resolvedWarnings, err := LintResolvedPolicies(policies)
+	if err != nil {
+		return nil, err
+	}
+	warnings := append(LintSourcePolicies(kubePolicies), resolvedWarnings...)
 
 	// TODO do some stuff with comparing simplified to non-simplified policies
 
@@ -142,7 +149,7 @@ func Lint(kubePolicies []*networkingv1.NetworkPolicy, skip *set.Set[Check]) []Wa
 			filtered = append(filtered, warning)
 		}
 	}
-	return filtered
+	return filtered, nil
 }
 
 func LintSourcePolicies(kubePolicies []*networkingv1.NetworkPolicy) []Warning {
@@ -202,13 +209,22 @@ func LintNetworkPolicyPorts(policy *networkingv1.NetworkPolicy, ports []networki
 	return ws
 }
 
-func LintResolvedPolicies(policies *matcher.Policy) []Warning {
+func LintResolvedPolicies(policies *matcher.Policy) ([]Warning, error) {
 	var ws []Warning
+	dnsPeer := &matcher.TrafficPeer{Internal: nil, IP: "8.8.8.8"}
 	for _, egress := range policies.Egress {
-		if !egress.Allows(&matcher.TrafficPeer{Internal: nil, IP: "8.8.8.8"}, 53, "", v1.ProtocolTCP) {
+		isTCPAllowed, err := egress.Allows(dnsPeer, 53, "", v1.ProtocolTCP)
+		if err != nil {
+			return nil, err
+		}
+		if !isTCPAllowed {
 			ws = append(ws, &resolvedWarning{Check: CheckDNSBlockedOnTCP, Target: egress})
 		}
-		if !egress.Allows(&matcher.TrafficPeer{Internal: nil, IP: "8.8.8.8"}, 53, "", v1.ProtocolUDP) {
+		isUDPAllowed, err := egress.Allows(dnsPeer, 53, "", v1.ProtocolUDP)
+		if err != nil {
+			return nil, err
+		}
+		if !isUDPAllowed {
 			ws = append(ws, &resolvedWarning{Check: CheckDNSBlockedOnUDP, Target: egress})
 		}
 
@@ -234,5 +250,5 @@ func LintResolvedPolicies(policies *matcher.Policy) []Warning {
 
 	}
 
-	return ws
+	return ws, nil
 }
@@ -8,10 +8,13 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-func BuildNetworkPolicies(simplify bool, netpols []*networkingv1.NetworkPolicy) *Policy {
+func BuildNetworkPolicies(simplify bool, netpols []*networkingv1.NetworkPolicy) (*Policy, error) {
 	np := NewPolicy()
 	for _, policy := range netpols {
-		ingress, egress := BuildTarget(policy)
+		ingress, egress, err := BuildTarget(policy)
+		if err != nil {
+			return nil, err
+		}
 		if ingress != nil {
 			np.AddTarget(true, ingress)
 		}
@@ -22,7 +25,7 @@ func BuildNetworkPolicies(simplify bool, netpols []*networkingv1.NetworkPolicy)
 	if simplify {
 		np.Simplify()
 	}
-	return np
+	return np, nil
 }
 
 func getPolicyNamespace(policy *networkingv1.NetworkPolicy) string {
@@ -32,59 +35,80 @@ func getPolicyNamespace(policy *networkingv1.NetworkPolicy) string {
 	return policy.Namespace
 }
 
-func BuildTarget(netpol *networkingv1.NetworkPolicy) (*Target, *Target) {
+func BuildTarget(netpol *networkingv1.NetworkPolicy) (*Target, *Target, error) {
 	var ingress *Target
 	var egress *Target
 	if len(netpol.Spec.PolicyTypes) == 0 {
-		panic(errors.Errorf("invalid network policy: need at least 1 type"))
+		return nil, nil, errors.Errorf("invalid network policy %s/%s: need at least 1 type", netpol.Namespace, netpol.Name)
 	}
 	policyNamespace := getPolicyNamespace(netpol)
 	for _, pType := range netpol.Spec.PolicyTypes {
 		switch pType {
 		case networkingv1.PolicyTypeIngress:
+			peers, err := BuildIngressMatcher(policyNamespace, netpol.Spec.Ingress)
+			if err != nil {
+				return nil, nil, errors.WithMessagef(err, "unable to build ingress for network policy %s/%s", netpol.Namespace, netpol.Name)
+			}
 			ingress = &Target{
 				Namespace:   policyNamespace,
 				PodSelector: netpol.Spec.PodSelector,
 				SourceRules: []*networkingv1.NetworkPolicy{netpol},
-				Peers:       BuildIngressMatcher(policyNamespace, netpol.Spec.Ingress),
+				Peers:       peers,
 			}
 		case networkingv1.PolicyTypeEgress:
+			peers, err := BuildEgressMatcher(policyNamespace, netpol.Spec.Egress)
+			if err != nil {
+				return nil, nil, errors.WithMessagef(err, "unable to build egress for network policy %s/%s", netpol.Namespace, netpol.Name)
+			}
 			egress = &Target{
 				Namespace:   policyNamespace,
 				PodSelector: netpol.Spec.PodSelector,
 				SourceRules: []*networkingv1.NetworkPolicy{netpol},
-				Peers:       BuildEgressMatcher(policyNamespace, netpol.Spec.Egress),
+				Peers:       peers,
 			}
+		default:
+			return nil, nil, errors.Errorf("invalid network policy %s/%s: unrecognized policy type %s", netpol.Namespace, netpol.Name, pType)
 		}
 	}
-	return ingress, egress
+	return ingress, egress, nil
 }
 
-func BuildIngressMatcher(policyNamespace string, ingresses []networkingv1.NetworkPolicyIngressRule) []PeerMatcher {
+func BuildIngressMatcher(policyNamespace string, ingresses []networkingv1.NetworkPolicyIngressRule) ([]PeerMatcher, error) {
 	var matchers []PeerMatcher
 	for _, ingress := range ingresses {
-		matchers = append(matchers, BuildPeerMatcher(policyNamespace, ingress.Ports, ingress.From)...)
+		peers, err := BuildPeerMatcher(policyNamespace, ingress.Ports, ingress.From)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, peers...)
 	}
-	return matchers
+	return matchers, nil
 }
 
-func BuildEgressMatcher(policyNamespace string, egresses []networkingv1.NetworkPolicyEgressRule) []PeerMatcher {
+func BuildEgressMatcher(policyNamespace string, egresses []networkingv1.NetworkPolicyEgressRule) ([]PeerMatcher, error) {
 	var matchers []PeerMatcher
 	for _, egress := range egresses {
-		matchers = append(matchers, BuildPeerMatcher(policyNamespace, egress.Ports, egress.To)...)
+		peers, err := BuildPeerMatcher(policyNamespace, egress.Ports, egress.To)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, peers...)
 	}
-	return matchers
+	return matchers, nil
 }
 
-func BuildPeerMatcher(policyNamespace string, npPorts []networkingv1.NetworkPolicyPort, peers []networkingv1.NetworkPolicyPeer) []PeerMatcher {
+func BuildPeerMatcher(policyNamespace string, npPorts []networkingv1.NetworkPolicyPort, peers []networkingv1.NetworkPolicyPeer) ([]PeerMatcher, error) {
 	if len(npPorts) == 0 && len(peers) == 0 {
-		return []PeerMatcher{AllPeersPorts}
+		return []PeerMatcher{AllPeersPorts}, nil
 	}
 	// 1. build port matcher
-	port := BuildPortMatcher(npPorts)
+	port, err := BuildPortMatcher(npPorts)
+	if err != nil {
+		return nil, err
+	}
 	// 2. build Peers
 	if len(peers) == 0 {
-		return []PeerMatcher{&PortsForAllPeersMatcher{Port: port}}
+		return []PeerMatcher{&PortsForAllPeersMatcher{Port: port}}, nil
 	}
 
 	var matchers []PeerMatcher
@@ -92,10 +116,10 @@ func BuildPeerMatcher(policyNamespace string, npPorts []networkingv1.NetworkPoli
 		ip, ns, pod := BuildIPBlockNamespacePodMatcher(policyNamespace, from)
 		// invalid netpol guards
 		if ip == nil && ns == nil && pod == nil {
-			panic(errors.Errorf("invalid NetworkPolicyPeer: all of IPBlock, NamespaceSelector, and PodSelector are nil"))
+			return nil, errors.Errorf("invalid NetworkPolicyPeer: all of IPBlock, NamespaceSelector, and PodSelector are nil")
 		}
 		if ip != nil && (ns != nil || pod != nil) {
-			panic(errors.Errorf("invalid NetworkPolicyPeer: if NamespaceSelector or PodSelector is non-nil, IPBlock must be nil"))
+			return nil, errors.Errorf("invalid NetworkPolicyPeer: if NamespaceSelector or PodSelector is non-nil, IPBlock must be nil")
 		}
 		// process a valid netpol
 		if ip != nil {
@@ -109,7 +133,7 @@ func BuildPeerMatcher(policyNamespace string, npPorts []networkingv1.NetworkPoli
 			})
 		}
 	}
-	return matchers
+	return matchers, nil
 }
 
 func BuildIPBlockNamespacePodMatcher(policyNamespace string, peer networkingv1.NetworkPolicyPeer) (*IPPeerMatcher, NamespaceMatcher, PodMatcher) {
@@ -141,47 +165,53 @@ func BuildIPBlockNamespacePodMatcher(policyNamespace string, peer networkingv1.N
 	return nil, nsMatcher, podMatcher
 }
 
-func BuildPortMatcher(npPorts []networkingv1.NetworkPolicyPort) PortMatcher {
+func BuildPortMatcher(npPorts []networkingv1.NetworkPolicyPort) (PortMatcher, error) {
 	if len(npPorts) == 0 {
-		return &AllPortMatcher{}
+		return &AllPortMatcher{}, nil
 	} else {
 		matcher := &SpecificPortMatcher{}
 		for _, p := range npPorts {
-			singlePort, portRange := BuildSinglePortMatcher(p)
+			singlePort, portRange, err := BuildSinglePortMatcher(p)
+			if err != nil {
+				return nil, err
+			}
 			if singlePort != nil {
 				matcher.Ports = append(matcher.Ports, singlePort)
 			} else {
 				matcher.PortRanges = append(matcher.PortRanges, portRange)
 			}
 		}
-		return matcher
+		return matcher, nil
 	}
 }
 
-func BuildSinglePortMatcher(npPort networkingv1.NetworkPolicyPort) (*PortProtocolMatcher, *PortRangeMatcher) {
+func BuildSinglePortMatcher(npPort networkingv1.NetworkPolicyPort) (*PortProtocolMatcher, *PortRangeMatcher, error) {
 	protocol := v1.ProtocolTCP
 	if npPort.Protocol != nil {
 		protocol = *npPort.Protocol
 	}
+	if npPort.Port != nil && npPort.Port.Type != intstr.Int && npPort.Port.Type != intstr.String {
+		return nil, nil, errors.Errorf("invalid port: unrecognized IntOrString type %d", npPort.Port.Type)
+	}
 	if npPort.EndPort == nil {
 		return &PortProtocolMatcher{
 			Port:     npPort.Port,
 			Protocol: protocol,
-		}, nil
+		}, nil, nil
 	}
 	// we have a port range: make sure it's valid
 	if npPort.Port == nil {
-		panic(errors.Errorf("invalid port range: start port is nil"))
+		return nil, nil, errors.Errorf("invalid port range: start port is nil")
 	}
 	if npPort.Port.Type == intstr.String {
-		panic(errors.Errorf("invalid port range: start port is string"))
+		return nil, nil, errors.Errorf("invalid port range: start port is string")
 	}
 	if *npPort.EndPort < npPort.Port.IntVal {
-		panic(errors.Errorf("invalid port range: end port < start port"))
+		return nil, nil, errors.Errorf("invalid port range: end port < start port")
 	}
 	return nil, &PortRangeMatcher{
 		From:     int(npPort.Port.IntVal),
 		To:       int(*npPort.EndPort),
 		Protocol: protocol,
-	}
+	}, nil
 }
@@ -23,7 +23,8 @@ var (
 func RunBuilderTests() {
 	Describe("BuildTarget: Allow none -- nil egress/ingress", func() {
 		It("allow-no-ingress", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoIngress)
+			ingress, egress, err := BuildTarget(netpol.AllowNoIngress)
+			Expect(err).To(BeNil())
 
 			Expect(ingress).ToNot(BeNil())
 			Expect(ingress.Peers).To(BeNil())
@@ -32,7 +33,8 @@ func RunBuilderTests() {
 		})
 
 		It("allow-no-egress", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoEgress)
+			ingress, egress, err := BuildTarget(netpol.AllowNoEgress)
+			Expect(err).To(BeNil())
 
 			Expect(egress).ToNot(BeNil())
 			Expect(egress.Peers).To(BeNil())
@@ -41,7 +43,8 @@ func RunBuilderTests() {
 		})
 
 		It("allow-neither", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoIngressAllowNoEgress)
+			ingress, egress, err := BuildTarget(netpol.AllowNoIngressAllowNoEgress)
+			Expect(err).To(BeNil())
 
 			Expect(egress).ToNot(BeNil())
 			Expect(egress.Peers).To(BeNil())
@@ -53,7 +56,7 @@ func RunBuilderTests() {
 
 	Describe("BuildTarget: missing namespace gets treated as default namespace", func() {
 		It("missing namespace", func() {
-			ingress, egress := BuildTarget(&networkingv1.NetworkPolicy{
+			ingress, egress, err := BuildTarget(&networkingv1.NetworkPolicy{
 				ObjectMeta: metav1.ObjectMeta{
 					Name: "abc",
 				},
@@ -62,6 +65,7 @@ func RunBuilderTests() {
 					Ingress:     []networkingv1.NetworkPolicyIngressRule{},
 					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
 				}})
+			Expect(err).To(BeNil())
 
 			Expect(ingress.Namespace).To(Equal("default"))
 			Expect(egress.Namespace).To(Equal("default"))
@@ -70,7 +74,8 @@ func RunBuilderTests() {
 
 	Describe("BuildTarget: Allow none -- empty ingress/egress", func() {
 		It("allow-no-ingress", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoIngress_EmptyIngress)
+			ingress, egress, err := BuildTarget(netpol.AllowNoIngress_EmptyIngress)
+			Expect(err).To(BeNil())
 
 			Expect(ingress).ToNot(BeNil())
 			Expect(ingress.Peers).To(BeNil())
@@ -79,7 +84,8 @@ func RunBuilderTests() {
 		})
 
 		It("allow-no-egress", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoEgress_EmptyEgress)
+			ingress, egress, err := BuildTarget(netpol.AllowNoEgress_EmptyEgress)
+			Expect(err).To(BeNil())
 
 			Expect(egress).ToNot(BeNil())
 			Expect(egress.Peers).To(BeNil())
@@ -88,7 +94,8 @@ func RunBuilderTests() {
 		})
 
 		It("allow-neither", func() {
-			ingress, egress := BuildTarget(netpol.AllowNoIngressAllowNoEgress_EmptyEgressEmptyIngress)
+			ingress, egress, err := BuildTarget(netpol.AllowNoIngressAllowNoEgress_EmptyEgressEmptyIngress)
+			Expect(err).To(BeNil())
 
 			Expect(egress).ToNot(BeNil())
 			Expect(egress.Peers).To(BeNil())
@@ -100,56 +107,87 @@ func RunBuilderTests() {
 
 	Describe("BuildTarget: Allow all", func() {
 		It("allow-all-ingress", func() {
-			ingress, egress := BuildTarget(netpol.AllowAllIngress)
+			ingress, egress, err := BuildTarget(netpol.AllowAllIngress)
+			Expect(err).To(BeNil())
 
 			Expect(egress).To(BeNil())
 			Expect(ingress.Peers).To(Equal([]PeerMatcher{AllPeersPorts}))
 		})
 
 		It("allow-all-egress", func() {
-			ingress, egress := BuildTarget(netpol.AllowAllEgress)
+			ingress, egress, err := BuildTarget(netpol.AllowAllEgress)
+			Expect(err).To(BeNil())
 
 			Expect(egress.Peers).To(Equal([]PeerMatcher{AllPeersPorts}))
 			Expect(ingress).To(BeNil())
 		})
 
 		It("allow-all-both", func() {
-			ingress, egress := BuildTarget(netpol.AllowAllIngressAllowAllEgress)
+			ingress, egress, err := BuildTarget(netpol.AllowAllIngressAllowAllEgress)
+			Expect(err).To(BeNil())
 
 			Expect(egress.Peers).To(Equal([]PeerMatcher{AllPeersPorts}))
 			Expect(ingress.Peers).To(Equal([]PeerMatcher{AllPeersPorts}))
 		})
 	})
 
+	Describe("BuildTarget: invalid policies", func() {
+		It("returns an error for a policy without policy types", func() {
+			_, _, err := BuildTarget(&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "x", Name: "abc"},
+				Spec:       networkingv1.NetworkPolicySpec{PodSelector: metav1.LabelSelector{}},
+			})
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("returns an error for a port range whose end is before its start", func() {
+			endPort := int32(50)
+			_, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80, EndPort: &endPort}})
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	Describe("IPPeerMatcher: invalid ips", func() {
+		It("returns an error instead of panicking", func() {
+			ip := &IPPeerMatcher{IPBlock: netpol.IPBlock_10_0_0_1_24, Port: &AllPortMatcher{}}
+			_, err := ip.Allows(&TrafficPeer{IP: "not-an-ip"}, 80, "", tcp)
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
 	// TODO target: combine, ??? etc.
 
 	Describe("PeerMatcher from slice of ingress/egress rules", func() {
 		It("allows no ingress from an empty slice of ingress rules", func() {
-			peers := BuildIngressMatcher("abc", []networkingv1.NetworkPolicyIngressRule{})
+			peers, err := BuildIngressMatcher("abc", []networkingv1.NetworkPolicyIngressRule{})
+			Expect(err).To(BeNil())
 			Expect(peers).To(BeNil())
 		})
 
 		It("allows no egress from an empty slice of egress rules", func() {
-			peers := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{})
+			peers, err := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{})
+			Expect(err).To(BeNil())
 			Expect(peers).To(BeNil())
 		})
 
 		It("allows all ingress from an ingress containing a single empty rule", func() {
-			peers := BuildIngressMatcher("abc", []networkingv1.NetworkPolicyIngressRule{
+			peers, err := BuildIngressMatcher("abc", []networkingv1.NetworkPolicyIngressRule{
 				{Ports: nil, From: nil},
 			})
+			Expect(err).To(BeNil())
 			Expect(peers).To(Equal([]PeerMatcher{AllPeersPorts}))
 		})
 
 		It("allows all egress from an ingress containing a single empty rule", func() {
-			peers := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{
+			peers, err := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{
 				{Ports: nil, To: nil},
 			})
+			Expect(err).To(BeNil())
 			Expect(peers).To(Equal([]PeerMatcher{AllPeersPorts}))
 		})
 
 		It("allows to ips in IPBlock range and also to all pods/ips for DNS", func() {
-			peers := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{
+			peers, err := BuildEgressMatcher("abc", []networkingv1.NetworkPolicyEgressRule{
 				{
 					Ports: []networkingv1.NetworkPolicyPort{{Port: &port80, Protocol: &tcp}},
 					To: []networkingv1.NetworkPolicyPeer{
@@ -161,6 +199,7 @@ func RunBuilderTests() {
 					Ports: []networkingv1.NetworkPolicyPort{{Port: &port53, Protocol: &udp}},
 				},
 			})
+			Expect(err).To(BeNil())
 			port53UDPMatcher := &SpecificPortMatcher{Ports: []*PortProtocolMatcher{{Port: &port53, Protocol: v1.ProtocolUDP}}}
 			port80TCPMatcher := &SpecificPortMatcher{Ports: []*PortProtocolMatcher{{Port: &port80, Protocol: v1.ProtocolTCP}}}
 			ip := &IPPeerMatcher{
@@ -178,21 +217,25 @@ func RunBuilderTests() {
 					Port: port53UDPMatcher,
 				}}))
 
-			Expect(ip.Allows(&TrafficPeer{IP: "192.168.242.249"}, 80, "", tcp)).To(Equal(true))
+			isAllowed, err := ip.Allows(&TrafficPeer{IP: "192.168.242.249"}, 80, "", tcp)
+			Expect(err).To(BeNil())
+			Expect(isAllowed).To(Equal(true))
 		})
 	})
 
 	Describe("PeerMatcher from slice of NetworkPolicyPeer", func() {
 		It("allows all source/destination from an empty slice", func() {
-			sds := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{})
+			sds, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{})
+			Expect(err).To(BeNil())
 			Expect(sds).To(Equal([]PeerMatcher{AllPeersPorts}))
 		})
 
 		It("allows all ips and all pods over a specific port from an empty peer slice", func() {
-			sds := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{{
+			sds, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{{
 				Protocol: &sctp,
 				Port:     &port103,
 			}}, []networkingv1.NetworkPolicyPeer{})
+			Expect(err).To(BeNil())
 			portMatcher := &SpecificPortMatcher{Ports: []*PortProtocolMatcher{
 				{Port: &port103, Protocol: v1.ProtocolSCTP},
 			}}
@@ -201,9 +244,10 @@ func RunBuilderTests() {
 		})
 
 		It("allows ips, but no pods from a single IPBlock", func() {
-			peers := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
+			peers, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
 				{IPBlock: netpol.IPBlock_10_0_0_1_24},
 			})
+			Expect(err).To(BeNil())
 			ip := &IPPeerMatcher{
 				IPBlock: netpol.IPBlock_10_0_0_1_24,
 				Port:    &AllPortMatcher{},
@@ -212,20 +256,22 @@ func RunBuilderTests() {
 		})
 
 		It("allows all ns/pods/ports, but no ips from a single peer with empty pod/ns selectors", func() {
-			peers := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
+			peers, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
 				{
 					PodSelector:       netpol.SelectorEmpty,
 					NamespaceSelector: netpol.SelectorEmpty,
 				},
 			})
+			Expect(err).To(BeNil())
 			Expect(peers).To(Equal([]PeerMatcher{
 				&PodPeerMatcher{Namespace: &AllNamespaceMatcher{}, Pod: &AllPodMatcher{}, Port: &AllPortMatcher{}}}))
 		})
 
 		It("allows ns/pods, but no ips from a single namespace/pod", func() {
-			peers := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
+			peers, err := BuildPeerMatcher("abc", []networkingv1.NetworkPolicyPort{}, []networkingv1.NetworkPolicyPeer{
 				{PodSelector: netpol.SelectorEmpty},
 			})
+			Expect(err).To(BeNil())
 			matcher := &PodPeerMatcher{
 				Namespace: &ExactNamespaceMatcher{Namespace: "abc"},
 				Pod:       &AllPodMatcher{},
@@ -312,18 +358,21 @@ func RunBuilderTests() {
 
 	Describe("Port from NetworkPolicyPort", func() {
 		It("allows all ports and all protocols from an empty slice", func() {
-			pm := BuildPortMatcher([]networkingv1.NetworkPolicyPort{})
+			pm, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{})
+			Expect(err).To(BeNil())
 			Expect(pm).To(Equal(&AllPortMatcher{}))
 		})
 
 		It("allow all ports on protocol", func() {
-			pm := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowAllPortsOnProtocol})
+			pm, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowAllPortsOnProtocol})
+			Expect(err).To(BeNil())
 			Expect(pm).To(Equal(&SpecificPortMatcher{Ports: []*PortProtocolMatcher{{Port: nil, Protocol: v1.ProtocolSCTP}}}))
 		})
 
 		It("allow numbered port on protocol", func() {
 			portNumber := intstr.FromInt(9001)
-			pm := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowNumberedPortOnProtocol})
+			pm, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowNumberedPortOnProtocol})
+			Expect(err).To(BeNil())
 			Expect(pm).To(Equal(&SpecificPortMatcher{Ports: []*PortProtocolMatcher{{
 				Protocol: v1.ProtocolTCP,
 				Port:     &portNumber,
@@ -332,7 +381,8 @@ func RunBuilderTests() {
 
 		It("allow named port on protocol", func() {
 			portName := intstr.FromString("hello")
-			pm := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowNamedPortOnProtocol})
+			pm, err := BuildPortMatcher([]networkingv1.NetworkPolicyPort{netpol.AllowNamedPortOnProtocol})
+			Expect(err).To(BeNil())
 			Expect(pm).To(Equal(&SpecificPortMatcher{Ports: []*PortProtocolMatcher{{
 				Protocol: v1.ProtocolUDP,
 				Port:     &portName,
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/mattfenwick/collections/pkg/slice"
 	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"strings"
@@ -34,11 +35,13 @@ func (i *IPPeerMatcher) MarshalJSON() (b []byte, e error) {
 	})
 }
 
-func (i *IPPeerMatcher) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) bool {
+func (i *IPPeerMatcher) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) (bool, error) {
 	isIpMatch, err := kube.IsIPAddressMatchForIPBlock(peer.IP, i.IPBlock)
-	// TODO propagate this error instead of panic
 	if err != nil {
-		panic(err)
+		return false, errors.WithMessagef(err, "unable to match ip %s against ipblock %s", peer.IP, i.PrimaryKey())
 	}
-	return isIpMatch && i.Port.Allows(portInt, portName, protocol)
+	if !isIpMatch {
+		return false, nil
+	}
+	return i.Port.Allows(portInt, portName, protocol)
 }
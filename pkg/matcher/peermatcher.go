@@ -10,13 +10,13 @@ var (
 )
 
 type PeerMatcher interface {
-	Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) bool
+	Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) (bool, error)
 }
 
 type AllPeersMatcher struct{}
 
-func (a *AllPeersMatcher) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) bool {
-	return true
+func (a *AllPeersMatcher) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) (bool, error) {
+	return true, nil
 }
 
 func (a *AllPeersMatcher) MarshalJSON() (b []byte, e error) {
@@ -29,7 +29,7 @@ type PortsForAllPeersMatcher struct {
 	Port PortMatcher
 }
 
-func (a *PortsForAllPeersMatcher) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) bool {
+func (a *PortsForAllPeersMatcher) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) (bool, error) {
 	return a.Port.Allows(portInt, portName, protocol)
 }
 
@@ -18,13 +18,19 @@ func (ppm *PodPeerMatcher) PrimaryKey() string {
 	return ppm.Namespace.PrimaryKey() + "---" + ppm.Pod.PrimaryKey()
 }
 
-func (ppm *PodPeerMatcher) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) bool {
+func (ppm *PodPeerMatcher) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) (bool, error) {
 	if peer.IsExternal() {
-		return false
+		return false, nil
 	}
-	return ppm.Namespace.Allows(peer.Internal.Namespace, peer.Internal.NamespaceLabels) &&
-		ppm.Pod.Allows(peer.Internal.PodLabels) &&
-		ppm.Port.Allows(portInt, portName, protocol)
+	isNamespaceMatch, err := ppm.Namespace.Allows(peer.Internal.Namespace, peer.Internal.NamespaceLabels)
+	if err != nil || !isNamespaceMatch {
+		return false, err
+	}
+	isPodMatch, err := ppm.Pod.Allows(peer.Internal.PodLabels)
+	if err != nil || !isPodMatch {
+		return false, err
+	}
+	return ppm.Port.Allows(portInt, portName, protocol)
 }
 
 // PodMatcher possibilities:
@@ -66,14 +72,14 @@ func (ppm *PodPeerMatcher) Allows(peer *TrafficPeer, portInt int, portName strin
 //
 
 type PodMatcher interface {
-	Allows(podLabels map[string]string) bool
+	Allows(podLabels map[string]string) (bool, error)
 	PrimaryKey() string
 }
 
 type AllPodMatcher struct{}
 
-func (p *AllPodMatcher) Allows(podLabels map[string]string) bool {
-	return true
+func (p *AllPodMatcher) Allows(podLabels map[string]string) (bool, error) {
+	return true, nil
 }
 
 func (p *AllPodMatcher) MarshalJSON() (b []byte, e error) {
@@ -90,7 +96,7 @@ type LabelSelectorPodMatcher struct {
 	Selector metav1.LabelSelector
 }
 
-func (p *LabelSelectorPodMatcher) Allows(podLabels map[string]string) bool {
+func (p *LabelSelectorPodMatcher) Allows(podLabels map[string]string) (bool, error) {
 	return kube.IsLabelsMatchLabelSelector(podLabels, p.Selector)
 }
 
@@ -108,7 +114,7 @@ func (p *LabelSelectorPodMatcher) PrimaryKey() string {
 // namespaces
 
 type NamespaceMatcher interface {
-	Allows(namespace string, namespaceLabels map[string]string) bool
+	Allows(namespace string, namespaceLabels map[string]string) (bool, error)
 	PrimaryKey() string
 }
 
@@ -116,8 +122,8 @@ type ExactNamespaceMatcher struct {
 	Namespace string
 }
 
-func (p *ExactNamespaceMatcher) Allows(namespace string, namespaceLabels map[string]string) bool {
-	return p.Namespace == namespace
+func (p *ExactNamespaceMatcher) Allows(namespace string, namespaceLabels map[string]string) (bool, error) {
+	return p.Namespace == namespace, nil
 }
 
 func (p *ExactNamespaceMatcher) MarshalJSON() (b []byte, e error) {
@@ -135,7 +141,7 @@ type LabelSelectorNamespaceMatcher struct {
 	Selector metav1.LabelSelector
 }
 
-func (p *LabelSelectorNamespaceMatcher) Allows(namespace string, namespaceLabels map[string]string) bool {
+func (p *LabelSelectorNamespaceMatcher) Allows(namespace string, namespaceLabels map[string]string) (bool, error) {
 	return kube.IsLabelsMatchLabelSelector(namespaceLabels, p.Selector)
 }
 
@@ -152,8 +158,8 @@ func (p *LabelSelectorNamespaceMatcher) PrimaryKey() string {
 
 type AllNamespaceMatcher struct{}
 
-func (a *AllNamespaceMatcher) Allows(namespace string, namespaceLabels map[string]string) bool {
-	return true
+func (a *AllNamespaceMatcher) Allows(namespace string, namespaceLabels map[string]string) (bool, error) {
+	return true, nil
 }
 
 func (a *AllNamespaceMatcher) MarshalJSON() (b []byte, e error) {
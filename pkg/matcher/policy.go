@@ -5,6 +5,7 @@ import (
 	"github.com/mattfenwick/collections/pkg/slice"
 	"github.com/mattfenwick/cyclonus/pkg/kube"
 	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
 	"golang.org/x/exp/maps"
 	"strings"
 )
@@ -56,7 +57,7 @@ func (p *Policy) AddTarget(isIngress bool, target *Target) *Target {
 	return dict[pk]
 }
 
-func (p *Policy) TargetsApplyingToPod(isIngress bool, namespace string, podLabels map[string]string) []*Target {
+func (p *Policy) TargetsApplyingToPod(isIngress bool, namespace string, podLabels map[string]string) ([]*Target, error) {
 	var targets []*Target
 	var dict map[string]*Target
 	if isIngress {
@@ -65,11 +66,15 @@ func (p *Policy) TargetsApplyingToPod(isIngress bool, namespace string, podLabel
 		dict = p.Egress
 	}
 	for _, target := range dict {
-		if target.IsMatch(namespace, podLabels) {
+		isMatch, err := target.IsMatch(namespace, podLabels)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to match target %s", target.GetPrimaryKey())
+		}
+		if isMatch {
 			targets = append(targets, target)
 		}
 	}
-	return targets
+	return targets, nil
 }
 
 type DirectionResult struct {
@@ -120,14 +125,19 @@ func (ar *AllowedResult) IsAllowed() bool {
 // - whether the traffic is allowed
 // - which rules allowed the traffic
 // - which rules matched the traffic target
-func (p *Policy) IsTrafficAllowed(traffic *Traffic) *AllowedResult {
-	return &AllowedResult{
-		Ingress: p.IsIngressOrEgressAllowed(traffic, true),
-		Egress:  p.IsIngressOrEgressAllowed(traffic, false),
+func (p *Policy) IsTrafficAllowed(traffic *Traffic) (*AllowedResult, error) {
+	ingress, err := p.IsIngressOrEgressAllowed(traffic, true)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to evaluate ingress")
+	}
+	egress, err := p.IsIngressOrEgressAllowed(traffic, false)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to evaluate egress")
 	}
+	return &AllowedResult{Ingress: ingress, Egress: egress}, nil
 }
 
-func (p *Policy) IsIngressOrEgressAllowed(traffic *Traffic, isIngress bool) *DirectionResult {
+func (p *Policy) IsIngressOrEgressAllowed(traffic *Traffic, isIngress bool) (*DirectionResult, error) {
 	var target *TrafficPeer
 	var peer *TrafficPeer
 	if isIngress {
@@ -141,23 +151,34 @@ func (p *Policy) IsIngressOrEgressAllowed(traffic *Traffic, isIngress bool) *Dir
 	// 1. if target is external to cluster -> allow
 	//   this is because we can't stop external hosts from sending or receiving traffic
 	if target.Internal == nil {
-		return &DirectionResult{AllowingTargets: nil, DenyingTargets: nil}
+		return &DirectionResult{AllowingTargets: nil, DenyingTargets: nil}, nil
 	}
 
-	matchingTargets := p.TargetsApplyingToPod(isIngress, target.Internal.Namespace, target.Internal.PodLabels)
+	matchingTargets, err := p.TargetsApplyingToPod(isIngress, target.Internal.Namespace, target.Internal.PodLabels)
+	if err != nil {
+		return nil, err
+	}
 
 	// 2. No targets match => automatic allow
 	if len(matchingTargets) == 0 {
-		return &DirectionResult{AllowingTargets: nil, DenyingTargets: nil}
+		return &DirectionResult{AllowingTargets: nil, DenyingTargets: nil}, nil
 	}
 
 	// 3. Check if any matching targets allow this traffic
-	pair := slice.Partition(func(t *Target) bool {
-		return t.Allows(peer, traffic.ResolvedPort, traffic.ResolvedPortName, traffic.Protocol)
-	}, matchingTargets)
-	allowers, deniers := pair.Fst, pair.Snd
+	var allowers, deniers []*Target
+	for _, t := range matchingTargets {
+		isAllowed, err := t.Allows(peer, traffic.ResolvedPort, traffic.ResolvedPortName, traffic.Protocol)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to evaluate target %s", t.GetPrimaryKey())
+		}
+		if isAllowed {
+			allowers = append(allowers, t)
+		} else {
+			deniers = append(deniers, t)
+		}
+	}
 
-	return &DirectionResult{AllowingTargets: allowers, DenyingTargets: deniers}
+	return &DirectionResult{AllowingTargets: allowers, DenyingTargets: deniers}, nil
 }
 
 func (p *Policy) Simplify() {
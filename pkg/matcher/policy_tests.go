@@ -24,11 +24,12 @@ spec:
   - Ingress`
 	allowAllOnSCTPSerializedPolicy, err := utils.ParseYaml[networkingv1.NetworkPolicy]([]byte(allowAllOnSCTPSerializedYaml))
 	utils.DoOrDie(err)
-	allowAllOnSCTP := BuildNetworkPolicies(true, []*networkingv1.NetworkPolicy{allowAllOnSCTPSerializedPolicy})
+	allowAllOnSCTP, err := BuildNetworkPolicies(true, []*networkingv1.NetworkPolicy{allowAllOnSCTPSerializedPolicy})
+	utils.DoOrDie(err)
 
 	Describe("Allowing a protocol should implicitly deny other protocols from pods", func() {
 		It("should not allow TCP", func() {
-			tcpAllowed := allowAllOnSCTP.IsTrafficAllowed(&Traffic{
+			tcpAllowed, err := allowAllOnSCTP.IsTrafficAllowed(&Traffic{
 				Source: &TrafficPeer{
 					Internal: &InternalPeer{
 						PodLabels:       nil,
@@ -49,11 +50,12 @@ spec:
 				//ResolvedPortName: "port-hello",
 				Protocol: v1.ProtocolTCP,
 			})
+			Expect(err).To(BeNil())
 			Expect(tcpAllowed.IsAllowed()).To(BeFalse())
 		})
 
 		It("should allow SCTP", func() {
-			sctpAllowed := allowAllOnSCTP.IsTrafficAllowed(&Traffic{
+			sctpAllowed, err := allowAllOnSCTP.IsTrafficAllowed(&Traffic{
 				Source: &TrafficPeer{
 					Internal: &InternalPeer{
 						PodLabels:       nil,
@@ -74,13 +76,14 @@ spec:
 				//ResolvedPortName: "port-hello",
 				Protocol: v1.ProtocolSCTP,
 			})
+			Expect(err).To(BeNil())
 			Expect(sctpAllowed.IsAllowed()).To(BeTrue())
 		})
 	})
 
 	Describe("Allowing a protocol should implicitly deny other protocols from ips", func() {
 		It("should not allow TCP", func() {
-			tcpAllowed := allowAllOnSCTP.IsTrafficAllowed(&Traffic{
+			tcpAllowed, err := allowAllOnSCTP.IsTrafficAllowed(&Traffic{
 				Source: &TrafficPeer{
 					Internal: nil,
 					IP:       "1.2.3.4",
@@ -97,11 +100,12 @@ spec:
 				//ResolvedPortName: "port-hello",
 				Protocol: v1.ProtocolTCP,
 			})
+			Expect(err).To(BeNil())
 			Expect(tcpAllowed.IsAllowed()).To(BeFalse())
 		})
 
 		It("should allow SCTP", func() {
-			sctpAllowed := allowAllOnSCTP.IsTrafficAllowed(&Traffic{
+			sctpAllowed, err := allowAllOnSCTP.IsTrafficAllowed(&Traffic{
 				Source: &TrafficPeer{
 					Internal: nil,
 					IP:       "1.2.3.4",
@@ -118,6 +122,7 @@ spec:
 				//ResolvedPortName: "port-hello",
 				Protocol: v1.ProtocolSCTP,
 			})
+			Expect(err).To(BeNil())
 			Expect(sctpAllowed.IsAllowed()).To(BeTrue())
 		})
 	})
@@ -149,10 +154,11 @@ spec:
   - Egress`
 		kubePolicy, err := utils.ParseYaml[networkingv1.NetworkPolicy]([]byte(policyYaml))
 		utils.DoOrDie(err)
-		policy := BuildNetworkPolicies(true, []*networkingv1.NetworkPolicy{kubePolicy})
+		policy, err := BuildNetworkPolicies(true, []*networkingv1.NetworkPolicy{kubePolicy})
+		utils.DoOrDie(err)
 
 		It("Should allow ips in cidr", func() {
-			Expect(policy.IsTrafficAllowed(&Traffic{
+			allowed, err := policy.IsTrafficAllowed(&Traffic{
 				Source: &TrafficPeer{
 					Internal: &InternalPeer{
 						PodLabels:       map[string]string{"pod": "a"},
@@ -172,7 +178,9 @@ spec:
 				ResolvedPort: 80,
 				//ResolvedPortName: "port-hello",
 				Protocol: v1.ProtocolTCP,
-			}).IsAllowed()).To(BeTrue())
+			})
+			Expect(err).To(BeNil())
+			Expect(allowed.IsAllowed()).To(BeTrue())
 		})
 	})
 
@@ -195,10 +203,11 @@ spec:
   - Ingress`
 		kubePolicy, err := utils.ParseYaml[networkingv1.NetworkPolicy]([]byte(policyYaml))
 		utils.DoOrDie(err)
-		policy := BuildNetworkPolicies(true, []*networkingv1.NetworkPolicy{kubePolicy})
+		policy, err := BuildNetworkPolicies(true, []*networkingv1.NetworkPolicy{kubePolicy})
+		utils.DoOrDie(err)
 
 		It("Should allow access to named port", func() {
-			Expect(policy.IsTrafficAllowed(&Traffic{
+			allowed, err := policy.IsTrafficAllowed(&Traffic{
 				Source: &TrafficPeer{
 					IP: "1.2.3.4",
 				},
@@ -213,7 +222,9 @@ spec:
 				//ResolvedPort: 0, // TODO
 				ResolvedPortName: "port-hello",
 				Protocol:         v1.ProtocolTCP,
-			}).IsAllowed()).To(BeTrue())
+			})
+			Expect(err).To(BeNil())
+			Expect(allowed.IsAllowed()).To(BeTrue())
 		})
 	})
 }
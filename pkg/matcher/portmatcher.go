@@ -5,19 +5,20 @@ import (
 	"sort"
 
 	collectionsjson "github.com/mattfenwick/collections/pkg/json"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 type PortMatcher interface {
-	Allows(portInt int, portName string, protocol v1.Protocol) bool
+	Allows(portInt int, portName string, protocol v1.Protocol) (bool, error)
 }
 
 type AllPortMatcher struct{}
 
-func (ap *AllPortMatcher) Allows(portInt int, portName string, protocol v1.Protocol) bool {
-	return true
+func (ap *AllPortMatcher) Allows(portInt int, portName string, protocol v1.Protocol) (bool, error) {
+	return true, nil
 }
 
 func (ap *AllPortMatcher) MarshalJSON() (b []byte, e error) {
@@ -34,11 +35,14 @@ type PortProtocolMatcher struct {
 }
 
 // AllowsPortProtocol does not implement the PortMatcher interface, purposely!
-func (p *PortProtocolMatcher) AllowsPortProtocol(portInt int, portName string, protocol v1.Protocol) bool {
+func (p *PortProtocolMatcher) AllowsPortProtocol(portInt int, portName string, protocol v1.Protocol) (bool, error) {
+	if p.Protocol != protocol {
+		return false, nil
+	}
 	if p.Port != nil {
-		return isPortMatch(*p.Port, portInt, portName) && p.Protocol == protocol
+		return isPortMatch(*p.Port, portInt, portName)
 	}
-	return p.Protocol == protocol
+	return true, nil
 }
 
 func (p *PortProtocolMatcher) Equals(other *PortProtocolMatcher) bool {
@@ -80,18 +84,22 @@ type SpecificPortMatcher struct {
 	PortRanges []*PortRangeMatcher
 }
 
-func (s *SpecificPortMatcher) Allows(portInt int, portName string, protocol v1.Protocol) bool {
+func (s *SpecificPortMatcher) Allows(portInt int, portName string, protocol v1.Protocol) (bool, error) {
 	for _, matcher := range s.Ports {
-		if matcher.AllowsPortProtocol(portInt, portName, protocol) {
-			return true
+		isMatch, err := matcher.AllowsPortProtocol(portInt, portName, protocol)
+		if err != nil {
+			return false, err
+		}
+		if isMatch {
+			return true, nil
 		}
 	}
 	for _, matcher := range s.PortRanges {
 		if matcher.AllowsPortProtocol(portInt, protocol) {
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 func (s *SpecificPortMatcher) MarshalJSON() (b []byte, e error) {
@@ -198,14 +206,14 @@ func isPortLessThan(a *intstr.IntOrString, b *intstr.IntOrString) bool {
 	}
 }
 
-func isPortMatch(a intstr.IntOrString, portInt int, portName string) bool {
+func isPortMatch(a intstr.IntOrString, portInt int, portName string) (bool, error) {
 	switch a.Type {
 	case intstr.Int:
-		return int(a.IntVal) == portInt
+		return int(a.IntVal) == portInt, nil
 	case intstr.String:
-		return a.StrVal == portName
+		return a.StrVal == portName, nil
 	default:
-		panic("invalid type")
+		return false, errors.Errorf("invalid IntOrString type %d", a.Type)
 	}
 }
 
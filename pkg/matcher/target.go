@@ -22,17 +22,24 @@ func (t *Target) String() string {
 	return t.GetPrimaryKey()
 }
 
-func (t *Target) IsMatch(namespace string, podLabels map[string]string) bool {
-	return t.Namespace == namespace && kube.IsLabelsMatchLabelSelector(podLabels, t.PodSelector)
+func (t *Target) IsMatch(namespace string, podLabels map[string]string) (bool, error) {
+	if t.Namespace != namespace {
+		return false, nil
+	}
+	return kube.IsLabelsMatchLabelSelector(podLabels, t.PodSelector)
 }
 
-func (t *Target) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) bool {
+func (t *Target) Allows(peer *TrafficPeer, portInt int, portName string, protocol v1.Protocol) (bool, error) {
 	for _, peerMatcher := range t.Peers {
-		if peerMatcher.Allows(peer, portInt, portName, protocol) {
-			return true
+		isAllowed, err := peerMatcher.Allows(peer, portInt, portName, protocol)
+		if err != nil {
+			return false, err
+		}
+		if isAllowed {
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 // Combine creates a new Target combining the egress and ingress rules
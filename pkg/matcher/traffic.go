@@ -54,9 +54,11 @@ func labelsToString(labels map[string]string) string {
 	return strings.Join(slice.Map(format, slice.Sort(maps.Keys(labels))), "\n")
 }
 
+// TrafficPeer's IP is the address used by this traffic; for dual-stack peers, IPs holds one address per ip family
 type TrafficPeer struct {
 	Internal *InternalPeer
 	IP       string
+	IPs      []string
 }
 
 func (p *TrafficPeer) Namespace() string {
@@ -28,9 +28,22 @@ func (r *Recipe) Policies() []*networkingv1.NetworkPolicy {
 	return policies
 }
 
+func (r *Recipe) ParsedPolicies() *matcher.Policy {
+	policies, err := matcher.BuildNetworkPolicies(true, r.Policies())
+	utils.DoOrDie(err)
+	return policies
+}
+
+// SimulatedResources assigns simulated ips to the recipe's pods, so that ipblock rules can be evaluated
+func (r *Recipe) SimulatedResources() *probe.Resources {
+	resources, err := r.Resources.AssignIPs(probe.NewDefaultIPAM())
+	utils.DoOrDie(err)
+	return resources
+}
+
 func (r *Recipe) RunProbe() *probe.Table {
-	runner := probe.NewSimulatedRunner(matcher.BuildNetworkPolicies(true, r.Policies()), &probe.JobBuilder{TimeoutSeconds: 5})
-	return runner.RunProbeForConfig(generator.NewProbeConfig(intstr.FromInt(r.Port), r.Protocol, generator.ProbeModeServiceName), r.Resources)
+	runner := probe.NewSimulatedRunner(r.ParsedPolicies(), &probe.JobBuilder{TimeoutSeconds: 5})
+	return runner.RunProbeForConfig(generator.NewProbeConfig(intstr.FromInt(r.Port), r.Protocol, generator.ProbeModeServiceName), r.SimulatedResources())
 }
 
 var AllRecipes = []*Recipe{
@@ -55,9 +68,9 @@ func Run() {
 	for _, recipe := range AllRecipes {
 		table := recipe.RunProbe()
 
-		fmt.Printf("Policies:\n%s\n", matcher.BuildNetworkPolicies(true, recipe.Policies()).ExplainTable())
+		fmt.Printf("Policies:\n%s\n", recipe.ParsedPolicies().ExplainTable())
 
-		fmt.Printf("resources:\n%s\n", recipe.Resources.RenderTable())
+		fmt.Printf("resources:\n%s\n", recipe.SimulatedResources().RenderTable())
 
 		fmt.Printf("Results:\n%s\n", table.RenderTable())
 
@@ -0,0 +1,222 @@
+package worker
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	"github.com/mattfenwick/cyclonus/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	agentHealthTimeout      = 30 * time.Second
+	agentHealthPollInterval = 1 * time.Second
+)
+
+// HTTPClient talks to a single agent
+type HTTPClient struct {
+	Resty *resty.Client
+}
+
+func NewHTTPClient(host string, port int) *HTTPClient {
+	return &HTTPClient{Resty: resty.New().
+		SetBaseURL("http://" + net.JoinHostPort(host, strconv.Itoa(port))).
+		SetTimeout(60 * time.Second)}
+}
+
+func (c *HTTPClient) Batch(b *Batch) ([]*Result, error) {
+	var results []*Result
+	_, err := utils.IssueRequest(c.Resty, "POST", "/batch", b, &results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(b.Requests) {
+		return results, errors.Errorf("expected %d results, but got only %d", len(b.Requests), len(results))
+	}
+	return results, nil
+}
+
+func (c *HTTPClient) Health() error {
+	_, err := utils.IssueRequest(c.Resty, "GET", "/healthz", nil, nil)
+	return err
+}
+
+type AgentAccess string
+
+const (
+	// AgentAccessPortForward reaches agents through the kube apiserver, so that network policies can't block
+	// the traffic
+	AgentAccessPortForward AgentAccess = "port-forward"
+	// AgentAccessPodIP reaches agents directly, which requires network access to pod ips -- and is subject to
+	// network policies
+	AgentAccessPodIP AgentAccess = "pod-ip"
+)
+
+var AllAgentAccesses = []AgentAccess{
+	AgentAccessPortForward,
+	AgentAccessPodIP,
+}
+
+// AgentClient sends each batch to the agent in the batch's pod, setting up -- and caching -- a connection to
+// each agent on first use
+type AgentClient struct {
+	Kubernetes kube.IKubernetes
+	Access     AgentAccess
+	Port       int
+
+	// mutex only guards the map, so that a slow connection to one agent doesn't hold up batches to the others
+	mutex   *sync.Mutex
+	clients map[string]*agentEntry
+}
+
+// agentEntry is a pod's connection, which is set up once, by the first batch for the pod
+type agentEntry struct {
+	once sync.Once
+	conn *agentConnection
+	err  error
+}
+
+// close waits for the connection to be set up, if that's in progress, and then tears it down
+func (e *agentEntry) close() {
+	e.once.Do(func() {
+		e.err = errors.Errorf("connection closed")
+	})
+	if e.conn != nil && e.conn.stop != nil {
+		e.conn.stop()
+	}
+}
+
+type agentConnection struct {
+	client *HTTPClient
+	stop   func()
+}
+
+// awaitHealthy gives a newly-started agent time to come up: pods are considered ready once they're running,
+// which may be before the agent serves
+func (c *agentConnection) awaitHealthy() error {
+	deadline := time.Now().Add(agentHealthTimeout)
+	for {
+		err := c.client.Health()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(agentHealthPollInterval)
+	}
+}
+
+func NewAgentClient(kubernetes kube.IKubernetes, access AgentAccess, port int) *AgentClient {
+	return &AgentClient{
+		Kubernetes: kubernetes,
+		Access:     access,
+		Port:       port,
+		mutex:      &sync.Mutex{},
+		clients:    map[string]*agentEntry{},
+	}
+}
+
+// Batch sends the batch to its pod's agent.  Pods may be deleted and recreated during a test, so on failure
+// the connection is discarded and the batch retried once over a new connection.
+func (a *AgentClient) Batch(b *Batch) ([]*Result, error) {
+	key := fmt.Sprintf("%s/%s", b.Namespace, b.Pod)
+	entry, err := a.connection(key, b.Namespace, b.Pod)
+	if err == nil {
+		var results []*Result
+		results, err = entry.conn.client.Batch(b)
+		if err == nil {
+			return results, nil
+		}
+		// other batches may be using the connection too: only the first of them to fail discards it
+		if a.forget(key, entry) {
+			entry.close()
+		}
+	}
+	logrus.Debugf("unable to issue batch %s to agent, reconnecting: %+v", b.Key(), err)
+
+	entry, err = a.connection(key, b.Namespace, b.Pod)
+	if err != nil {
+		return nil, err
+	}
+	return entry.conn.client.Batch(b)
+}
+
+// Close tears down every connection
+func (a *AgentClient) Close() {
+	a.mutex.Lock()
+	entries := a.clients
+	a.clients = map[string]*agentEntry{}
+	a.mutex.Unlock()
+	for _, entry := range entries {
+		entry.close()
+	}
+}
+
+// connection returns the pod's connection, setting it up if this is the first batch for the pod.  The lock is
+// only held to find the pod's entry: batches for other pods can go ahead while the connection is set up.
+func (a *AgentClient) connection(key string, namespace string, pod string) (*agentEntry, error) {
+	a.mutex.Lock()
+	entry, ok := a.clients[key]
+	if !ok {
+		entry = &agentEntry{}
+		a.clients[key] = entry
+	}
+	a.mutex.Unlock()
+
+	entry.once.Do(func() {
+		entry.conn, entry.err = a.connect(namespace, pod)
+	})
+	if entry.err != nil {
+		// forget the failed connection, so that the next batch tries again
+		a.forget(key, entry)
+		return nil, entry.err
+	}
+	return entry, nil
+}
+
+// forget removes the entry, unless it's already been replaced; it returns whether the entry was removed
+func (a *AgentClient) forget(key string, entry *agentEntry) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.clients[key] != entry {
+		return false
+	}
+	delete(a.clients, key)
+	return true
+}
+
+func (a *AgentClient) connect(namespace string, pod string) (*agentConnection, error) {
+	conn := &agentConnection{}
+	switch a.Access {
+	case AgentAccessPortForward:
+		localPort, stop, err := a.Kubernetes.PortForward(namespace, pod, a.Port)
+		if err != nil {
+			return nil, err
+		}
+		conn.client, conn.stop = NewHTTPClient("localhost", localPort), stop
+	case AgentAccessPodIP:
+		kubePod, err := a.Kubernetes.GetPod(namespace, pod)
+		if err != nil {
+			return nil, err
+		}
+		if kubePod.Status.PodIP == "" {
+			return nil, errors.Errorf("pod %s/%s has no ip", namespace, pod)
+		}
+		conn.client = NewHTTPClient(kubePod.Status.PodIP, a.Port)
+	default:
+		return nil, errors.Errorf("invalid agent access %s", a.Access)
+	}
+
+	if err := conn.awaitHealthy(); err != nil {
+		if conn.stop != nil {
+			conn.stop()
+		}
+		return nil, errors.WithMessagef(err, "agent in %s/%s is not healthy", namespace, pod)
+	}
+	logrus.Debugf("connected to agent in %s/%s via %s", namespace, pod, a.Access)
+	return conn, nil
+}
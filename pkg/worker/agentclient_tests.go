@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mattfenwick/cyclonus/pkg/kube"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// portForwardingKube forwards to agents served by the test, taking `delays[pod]` to set up each port-forward
+type portForwardingKube struct {
+	kube.IKubernetes
+	port   int
+	delays map[string]time.Duration
+
+	mutex   sync.Mutex
+	stopped int
+}
+
+func (k *portForwardingKube) PortForward(namespace string, pod string, port int) (int, func(), error) {
+	time.Sleep(k.delays[pod])
+	return k.port, func() {
+		k.mutex.Lock()
+		defer k.mutex.Unlock()
+		k.stopped++
+	}, nil
+}
+
+func (k *portForwardingKube) stops() int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.stopped
+}
+
+func RunAgentClientTests() {
+	Describe("AgentClient", func() {
+		It("Should connect to agents independently, and tear down connections on close", func() {
+			server := httptest.NewServer(NewServeMux(1))
+			defer server.Close()
+			serverURL, err := url.Parse(server.URL)
+			Expect(err).To(Succeed())
+			_, portString, err := net.SplitHostPort(serverURL.Host)
+			Expect(err).To(Succeed())
+			port, err := strconv.Atoi(portString)
+			Expect(err).To(Succeed())
+
+			kubernetes := &portForwardingKube{port: port, delays: map[string]time.Duration{"slow": 500 * time.Millisecond}}
+			client := NewAgentClient(kubernetes, AgentAccessPortForward, DefaultPort)
+
+			slowDone := make(chan error)
+			go func() {
+				_, err := client.Batch(&Batch{Namespace: "x", Pod: "slow"})
+				slowDone <- err
+			}()
+			time.Sleep(50 * time.Millisecond)
+
+			// the slow pod's connection doesn't hold up the fast pod's
+			start := time.Now()
+			_, err = client.Batch(&Batch{Namespace: "x", Pod: "fast"})
+			Expect(err).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("<", 400*time.Millisecond))
+
+			Expect(<-slowDone).To(Succeed())
+			// connections are reused
+			_, err = client.Batch(&Batch{Namespace: "x", Pod: "fast"})
+			Expect(err).To(Succeed())
+
+			Expect(kubernetes.stops()).To(Equal(0))
+			client.Close()
+			Expect(kubernetes.stops()).To(Equal(2))
+		})
+	})
+}
@@ -3,11 +3,13 @@ package worker
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/mattfenwick/cyclonus/pkg/utils"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
 )
 
 func Run() {
@@ -28,7 +30,7 @@ func SetupRootCommand() *cobra.Command {
 	args := &Args{}
 	command := &cobra.Command{
 		Use:   "cyclonus-worker",
-		Short: "thin wrapper around 'agnhost connect' for issuing batches of connectivity requests",
+		Short: "issue batches of connectivity requests from within a pod",
 		Run: func(cmd *cobra.Command, as []string) {
 			RunWorkerCommand(args)
 		},
@@ -41,6 +43,10 @@ func SetupRootCommand() *cobra.Command {
 	command.Flags().StringVar(&args.Jobs, "jobs", "", "JSON-formatted string of jobs")
 	utils.DoOrDie(command.MarkFlagRequired("jobs"))
 
+	command.AddCommand(SetupEchoServerCommand())
+	command.AddCommand(SetupHoldCommand())
+	command.AddCommand(SetupServeCommand())
+
 	return command
 }
 
@@ -51,3 +57,70 @@ func RunWorkerCommand(args *Args) {
 	utils.DoOrDie(err)
 	fmt.Printf("%s\n", out)
 }
+
+type EchoServerArgs struct {
+	Protocol string
+	Port     int
+}
+
+func SetupEchoServerCommand() *cobra.Command {
+	args := &EchoServerArgs{}
+	command := &cobra.Command{
+		Use:   "echo-server",
+		Short: "serve echo on a port and protocol, holding connections open",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, as []string) {
+			utils.DoOrDie(ServeEcho(v1.Protocol(strings.ToUpper(args.Protocol)), args.Port))
+		},
+	}
+
+	command.Flags().StringVar(&args.Protocol, "protocol", "tcp", "protocol to serve on")
+	command.Flags().IntVar(&args.Port, "port", 80, "port to serve on")
+
+	return command
+}
+
+type HoldArgs struct {
+	Jobs string
+}
+
+func SetupHoldCommand() *cobra.Command {
+	args := &HoldArgs{}
+	command := &cobra.Command{
+		Use:   "hold",
+		Short: "open long-lived connections and ping them periodically, then report what happened to them",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, as []string) {
+			out, err := RunHold(args.Jobs)
+			utils.DoOrDie(err)
+			fmt.Printf("%s\n", out)
+		},
+	}
+
+	command.Flags().StringVar(&args.Jobs, "jobs", "", "JSON-formatted hold batch")
+	utils.DoOrDie(command.MarkFlagRequired("jobs"))
+
+	return command
+}
+
+type ServeArgs struct {
+	Port        int
+	Concurrency int
+}
+
+func SetupServeCommand() *cobra.Command {
+	args := &ServeArgs{}
+	command := &cobra.Command{
+		Use:   "serve",
+		Short: "run as a long-lived agent, issuing batches of connectivity requests received over http",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, as []string) {
+			utils.DoOrDie(Serve(args.Port, args.Concurrency))
+		},
+	}
+
+	command.Flags().IntVar(&args.Port, "port", DefaultPort, "port to serve on")
+	command.Flags().IntVar(&args.Concurrency, "concurrency", 10, "number of jobs to simultaneously run, per batch")
+
+	return command
+}
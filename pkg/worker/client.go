@@ -8,6 +8,12 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// BatchClient issues batches of requests from within the batch's pod
+type BatchClient interface {
+	Batch(b *Batch) ([]*Result, error)
+}
+
+// Client runs the worker by exec'ing into the batch's container
 type Client struct {
 	Kubernetes kube.IKubernetes
 }
@@ -41,25 +47,32 @@ func (c *Client) Batch(b *Batch) ([]*Result, error) {
 	return results, nil
 }
 
-/*
-type Client struct {
-	Resty *resty.Client
-}
+// Hold runs the batch, and so blocks for at least the batch's duration
+func (c *Client) Hold(b *HoldBatch) ([]*HoldResult, error) {
+	bytes, err := json.Marshal(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to marshal json")
+	}
+	command := []string{"/worker", "hold", "--jobs", string(bytes)}
+	logrus.Infof("issuing %s hold command with %d connections for %s", b.Key(), len(b.Requests), b.Duration)
+	stdout, stderr, commandErr, err := c.Kubernetes.ExecuteRemoteCommand(b.Namespace, b.Pod, b.Container, command)
+	logrus.Tracef("%s hold stdout:\n%s\nhold stderr:\n%s\n", b.Key(), stdout, stderr)
 
-func NewDefaultClient(host string) *Client {
-	return NewClient(host, DefaultPort)
-}
+	if err != nil {
+		return nil, err
+	} else if commandErr != nil {
+		return nil, errors.WithMessagef(commandErr, "hold command failed: %s", stderr)
+	}
 
-func NewClient(host string, port int) *Client {
-	return &Client{Resty: resty.New().
-		SetHostURL(net.JoinHostPort(host, strconv.Itoa(port))).
-		//SetDebug(false).
-		SetTimeout(30 * time.Second)}
-}
+	var results []*HoldResult
+	err = json.Unmarshal([]byte(stdout), &results)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal json")
+	}
 
-func (c *Client) Batch(b *Batch) ([]*Result, error) {
-	var results []*Result
-	_, err := utils.IssueRequest(c.Resty, "POST", "/batch", b, &results)
-	return results, err
+	if len(results) != len(b.Requests) {
+		return results, errors.Errorf("expected %d results, but got only %d", len(b.Requests), len(results))
+	}
+
+	return results, nil
 }
-*/
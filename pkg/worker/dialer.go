@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultRequestTimeout = 1 * time.Second
+	// udpProbeMessage is answered both by agnhost's udp server -- which replies to anything with its
+	// hostname -- and by the worker's echo server
+	udpProbeMessage = "hostname"
+)
+
+// ErrorType classifies a failed connection attempt
+type ErrorType string
+
+const (
+	ErrorTypeNone ErrorType = ""
+	// ErrorTypeTimeout means no response to a tcp or sctp connection attempt: packets were dropped
+	ErrorTypeTimeout ErrorType = "timeout"
+	// ErrorTypeNoReply means a udp datagram was sent, but nothing came back: packets were dropped
+	ErrorTypeNoReply ErrorType = "no-reply"
+	// ErrorTypeRefused means the attempt was actively rejected: a tcp reset, an sctp abort, or an icmp port
+	// unreachable in response to a udp datagram
+	ErrorTypeRefused ErrorType = "refused"
+	// ErrorTypeUnreachable means an icmp host or network unreachable came back, which some CNIs use to
+	// reject traffic
+	ErrorTypeUnreachable ErrorType = "unreachable"
+	ErrorTypeDNS         ErrorType = "dns"
+	ErrorTypeUnknown     ErrorType = "unknown"
+)
+
+// ClassifyError determines the ErrorType of a failed dial, read or write
+func ClassifyError(err error) ErrorType {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ErrorTypeNone
+	case errors.As(err, &dnsErr):
+		return ErrorTypeDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorTypeRefused
+	case errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH):
+		return ErrorTypeUnreachable
+	case errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return ErrorTypeTimeout
+	default:
+		return ErrorTypeUnknown
+	}
+}
+
+// Dial makes a connection attempt from within the pod, without shelling out: a tcp or sctp attempt succeeds
+// once the connection is established, and a udp attempt once a reply to a datagram comes back.
+func Dial(r *Request) *Result {
+	result := &Result{Request: r}
+	start := time.Now()
+	deadline := start.Add(r.GetTimeout())
+	fail := func(errorType ErrorType, err error) *Result {
+		result.Latency = time.Since(start)
+		result.ErrorType = errorType
+		result.Error = err.Error()
+		return result
+	}
+
+	// 1. resolve
+	ip, err := resolve(r.Host, deadline)
+	result.ResolveDuration = time.Since(start)
+	if err != nil {
+		return fail(ErrorTypeDNS, err)
+	}
+	address := net.JoinHostPort(ip, strconv.Itoa(r.Port))
+
+	// 2. connect
+	connectStart := time.Now()
+	conn, err := dial(r.Protocol, address, time.Until(deadline))
+	result.ConnectDuration = time.Since(connectStart)
+	if err != nil {
+		return fail(ClassifyError(err), errors.WithMessagef(err, "%s connect to %s", r.Protocol, address))
+	}
+	defer conn.Close()
+
+	// 3. udp isn't connection-oriented: wait for a reply
+	if r.Protocol == v1.ProtocolUDP {
+		replyStart := time.Now()
+		reply, err := exchangeDatagram(conn, deadline)
+		result.ReplyDuration = time.Since(replyStart)
+		if err != nil {
+			errorType := ClassifyError(err)
+			if errorType == ErrorTypeTimeout {
+				errorType = ErrorTypeNoReply
+			}
+			return fail(errorType, errors.WithMessagef(err, "no reply from %s", address))
+		}
+		result.Output = reply
+	}
+
+	result.Latency = time.Since(start)
+	return result
+}
+
+// resolve returns the host if it's an ip, or else its first address
+func resolve(host string, deadline time.Time) (string, error) {
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to resolve %s", host)
+	} else if len(addresses) == 0 {
+		return "", errors.WithStack(&net.DNSError{Err: "no addresses found", Name: host})
+	}
+	return addresses[0], nil
+}
+
+// exchangeDatagram sends a datagram and waits for a reply.  Since the socket is connected, an icmp port
+// unreachable in response fails the read with 'connection refused', rather than leaving it to time out.
+func exchangeDatagram(conn net.Conn, deadline time.Time) (string, error) {
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", errors.Wrapf(err, "unable to set deadline")
+	}
+	if _, err := conn.Write([]byte(udpProbeMessage)); err != nil {
+		return "", errors.Wrapf(err, "unable to write")
+	}
+	buffer := make([]byte, 1024)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to read")
+	}
+	return string(buffer[:n]), nil
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"net"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+// unusedPort finds a port with nothing listening on it
+func unusedPort(network string) int {
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).To(Succeed())
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).Port
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(Succeed())
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// serveUDP replies to each datagram with `reply`, or -- if `reply` is empty -- ignores them
+func serveUDP(reply string) (int, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).To(Succeed())
+	go func() {
+		buffer := make([]byte, 1024)
+		for {
+			_, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			if reply != "" {
+				_, _ = conn.WriteTo([]byte(reply), addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port, func() { _ = conn.Close() }
+}
+
+func RunDialerTests() {
+	Describe("Dialer", func() {
+		It("Should connect over tcp", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).To(Succeed())
+			defer listener.Close()
+
+			result := Dial(&Request{Protocol: v1.ProtocolTCP, Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port})
+			Expect(result.Error).To(Equal(""))
+			Expect(result.ErrorType).To(Equal(ErrorTypeNone))
+			Expect(result.IsSuccess()).To(BeTrue())
+			Expect(result.Latency).To(BeNumerically(">=", result.ConnectDuration))
+		})
+
+		It("Should report refused tcp connections", func() {
+			result := Dial(&Request{Protocol: v1.ProtocolTCP, Host: "127.0.0.1", Port: unusedPort("tcp")})
+			Expect(result.IsSuccess()).To(BeFalse())
+			Expect(result.ErrorType).To(Equal(ErrorTypeRefused))
+			Expect(result.Error).To(ContainSubstring("connection refused"))
+		})
+
+		It("Should get a udp reply", func() {
+			port, stop := serveUDP("server-hostname")
+			defer stop()
+
+			result := Dial(&Request{Protocol: v1.ProtocolUDP, Host: "127.0.0.1", Port: port})
+			Expect(result.Error).To(Equal(""))
+			Expect(result.Output).To(Equal("server-hostname"))
+			Expect(result.Latency).To(BeNumerically(">=", result.ReplyDuration))
+		})
+
+		It("Should tell udp without a reply apart from udp refused by icmp", func() {
+			port, stop := serveUDP("")
+			defer stop()
+
+			noReply := Dial(&Request{Protocol: v1.ProtocolUDP, Host: "127.0.0.1", Port: port, Timeout: 200 * time.Millisecond})
+			Expect(noReply.ErrorType).To(Equal(ErrorTypeNoReply))
+			Expect(noReply.ReplyDuration).To(BeNumerically(">=", 150*time.Millisecond))
+
+			refused := Dial(&Request{Protocol: v1.ProtocolUDP, Host: "127.0.0.1", Port: unusedPort("udp"), Timeout: 2 * time.Second})
+			Expect(refused.ErrorType).To(Equal(ErrorTypeRefused))
+			Expect(refused.Latency).To(BeNumerically("<", 2*time.Second))
+		})
+
+		It("Should report dns failures", func() {
+			result := Dial(&Request{Protocol: v1.ProtocolTCP, Host: "cyclonus-worker-test.invalid", Port: 80})
+			Expect(result.ErrorType).To(Equal(ErrorTypeDNS))
+		})
+
+		It("Should report unsupported protocols", func() {
+			result := Dial(&Request{Protocol: "ICMP", Host: "127.0.0.1", Port: 80})
+			Expect(result.ErrorType).To(Equal(ErrorTypeUnknown))
+		})
+
+		It("Should default the timeout", func() {
+			Expect((&Request{}).GetTimeout()).To(Equal(defaultRequestTimeout))
+			Expect((&Request{Timeout: 3 * time.Second}).GetTimeout()).To(Equal(3 * time.Second))
+		})
+
+		It("Should classify wrapped errors", func() {
+			Expect(ClassifyError(nil)).To(Equal(ErrorTypeNone))
+			Expect(ClassifyError(errors.Wrapf(os.ErrDeadlineExceeded, "connect"))).To(Equal(ErrorTypeTimeout))
+			Expect(ClassifyError(errors.Errorf("something else"))).To(Equal(ErrorTypeUnknown))
+		})
+	})
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+)
+
+// ServeEcho echoes back everything it receives, holding connections open until the client closes them;
+// unlike agnhost's servers, this allows long-lived connections to be tested.
+func ServeEcho(protocol v1.Protocol, port int) error {
+	address := net.JoinHostPort("", strconv.Itoa(port))
+	switch protocol {
+	case v1.ProtocolTCP:
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return errors.Wrapf(err, "unable to listen on tcp %s", address)
+		}
+		return serveEchoStream(listener)
+	case v1.ProtocolSCTP:
+		listener, err := listenSCTP(port)
+		if err != nil {
+			return err
+		}
+		return serveEchoStream(listener)
+	case v1.ProtocolUDP:
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return errors.Wrapf(err, "unable to listen on udp %s", address)
+		}
+		return serveEchoPackets(conn)
+	default:
+		return errors.Errorf("protocol %s not supported", protocol)
+	}
+}
+
+func serveEchoStream(listener net.Listener) error {
+	logrus.Infof("serving echo on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return errors.Wrapf(err, "unable to accept connection")
+		}
+		go func() {
+			defer conn.Close()
+			if _, err := io.Copy(conn, conn); err != nil {
+				logrus.Debugf("connection from %s closed: %+v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func serveEchoPackets(conn net.PacketConn) error {
+	logrus.Infof("serving echo on %s", conn.LocalAddr())
+	buffer := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read packet")
+		}
+		if _, err := conn.WriteTo(buffer[:n], addr); err != nil {
+			logrus.Debugf("unable to write packet to %s: %+v", addr, err)
+		}
+	}
+}
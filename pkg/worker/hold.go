@@ -0,0 +1,146 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+// HoldBatch is a set of connections, from a single container, which are opened and then pinged
+// every Interval until Duration has passed
+type HoldBatch struct {
+	Namespace string
+	Pod       string
+	Container string
+	Requests  []*Request
+	Duration  time.Duration
+	Interval  time.Duration
+}
+
+func (b *HoldBatch) Key() string {
+	return fmt.Sprintf("%s/%s/%s", b.Namespace, b.Pod, b.Container)
+}
+
+// Ping is the outcome of one round trip over a held connection; Elapsed is measured from the start of the batch
+type Ping struct {
+	Elapsed time.Duration
+	Error   string
+}
+
+type HoldResult struct {
+	Request *Request
+	// Error is set if the connection couldn't be established
+	Error string
+	Pings []*Ping
+}
+
+func (r *HoldResult) IsEstablished() bool {
+	return r.Error == ""
+}
+
+// FirstFailedPing returns the earliest failed ping, or nil if every ping succeeded
+func (r *HoldResult) FirstFailedPing() *Ping {
+	for _, ping := range r.Pings {
+		if ping.Error != "" {
+			return ping
+		}
+	}
+	return nil
+}
+
+func RunHold(jobs string) (string, error) {
+	var batch HoldBatch
+	err := json.Unmarshal([]byte(jobs), &batch)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to unmarshal json from '%s'", jobs)
+	}
+	for _, r := range batch.Requests {
+		if !protocols[r.Protocol] {
+			return "", errors.Errorf("invalid protocol %+v", r)
+		}
+	}
+
+	jsonBytes, err := json.MarshalIndent(HoldConnections(&batch), "", "  ")
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to marshal json")
+	}
+	return string(jsonBytes), nil
+}
+
+// HoldConnections opens all the batch's connections concurrently, and pings each of them until the batch's duration has passed
+func HoldConnections(batch *HoldBatch) []*HoldResult {
+	start := time.Now()
+	results := make([]*HoldResult, len(batch.Requests))
+	wg := &sync.WaitGroup{}
+	for i, request := range batch.Requests {
+		wg.Add(1)
+		go func(i int, request *Request) {
+			defer wg.Done()
+			results[i] = holdConnection(request, start, batch.Duration, batch.Interval)
+		}(i, request)
+	}
+	wg.Wait()
+	return results
+}
+
+func holdConnection(request *Request, start time.Time, duration time.Duration, interval time.Duration) *HoldResult {
+	result := &HoldResult{Request: request}
+	conn, err := dial(request.Protocol, request.Address(), interval)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	buffer := make([]byte, 64)
+	for i := 0; time.Since(start) < duration; i++ {
+		pingStart := time.Now()
+		ping := &Ping{Elapsed: pingStart.Sub(start)}
+		if err := echo(conn, []byte(fmt.Sprintf("ping-%08d", i)), buffer, interval); err != nil {
+			ping.Error = err.Error()
+		}
+		result.Pings = append(result.Pings, ping)
+		time.Sleep(interval - time.Since(pingStart))
+	}
+	return result
+}
+
+func dial(protocol v1.Protocol, address string, timeout time.Duration) (net.Conn, error) {
+	switch protocol {
+	case v1.ProtocolTCP:
+		return net.DialTimeout("tcp", address, timeout)
+	case v1.ProtocolUDP:
+		return net.DialTimeout("udp", address, timeout)
+	case v1.ProtocolSCTP:
+		return dialSCTP(address, timeout)
+	default:
+		return nil, errors.Errorf("protocol %s not supported", protocol)
+	}
+}
+
+// echo sends a message and waits for it to come back
+func echo(conn net.Conn, message []byte, buffer []byte, timeout time.Duration) error {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return errors.Wrapf(err, "unable to set deadline")
+	}
+	if _, err := conn.Write(message); err != nil {
+		return errors.Wrapf(err, "unable to write")
+	}
+	received := 0
+	for received < len(message) {
+		n, err := conn.Read(buffer[received:])
+		if err != nil {
+			return errors.Wrapf(err, "unable to read")
+		}
+		received += n
+	}
+	if string(buffer[:received]) != string(message) {
+		return errors.Errorf("expected echo '%s', received '%s'", message, buffer[:received])
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"net"
 	"strconv"
+	"time"
 )
 
 type Batch struct {
@@ -29,9 +30,16 @@ func (b *Batch) IsValid() error {
 }
 
 type Result struct {
-	Request *Request
-	Output  string
-	Error   string
+	Request   *Request
+	Output    string
+	Error     string
+	ErrorType ErrorType
+	// Latency is how long the connection attempt took, from within the pod; it's broken down into resolving
+	// the host, connecting, and -- for udp -- waiting for a reply
+	Latency         time.Duration
+	ResolveDuration time.Duration
+	ConnectDuration time.Duration
+	ReplyDuration   time.Duration
 }
 
 func (r *Result) IsSuccess() bool {
@@ -43,21 +51,17 @@ type Request struct {
 	Protocol v1.Protocol
 	Host     string
 	Port     int
+	// Timeout bounds the whole connection attempt; if 0, defaultRequestTimeout is used
+	Timeout time.Duration
 }
 
-func (r *Request) Address() string {
-	return net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+func (r *Request) GetTimeout() time.Duration {
+	if r.Timeout <= 0 {
+		return defaultRequestTimeout
+	}
+	return r.Timeout
 }
 
-func (r *Request) Command() []string {
-	switch r.Protocol {
-	case v1.ProtocolSCTP:
-		return []string{"/agnhost", "connect", r.Address(), "--timeout=1s", "--protocol=sctp"}
-	case v1.ProtocolTCP:
-		return []string{"/agnhost", "connect", r.Address(), "--timeout=1s", "--protocol=tcp"}
-	case v1.ProtocolUDP:
-		return []string{"/agnhost", "connect", r.Address(), "--timeout=1s", "--protocol=udp"}
-	default:
-		panic(errors.Errorf("protocol %s not supported", r.Protocol))
-	}
+func (r *Request) Address() string {
+	return net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
 }
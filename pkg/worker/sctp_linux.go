@@ -0,0 +1,101 @@
+//go:build linux
+
+package worker
+
+import (
+	"net"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// the go standard library doesn't support SCTP, but on linux, one-to-one style SCTP sockets behave just
+// like TCP sockets, so they can be wrapped as net.Conns and net.Listeners
+
+func listenSCTP(port int) (net.Listener, error) {
+	fd, err := unix.Socket(unix.AF_INET6, unix.SOCK_STREAM, unix.IPPROTO_SCTP)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create sctp socket")
+	}
+	if err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+		unix.Close(fd)
+		return nil, errors.Wrapf(err, "unable to set SO_REUSEADDR")
+	}
+	// listen on both ipv4 and ipv6
+	if err = unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, 0); err != nil {
+		unix.Close(fd)
+		return nil, errors.Wrapf(err, "unable to unset IPV6_V6ONLY")
+	}
+	if err = unix.Bind(fd, &unix.SockaddrInet6{Port: port}); err != nil {
+		unix.Close(fd)
+		return nil, errors.Wrapf(err, "unable to bind sctp socket to port %d", port)
+	}
+	if err = unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		unix.Close(fd)
+		return nil, errors.Wrapf(err, "unable to listen on sctp port %d", port)
+	}
+	file := os.NewFile(uintptr(fd), "sctp-listener")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	return listener, errors.Wrapf(err, "unable to wrap sctp listener")
+}
+
+func dialSCTP(address string, timeout time.Duration) (net.Conn, error) {
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to resolve %s", address)
+	}
+	family, sockaddr := unix.AF_INET6, unix.Sockaddr(nil)
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		sa := &unix.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], ip4)
+		family, sockaddr = unix.AF_INET, sa
+	} else {
+		sa := &unix.SockaddrInet6{Port: addr.Port}
+		copy(sa.Addr[:], addr.IP.To16())
+		sockaddr = sa
+	}
+	fd, err := unix.Socket(family, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, unix.IPPROTO_SCTP)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create sctp socket")
+	}
+	if err = connectWithTimeout(fd, sockaddr, timeout); err != nil {
+		unix.Close(fd)
+		return nil, errors.WithMessagef(err, "sctp connect to %s", address)
+	}
+	file := os.NewFile(uintptr(fd), "sctp-conn")
+	defer file.Close()
+	conn, err := net.FileConn(file)
+	return conn, errors.Wrapf(err, "unable to wrap sctp connection")
+}
+
+// connectWithTimeout connects a non-blocking socket, waiting at most `timeout` for the connection to complete
+func connectWithTimeout(fd int, sockaddr unix.Sockaddr, timeout time.Duration) error {
+	err := unix.Connect(fd, sockaddr)
+	if err == nil {
+		return nil
+	} else if err != unix.EINPROGRESS {
+		return errors.Wrapf(err, "connect")
+	}
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLOUT}}
+	for {
+		n, err := unix.Poll(fds, int(timeout.Milliseconds()))
+		if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "poll")
+		} else if n == 0 {
+			return errors.Wrapf(os.ErrDeadlineExceeded, "connect")
+		}
+		break
+	}
+	soErr, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ERROR)
+	if err != nil {
+		return errors.Wrapf(err, "getsockopt SO_ERROR")
+	} else if soErr != 0 {
+		return errors.Wrapf(unix.Errno(soErr), "connect")
+	}
+	return nil
+}
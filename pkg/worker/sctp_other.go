@@ -0,0 +1,18 @@
+//go:build !linux
+
+package worker
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func listenSCTP(port int) (net.Listener, error) {
+	return nil, errors.Errorf("sctp is only supported on linux")
+}
+
+func dialSCTP(address string, timeout time.Duration) (net.Conn, error) {
+	return nil, errors.Errorf("sctp is only supported on linux")
+}
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPort is the port the worker's agent serves on.  The agent runs in its own container, alongside the
+// probe pod's server containers: since containers share their pod's network namespace, its connections are
+// subject to the same network policies as connections from the server containers.
+const DefaultPort = 23456
+
+// NewServeMux serves:
+//   - POST /batch: issues a batch of requests, responding with the results
+//   - GET /healthz: responds 200 once the agent is up
+func NewServeMux(concurrency int) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/batch", func(w http.ResponseWriter, r *http.Request) {
+		logrus.Debugf("received request: %s to %s", r.Method, r.URL.String())
+		if r.Method != http.MethodPost {
+			NotFound(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			HandleError(w, r, errors.Wrapf(err, "unable to read request body"), 400)
+			return
+		}
+		logrus.Tracef("received body: %s", body)
+		var batch Batch
+		err = json.Unmarshal(body, &batch)
+		if err != nil {
+			HandleError(w, r, errors.Wrapf(err, "unable to unmarshal JSON"), 400)
+			return
+		}
+		if err = batch.IsValid(); err != nil {
+			HandleError(w, r, err, 400)
+			return
+		}
+
+		jsonBytes, err := json.MarshalIndent(IssueBatch(&batch, concurrency), "", "  ")
+		if err != nil {
+			HandleError(w, r, errors.Wrapf(err, "unable to marshal JSON"), 500)
+			return
+		}
+		w.Header().Set(http.CanonicalHeaderKey("content-type"), "application/json")
+		_, err = fmt.Fprint(w, string(jsonBytes))
+		if err != nil {
+			logrus.Errorf("unable to write response: %+v", err)
+		}
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			NotFound(w, r)
+			return
+		}
+		_, err := fmt.Fprint(w, "ok")
+		if err != nil {
+			logrus.Errorf("unable to write response: %+v", err)
+		}
+	})
+	return mux
+}
+
+// Serve runs the agent until it fails
+func Serve(port int, concurrency int) error {
+	logrus.Infof("serving agent on port %d", port)
+	return errors.Wrapf(http.ListenAndServe(fmt.Sprintf(":%d", port), NewServeMux(concurrency)), "unable to serve on port %d", port)
+}
+
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	logrus.Errorf("HTTPResponder not found from request %+v", r)
+	http.NotFound(w, r)
+}
+
+func HandleError(w http.ResponseWriter, r *http.Request, err error, statusCode int) {
+	logrus.Errorf("HTTPResponder error %s with code %d from request %+v", err.Error(), statusCode, r)
+	http.Error(w, err.Error(), statusCode)
+}
@@ -0,0 +1,15 @@
+package worker
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWorker(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunDialerTests()
+	RunAgentClientTests()
+	RunSpecs(t, "worker suite")
+}